@@ -1,37 +1,266 @@
 package ai
 
 import (
+	"ai-chatbot-web/internal/retry"
+	"ai-chatbot-web/internal/tools"
 	"bytes"
+	"cmp"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 )
 
+// ollamaURL returns the Ollama base URL from OLLAMA_HOST, the same
+// variable the server reads, defaulting to the local instance.
+func ollamaURL() string {
+	host := os.Getenv("OLLAMA_HOST")
+	if host == "" {
+		return "http://localhost:11434"
+	}
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = "http://" + host
+	}
+	return strings.TrimSuffix(host, "/")
+}
+
+// chatRetry retries requests that fail before the reply starts, e.g.
+// while Ollama is still loading the model. It is the server's policy, read
+// from the same AI_RETRIES, AI_RETRY_BASE_DELAY and AI_RETRY_MAX_DELAY.
+var chatRetry = retry.FromEnv()
+
+// fallbackTimeout bounds the wait for each model of a fallback chain but
+// the last to start answering, so a slow model hands over to the next one.
+var fallbackTimeout = 60 * time.Second
+
+// partialReply is a failure after part of the reply was printed. Falling
+// back would print a second reply after the first, so it ends the turn.
+type partialReply struct {
+	err error
+}
+
+func (e *partialReply) Error() string { return e.err.Error() }
+func (e *partialReply) Unwrap() error { return e.err }
+
+// startDeadline returns a context that is cancelled unless its stop
+// function is called within limit, once the model has started answering.
+// A zero limit never expires.
+func startDeadline(limit time.Duration) (context.Context, func() bool, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	if limit <= 0 {
+		return ctx, func() bool { return true }, func() { cancel(nil) }
+	}
+	timer := time.AfterFunc(limit, func() {
+		cancel(fmt.Errorf("no reply within %s", limit))
+	})
+	return ctx, timer.Stop, func() {
+		timer.Stop()
+		cancel(nil)
+	}
+}
+
+// requestError prefers the reason ctx was cancelled, if it was, over the
+// transport error it caused.
+func requestError(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); cause != nil {
+		return cause
+	}
+	return err
+}
+
+// ModelError is an error response from Ollama, as opposed to a problem
+// reaching it.
+type ModelError struct {
+	StatusCode int
+	Status     string
+	Message    string
+	RetryAfter time.Duration // from the Retry-After header, if any
+}
+
+func (e *ModelError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("ollama returned %s: %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("ollama returned %s", e.Status)
+}
+
+// Temporary reports whether the request may succeed if retried.
+func (e *ModelError) Temporary() bool {
+	return retry.Status(e.StatusCode)
+}
+
+// checkStatus turns an error response from Ollama into a *ModelError.
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return &ModelError{StatusCode: resp.StatusCode, Status: resp.Status, Message: body.Error, RetryAfter: retry.RetryAfter(resp.Header)}
+}
 
+// postChat sends a chat request, retrying connection failures and
+// temporary errors as chatRetry says until ctx is done.
+func postChat(ctx context.Context, client *http.Client, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, ollamaURL()+"/api/chat", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err == nil {
+			if err = checkStatus(resp); err == nil {
+				return resp, nil
+			}
+			resp.Body.Close()
+		}
+
+		// a request that timed out is not tried again: the model is too
+		// slow, and the fallback chain should take over
+		var modelErr *ModelError
+		var netErr net.Error
+		temporary, retryAfter := true, time.Duration(0)
+		if errors.As(err, &modelErr) {
+			temporary, retryAfter = modelErr.Temporary(), modelErr.RetryAfter
+		}
+		if errors.As(err, &netErr) && netErr.Timeout() || ctx.Err() != nil {
+			temporary = false
+		}
+		if !temporary || attempt >= chatRetry.Retries {
+			return nil, err
+		}
+
+		delay := chatRetry.Backoff(attempt, retryAfter)
+		debugColor.Printf("(retrying in %s: %v) ", delay.Round(time.Millisecond), err)
+		time.Sleep(delay)
+	}
+}
 
 type OllamaRequest struct {
     Model    string        `json:"model"`
     Messages []ChatMessage `json:"messages"`
+    Tools    []tools.Definition `json:"tools,omitempty"`
     Stream   bool          `json:"stream"`
 }
 
 type OllamaResponse struct {
-    Message ChatMessage `json:"message"`
+    Model           string      `json:"model"`
+    Message         ChatMessage `json:"message"`
+    PromptEvalCount int         `json:"prompt_eval_count"`
+    EvalCount       int         `json:"eval_count"`
 }
 
 // For streaming responses, Ollama sends multiple JSON objects
 type OllamaStreamResponse struct {
-    Message ChatMessage `json:"message"`
-    Done    bool        `json:"done"`
+    Model           string      `json:"model"`
+    Message         ChatMessage `json:"message"`
+    Done            bool        `json:"done"`
+    PromptEvalCount int         `json:"prompt_eval_count"`
+    EvalCount       int         `json:"eval_count"`
 }
 
+// modelChain returns the models to try in order: the conversation's model,
+// then its fallbacks.
+func (c *SmartConversation) modelChain() []string {
+	chain := []string{c.Model}
+	for _, model := range c.FallbackModels {
+		if model != "" && model != c.Model {
+			chain = append(chain, model)
+		}
+	}
+	return chain
+}
+
+// withFallback calls send with each model of the chain until one answers,
+// and returns the last error if none does. Every model but the last must
+// start answering within fallbackTimeout, which send is given; the last
+// is given zero, no limit. A partialReply ends the chain at once.
+func (c *SmartConversation) withFallback(send func(model string, startTimeout time.Duration) (string, error)) (string, error) {
+	chain := c.modelChain()
+	var err error
+	for i, model := range chain {
+		last := i == len(chain)-1
+		var limit time.Duration
+		if !last {
+			limit = fallbackTimeout
+		}
+
+		var response string
+		response, err = send(model, limit)
+		var partial *partialReply
+		if errors.As(err, &partial) {
+			return "", partial.err
+		}
+		if err == nil {
+			if i > 0 {
+				debugColor.Printf("(answered by %s, %s failed)\n", model, chain[0])
+			}
+			return response, nil
+		}
+		if !last {
+			debugColor.Printf("(%s failed: %v; trying %s) ", model, err, chain[i+1])
+		}
+	}
+	return "", err
+}
+
+// withTools calls send and, while the model answers with tool calls, runs
+// them and sends the results back. send is given the tools to offer; after
+// tools.MaxRounds rounds none are offered so the model has to answer. Like
+// services.CompleteWithTools, calls made when no tools were offered are
+// dropped rather than run.
+func (c *SmartConversation) withTools(send func(offered []tools.Definition) (string, error)) (string, error) {
+	for round := 0; ; round++ {
+		var offered []tools.Definition
+		if c.Tools != nil && round < tools.MaxRounds {
+			offered = c.Tools.Definitions()
+		}
+
+		response, err := send(offered)
+		if err != nil {
+			return "", err
+		}
+		reply := &c.Messages[len(c.Messages)-1]
+		if len(reply.ToolCalls) == 0 || len(offered) == 0 {
+			reply.ToolCalls = nil
+			return response, nil
+		}
+
+		for _, call := range reply.ToolCalls {
+			debugColor.Printf("🔧 %s %s\n", call.Function.Name, call.Function.Arguments)
+			output, _ := c.Tools.Run(context.Background(), call)
+			c.AddMessage("tool", output)
+			c.Messages[len(c.Messages)-1].ToolName = call.Function.Name
+		}
+	}
+}
+
+// SendToOllamaBatch asks for the whole reply at once, falling back along
+// the model chain and running any tools the model calls.
 func (c *SmartConversation) SendToOllamaBatch() (string, error) {
+	return c.withTools(func(offered []tools.Definition) (string, error) {
+		return c.withFallback(func(model string, startTimeout time.Duration) (string, error) {
+			return c.batchFrom(model, startTimeout, offered)
+		})
+	})
+}
+
+// batchFrom asks model for the whole reply, giving up after 60s, or after
+// startTimeout if it is set: the reply arrives in one piece.
+func (c *SmartConversation) batchFrom(model string, startTimeout time.Duration, offered []tools.Definition) (string, error) {
     request := OllamaRequest{
-        Model:    c.Model,
-        Messages: c.Messages,
+        Model:    model,
+        Messages: c.getMessagesForAPI(),
+        Tools:    offered,
         Stream:   false,
     }
     
@@ -40,32 +269,48 @@ func (c *SmartConversation) SendToOllamaBatch() (string, error) {
         return "", err
     }
     
+    start := time.Now()
+    ctx, _, cancel := startDeadline(startTimeout)
+    defer cancel()
     client := &http.Client{Timeout: 60 * time.Second}
-    resp, err := client.Post(
-        "http://localhost:11434/api/chat",
-        "application/json",
-        bytes.NewBuffer(jsonData),
-    )
+    resp, err := postChat(ctx, client, jsonData)
     if err != nil {
-        return "", err
+        return "", requestError(ctx, err)
     }
     defer resp.Body.Close()
     
     var response OllamaResponse
     if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-        return "", err
+        return "", requestError(ctx, err)
     }
     
     // Add response to conversation
     c.AddMessage("assistant", response.Message.Content)
+    c.Messages[len(c.Messages)-1].ToolCalls = response.Message.ToolCalls
+    latency := time.Since(start)
+    c.recordResponseStats(cmp.Or(response.Model, model), response.PromptEvalCount, response.EvalCount, latency, latency)
     
     return response.Message.Content, nil
 }
 
+// SendToOllamaStream prints the reply as it arrives, falling back along the
+// model chain and running any tools the model calls.
 func (c *SmartConversation) SendToOllamaStream() (string, error) {
+	return c.withTools(func(offered []tools.Definition) (string, error) {
+		return c.withFallback(func(model string, startTimeout time.Duration) (string, error) {
+			return c.streamFrom(model, startTimeout, offered)
+		})
+	})
+}
+
+// streamFrom prints model's reply as it arrives. If startTimeout is set
+// the model must send its first token within it; after that the stream
+// may take up to 300s in all.
+func (c *SmartConversation) streamFrom(model string, startTimeout time.Duration, offered []tools.Definition) (string, error) {
     request := OllamaRequest{
-        Model:    c.Model,
+        Model:    model,
         Messages: c.getMessagesForAPI(),
+        Tools:    offered,
         Stream:   true,
     }
     
@@ -74,18 +319,20 @@ func (c *SmartConversation) SendToOllamaStream() (string, error) {
         return "", err
     }
     
+    start := time.Now()
+    ctx, started, cancel := startDeadline(startTimeout)
+    defer cancel()
     client := &http.Client{Timeout: 300 * time.Second}
-    resp, err := client.Post(
-        "http://localhost:11434/api/chat",
-        "application/json",
-        bytes.NewBuffer(jsonData),
-    )
+    resp, err := postChat(ctx, client, jsonData)
     if err != nil {
-        return "", err
+        return "", requestError(ctx, err)
     }
     defer resp.Body.Close()
     
 	var fullResponse strings.Builder
+	var toolCalls []tools.Call
+	var firstToken time.Duration
+	var final OllamaStreamResponse
 	decoder := json.NewDecoder(resp.Body)
 
 	// process the streaming response
@@ -96,16 +343,28 @@ func (c *SmartConversation) SendToOllamaStream() (string, error) {
 			if err == io.EOF {
 				break
 			}
-			return "", fmt.Errorf("stream decoding error: %v", err)
+			err = fmt.Errorf("stream decoding error: %v", requestError(ctx, err))
+			if firstToken != 0 {
+				fmt.Println()
+				return "", &partialReply{err: err}
+			}
+			return "", err
+		}
+		started()
+		if firstToken == 0 && streamResp.Message.Content != "" {
+			firstToken = time.Since(start)
 		}
+
 		// Print each token as it is received
 		fmt.Print(streamResp.Message.Content)
 		fullResponse.WriteString(streamResp.Message.Content)
+		toolCalls = append(toolCalls, streamResp.Message.ToolCalls...)
 
 		// Small delay for a typewriter effect
 		time.Sleep(10 * time.Millisecond)
 
 		if streamResp.Done {
+			final = streamResp
 			break
 		}
 	}
@@ -114,10 +373,31 @@ func (c *SmartConversation) SendToOllamaStream() (string, error) {
 	// add response to conversation history
 	response := fullResponse.String()
 	c.AddMessage("assistant", response)
+	c.Messages[len(c.Messages)-1].ToolCalls = toolCalls
+	c.recordResponseStats(cmp.Or(final.Model, model), final.PromptEvalCount, final.EvalCount, time.Since(start), firstToken)
 
 	return response, nil
 }
 
+// recordResponseStats annotates the latest assistant message
+// with model and timing data used by `stats --all`
+func (c *SmartConversation) recordResponseStats(model string, promptTokens, completionTokens int, latency, firstToken time.Duration) {
+	if len(c.Messages) == 0 || c.Messages[len(c.Messages)-1].Role != "assistant" {
+		return
+	}
+
+	if model == "" {
+		model = c.Model
+	}
+
+	msg := &c.Messages[len(c.Messages)-1]
+	msg.Model = model
+	msg.PromptTokens = promptTokens
+	msg.CompletionTokens = completionTokens
+	msg.LatencyMs = latency.Milliseconds()
+	msg.TimeToFirstTokenMs = firstToken.Milliseconds()
+}
+
 // getMessagesForAPI converts messages to API format
 // removes timestamp
 func (c *SmartConversation) getMessagesForAPI() []ChatMessage {
@@ -127,6 +407,9 @@ func (c *SmartConversation) getMessagesForAPI() []ChatMessage {
 		apiMessages[i] = ChatMessage{
 			Role:		msg.Role,
 			Content: 	msg.Content,
+			ToolCalls:	msg.ToolCalls,
+			ToolName:	msg.ToolName,
+			Images:		msg.Images,
 		}
 	}
 
@@ -0,0 +1,271 @@
+package ai
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"ai-chatbot-web/internal/fakeollama"
+	"ai-chatbot-web/internal/retry"
+	"ai-chatbot-web/internal/tools"
+)
+
+func newFakeOllama(t *testing.T) *fakeollama.Server {
+	t.Helper()
+	policy := chatRetry
+	chatRetry = retry.Policy{Retries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	t.Cleanup(func() { chatRetry = policy })
+
+	fake := fakeollama.New()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	t.Setenv("OLLAMA_HOST", srv.URL)
+	return fake
+}
+
+func TestSendToOllamaStream(t *testing.T) {
+	fake := newFakeOllama(t)
+	fake.Respond("Hi there, friend.")
+
+	conv := NewSmartConversation("test", "test", fakeollama.DefaultModel, "Be brief.", 4000)
+	conv.AddMessage("user", "hello")
+
+	reply, err := conv.SendToOllamaStream()
+	if err != nil {
+		t.Fatalf("SendToOllamaStream: %v", err)
+	}
+	if reply != "Hi there, friend." {
+		t.Errorf("reply = %q", reply)
+	}
+
+	last := conv.Messages[len(conv.Messages)-1]
+	if last.Role != "assistant" || last.Content != reply {
+		t.Errorf("reply not added to the conversation: %+v", last)
+	}
+	if last.Model != fakeollama.DefaultModel || last.CompletionTokens != 3 || last.PromptTokens == 0 {
+		t.Errorf("response stats not recorded: %+v", last)
+	}
+
+	req, _ := fake.LastRequest()
+	if len(req.Messages) != 2 || req.Messages[0].Role != "system" || req.Messages[1].Content != "hello" {
+		t.Errorf("unexpected request sent to the model: %+v", req.Messages)
+	}
+}
+
+func TestSendToOllamaBatch(t *testing.T) {
+	newFakeOllama(t)
+
+	conv := NewSmartConversation("test", "test", fakeollama.DefaultModel, "", 4000)
+	conv.AddMessage("user", "ping")
+
+	reply, err := conv.SendToOllamaBatch()
+	if err != nil {
+		t.Fatalf("SendToOllamaBatch: %v", err)
+	}
+	if reply != "echo: ping" {
+		t.Errorf("reply = %q", reply)
+	}
+}
+
+func TestSendToOllamaRetriesTemporaryFailures(t *testing.T) {
+	fake := newFakeOllama(t)
+	fake.FailNext(chatRetry.Retries, http.StatusServiceUnavailable)
+
+	conv := NewSmartConversation("test", "test", fakeollama.DefaultModel, "", 4000)
+	conv.AddMessage("user", "hello")
+
+	if _, err := conv.SendToOllamaStream(); err != nil {
+		t.Fatalf("SendToOllamaStream: %v", err)
+	}
+	if n := len(fake.Requests()); n != chatRetry.Retries+1 {
+		t.Errorf("sent %d requests, want %d", n, chatRetry.Retries+1)
+	}
+}
+
+func TestSendToOllamaFailure(t *testing.T) {
+	fake := newFakeOllama(t)
+	fake.FailNext(chatRetry.Retries+1, http.StatusInternalServerError)
+
+	conv := NewSmartConversation("test", "test", fakeollama.DefaultModel, "", 4000)
+	conv.AddMessage("user", "hello")
+
+	if _, err := conv.SendToOllamaStream(); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("expected a 500 error, got %v", err)
+	}
+	if last := conv.Messages[len(conv.Messages)-1]; last.Role != "user" {
+		t.Errorf("failed request added a %s message", last.Role)
+	}
+
+	// unknown models are rejected like on Ollama
+	conv.Model = "missing:latest"
+	before := len(fake.Requests())
+	_, err := conv.SendToOllamaBatch()
+	var modelErr *ModelError
+	if !errors.As(err, &modelErr) || modelErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a model not found error, got %v", err)
+	}
+	if n := len(fake.Requests()) - before; n != 1 {
+		t.Errorf("not found was retried: %d requests", n)
+	}
+}
+
+func TestSendToOllamaFallsBack(t *testing.T) {
+	fake := newFakeOllama(t)
+	fake.SetModels("small")
+
+	conv := NewSmartConversation("test", "test", "big", "", 4000)
+	conv.FallbackModels = []string{"small"}
+	conv.AddMessage("user", "hello")
+
+	reply, err := conv.SendToOllamaStream()
+	if err != nil {
+		t.Fatalf("SendToOllamaStream: %v", err)
+	}
+	if reply != "echo: hello" {
+		t.Errorf("reply = %q", reply)
+	}
+	if last := conv.Messages[len(conv.Messages)-1]; last.Model != "small" {
+		t.Errorf("answering model = %q, want small", last.Model)
+	}
+
+	// a slow model hands over once fallbackTimeout passes
+	timeout := fallbackTimeout
+	fallbackTimeout = 20 * time.Millisecond
+	t.Cleanup(func() { fallbackTimeout = timeout })
+	fake.SetModels("big", "small")
+	fake.SetLatency(50 * time.Millisecond)
+
+	conv.AddMessage("user", "again")
+	if _, err := conv.SendToOllamaBatch(); err != nil {
+		t.Fatalf("SendToOllamaBatch: %v", err)
+	}
+	if last := conv.Messages[len(conv.Messages)-1]; last.Model != "small" {
+		t.Errorf("answering model after a timeout = %q, want small", last.Model)
+	}
+}
+
+func TestModelFallbackCommandKeepsCase(t *testing.T) {
+	bot := &InteractiveChatbot{
+		config:        Config{Model: fakeollama.DefaultModel, MaxTokens: 4000},
+		conversations: map[string]*SmartConversation{},
+	}
+	bot.conversation = NewSmartConversation("c1", "Notes", fakeollama.DefaultModel, "", 4000)
+
+	bot.handleCommand("Model Fallback Qwen2.5:7B-Instruct llama3.2:3b")
+	want := []string{"Qwen2.5:7B-Instruct", "llama3.2:3b"}
+	if !slices.Equal(bot.conversation.FallbackModels, want) || !slices.Equal(bot.config.FallbackModels, want) {
+		t.Errorf("fallback models = %v, config %v; want %v", bot.conversation.FallbackModels, bot.config.FallbackModels, want)
+	}
+}
+
+func TestSendToOllamaLetsStartedRepliesFinish(t *testing.T) {
+	fake := newFakeOllama(t)
+	fake.SetModels("big", "small")
+	timeout := fallbackTimeout
+	fallbackTimeout = 20 * time.Millisecond
+	t.Cleanup(func() { fallbackTimeout = timeout })
+
+	// the first token comes at once, the whole reply well after fallbackTimeout
+	fake.SetTokenDelay(15 * time.Millisecond)
+	fake.Respond("one two three four five six")
+
+	conv := NewSmartConversation("test", "test", "big", "", 4000)
+	conv.FallbackModels = []string{"small"}
+	conv.AddMessage("user", "hello")
+
+	reply, err := conv.SendToOllamaStream()
+	if err != nil {
+		t.Fatalf("SendToOllamaStream: %v", err)
+	}
+	if reply != "one two three four five six" {
+		t.Errorf("reply = %q", reply)
+	}
+	if n := len(fake.Requests()); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+}
+
+func TestSendToOllamaRunsTools(t *testing.T) {
+	fake := newFakeOllama(t)
+	fake.Script(fakeollama.Reply{ToolCalls: []fakeollama.ToolCall{fakeollama.Call("calculate", `{"expression": "6 * 7"}`)}})
+	fake.Respond("It is 42.")
+
+	registry := tools.NewRegistry()
+	tools.RegisterBuiltins(registry)
+	conv := NewSmartConversation("test", "test", fakeollama.DefaultModel, "", 4000)
+	conv.Tools = registry
+	conv.AddMessage("user", "what is 6 * 7?")
+
+	reply, err := conv.SendToOllamaStream()
+	if err != nil {
+		t.Fatalf("SendToOllamaStream: %v", err)
+	}
+	if reply != "It is 42." {
+		t.Errorf("reply = %q", reply)
+	}
+
+	var roles []string
+	for _, m := range conv.Messages {
+		roles = append(roles, m.Role)
+	}
+	if got := strings.Join(roles, ","); got != "user,assistant,tool,assistant" {
+		t.Fatalf("messages = %s", got)
+	}
+	if result := conv.Messages[2]; result.ToolName != "calculate" || result.Content != "42" {
+		t.Errorf("tool result = %+v", result)
+	}
+
+	requests := fake.Requests()
+	if len(requests) != 2 || len(requests[0].Tools) != 2 {
+		t.Fatalf("requests to the model: %+v", requests)
+	}
+	if sent := requests[1].Messages; len(sent[1].ToolCalls) != 1 || sent[2].ToolName != "calculate" {
+		t.Errorf("tool round trip not sent back: %+v", sent)
+	}
+}
+
+func TestSendToOllamaIgnoresToolCallsWhenToolsAreOff(t *testing.T) {
+	fake := newFakeOllama(t)
+	fake.Script(fakeollama.Reply{Content: "Let me check.", ToolCalls: []fakeollama.ToolCall{fakeollama.Call("calculate", `{"expression": "1 + 1"}`)}})
+
+	conv := NewSmartConversation("test", "test", fakeollama.DefaultModel, "", 4000)
+	conv.AddMessage("user", "what is 1 + 1?")
+
+	reply, err := conv.SendToOllamaBatch()
+	if err != nil {
+		t.Fatalf("SendToOllamaBatch: %v", err)
+	}
+	if last := conv.Messages[len(conv.Messages)-1]; reply != "Let me check." || last.Role != "assistant" || last.ToolCalls != nil {
+		t.Errorf("reply = %q, last message %+v", reply, last)
+	}
+	if requests := fake.Requests(); len(requests) != 1 {
+		t.Errorf("sent %d requests, want 1", len(requests))
+	}
+}
+
+func TestSendToOllamaStopsCallingTools(t *testing.T) {
+	fake := newFakeOllama(t)
+	for range tools.MaxRounds + 1 {
+		fake.Script(fakeollama.Reply{ToolCalls: []fakeollama.ToolCall{fakeollama.Call("current_time", `{}`)}})
+	}
+
+	registry := tools.NewRegistry()
+	if err := tools.RegisterBuiltins(registry); err != nil {
+		t.Fatalf("RegisterBuiltins: %v", err)
+	}
+	conv := NewSmartConversation("test", "test", fakeollama.DefaultModel, "", 4000)
+	conv.Tools = registry
+	conv.AddMessage("user", "what time is it?")
+
+	if _, err := conv.SendToOllamaBatch(); err != nil {
+		t.Fatalf("SendToOllamaBatch: %v", err)
+	}
+	requests := fake.Requests()
+	if len(requests) != tools.MaxRounds+1 || len(requests[tools.MaxRounds].Tools) != 0 {
+		t.Errorf("sent %d requests; the last offered %d tools", len(requests), len(requests[len(requests)-1].Tools))
+	}
+}
@@ -0,0 +1,136 @@
+package ai
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxAttachmentBytes bounds a single attached file.
+var maxAttachmentBytes int64 = 256 << 10
+
+// Attachment is a file waiting to be sent with the next user message.
+type Attachment struct {
+	Path    string
+	Content string
+}
+
+// block formats the attachment as delimited context for the model.
+func (a Attachment) block() string {
+	return fmt.Sprintf("<attachment path=%q>\n%s\n</attachment>", a.Path, strings.TrimRight(a.Content, "\n"))
+}
+
+// Attach reads the files matching pattern, a path or a glob, and holds
+// them for the next user message. Directories are skipped; binary files,
+// files over maxAttachmentBytes and files that would not fit in MaxTokens
+// alongside the system prompt are refused. It returns the paths attached.
+func (c *SmartConversation) Attach(pattern string) ([]string, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("bad pattern %q: %v", pattern, err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no files match %s", pattern)
+	}
+
+	budget := c.MaxTokens - c.pendingTokens()
+	if len(c.Messages) > 0 && c.Messages[0].Role == "system" {
+		budget -= c.estimateTokens(c.Messages[0].Content)
+	}
+
+	var files []Attachment
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		if info.Size() > maxAttachmentBytes {
+			return nil, fmt.Errorf("%s is %d bytes, the limit is %d", path, info.Size(), maxAttachmentBytes)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if isBinary(data) {
+			return nil, fmt.Errorf("%s looks like a binary file", path)
+		}
+
+		file := Attachment{Path: path, Content: string(data)}
+		if budget -= c.estimateTokens(file.block()); budget < 0 {
+			return nil, fmt.Errorf("%s does not fit in the %d token context", path, c.MaxTokens)
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files match %s", pattern)
+	}
+
+	c.pending = append(c.pending, files...)
+	attached := make([]string, len(files))
+	for i, file := range files {
+		attached[i] = file.Path
+	}
+	return attached, nil
+}
+
+// Pending returns the files held for the next user message.
+func (c *SmartConversation) Pending() []Attachment {
+	return c.pending
+}
+
+// ClearAttachments drops the files and images held for the next user
+// message.
+func (c *SmartConversation) ClearAttachments() {
+	c.pending = nil
+	c.images = nil
+}
+
+func (c *SmartConversation) pendingTokens() int {
+	tokens := 0
+	for _, file := range c.pending {
+		tokens += c.estimateTokens(file.block())
+	}
+	return tokens
+}
+
+// AddUserMessage adds a user message with any pending attachments: files
+// are placed before the text and images sent alongside it. The paths of
+// both are recorded on the message.
+func (c *SmartConversation) AddUserMessage(text string) {
+	if len(c.pending) == 0 && len(c.images) == 0 {
+		c.AddMessage("user", text)
+		return
+	}
+
+	var content strings.Builder
+	var paths, images []string
+	for _, file := range c.pending {
+		content.WriteString(file.block())
+		content.WriteString("\n\n")
+		paths = append(paths, file.Path)
+	}
+	for _, image := range c.images {
+		paths = append(paths, image.Path)
+		images = append(images, image.Data)
+	}
+	content.WriteString(text)
+	c.pending, c.images = nil, nil
+
+	c.AddMessage("user", content.String())
+	msg := &c.Messages[len(c.Messages)-1]
+	msg.Attachments = paths
+	msg.Images = images
+}
+
+// isBinary reports whether data looks like anything but UTF-8 text: it
+// has a NUL byte near the start or is not valid UTF-8.
+func isBinary(data []byte) bool {
+	head := data[:min(len(data), 8000)]
+	return bytes.IndexByte(head, 0) >= 0 || !utf8.Valid(data)
+}
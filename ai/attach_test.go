@@ -0,0 +1,114 @@
+package ai
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ai-chatbot-web/internal/fakeollama"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAttach(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.go"), "package a\n")
+	writeFile(t, filepath.Join(dir, "b.go"), "package b\n")
+	writeFile(t, filepath.Join(dir, "logo.png"), "\x89PNG\r\n\x1a\n\x00\x00")
+	writeFile(t, filepath.Join(dir, "big.txt"), strings.Repeat("x", 2000))
+	os.Mkdir(filepath.Join(dir, "sub.go"), 0755)
+
+	conv := NewSmartConversation("test", "test", fakeollama.DefaultModel, "Be brief.", 300)
+
+	paths, err := conv.Attach(filepath.Join(dir, "*.go"))
+	if err != nil || len(paths) != 2 {
+		t.Fatalf("Attach glob = %v, %v", paths, err)
+	}
+	if _, err := conv.Attach(filepath.Join(dir, "logo.png")); err == nil || !strings.Contains(err.Error(), "binary") {
+		t.Errorf("binary file: %v", err)
+	}
+	if _, err := conv.Attach(filepath.Join(dir, "big.txt")); err == nil || !strings.Contains(err.Error(), "300 token") {
+		t.Errorf("file over the token budget: %v", err)
+	}
+	if _, err := conv.Attach(filepath.Join(dir, "*.md")); err == nil {
+		t.Error("pattern without matches accepted")
+	}
+
+	limit := maxAttachmentBytes
+	maxAttachmentBytes = 100
+	t.Cleanup(func() { maxAttachmentBytes = limit })
+	if _, err := conv.Attach(filepath.Join(dir, "big.txt")); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("file over the size limit: %v", err)
+	}
+	if len(conv.Pending()) != 2 {
+		t.Fatalf("refused files were attached: %+v", conv.Pending())
+	}
+
+	before := conv.TokenCount
+	conv.AddUserMessage("review these")
+	msg := conv.Messages[len(conv.Messages)-1]
+	want := "<attachment path=\"" + filepath.Join(dir, "a.go") + "\">\npackage a\n</attachment>"
+	if !strings.HasPrefix(msg.Content, want) || !strings.HasSuffix(msg.Content, "</attachment>\n\nreview these") {
+		t.Errorf("content = %q", msg.Content)
+	}
+	if len(msg.Attachments) != 2 || conv.TokenCount-before != conv.estimateTokens(msg.Content) {
+		t.Errorf("attachments not recorded or counted: %+v, tokens %d", msg.Attachments, conv.TokenCount-before)
+	}
+	if len(conv.Pending()) != 0 {
+		t.Error("attachments kept after being sent")
+	}
+
+	conv.AddUserMessage("plain")
+	if msg := conv.Messages[len(conv.Messages)-1]; msg.Content != "plain" || msg.Attachments != nil {
+		t.Errorf("attachments sent twice: %+v", msg)
+	}
+}
+
+func TestSaveAndLoadAttachments(t *testing.T) {
+	fake := newFakeOllama(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "notes.txt")
+	writeFile(t, file, "remember the milk")
+
+	bot := &InteractiveChatbot{
+		config:        Config{Model: fakeollama.DefaultModel, MaxTokens: 4000},
+		conversations: map[string]*SmartConversation{},
+		saveDir:       dir,
+	}
+	bot.conversation = NewSmartConversation("c1", "Notes", fakeollama.DefaultModel, "", 4000)
+	bot.conversations["c1"] = bot.conversation
+
+	if _, err := bot.conversation.Attach(file); err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	bot.conversation.AddUserMessage("what should I remember?")
+	if _, err := bot.conversation.SendToOllamaBatch(); err != nil {
+		t.Fatalf("SendToOllamaBatch: %v", err)
+	}
+	req, _ := fake.LastRequest()
+	if !strings.Contains(req.Messages[0].Content, "remember the milk") {
+		t.Errorf("attachment not sent to the model: %+v", req.Messages)
+	}
+
+	if err := bot.saveConversation("notes"); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	bot.conversation = NewSmartConversation("other", "Other", fakeollama.DefaultModel, "", 4000)
+
+	if err := bot.loadConversation("notes"); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	loaded := bot.conversation
+	if loaded.ID != "c1" || len(loaded.Messages) != 2 || loaded.TokenCount == 0 {
+		t.Fatalf("loaded conversation = %+v", loaded)
+	}
+	if got := loaded.Messages[0].Attachments; len(got) != 1 || got[0] != file {
+		t.Errorf("attachments after load = %v", got)
+	}
+}
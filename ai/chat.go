@@ -1,10 +1,13 @@
 package ai
 
 import (
-	"ai-chatbot/progress"
+	"ai-chatbot-web/internal/tools"
+	"ai-chatbot-web/progress"
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -14,6 +17,25 @@ type ChatMessage struct {
     Role    string `json:"role"`
     Content string `json:"content"`
 	Time	time.Time `json:"time"`
+
+	// Accounting, recorded on assistant messages only
+	Model				string	`json:"model,omitempty"`
+	PromptTokens		int		`json:"prompt_tokens,omitempty"`
+	CompletionTokens	int		`json:"completion_tokens,omitempty"`
+	LatencyMs			int64	`json:"latency_ms,omitempty"`
+	TimeToFirstTokenMs	int64	`json:"time_to_first_token_ms,omitempty"`
+
+	// Tool use: calls made by an assistant message, and the tool that
+	// produced a tool message
+	ToolCalls			[]tools.Call	`json:"tool_calls,omitempty"`
+	ToolName			string	`json:"tool_name,omitempty"`
+
+	// Paths of the files and images attached to a user message; file
+	// contents are part of Content
+	Attachments			[]string	`json:"attachments,omitempty"`
+
+	// Base64 images sent with a user message, for vision models
+	Images				[]string	`json:"images,omitempty"`
 }
 
 type Config struct {
@@ -22,6 +44,7 @@ type Config struct {
 	MaxTokens		int		`json:"max_tokens"`
 	StreamMode		bool	`json:"stream_mode"`
 	SaveDir			string	`json:"save_dir"`
+	FallbackModels	[]string `json:"fallback_models,omitempty"` // tried in order when Model fails
 }
 
 type ConversationMeta struct {
@@ -44,6 +67,8 @@ type InteractiveChatbot struct {
 	conversations	map[string]*SmartConversation
 	currentID		string
 	saveDir			string
+	tools			*tools.Registry
+	remote			*Remote // set in remote mode, see UseServer
 }
 
 // SmartConversation manages conversation with token limits
@@ -52,13 +77,19 @@ type SmartConversation struct {
 	Name		string
     Messages   []ChatMessage
     Model      string
+    FallbackModels []string // tried in order when Model fails
+    Tools      *tools.Registry // tools the model may call; nil turns them off
     MaxTokens  int // Maximum tokens to keep in context
     TokenCount int // Current estimated token count
 	Created		time.Time
 	LastUsed	time.Time
+
+	pending		[]Attachment // files for the next user message, see Attach
+	images		[]ImageAttachment // images for the next user message, see AttachImage
+	remote		*Remote // server the conversation lives on; nil talks to Ollama
 }
 
-func NewInteractiveChatBot(model string, systemPrompt string) *InteractiveChatbot {
+func NewInteractiveChatBot(model string, systemPrompt string) (*InteractiveChatbot, error) {
 
 	config := Config{
 		Model: 			"llama3.1:8b",
@@ -76,12 +107,16 @@ func NewInteractiveChatBot(model string, systemPrompt string) *InteractiveChatbo
 		conversations: make(map[string]*SmartConversation),
 		currentID: "default",
 		saveDir: config.SaveDir,
+		tools: tools.NewRegistry(),
+	}
+	if err := tools.RegisterBuiltins(bot.tools); err != nil {
+		return nil, fmt.Errorf("failed to register tools: %v", err)
 	}
 
 	bot.conversations["default"] = NewSmartConversation("default", "Default Chat", config.Model, config.SystemPrompt, config.MaxTokens)
 	bot.conversation = bot.conversations["default"]
 
-	return bot
+	return bot, nil
 }
 
 func NewSmartConversation(id, name, model, systemPrompt string, maxTokens int) *SmartConversation {
@@ -144,8 +179,8 @@ func (c *SmartConversation) trimToFitContext() {
 }
 
 func (bot *InteractiveChatbot) sendMessage(userInput string) {
-	// Add user message to conversation
-	bot.conversation.AddMessage("user", userInput)
+	// Add user message, with any attached files, to conversation
+	bot.conversation.AddUserMessage(userInput)
 
 	// Show thinking indicator while model is spinning
 	fmt.Print("🤖 ")
@@ -153,15 +188,21 @@ func (bot *InteractiveChatbot) sendMessage(userInput string) {
 
 	var err error
 
-	// Send message to Ollama and await response
+	// Send message to Ollama, or the server in remote mode, and await response
+	stream, batch := bot.conversation.SendToOllamaStream, bot.conversation.SendToOllamaBatch
+	if bot.conversation.remote != nil {
+		stream = func() (string, error) { return bot.conversation.SendToServer(true) }
+		batch = func() (string, error) { return bot.conversation.SendToServer(false) }
+	}
+
 	if bot.config.StreamMode{
-		_, err = bot.conversation.SendToOllamaStream()
+		_, err = stream()
 	} else {
 		ctx, cancel := context.WithCancel(context.Background())
 		// go progress.ShowSpinnerProgress(ctx)
 		go progress.ShowColorfulProgress(ctx)
 
-		response, batchErr := bot.conversation.SendToOllamaBatch()
+		response, batchErr := batch()
 
 		// stop the spinner as soon as response comes back
 		cancel()
@@ -178,8 +219,18 @@ func (bot *InteractiveChatbot) sendMessage(userInput string) {
 		errorColor.Printf("❌ Error: %v\n", err)
 
 		// Give some high level troubleshooting
-		if strings.Contains(err.Error(), "connection refused") {
+		var modelErr *ModelError
+		var remoteErr *RemoteError
+		if bot.remote != nil && strings.Contains(err.Error(), "connection refused") {
+			systemColor.Printf("💡 Tip: Make sure the server at %s is running\n", bot.remote.URL)
+		} else if errors.As(err, &remoteErr) && remoteErr.StatusCode == http.StatusUnauthorized {
+			systemColor.Println("💡 Tip: check the key given with --api-key")
+		} else if strings.Contains(err.Error(), "connection refused") {
 			systemColor.Println("💡 Tip: Make sure Ollama is running with `ollama serve`")
+		} else if errors.As(err, &modelErr) && modelErr.StatusCode == http.StatusNotFound {
+			systemColor.Printf("💡 Tip: pull the model first with `ollama pull %s`\n", bot.conversation.Model)
+		} else if errors.As(err, &modelErr) && modelErr.Temporary() {
+			systemColor.Println("💡 Tip: Ollama is having trouble, possibly still loading the model. Try again in a moment.")
 		} else if strings.Contains(err.Error(), "timeout") {
 			systemColor.Printf("💡 Tip: the model might be processing.  Try a shorter message.")
 		}
@@ -1,10 +1,12 @@
 package ai
 
 import (
+	"cmp"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
@@ -13,6 +15,7 @@ import (
 func (bot *InteractiveChatbot) handleCommand(command string) bool {
 	validCmd := false
     parts := strings.Fields(strings.ToLower(command))
+	args := strings.Fields(command)[1:] // as typed, for paths and names
 	cmd := parts[0]
 	switch cmd {
 	case "help":
@@ -28,14 +31,31 @@ func (bot *InteractiveChatbot) handleCommand(command string) bool {
 		}
 		id := fmt.Sprintf("conv_%d", time.Now().Unix())
 
-		bot.conversations[id] = NewSmartConversation(id, name, bot.config.Model, bot.config.SystemPrompt, bot.config.MaxTokens)
-		bot.conversation = bot.conversations[id]
+		conv := NewSmartConversation(id, name, bot.config.Model, bot.config.SystemPrompt, bot.config.MaxTokens)
+		conv.FallbackModels = bot.config.FallbackModels
+		if bot.remote != nil {
+			if err := bot.remote.Create(conv, conv.Messages); err != nil {
+				errorColor.Printf("❌ New failed: %v\n", err)
+				validCmd = true
+				break
+			}
+			id = conv.ID
+		}
+		bot.conversations[id] = conv
+		bot.conversation = conv
 		bot.currentID = id
 
 		successColor.Printf("✨ Created new conversation: %s (%s)\n", name, id)
 		validCmd = true
 
 	case "list":
+		if bot.remote != nil {
+			if err := bot.listRemoteConversations(); err != nil {
+				errorColor.Printf("❌ List failed: %v\n", err)
+			}
+			validCmd = true
+			break
+		}
 		systemColor.Println("📃 All Conversations:")
 	for id, conv := range bot.conversations {
 			current := ""
@@ -56,10 +76,23 @@ func (bot *InteractiveChatbot) handleCommand(command string) bool {
 		bot.showDebugInfo()
 		validCmd = true
 	case "stats":
-		bot.showStats()
+		if len(parts) > 1 && parts[1] == "--all" {
+			bot.showAllStats()
+		} else {
+			bot.showStats()
+		}
 		validCmd = true
 	case "model":
-		systemColor.Printf("model: %v\n", bot.config.Model)
+		if len(parts) > 1 && parts[1] == "fallback" {
+			// applies to the current conversation and new ones; model
+			// names are case-sensitive
+			bot.conversation.FallbackModels = args[1:]
+			bot.config.FallbackModels = args[1:]
+		}
+		systemColor.Printf("model: %v\n", bot.conversation.Model)
+		if len(bot.conversation.FallbackModels) > 0 {
+			systemColor.Printf("fallback: %s\n", strings.Join(bot.conversation.FallbackModels, " → "))
+		}
 		validCmd = true
 	case "save":
 		if len(parts) != 2{
@@ -72,6 +105,91 @@ func (bot *InteractiveChatbot) handleCommand(command string) bool {
 			successColor.Printf("💾 Saved as: %s.json\n", fileName)
 		}
 		validCmd = true
+	case "tools":
+		if bot.remote != nil {
+			systemColor.Println("🔧 Tools run on the server; choose them for a conversation in the web app")
+			validCmd = true
+			break
+		}
+		if len(parts) > 1 {
+			switch parts[1] {
+			case "on":
+				bot.conversation.Tools = bot.tools
+			case "off":
+				bot.conversation.Tools = nil
+			}
+		}
+		state := "off"
+		if bot.conversation.Tools != nil {
+			state = "on"
+		}
+		systemColor.Printf("🔧 Tools are %s for this conversation: %s\n", state, strings.Join(bot.tools.Names(), ", "))
+		validCmd = true
+	case "attach":
+		switch {
+		case len(args) == 1 && parts[1] == "clear":
+			bot.conversation.ClearAttachments()
+			systemColor.Println("📎 Attachments cleared")
+		case len(args) > 0:
+			for _, pattern := range args {
+				paths, err := bot.conversation.Attach(pattern)
+				if err != nil {
+					errorColor.Printf("❌ Attach failed: %v\n", err)
+					continue
+				}
+				successColor.Printf("📎 Attached %s\n", strings.Join(paths, ", "))
+			}
+		}
+		if pending := bot.conversation.Pending(); len(pending) > 0 {
+			systemColor.Printf("📎 %d file(s) will be sent with your next message (%d tokens)\n",
+				len(pending), bot.conversation.pendingTokens())
+		} else if len(args) == 0 {
+			systemColor.Println("📎 No files attached")
+		}
+		validCmd = true
+	case "image":
+		if len(args) == 0 {
+			errorColor.Println("❌ Image failed: usage `image <path>...`")
+		}
+		for _, path := range args {
+			if err := bot.conversation.AttachImage(path); err != nil {
+				errorColor.Printf("❌ Image failed: %v\n", err)
+				continue
+			}
+			successColor.Printf("🖼️  Attached %s\n", path)
+		}
+		if images := bot.conversation.PendingImages(); len(images) > 0 {
+			systemColor.Printf("🖼️  %d image(s) will be sent with your next message\n", len(images))
+		}
+		validCmd = true
+	case "export":
+		if len(args) == 0 || len(args) > 2 {
+			errorColor.Println("❌ Export failed: usage `export md|html|json|jsonl [path]`")
+			validCmd = true
+			break
+		}
+		path := ""
+		if len(args) == 2 {
+			path = args[1]
+		}
+		if written, err := bot.exportConversation(parts[1], path); err != nil {
+			errorColor.Printf("❌ Export failed: %v\n", err)
+		} else {
+			successColor.Printf("📤 Exported %d messages to %s\n", len(bot.conversation.Messages), written)
+		}
+		validCmd = true
+	case "load":
+		if bot.remote != nil && len(args) > 0 {
+			// a conversation on the server, by ID or name
+			if err := bot.loadRemoteConversation(strings.Join(args, " ")); err != nil {
+				errorColor.Printf("❌ Load failed: %v\n", err)
+			}
+		} else if len(args) != 1 {
+			errorColor.Println("❌ Load failed: usage `load file-name`")
+		} else if err := bot.loadConversation(args[0]); err != nil {
+			errorColor.Printf("❌ Load failed: %v\n", err)
+		}
+		validCmd = true
 	case "stream":
 		bot.config.StreamMode = !bot.config.StreamMode
 		if bot.config.StreamMode {
@@ -98,6 +216,9 @@ func (bot *InteractiveChatbot) printWelcome() {
 	fmt.Println()
 	successColor.Println("🤖 Taconite - an interactive ai chat bot")
 	systemColor.Printf("Model: %s\n", bot.config.Model)
+	if bot.remote != nil {
+		systemColor.Printf("Server: %s (new, list and load use its conversations)\n", bot.remote.URL)
+	}
 	systemColor.Println("Commands:")
 	fmt.Println("	help			- Show this help message")
 	fmt.Println("	quit/exit		- Exit the chatbot")
@@ -105,8 +226,15 @@ func (bot *InteractiveChatbot) printWelcome() {
 	fmt.Println("	clear			- Clear conversation history")
 	fmt.Println("	debug			- Show debug information")
 	fmt.Println("	stats			- Show conversation statistics")
+	fmt.Println("	stats --all		- Show statistics across all saved conversations")
 	fmt.Println("	model			- Show/change current model")
+	fmt.Println("	model fallback [m...]	- Models to try in order when the model fails")
 	fmt.Println("	save [name]		- Save current conversation")
+	fmt.Println("	load <name>		- Load a saved conversation and show its attachments")
+	fmt.Println("	export <format> [path]	- Export as md, html, json or jsonl (jsonl appends, for fine-tuning datasets)")
+	fmt.Println("	attach <path|glob>	- Send files with your next message (attach clear to drop them)")
+	fmt.Println("	image <path>		- Send a PNG or JPEG with your next message (vision models only)")
+	fmt.Println("	tools [on|off]		- Let the model call tools in this conversation")
 	fmt.Println()
 	systemColor.Println("💡 Tip: Just type your message to chat!")
 }
@@ -114,6 +242,9 @@ func (bot *InteractiveChatbot) printWelcome() {
 func (bot *InteractiveChatbot) showDebugInfo() {
 	debugColor.Println("🔍 Debug Information:")
 	debugColor.Printf("	Model: %s\n", bot.config.Model)
+	if len(bot.conversation.FallbackModels) > 0 {
+		debugColor.Printf("	Fallback models: %s\n", strings.Join(bot.conversation.FallbackModels, ", "))
+	}
 	debugColor.Printf("	Messsages in conversation: %d\n", len(bot.conversation.Messages))
 	debugColor.Printf("	Estimated tokens: %d/%d\n", bot.conversation.TokenCount, bot.conversation.MaxTokens)
 	debugColor.Printf("	Context usage: %.1f%%\n",
@@ -180,6 +311,48 @@ func (bot *InteractiveChatbot) saveConversation(filename string) error {
 	return encoder.Encode(savedConvo)
 }
 
+// loadConversation restores a saved conversation, makes it current and
+// lists the files attached along the way.
+func (bot *InteractiveChatbot) loadConversation(name string) error {
+	filePath := filepath.Join(bot.saveDir, strings.TrimSuffix(name, ".json")+".json")
+	savedConv, err := bot.readConversationMeta(filePath)
+	if err != nil {
+		return err
+	}
+
+	conv := &SmartConversation{
+		ID:				savedConv.Meta.ID,
+		Name:			savedConv.Meta.Name,
+		Messages:		savedConv.Messages,
+		Model:			cmp.Or(savedConv.Config.Model, bot.config.Model),
+		FallbackModels:	savedConv.Config.FallbackModels,
+		MaxTokens:		cmp.Or(savedConv.Config.MaxTokens, bot.config.MaxTokens),
+		Created:		savedConv.Meta.Created,
+		LastUsed:		savedConv.Meta.LastUsed,
+	}
+	for _, msg := range conv.Messages {
+		conv.TokenCount += conv.estimateTokens(msg.Content)
+	}
+
+	// don't clobber a different conversation that has the same ID
+	id := conv.ID
+	if existing, ok := bot.conversations[id]; id == "" || (ok && !existing.Created.Equal(conv.Created)) {
+		id = strings.TrimSuffix(name, ".json")
+		conv.ID = id
+	}
+	bot.conversations[id] = conv
+	bot.conversation = conv
+	bot.currentID = id
+
+	successColor.Printf("📂 Loaded %s (%s): %d messages\n", conv.Name, id, len(conv.Messages))
+	for i, msg := range conv.Messages {
+		if len(msg.Attachments) > 0 {
+			fmt.Printf("	📎 message %d: %s\n", i+1, strings.Join(msg.Attachments, ", "))
+		}
+	}
+	return nil
+}
+
 func (bot *InteractiveChatbot) listSavedConversations() {
 	files, err := filepath.Glob(filepath.Join(bot.saveDir, "*.json"))
 	if err != nil || len(files) == 0 {
@@ -191,7 +364,6 @@ func (bot *InteractiveChatbot) listSavedConversations() {
 		name := strings.TrimSuffix(filepath.Base(file), ".json")
 
 		// Try and read in metadata
-		//BUG: missing function
 		if savedConv, err := bot.readConversationMeta(file); err == nil {
            fmt.Printf("  💾 %s: %s (%d messages, %s)\n", 
                 name, savedConv.Meta.Name, savedConv.Meta.MessageCount, 
@@ -201,3 +373,112 @@ func (bot *InteractiveChatbot) listSavedConversations() {
 		}
 	}
 }
+
+// readConversationMeta reads a saved conversation file
+func (bot *InteractiveChatbot) readConversationMeta(filePath string) (*SavedConversation, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var savedConv SavedConversation
+	if err := json.NewDecoder(file).Decode(&savedConv); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", filepath.Base(filePath), err)
+	}
+
+	return &savedConv, nil
+}
+
+// modelStats holds per model totals for `stats --all`
+type modelStats struct {
+	responses			int
+	promptTokens		int
+	completionTokens	int
+	latencyMs			int64
+	timedResponses		int
+}
+
+// showAllStats aggregates statistics across every saved conversation
+func (bot *InteractiveChatbot) showAllStats() {
+	files, err := filepath.Glob(filepath.Join(bot.saveDir, "*.json"))
+	if err != nil || len(files) == 0 {
+		systemColor.Println("📊 No saved conversations found")
+		return
+	}
+
+	conversations := 0
+	roleCounts := make(map[string]int)
+	byModel := make(map[string]*modelStats)
+	byDay := make(map[string]int)
+
+	for _, file := range files {
+		savedConv, err := bot.readConversationMeta(file)
+		if err != nil {
+			errorColor.Printf("❌ Skipping %v\n", err)
+			continue
+		}
+		conversations++
+
+		for _, msg := range savedConv.Messages {
+			roleCounts[msg.Role]++
+			if !msg.Time.IsZero() {
+				byDay[msg.Time.Format("2006-01-02")]++
+			}
+
+			if msg.Role != "assistant" {
+				continue
+			}
+
+			// older saves have no per message model
+			model := msg.Model
+			if model == "" {
+				model = savedConv.Config.Model
+			}
+			stats, ok := byModel[model]
+			if !ok {
+				stats = &modelStats{}
+				byModel[model] = stats
+			}
+			stats.responses++
+			stats.promptTokens += msg.PromptTokens
+			stats.completionTokens += msg.CompletionTokens
+			if msg.LatencyMs > 0 {
+				stats.latencyMs += msg.LatencyMs
+				stats.timedResponses++
+			}
+		}
+	}
+
+	systemColor.Println("📊 Statistics across all saved conversations:")
+	fmt.Printf("	Conversations: %d\n", conversations)
+	fmt.Printf("	User messages: %d\n", roleCounts["user"])
+	fmt.Printf("	AI responses: %d\n", roleCounts["assistant"])
+	fmt.Printf("	System messages: %d\n", roleCounts["system"])
+
+	systemColor.Println("	By model:")
+	models := make([]string, 0, len(byModel))
+	for model := range byModel {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		stats := byModel[model]
+		avgLatency := int64(0)
+		if stats.timedResponses > 0 {
+			avgLatency = stats.latencyMs / int64(stats.timedResponses)
+		}
+		fmt.Printf("	  %s: %d responses, %d prompt / %d completion tokens, avg %dms\n",
+			model, stats.responses, stats.promptTokens, stats.completionTokens, avgLatency)
+	}
+
+	systemColor.Println("	By day:")
+	days := make([]string, 0, len(byDay))
+	for day := range byDay {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	for _, day := range days {
+		fmt.Printf("	  %s: %d messages\n", day, byDay[day])
+	}
+}
@@ -0,0 +1,70 @@
+package ai
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"ai-chatbot-web/internal/export"
+)
+
+// Transcript converts the conversation for export.
+func (c *SmartConversation) Transcript() export.Transcript {
+	transcript := export.Transcript{
+		ID:      c.ID,
+		Title:   c.Name,
+		Model:   c.Model,
+		Created: c.Created,
+	}
+	for _, msg := range c.Messages {
+		m := export.Message{
+			Role:        msg.Role,
+			Content:     msg.Content,
+			Time:        msg.Time,
+			Model:       msg.Model,
+			ToolName:    msg.ToolName,
+			Attachments: msg.Attachments,
+		}
+		for _, call := range msg.ToolCalls {
+			m.ToolCalls = append(m.ToolCalls, export.ToolCall{Name: call.Function.Name, Arguments: call.Function.Arguments})
+		}
+		transcript.Messages = append(transcript.Messages, m)
+	}
+	return transcript
+}
+
+// exportConversation writes the current conversation to path in format
+// and returns the file written. Without a path, or given a directory, the
+// file is named after the conversation and put in the save directory or
+// that directory. JSONL is appended, so exports build up a dataset.
+func (bot *InteractiveChatbot) exportConversation(format, path string) (string, error) {
+	if !slices.Contains(export.Formats, format) {
+		return "", fmt.Errorf("unknown format %q, use one of %s", format, strings.Join(export.Formats, ", "))
+	}
+
+	transcript := bot.conversation.Transcript()
+	path = cmp.Or(path, bot.saveDir)
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, export.Filename(transcript, format))
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if format == export.JSONL {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return "", err
+	}
+	if err := export.Write(file, format, transcript); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return path, nil
+}
@@ -0,0 +1,50 @@
+package ai
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ai-chatbot-web/internal/fakeollama"
+)
+
+func TestExportConversation(t *testing.T) {
+	dir := t.TempDir()
+	bot := &InteractiveChatbot{
+		config:        Config{Model: fakeollama.DefaultModel, MaxTokens: 4000},
+		conversations: map[string]*SmartConversation{},
+		saveDir:       dir,
+	}
+	bot.conversation = NewSmartConversation("c1", "Go Tips", fakeollama.DefaultModel, "Be brief.", 4000)
+	bot.conversation.AddMessage("user", "How do I reverse a slice?")
+	bot.conversation.AddMessage("assistant", "Like this:\n```go\nslices.Reverse(s)\n```")
+
+	path, err := bot.exportConversation("md", "")
+	if err != nil || path != filepath.Join(dir, "go-tips.md") {
+		t.Fatalf("export md = %s, %v", path, err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "### User") || !strings.Contains(string(data), "```go\nslices.Reverse(s)\n```") {
+		t.Errorf("markdown:\n%s", data)
+	}
+
+	// JSONL exports accumulate into a dataset
+	dataset := filepath.Join(dir, "dataset.jsonl")
+	for i := 0; i < 2; i++ {
+		if _, err := bot.exportConversation("jsonl", dataset); err != nil {
+			t.Fatalf("export jsonl: %v", err)
+		}
+	}
+	data, _ = os.ReadFile(dataset)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[0], `{"messages":[{"role":"system"`) {
+		t.Errorf("dataset:\n%s", data)
+	}
+
+	if _, err := bot.exportConversation("pdf", path); err == nil {
+		t.Error("unknown format accepted")
+	}
+	if data, _ := os.ReadFile(path); len(data) == 0 {
+		t.Error("failed export clobbered an existing file")
+	}
+}
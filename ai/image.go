@@ -0,0 +1,96 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+)
+
+// maxImageBytes bounds a single image, matching the server's limit.
+var maxImageBytes int64 = 10 << 20
+
+// ImageAttachment is an image waiting to be sent with the next user
+// message, base64 encoded as Ollama expects.
+type ImageAttachment struct {
+	Path string
+	Data string
+}
+
+// AttachImage reads a PNG or JPEG image and holds it for the next user
+// message. It is refused unless Ollama reports that the conversation's
+// model can read images; in remote mode the server decides.
+func (c *SmartConversation) AttachImage(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > maxImageBytes {
+		return fmt.Errorf("%s is %d bytes, the limit is %d", path, info.Size(), maxImageBytes)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if kind := http.DetectContentType(data); kind != "image/png" && kind != "image/jpeg" {
+		return fmt.Errorf("%s is %s; only PNG and JPEG images are supported", path, kind)
+	}
+
+	// the server checks the model itself when the message is sent
+	if c.remote == nil {
+		vision, err := supportsVision(c.Model)
+		if err != nil {
+			return fmt.Errorf("could not check model %s: %v", c.Model, err)
+		}
+		if !vision {
+			return fmt.Errorf("model %s does not support images; switch to a vision model such as llava", c.Model)
+		}
+	}
+
+	c.images = append(c.images, ImageAttachment{Path: path, Data: base64.StdEncoding.EncodeToString(data)})
+	return nil
+}
+
+// PendingImages returns the images held for the next user message.
+func (c *SmartConversation) PendingImages() []ImageAttachment {
+	return c.images
+}
+
+// supportsVision asks Ollama's /api/show whether model can read images:
+// newer servers list a "vision" capability, older ones a clip family.
+func supportsVision(model string) (bool, error) {
+	body, err := json.Marshal(map[string]string{"model": model})
+	if err != nil {
+		return false, err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(ollamaURL()+"/api/show", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return false, err
+	}
+
+	var show struct {
+		Capabilities []string `json:"capabilities"`
+		Details      struct {
+			Families []string `json:"families"`
+		} `json:"details"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&show); err != nil {
+		return false, err
+	}
+	if len(show.Capabilities) > 0 {
+		return slices.Contains(show.Capabilities, "vision"), nil
+	}
+	return slices.Contains(show.Details.Families, "clip"), nil
+}
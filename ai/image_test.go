@@ -0,0 +1,51 @@
+package ai
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ai-chatbot-web/internal/fakeollama"
+)
+
+func TestAttachImage(t *testing.T) {
+	fake := newFakeOllama(t)
+	fake.SetModels(fakeollama.DefaultModel, "llava")
+	fake.SetVision("llava")
+
+	dir := t.TempDir()
+	png := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+	writeFile(t, filepath.Join(dir, "cat.png"), png)
+	writeFile(t, filepath.Join(dir, "notes.txt"), "not an image")
+
+	conv := NewSmartConversation("test", "test", fakeollama.DefaultModel, "", 4000)
+	if err := conv.AttachImage(filepath.Join(dir, "cat.png")); err == nil || !strings.Contains(err.Error(), "does not support images") {
+		t.Errorf("image for a model without vision: %v", err)
+	}
+
+	conv.Model = "llava"
+	if err := conv.AttachImage(filepath.Join(dir, "notes.txt")); err == nil || !strings.Contains(err.Error(), "only PNG and JPEG") {
+		t.Errorf("text file as image: %v", err)
+	}
+	if err := conv.AttachImage(filepath.Join(dir, "cat.png")); err != nil {
+		t.Fatalf("AttachImage: %v", err)
+	}
+
+	conv.AddUserMessage("what is this?")
+	msg := conv.Messages[len(conv.Messages)-1]
+	if msg.Content != "what is this?" || len(msg.Images) != 1 || len(msg.Attachments) != 1 {
+		t.Errorf("message = %+v", msg)
+	}
+	if len(conv.PendingImages()) != 0 {
+		t.Error("image kept after being sent")
+	}
+
+	if _, err := conv.SendToOllamaBatch(); err != nil {
+		t.Fatalf("SendToOllamaBatch: %v", err)
+	}
+	req, _ := fake.LastRequest()
+	if images := req.Messages[0].Images; len(images) != 1 || images[0] != base64.StdEncoding.EncodeToString([]byte(png)) {
+		t.Errorf("images sent to Ollama = %v", images)
+	}
+}
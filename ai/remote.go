@@ -0,0 +1,505 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"ai-chatbot-web/internal/tools"
+)
+
+// Remote is a chat server whose REST API holds the conversations in
+// remote mode, so they can be continued in the browser.
+type Remote struct {
+	URL    string // base URL of the server, without /api/v1
+	APIKey string
+	client *http.Client
+}
+
+// RemoteError is an error response from the chat server.
+type RemoteError struct {
+	StatusCode int
+	Status     string
+	Message    string
+	Code       string // machine-readable error code, such as "upstream_timeout"
+}
+
+// remoteFailure is the body of an error response. Servers from before the
+// error envelope put the message in Error.
+type remoteFailure struct {
+	Message string `json:"message"`
+	Error   string `json:"error"`
+	Code    string `json:"code"`
+}
+
+func (e *RemoteError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("server returned %s: %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("server returned %s", e.Status)
+}
+
+// remoteConversation is a conversation as the server returns it.
+type remoteConversation struct {
+	ID             string          `json:"id"`
+	Name           string          `json:"name"`
+	Model          string          `json:"model"`
+	FallbackModels []string        `json:"fallback_models"`
+	SystemPrompt   string          `json:"system_prompt"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	Messages       []remoteMessage `json:"messages"`
+}
+
+// remoteMessage is a message as the server returns it.
+type remoteMessage struct {
+	Role               string       `json:"role"`
+	Content            string       `json:"content"`
+	Status             string       `json:"status"`
+	CreatedAt          time.Time    `json:"created_at"`
+	Model              string       `json:"model"`
+	PromptTokens       int          `json:"prompt_tokens"`
+	CompletionTokens   int          `json:"completion_tokens"`
+	LatencyMs          int64        `json:"latency_ms"`
+	TimeToFirstTokenMs int64        `json:"time_to_first_token_ms"`
+	ToolCalls          []tools.Call `json:"tool_calls"`
+	ToolName           string       `json:"tool_name"`
+}
+
+// chatMessage converts m to the CLI's form.
+func (m remoteMessage) chatMessage() ChatMessage {
+	return ChatMessage{
+		Role:               m.Role,
+		Content:            m.Content,
+		Time:               m.CreatedAt,
+		Model:              m.Model,
+		PromptTokens:       m.PromptTokens,
+		CompletionTokens:   m.CompletionTokens,
+		LatencyMs:          m.LatencyMs,
+		TimeToFirstTokenMs: m.TimeToFirstTokenMs,
+		ToolCalls:          m.ToolCalls,
+		ToolName:           m.ToolName,
+	}
+}
+
+// turnResponse is the server's answer to a message.
+type turnResponse struct {
+	AssistantMessage remoteMessage   `json:"assistant_message"`
+	ToolMessages     []remoteMessage `json:"tool_messages"`
+}
+
+// NewRemote returns a client for the chat server at serverURL. A missing
+// scheme means http, and a trailing /api/v1 is dropped.
+func NewRemote(serverURL, apiKey string) *Remote {
+	if !strings.HasPrefix(serverURL, "http://") && !strings.HasPrefix(serverURL, "https://") {
+		serverURL = "http://" + serverURL
+	}
+	serverURL = strings.TrimSuffix(strings.TrimSuffix(serverURL, "/"), "/api/v1")
+	return &Remote{
+		URL:    serverURL,
+		APIKey: apiKey,
+		client: &http.Client{Timeout: 300 * time.Second},
+	}
+}
+
+// request sends a request to path under /api/v1 and returns the response
+// once it has checked the status.
+func (r *Remote) request(method, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, r.URL+"/api/v1"+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if r.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.APIKey)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	var failure remoteFailure
+	json.NewDecoder(resp.Body).Decode(&failure)
+	return nil, &RemoteError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Message:    cmp.Or(failure.Message, failure.Error),
+		Code:       failure.Code,
+	}
+}
+
+// call sends in, if not nil, as JSON and decodes the response into out.
+func (r *Remote) call(method, path string, in, out any) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body, contentType = bytes.NewReader(data), "application/json"
+	}
+
+	resp, err := r.request(method, path, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Username checks the API key and returns the user it belongs to.
+func (r *Remote) Username() (string, error) {
+	var me struct {
+		User struct {
+			Username string `json:"username"`
+		} `json:"user"`
+	}
+	if err := r.call(http.MethodGet, "/auth/me", nil, &me); err != nil {
+		return "", err
+	}
+	return me.User.Username, nil
+}
+
+// Conversations lists the conversations on the server, without their
+// messages.
+func (r *Remote) Conversations() ([]remoteConversation, error) {
+	var list struct {
+		Conversations []remoteConversation `json:"conversations"`
+	}
+	if err := r.call(http.MethodGet, "/conversations", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Conversations, nil
+}
+
+// Create starts conversation c on the server with history, the messages
+// of c the server should already hold. History with turns beyond the
+// system prompt is uploaded through the import endpoint, so the server
+// sees the conversation the CLI does; images sent earlier are left out.
+// c takes the ID the server gives it, and is sent there from then on.
+func (r *Remote) Create(c *SmartConversation, history []ChatMessage) error {
+	systemPrompt := ""
+	if len(c.Messages) > 0 && c.Messages[0].Role == "system" {
+		systemPrompt = c.Messages[0].Content
+	}
+	if slices.ContainsFunc(history, func(msg ChatMessage) bool { return msg.Role != "system" }) {
+		return r.upload(c, history, systemPrompt)
+	}
+
+	var created struct {
+		Conversation remoteConversation `json:"conversation"`
+	}
+	err := r.call(http.MethodPost, "/conversations", map[string]any{
+		"name":            c.Name,
+		"model":           c.Model,
+		"system_prompt":   systemPrompt,
+		"fallback_models": c.FallbackModels,
+	}, &created)
+	if err != nil {
+		return err
+	}
+
+	c.ID = created.Conversation.ID
+	c.Created = created.Conversation.CreatedAt
+	c.remote = r
+	return nil
+}
+
+// upload imports c with history, in the form the CLI saves it in.
+func (r *Remote) upload(c *SmartConversation, history []ChatMessage, systemPrompt string) error {
+	saved := SavedConversation{
+		Meta: ConversationMeta{
+			ID:           c.ID,
+			Name:         c.Name,
+			Created:      c.Created,
+			LastUsed:     c.LastUsed,
+			MessageCount: len(history),
+		},
+		Messages: history,
+		Config: Config{
+			Model:          c.Model,
+			SystemPrompt:   systemPrompt,
+			FallbackModels: c.FallbackModels,
+		},
+	}
+
+	var report struct {
+		Conversations []struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+		} `json:"conversations"`
+	}
+	if err := r.call(http.MethodPost, "/conversations/import", saved, &report); err != nil {
+		return err
+	}
+	if len(report.Conversations) != 1 || report.Conversations[0].Status != "imported" {
+		return fmt.Errorf("server did not import conversation %s", c.Name)
+	}
+
+	c.ID = report.Conversations[0].ID
+	c.remote = r
+	return nil
+}
+
+// Load fetches a conversation by ID, or by name when no ID matches.
+// Messages whose turn failed are left out, as the model never saw them.
+func (r *Remote) Load(idOrName string, maxTokens int) (*SmartConversation, error) {
+	var found struct {
+		Conversation remoteConversation `json:"conversation"`
+	}
+	err := r.call(http.MethodGet, "/conversations/"+url.PathEscape(idOrName), nil, &found)
+	var remoteErr *RemoteError
+	if errors.As(err, &remoteErr) && remoteErr.StatusCode == http.StatusNotFound {
+		id, lookupErr := r.findByName(idOrName)
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		err = r.call(http.MethodGet, "/conversations/"+url.PathEscape(id), nil, &found)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	remote := found.Conversation
+	conv := &SmartConversation{
+		ID:             remote.ID,
+		Name:           remote.Name,
+		Messages:       make([]ChatMessage, 0, len(remote.Messages)),
+		Model:          remote.Model,
+		FallbackModels: remote.FallbackModels,
+		MaxTokens:      maxTokens,
+		Created:        remote.CreatedAt,
+		LastUsed:       remote.UpdatedAt,
+		remote:         r,
+	}
+	for _, msg := range remote.Messages {
+		if msg.Status != "complete" {
+			continue
+		}
+		conv.Messages = append(conv.Messages, msg.chatMessage())
+		conv.TokenCount += conv.estimateTokens(msg.Content)
+	}
+	return conv, nil
+}
+
+// findByName returns the ID of the conversation called name.
+func (r *Remote) findByName(name string) (string, error) {
+	conversations, err := r.Conversations()
+	if err != nil {
+		return "", err
+	}
+	for _, conv := range conversations {
+		if conv.Name == name {
+			return conv.ID, nil
+		}
+	}
+	return "", fmt.Errorf("no conversation %q on %s", name, r.URL)
+}
+
+// SendToServer sends the latest user message to the server, which asks
+// the model and saves both. A conversation without an ID is created there
+// first, with the messages before it. When stream is set the reply is
+// printed as it arrives. Any tool calls the server ran are added before
+// the reply.
+func (c *SmartConversation) SendToServer(stream bool) (string, error) {
+	if c.remote == nil {
+		return "", fmt.Errorf("conversation %s is not on a server", c.Name)
+	}
+	if c.ID == "" {
+		if err := c.remote.Create(c, c.Messages[:len(c.Messages)-1]); err != nil {
+			return "", err
+		}
+	}
+	msg := c.Messages[len(c.Messages)-1]
+
+	contentType, body, err := messageBody(msg)
+	if err != nil {
+		return "", err
+	}
+	path := "/conversations/" + url.PathEscape(c.ID) + "/messages"
+	if stream {
+		path += "?stream=true"
+	}
+	resp, err := c.remote.request(http.MethodPost, path, contentType, body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var turn turnResponse
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		err = readEvents(resp.Body, &turn)
+		fmt.Println()
+	} else {
+		err = json.NewDecoder(resp.Body).Decode(&turn)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	for _, step := range append(turn.ToolMessages, turn.AssistantMessage) {
+		c.AddMessage(step.Role, step.Content)
+		c.Messages[len(c.Messages)-1] = step.chatMessage()
+	}
+	return turn.AssistantMessage.Content, nil
+}
+
+// messageBody encodes a user message for the server: JSON, or a multipart
+// form when it carries images.
+func messageBody(msg ChatMessage) (string, io.Reader, error) {
+	if len(msg.Images) == 0 {
+		data, err := json.Marshal(map[string]string{"content": msg.Content})
+		return "application/json", bytes.NewReader(data), err
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("content", msg.Content)
+	for i, image := range msg.Images {
+		data, err := base64.StdEncoding.DecodeString(image)
+		if err != nil {
+			return "", nil, err
+		}
+		// image paths follow any file paths in Attachments
+		name := fmt.Sprintf("image%d", i+1)
+		if offset := len(msg.Attachments) - len(msg.Images); offset >= 0 {
+			name = filepath.Base(msg.Attachments[offset+i])
+		}
+		part, err := form.CreateFormFile("images", name)
+		if err != nil {
+			return "", nil, err
+		}
+		part.Write(data)
+	}
+	if err := form.Close(); err != nil {
+		return "", nil, err
+	}
+	return form.FormDataContentType(), &body, nil
+}
+
+// readEvents prints the "token" events of a streamed reply and decodes
+// the closing "done" event into turn. A "reset" event, after which the
+// reply starts over, is noted on a line of its own. An "error" event is
+// returned as a *RemoteError.
+func readEvents(r io.Reader, turn *turnResponse) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+
+	event, data := "", ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			continue
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+			continue
+		case line != "":
+			continue
+		}
+
+		// a blank line ends the event
+		switch event {
+		case "token":
+			var token struct {
+				Content string `json:"content"`
+			}
+			if err := json.Unmarshal([]byte(data), &token); err != nil {
+				return fmt.Errorf("stream decoding error: %v", err)
+			}
+			fmt.Print(token.Content)
+		case "reset":
+			fmt.Println()
+			debugColor.Println("(starting over)")
+		case "done":
+			return json.Unmarshal([]byte(data), turn)
+		case "error":
+			var failure remoteFailure
+			json.Unmarshal([]byte(data), &failure)
+			return &RemoteError{StatusCode: http.StatusOK, Status: "stream error", Message: cmp.Or(failure.Message, failure.Error), Code: failure.Code}
+		}
+		event, data = "", ""
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("stream ended before the reply was complete")
+}
+
+// UseServer switches the chatbot to remote mode: conversations are kept
+// on the chat server at serverURL and replies come from its models. The
+// current conversation, with any turns it already has, is created there
+// when its next message is sent.
+func (bot *InteractiveChatbot) UseServer(serverURL, apiKey string) error {
+	remote := NewRemote(serverURL, apiKey)
+	username, err := remote.Username()
+	if err != nil {
+		return fmt.Errorf("could not connect to %s: %v", remote.URL, err)
+	}
+
+	bot.remote = remote
+	bot.conversation.ID = ""
+	bot.conversation.remote = remote
+	successColor.Printf("🌐 Connected to %s as %s\n", remote.URL, username)
+	return nil
+}
+
+// listRemoteConversations prints the conversations on the server.
+func (bot *InteractiveChatbot) listRemoteConversations() error {
+	conversations, err := bot.remote.Conversations()
+	if err != nil {
+		return err
+	}
+
+	systemColor.Printf("🌐 Conversations on %s:\n", bot.remote.URL)
+	for _, conv := range conversations {
+		current := ""
+		if conv.ID == bot.conversation.ID {
+			current = " (current)"
+		}
+		fmt.Printf("	📝 %s: %s%s - %s, last used %s\n",
+			conv.ID, conv.Name, current, conv.Model, conv.UpdatedAt.Local().Format("Jan 2 15:04"))
+	}
+	if len(conversations) == 0 {
+		fmt.Println("	none yet")
+	}
+	return nil
+}
+
+// loadRemoteConversation makes a conversation on the server current.
+func (bot *InteractiveChatbot) loadRemoteConversation(idOrName string) error {
+	conv, err := bot.remote.Load(idOrName, bot.config.MaxTokens)
+	if err != nil {
+		return err
+	}
+	bot.conversations[conv.ID] = conv
+	bot.conversation = conv
+	bot.currentID = conv.ID
+
+	successColor.Printf("📂 Loaded %s (%s): %d messages\n", conv.Name, conv.ID, len(conv.Messages))
+	return nil
+}
@@ -0,0 +1,177 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer serves the parts of the chat server's API that remote mode
+// uses, for one conversation, answering every message with "echo: ...".
+type fakeServer struct {
+	created  map[string]any // body of the create request
+	imported map[string]any // body of the import request
+	messages []map[string]any
+	fail     string // error event to stream instead of a reply
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer gbk_test" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"status": "error", "message": "Authentication required"})
+		return
+	}
+
+	conversation := map[string]any{"id": "c1", "name": "Trip", "model": "llama3.1:8b", "messages": f.messages}
+	switch {
+	case r.URL.Path == "/api/v1/auth/me":
+		json.NewEncoder(w).Encode(map[string]any{"user": map[string]string{"username": "alice"}})
+	case r.URL.Path == "/api/v1/conversations" && r.Method == http.MethodPost:
+		json.NewDecoder(r.Body).Decode(&f.created)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"conversation": conversation})
+	case r.URL.Path == "/api/v1/conversations/import":
+		json.NewDecoder(r.Body).Decode(&f.imported)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"conversations": []any{map[string]string{"id": "c1", "status": "imported"}}})
+	case r.URL.Path == "/api/v1/conversations":
+		json.NewEncoder(w).Encode(map[string]any{"conversations": []any{conversation}})
+	case r.URL.Path == "/api/v1/conversations/c1":
+		json.NewEncoder(w).Encode(map[string]any{"conversation": conversation})
+	case r.URL.Path == "/api/v1/conversations/c1/messages":
+		var req struct{ Content string }
+		json.NewDecoder(r.Body).Decode(&req)
+		reply := map[string]any{"role": "assistant", "content": "echo: " + req.Content, "status": "complete", "model": "llama3.1:8b", "completion_tokens": 2}
+		f.messages = append(f.messages, map[string]any{"role": "user", "content": req.Content, "status": "complete"}, reply)
+		done, _ := json.Marshal(map[string]any{"assistant_message": reply})
+
+		if r.URL.Query().Get("stream") != "true" {
+			w.Write(done)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event:token\ndata:{\"content\":\"echo: \"}\n\nevent:token\ndata:{\"content\":%q}\n\n", req.Content)
+		if f.fail != "" {
+			fmt.Fprintf(w, "event:error\ndata:{\"error\":%q,\"code\":\"timeout\"}\n\n", f.fail)
+			return
+		}
+		fmt.Fprintf(w, "event:done\ndata:%s\n\n", done)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "conversation not found"})
+	}
+}
+
+func newRemoteBot(t *testing.T) (*InteractiveChatbot, *fakeServer) {
+	t.Helper()
+	fake := &fakeServer{}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	bot := &InteractiveChatbot{
+		config:        Config{Model: "llama3.1:8b", MaxTokens: 4000},
+		conversations: map[string]*SmartConversation{},
+	}
+	bot.conversation = NewSmartConversation("default", "Default Chat", "llama3.1:8b", "Be brief.", 4000)
+	bot.conversations["default"] = bot.conversation
+
+	if err := bot.UseServer(srv.URL+"/api/v1/", "wrong"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("UseServer with a bad key: %v", err)
+	}
+	if err := bot.UseServer(strings.TrimPrefix(srv.URL, "http://"), "gbk_test"); err != nil {
+		t.Fatalf("UseServer: %v", err)
+	}
+	return bot, fake
+}
+
+func TestRemoteConversation(t *testing.T) {
+	bot, fake := newRemoteBot(t)
+	conv := bot.conversation
+
+	conv.AddUserMessage("hi")
+	reply, err := conv.SendToServer(true)
+	if err != nil || reply != "echo: hi" {
+		t.Fatalf("SendToServer = %q, %v", reply, err)
+	}
+	if conv.ID != "c1" || fake.created["system_prompt"] != "Be brief." || fake.created["name"] != "Default Chat" {
+		t.Errorf("conversation not created on the server: id %q, request %v", conv.ID, fake.created)
+	}
+	last := conv.Messages[len(conv.Messages)-1]
+	if len(conv.Messages) != 3 || last.Content != "echo: hi" || last.Model != "llama3.1:8b" || last.CompletionTokens != 2 {
+		t.Errorf("messages = %+v", conv.Messages)
+	}
+
+	conv.AddUserMessage("again")
+	if reply, err := conv.SendToServer(false); err != nil || reply != "echo: again" {
+		t.Errorf("batch SendToServer = %q, %v", reply, err)
+	}
+
+	fake.fail = "model took too long"
+	conv.AddUserMessage("slow")
+	var remoteErr *RemoteError
+	if _, err := conv.SendToServer(true); !errors.As(err, &remoteErr) || remoteErr.Code != "timeout" {
+		t.Errorf("error event: %v", err)
+	}
+
+	// the conversation can be picked up again, by ID or name
+	bot.conversation = NewSmartConversation("other", "Other", "llama3.1:8b", "", 4000)
+	if err := bot.loadRemoteConversation("Trip"); err != nil {
+		t.Fatalf("load by name: %v", err)
+	}
+	if bot.conversation.ID != "c1" || len(bot.conversation.Messages) != 6 || bot.conversation.remote == nil {
+		t.Errorf("loaded conversation = %+v", bot.conversation)
+	}
+	if err := bot.loadRemoteConversation("missing"); err == nil {
+		t.Error("loading a missing conversation succeeded")
+	}
+}
+
+func TestRemoteConversationKeepsEarlierTurns(t *testing.T) {
+	bot, fake := newRemoteBot(t)
+	conv := bot.conversation
+	conv.AddUserMessage("asked locally")
+	conv.AddMessage("assistant", "answered locally")
+
+	conv.AddUserMessage("hi")
+	if reply, err := conv.SendToServer(false); err != nil || reply != "echo: hi" {
+		t.Fatalf("SendToServer = %q, %v", reply, err)
+	}
+	if fake.created != nil || conv.ID != "c1" {
+		t.Errorf("conversation created empty: id %q, request %v", conv.ID, fake.created)
+	}
+	uploaded, _ := fake.imported["messages"].([]any)
+	if len(uploaded) != 3 || uploaded[2].(map[string]any)["content"] != "answered locally" {
+		t.Errorf("uploaded messages = %v, want the system prompt and the local turn", uploaded)
+	}
+	if len(fake.messages) != 2 || fake.messages[0]["content"] != "hi" {
+		t.Errorf("messages sent = %v, want only the new one", fake.messages)
+	}
+}
+
+func TestMessageBodyWithImages(t *testing.T) {
+	msg := ChatMessage{
+		Content:     "what is this?",
+		Attachments: []string{"notes.txt", "/tmp/cat.png"},
+		Images:      []string{"iVBORw0KGgo="},
+		Time:        time.Now(),
+	}
+	contentType, body, err := messageBody(msg)
+	if err != nil || !strings.HasPrefix(contentType, "multipart/form-data") {
+		t.Fatalf("messageBody = %q, %v", contentType, err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set("Content-Type", contentType)
+	if err := req.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	files := req.MultipartForm.File["images"]
+	if req.FormValue("content") != "what is this?" || len(files) != 1 || files[0].Filename != "cat.png" || files[0].Size != 8 {
+		t.Errorf("form = %v, files %+v", req.MultipartForm.Value, files)
+	}
+}
@@ -0,0 +1,253 @@
+// Package api defines the request and response bodies of the REST API
+// under /api/v1. The handlers answer with these types and the client
+// package decodes them, so the two cannot drift apart.
+package api
+
+import (
+	"ai-chatbot-web/internal/models"
+	"ai-chatbot-web/internal/tools"
+	"time"
+)
+
+// Resources returned by the API, as stored by the server.
+type (
+	Conversation = models.Conversation
+	Message      = models.Message
+	User         = models.User
+	APIKey       = models.APIKey
+	Document     = models.Document
+	Citation     = models.Citation
+	Image        = models.Image
+	Tool         = tools.Definition
+)
+
+// StatusResponse acknowledges a request that returns nothing else, such as
+// a delete.
+type StatusResponse struct {
+	Status  string `json:"status,omitempty"`
+	Message string `json:"message"`
+}
+
+// HealthResponse is the body of GET /health.
+type HealthResponse struct {
+	Status   string          `json:"status"`
+	Message  string          `json:"message"`
+	Model    string          `json:"model"`              // default model of new conversations
+	Backends []BackendStatus `json:"backends,omitempty"` // when models are spread over several servers
+}
+
+// BackendStatus is the state of one model server.
+type BackendStatus struct {
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Healthy   bool      `json:"healthy"`
+	Circuit   string    `json:"circuit"`
+	InFlight  int64     `json:"in_flight"`
+	Models    []string  `json:"models"`
+	LastError string    `json:"last_error,omitempty"`
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+}
+
+// Credentials is the body of POST /auth/register and /auth/login.
+type Credentials struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// UserResponse is the body of POST /auth/register and GET /auth/me.
+type UserResponse struct {
+	Status  string `json:"status"`
+	User    *User  `json:"user"`
+	Message string `json:"message,omitempty"`
+}
+
+// LoginResponse is the body of POST /auth/login. The token is used as a
+// bearer token.
+type LoginResponse struct {
+	Status    string    `json:"status"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreateAPIKeyRequest is the body of POST /api-keys. Scopes default to
+// read and write.
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// APIKeyCreated is the body of POST /api-keys. Key is only ever returned
+// here.
+type APIKeyCreated struct {
+	Status  string  `json:"status"`
+	Key     string  `json:"key"`
+	APIKey  *APIKey `json:"api_key"`
+	Message string  `json:"message"`
+}
+
+// APIKeyList is the body of GET /api-keys.
+type APIKeyList struct {
+	APIKeys []APIKey `json:"api_keys"`
+	Count   int      `json:"count"`
+}
+
+// UsageRow is one group of assistant responses in a usage report. Only
+// the fields grouped by are set.
+type UsageRow struct {
+	UserID                string  `json:"user_id,omitempty"`
+	Username              string  `json:"username,omitempty"`
+	Model                 string  `json:"model,omitempty"`
+	Day                   string  `json:"day,omitempty"`
+	Requests              int64   `json:"requests"`
+	PromptTokens          int64   `json:"prompt_tokens"`
+	CompletionTokens      int64   `json:"completion_tokens"`
+	AvgLatencyMs          float64 `json:"avg_latency_ms"`
+	AvgTimeToFirstTokenMs float64 `json:"avg_time_to_first_token_ms"`
+}
+
+// UsageQuery selects a usage report; see GET /usage.
+type UsageQuery struct {
+	GroupBy  []string // user, model and day; empty means all three
+	From, To string   // inclusive dates as YYYY-MM-DD
+	AllUsers bool     // admins only
+}
+
+// UsageResponse is the body of GET /usage.
+type UsageResponse struct {
+	Status  string     `json:"status"`
+	GroupBy []string   `json:"group_by"`
+	Usage   []UsageRow `json:"usage"`
+	Count   int        `json:"count"`
+}
+
+// QuotaResponse is the body of GET /usage/quota: the caller's usage
+// against the limits of its user and, when it used one, its API key.
+type QuotaResponse struct {
+	Status string        `json:"status"`
+	User   *SubjectUsage `json:"user,omitempty"`
+	APIKey *SubjectUsage `json:"api_key,omitempty"`
+}
+
+// SubjectUsage is the usage of a user or API key.
+type SubjectUsage struct {
+	ID       string      `json:"id"`
+	Requests BucketUsage `json:"requests"`
+	Tokens   BucketUsage `json:"tokens"`
+}
+
+// BucketUsage is the consumption of one daily limit.
+type BucketUsage struct {
+	Limit     int       `json:"limit"` // 0 means unlimited
+	Used      int       `json:"used"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+// CreateConversationRequest is the body of POST /conversations. The model
+// defaults to the server's, and the system prompt to a generic one.
+type CreateConversationRequest struct {
+	Name           string   `json:"name,omitempty"`
+	SystemPrompt   string   `json:"system_prompt,omitempty"`
+	Model          string   `json:"model,omitempty"`
+	FallbackModels []string `json:"fallback_models,omitempty" binding:"max=5"`
+	Tools          []string `json:"tools,omitempty"`
+}
+
+// ConversationResponse is the body of the requests that return one
+// conversation. GET /conversations/{id} includes its messages.
+type ConversationResponse struct {
+	Status       string        `json:"status"`
+	Conversation *Conversation `json:"conversation"`
+	Message      string        `json:"message,omitempty"`
+}
+
+// ConversationList is the body of GET /conversations. Messages are not
+// included.
+type ConversationList struct {
+	Conversations []Conversation `json:"conversations"`
+	Count         int            `json:"count"`
+}
+
+// SendMessageRequest is the body of POST /conversations/{id}/messages:
+// JSON, or a multipart form with the same fields when Images are sent.
+type SendMessageRequest struct {
+	Content string        `json:"content" form:"content" binding:"required"`
+	Role    string        `json:"role,omitempty" form:"role"` // default user
+	Images  []ImageUpload `json:"-" form:"-"`
+}
+
+// ImageUpload is a PNG or JPEG image sent with a message, for vision
+// models.
+type ImageUpload struct {
+	Name string
+	Data []byte
+}
+
+// SendMessageResponse is the body of POST /conversations/{id}/messages and
+// of a retry: the user message, the tool calls made on the way, if any,
+// and the reply.
+type SendMessageResponse struct {
+	UserMessage      *Message  `json:"user_message"`
+	AssistantMessage *Message  `json:"assistant_message"`
+	ToolMessages     []Message `json:"tool_messages,omitempty"`
+	Success          bool      `json:"success"`
+}
+
+// Events of a streamed reply, sent with ?stream=true. A token event
+// carries a StreamToken, done a SendMessageResponse and error the error
+// body. A reset event, with an empty object, drops the tokens sent so
+// far: the reply starts over, from a fallback model or after tool calls.
+const (
+	EventToken = "token"
+	EventReset = "reset"
+	EventDone  = "done"
+	EventError = "error"
+)
+
+// StreamToken is a piece of a streamed reply.
+type StreamToken struct {
+	Content string `json:"content"`
+}
+
+// SetToolsRequest is the body of PUT /conversations/{id}/tools. An empty
+// list turns tool use off.
+type SetToolsRequest struct {
+	Tools []string `json:"tools"`
+}
+
+// ToolList is the body of GET /tools.
+type ToolList struct {
+	Tools []Tool `json:"tools"`
+	Count int    `json:"count"`
+}
+
+// DocumentResponse is the body of POST /conversations/{id}/documents.
+type DocumentResponse struct {
+	Status   string    `json:"status"`
+	Document *Document `json:"document"`
+}
+
+// DocumentList is the body of GET /conversations/{id}/documents.
+type DocumentList struct {
+	Documents []Document `json:"documents"`
+	Count     int        `json:"count"`
+}
+
+// ImportResponse is the body of POST /conversations/import.
+type ImportResponse struct {
+	Status        string         `json:"status"`
+	Imported      int            `json:"imported"`
+	Updated       int            `json:"updated"`
+	Skipped       int            `json:"skipped"`
+	Conversations []ImportResult `json:"conversations"`
+}
+
+// ImportResult is what became of one imported conversation.
+type ImportResult struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Source   string `json:"source"`   // taconite or chatgpt
+	Status   string `json:"status"`   // imported, updated or skipped
+	Messages int    `json:"messages"` // messages added
+}
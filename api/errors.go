@@ -0,0 +1,77 @@
+package api
+
+import "net/http"
+
+// Error is the body of every error response, and of the "error" event
+// that ends a failed streamed reply:
+//
+//	{"status": "error", "code": "validation_failed", "message": "content is required", "field": "content"}
+//
+// Code is one of the Code constants and is what programs should switch
+// on; Message is for people and may change.
+type Error struct {
+	Status  string `json:"status"` // always "error"
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	// Field is the request field at fault, for validation_failed errors.
+	Field string `json:"field,omitempty"`
+
+	// RetryAfter is how many seconds to wait before trying again, for
+	// rate_limited errors. It repeats the Retry-After header.
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+// NewError returns an error body.
+func NewError(code, message string) Error {
+	return Error{Status: "error", Code: code, Message: message}
+}
+
+// Error codes. Most follow from the HTTP status; the rest say more about
+// what went wrong.
+const (
+	CodeInvalidRequest       = "invalid_request"        // 400: the body or a parameter is malformed
+	CodeValidationFailed     = "validation_failed"      // 400: a field has a bad value; Field names it
+	CodeVisionUnsupported    = "vision_unsupported"     // 400: images sent to a model that cannot see
+	CodeUnauthorized         = "unauthorized"           // 401
+	CodeForbidden            = "forbidden"              // 403
+	CodeNotFound             = "not_found"              // 404
+	CodeMethodNotAllowed     = "method_not_allowed"     // 405
+	CodeConflict             = "conflict"               // 409
+	CodeNotRetryable         = "not_retryable"          // 409: the message cannot be retried
+	CodePayloadTooLarge      = "payload_too_large"      // 413
+	CodeUnsupportedMediaType = "unsupported_media_type" // 415
+	CodeUnprocessable        = "unprocessable"          // 422: the upload holds no usable text
+	CodeRateLimited          = "rate_limited"           // 429: a rate limit or daily quota is used up
+	CodeInternal             = "internal_error"         // 500
+	CodeUnavailable          = "unavailable"            // 503: the server is shutting down or its database is down
+	CodeInterrupted          = "interrupted"            // 503: shutdown cut the reply off; it can be retried
+	CodeUpstreamError        = "upstream_error"         // 502: the model server failed
+	CodeUpstreamUnavailable  = "upstream_unavailable"   // 503: no model server could take the request
+	CodeUpstreamTimeout      = "upstream_timeout"       // 504: the model server took too long
+)
+
+// statusCodes are the codes errors get from their HTTP status alone.
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeInvalidRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	http.StatusConflict:              CodeConflict,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusUnsupportedMediaType:  CodeUnsupportedMediaType,
+	http.StatusUnprocessableEntity:   CodeUnprocessable,
+	http.StatusTooManyRequests:       CodeRateLimited,
+	http.StatusBadGateway:            CodeUpstreamError,
+	http.StatusServiceUnavailable:    CodeUnavailable,
+	http.StatusGatewayTimeout:        CodeUpstreamTimeout,
+}
+
+// CodeForStatus returns the code of an error answered with status.
+func CodeForStatus(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	return CodeInternal
+}
@@ -0,0 +1,270 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// operation is one endpoint, as the OpenAPI document describes it.
+type operation struct {
+	method  string
+	path    string // OpenAPI style, e.g. /conversations/{id}
+	summary string
+	public  bool // served without authentication
+
+	query     []param
+	request   any    // body type, if any
+	multipart string // the body is a multipart form with this file field
+	status    int    // of a successful response; default 200
+	response  any    // body type; nil for a file download
+	stream    bool   // answers with server-sent events given ?stream=true
+}
+
+// param is a query parameter.
+type param struct {
+	name, description string
+}
+
+// operations lists every endpoint under /api/v1. The handler tests check
+// it against the router.
+var operations = []operation{
+	{method: http.MethodGet, path: "/health", summary: "Check the server, its database and its model servers", public: true, response: HealthResponse{}},
+	{method: http.MethodGet, path: "/openapi.json", summary: "This document", public: true, response: map[string]any{}},
+	{method: http.MethodPost, path: "/auth/register", summary: "Create a user account", public: true, request: Credentials{}, status: http.StatusCreated, response: UserResponse{}},
+	{method: http.MethodPost, path: "/auth/login", summary: "Start a session; the token is returned and set as a cookie", public: true, request: Credentials{}, response: LoginResponse{}},
+	{method: http.MethodPost, path: "/auth/logout", summary: "End the current session", response: StatusResponse{}},
+	{method: http.MethodGet, path: "/auth/me", summary: "Show the authenticated user", response: UserResponse{}},
+
+	{method: http.MethodGet, path: "/api-keys", summary: "List your API keys", response: APIKeyList{}},
+	{method: http.MethodPost, path: "/api-keys", summary: "Create an API key; the key is only shown once", request: CreateAPIKeyRequest{}, status: http.StatusCreated, response: APIKeyCreated{}},
+	{method: http.MethodDelete, path: "/api-keys/{id}", summary: "Revoke an API key", response: StatusResponse{}},
+
+	{method: http.MethodGet, path: "/usage", summary: "Aggregate model usage", query: []param{
+		{"group_by", "Comma separated: user, model, day. Defaults to all three."},
+		{"from", "First day, as YYYY-MM-DD"},
+		{"to", "Last day, as YYYY-MM-DD"},
+		{"all_users", "true to include every user; admins only"},
+	}, response: UsageResponse{}},
+	{method: http.MethodGet, path: "/usage/quota", summary: "Show remaining request and token quota", response: QuotaResponse{}},
+
+	{method: http.MethodGet, path: "/conversations", summary: "List your conversations", response: ConversationList{}},
+	{method: http.MethodPost, path: "/conversations", summary: "Create a conversation", request: CreateConversationRequest{}, status: http.StatusCreated, response: ConversationResponse{}},
+	{method: http.MethodPost, path: "/conversations/import", summary: "Import CLI saves or a ChatGPT conversations.json; re-imports only add new messages", request: json.RawMessage{}, status: http.StatusCreated, response: ImportResponse{}},
+	{method: http.MethodGet, path: "/conversations/{id}", summary: "Get a conversation with its messages", response: ConversationResponse{}},
+	{method: http.MethodDelete, path: "/conversations/{id}", summary: "Delete a conversation", response: StatusResponse{}},
+	{method: http.MethodGet, path: "/conversations/{id}/export", summary: "Download a transcript, or a JSONL fine-tuning example", query: []param{
+		{"format", "md (default), html, json or jsonl"},
+	}},
+	{method: http.MethodPut, path: "/conversations/{id}/tools", summary: "Choose the tools the model may call", request: SetToolsRequest{}, response: ConversationResponse{}},
+	{method: http.MethodGet, path: "/tools", summary: "List the tools conversations can enable", response: ToolList{}},
+	{method: http.MethodGet, path: "/conversations/{id}/documents", summary: "List the documents of a conversation", response: DocumentList{}},
+	{method: http.MethodPost, path: "/conversations/{id}/documents", summary: "Upload a text, Markdown or PDF document to answer questions from", multipart: "file", status: http.StatusCreated, response: DocumentResponse{}},
+	{method: http.MethodDelete, path: "/conversations/{id}/documents/{document_id}", summary: "Delete a document", response: StatusResponse{}},
+	{method: http.MethodGet, path: "/conversations/{id}/images/{image_id}", summary: "Download an image sent with a message"},
+	{method: http.MethodPost, path: "/conversations/{id}/messages", summary: "Send a message and get the reply; images go in a multipart form", request: SendMessageRequest{}, multipart: "images", response: SendMessageResponse{}, stream: true},
+	{method: http.MethodPost, path: "/conversations/{id}/messages/{message_id}/retry", summary: "Retry a failed or interrupted message", response: SendMessageResponse{}, stream: true},
+}
+
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// OpenAPI returns the OpenAPI 3 document of the API.
+func OpenAPI() ([]byte, error) {
+	schemas := schemaSet{}
+	paths := map[string]map[string]any{}
+	for _, op := range operations {
+		if paths[op.path] == nil {
+			paths[op.path] = map[string]any{}
+		}
+		paths[op.path][strings.ToLower(op.method)] = op.describe(schemas)
+	}
+	schemas.add(reflect.TypeFor[Error]())
+
+	return json.MarshalIndent(map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "AI chatbot API",
+			"version": "1",
+			"description": "Every error response is an Error with a machine-readable code. " +
+				"Authenticate with a session token from /auth/login or an API key, as a bearer token.",
+		},
+		"servers": []any{map[string]any{"url": "/api/v1"}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}, "", "  ")
+}
+
+func (op operation) describe(schemas schemaSet) map[string]any {
+	var params []any
+	for _, match := range pathParam.FindAllStringSubmatch(op.path, -1) {
+		params = append(params, map[string]any{"name": match[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"}})
+	}
+	for _, q := range op.query {
+		params = append(params, map[string]any{"name": q.name, "in": "query", "description": q.description, "schema": map[string]any{"type": "string"}})
+	}
+	if op.stream {
+		params = append(params, map[string]any{"name": "stream", "in": "query",
+			"description": "true to stream the reply as token events, ending with a done or error event",
+			"schema":      map[string]any{"type": "boolean"}})
+	}
+
+	status := op.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	content := map[string]any{}
+	if op.response == nil {
+		content["*/*"] = map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}
+	} else {
+		content["application/json"] = map[string]any{"schema": schemas.ref(reflect.TypeOf(op.response))}
+	}
+	if op.stream {
+		content["text/event-stream"] = map[string]any{"schema": map[string]any{"type": "string"}}
+	}
+
+	described := map[string]any{
+		"summary": op.summary,
+		"responses": map[string]any{
+			strconv.Itoa(status): map[string]any{"description": http.StatusText(status), "content": content},
+			"default": map[string]any{
+				"description": "Error",
+				"content":     map[string]any{"application/json": map[string]any{"schema": schemas.ref(reflect.TypeFor[Error]())}},
+			},
+		},
+	}
+	if len(params) > 0 {
+		described["parameters"] = params
+	}
+	if body := op.requestBody(schemas); body != nil {
+		described["requestBody"] = body
+	}
+	if !op.public {
+		described["security"] = []any{map[string]any{"bearer": []any{}}}
+	}
+	return described
+}
+
+func (op operation) requestBody(schemas schemaSet) map[string]any {
+	content := map[string]any{}
+	if op.request != nil {
+		content["application/json"] = map[string]any{"schema": schemas.ref(reflect.TypeOf(op.request))}
+	}
+	if op.multipart != "" {
+		form := map[string]any{"type": "object", "properties": map[string]any{}}
+		if op.request != nil {
+			form = schemas.schema(reflect.TypeOf(op.request))
+		}
+		file := map[string]any{"type": "string", "format": "binary"}
+		if op.multipart == "images" {
+			form["properties"].(map[string]any)[op.multipart] = map[string]any{"type": "array", "items": file}
+		} else {
+			form["properties"].(map[string]any)[op.multipart] = file
+			form["required"] = []string{op.multipart}
+		}
+		content["multipart/form-data"] = map[string]any{"schema": form}
+	}
+	if len(content) == 0 {
+		return nil
+	}
+	return map[string]any{"required": true, "content": content}
+}
+
+// schemaSet collects the schemas of named struct types, by name.
+type schemaSet map[string]any
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// ref returns the schema of t, by reference for named structs.
+func (s schemaSet) ref(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Struct && t.Name() != "" && t != timeType {
+		s.add(t)
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return s.schema(t)
+}
+
+// add puts the schema of the named struct t in the set.
+func (s schemaSet) add(t reflect.Type) {
+	if _, ok := s[t.Name()]; ok {
+		return
+	}
+	s[t.Name()] = nil // stop recursion
+	s[t.Name()] = s.schema(t)
+}
+
+// schema describes values of t as encoding/json writes them.
+func (s schemaSet) schema(t reflect.Type) map[string]any {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	if t == reflect.TypeFor[json.RawMessage]() {
+		return map[string]any{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := s.ref(t.Elem())
+		if _, isRef := schema["$ref"]; isRef {
+			return map[string]any{"allOf": []any{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": s.ref(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.ref(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]any{}
+		var required []string
+		s.fields(t, properties, &required)
+		schema := map[string]any{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+	return map[string]any{}
+}
+
+// fields adds the JSON fields of struct t, including those of embedded
+// structs. Fields bound with "required" are required.
+func (s schemaSet) fields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" {
+			s.fields(field.Type, properties, required)
+			continue
+		}
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.ref(field.Type)
+		if strings.Contains(field.Tag.Get("binding"), "required") {
+			*required = append(*required, name)
+		}
+	}
+}
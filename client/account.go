@@ -0,0 +1,104 @@
+package client
+
+import (
+	"ai-chatbot-web/api"
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Register creates a user account.
+func (c *Client) Register(ctx context.Context, username, password string) (*api.User, error) {
+	var registered api.UserResponse
+	err := c.call(ctx, http.MethodPost, "/auth/register", api.Credentials{Username: username, Password: password}, &registered)
+	if err != nil {
+		return nil, err
+	}
+	return registered.User, nil
+}
+
+// Login starts a session and makes the client use its token from then on.
+func (c *Client) Login(ctx context.Context, username, password string) (*api.LoginResponse, error) {
+	var session api.LoginResponse
+	err := c.call(ctx, http.MethodPost, "/auth/login", api.Credentials{Username: username, Password: password}, &session)
+	if err != nil {
+		return nil, err
+	}
+	c.token = session.Token
+	return &session, nil
+}
+
+// Logout ends the session the client is using.
+func (c *Client) Logout(ctx context.Context) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/auth/logout"}, nil)
+}
+
+// Me returns the user the client is authenticated as.
+func (c *Client) Me(ctx context.Context) (*api.User, error) {
+	var me api.UserResponse
+	if err := c.get(ctx, "/auth/me", &me); err != nil {
+		return nil, err
+	}
+	return me.User, nil
+}
+
+// CreateAPIKey issues an API key. The key itself, in APIKeyCreated.Key,
+// cannot be retrieved again.
+func (c *Client) CreateAPIKey(ctx context.Context, req api.CreateAPIKeyRequest) (*api.APIKeyCreated, error) {
+	var created api.APIKeyCreated
+	if err := c.call(ctx, http.MethodPost, "/api-keys", req, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// APIKeys lists the user's API keys, including revoked ones.
+func (c *Client) APIKeys(ctx context.Context) ([]api.APIKey, error) {
+	var list api.APIKeyList
+	if err := c.get(ctx, "/api-keys", &list); err != nil {
+		return nil, err
+	}
+	return list.APIKeys, nil
+}
+
+// RevokeAPIKey revokes one of the user's API keys.
+func (c *Client) RevokeAPIKey(ctx context.Context, id string) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: "/api-keys/" + url.PathEscape(id)}, nil)
+}
+
+// Usage aggregates the user's model usage, or everyone's for admins.
+func (c *Client) Usage(ctx context.Context, query api.UsageQuery) (*api.UsageResponse, error) {
+	params := url.Values{}
+	if len(query.GroupBy) > 0 {
+		params.Set("group_by", strings.Join(query.GroupBy, ","))
+	}
+	if query.From != "" {
+		params.Set("from", query.From)
+	}
+	if query.To != "" {
+		params.Set("to", query.To)
+	}
+	if query.AllUsers {
+		params.Set("all_users", "true")
+	}
+
+	path := "/usage"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	var usage api.UsageResponse
+	if err := c.get(ctx, path, &usage); err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// Quota reports the requests and tokens left today.
+func (c *Client) Quota(ctx context.Context) (*api.QuotaResponse, error) {
+	var quota api.QuotaResponse
+	if err := c.get(ctx, "/usage/quota", &quota); err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
@@ -0,0 +1,190 @@
+// Package client is a typed Go client for the chat server's REST API.
+//
+//	c := client.New("http://localhost:8080", os.Getenv("CHAT_API_KEY"))
+//	conv, err := c.CreateConversation(ctx, api.CreateConversationRequest{Name: "Notes"})
+//	...
+//	reply, err := c.SendMessage(ctx, conv.ID, api.SendMessageRequest{Content: "Hello"})
+//
+// Errors returned by the server are *Error values.
+package client
+
+import (
+	"ai-chatbot-web/api"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the API of one server. It is safe for concurrent use,
+// except that Login changes the token used by every request.
+type Client struct {
+	// HTTPClient sends the requests. Streamed replies last as long as the
+	// model takes, so it should not have a short Timeout.
+	HTTPClient *http.Client
+
+	baseURL string
+	token   string
+}
+
+// New returns a client for the server at baseURL, e.g.
+// http://localhost:8080, that authenticates with token: an API key or a
+// session token from Login. The token may be empty for Health, Register
+// and Login.
+func New(baseURL, token string) *Client {
+	return &Client{
+		HTTPClient: &http.Client{},
+		baseURL:    strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/api/v1"),
+		token:      token,
+	}
+}
+
+// Error is an error response from the server.
+type Error struct {
+	StatusCode int
+	Message    string
+
+	// Code is one of the api.Code constants, such as api.CodeNotFound.
+	Code string
+
+	// Field is the request field at fault, for api.CodeValidationFailed.
+	Field string
+
+	// RetryAfter is how long the server asked to wait before trying again.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s (%s)", e.StatusCode, http.StatusText(e.StatusCode), e.Message, e.Code)
+}
+
+// IsNotFound reports whether err is a 404 from the server.
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// newError returns the error for a response with status and body. Bodies
+// that are not the API's error envelope, say from a proxy, leave the
+// message and code to the status.
+func newError(status int, body api.Error) *Error {
+	return &Error{
+		StatusCode: status,
+		Message:    cmp.Or(body.Message, http.StatusText(status)),
+		Code:       cmp.Or(body.Code, api.CodeForStatus(status)),
+		Field:      body.Field,
+		RetryAfter: time.Duration(body.RetryAfter) * time.Second,
+	}
+}
+
+// request is an API call: a path under /api/v1 and its body, if any.
+type request struct {
+	method      string
+	path        string
+	body        io.Reader
+	contentType string
+}
+
+// jsonRequest returns a request with in encoded as its JSON body.
+func jsonRequest(method, path string, in any) (request, error) {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return request{}, err
+	}
+	return request{method: method, path: path, body: bytes.NewReader(data), contentType: "application/json"}, nil
+}
+
+// send makes the request and returns the response once it has checked the
+// status. The caller closes the body.
+func (c *Client) send(ctx context.Context, r request) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, r.method, c.baseURL+"/api/v1"+r.path, r.body)
+	if err != nil {
+		return nil, err
+	}
+	if r.contentType != "" {
+		req.Header.Set("Content-Type", r.contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	var body api.Error
+	json.NewDecoder(resp.Body).Decode(&body)
+	apiErr := newError(resp.StatusCode, body)
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return nil, apiErr
+}
+
+// do makes the request and decodes the JSON response into out, unless
+// out is nil.
+func (c *Client) do(ctx context.Context, r request, out any) error {
+	resp, err := c.send(ctx, r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response to %s %s: %v", r.method, r.path, err)
+	}
+	return nil
+}
+
+// get fetches path into out.
+func (c *Client) get(ctx context.Context, path string, out any) error {
+	return c.do(ctx, request{method: http.MethodGet, path: path}, out)
+}
+
+// call sends in as JSON and decodes the response into out.
+func (c *Client) call(ctx context.Context, method, path string, in, out any) error {
+	r, err := jsonRequest(method, path, in)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, r, out)
+}
+
+// download fetches path and returns its body and content type.
+func (c *Client) download(ctx context.Context, path string) ([]byte, string, error) {
+	resp, err := c.send(ctx, request{method: http.MethodGet, path: path})
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return data, resp.Header.Get("Content-Type"), err
+}
+
+// Health reports whether the server and its database are up.
+func (c *Client) Health(ctx context.Context) (*api.HealthResponse, error) {
+	var health api.HealthResponse
+	if err := c.get(ctx, "/health", &health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// BaseURL returns the address of the server.
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
@@ -0,0 +1,393 @@
+package client_test
+
+import (
+	"ai-chatbot-web/api"
+	"ai-chatbot-web/client"
+	"ai-chatbot-web/internal/blobs"
+	"ai-chatbot-web/internal/database/databasetest"
+	"ai-chatbot-web/internal/fakeollama"
+	"ai-chatbot-web/internal/handlers"
+	"ai-chatbot-web/internal/rag"
+	"ai-chatbot-web/internal/ratelimit"
+	"ai-chatbot-web/internal/services"
+	"ai-chatbot-web/internal/store"
+	"ai-chatbot-web/internal/tools"
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newServer runs the whole API, as cmd/server wires it, on a temporary
+// database and a fake Ollama, and returns a client logged in as alice.
+func newServer(t *testing.T) (*client.Client, *fakeollama.Server) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	fake := fakeollama.New()
+	fake.SetTokenDelay(time.Millisecond)
+	ollama := httptest.NewServer(fake)
+	t.Cleanup(ollama.Close)
+	t.Setenv("OLLAMA_HOST", ollama.URL)
+	t.Setenv("OLLAMA_MODEL", fakeollama.DefaultModel)
+	t.Setenv("AI_RETRY_BASE_DELAY", "1ms")
+
+	db := databasetest.Open(t)
+
+	aiClient, err := services.NewAIClient()
+	if err != nil {
+		t.Fatalf("NewAIClient: %v", err)
+	}
+	registry := tools.NewRegistry()
+	if err := tools.RegisterBuiltins(registry); err != nil {
+		t.Fatalf("register tools: %v", err)
+	}
+	stores := store.NewDatabaseStore(db)
+	images := blobs.NewDatabaseStore(db)
+	authService := services.NewAuthService(db)
+	apiKeyService := services.NewAPIKeyService(db)
+	quota := ratelimit.NewQuota(db)
+
+	router := gin.New()
+	handlers.Routes{
+		API: handlers.NewAPIHandler(stores.Conversations(), stores.Messages(), aiClient, services.NewGenerationTracker(),
+			registry, rag.NewIndex(aiClient, stores.Documents()), images),
+		Auth:          handlers.NewAuthHandler(authService),
+		APIKeys:       handlers.NewAPIKeyHandler(apiKeyService),
+		Usage:         handlers.NewUsageHandler(db),
+		Quota:         handlers.NewQuotaHandler(quota),
+		AuthService:   authService,
+		APIKeyService: apiKeyService,
+		Limits:        quota,
+	}.Register(router)
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	c := client.New(srv.URL, "")
+	if _, err := c.Register(ctx, "alice", "correct horse battery"); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if _, err := c.Login(ctx, "alice", "correct horse battery"); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	return c, fake
+}
+
+func TestConversation(t *testing.T) {
+	c, fake := newServer(t)
+	ctx := context.Background()
+
+	health, err := c.Health(ctx)
+	if err != nil || health.Model != fakeollama.DefaultModel {
+		t.Fatalf("Health = %+v, %v", health, err)
+	}
+	if me, err := c.Me(ctx); err != nil || me.Username != "alice" {
+		t.Fatalf("Me = %+v, %v", me, err)
+	}
+
+	conv, err := c.CreateConversation(ctx, api.CreateConversationRequest{Name: "Geography"})
+	if err != nil {
+		t.Fatalf("CreateConversation: %v", err)
+	}
+	fake.Respond("Paris.")
+	turn, err := c.SendMessage(ctx, conv.ID, api.SendMessageRequest{Content: "Capital of France?"})
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if !turn.Success || turn.AssistantMessage.Content != "Paris." || turn.UserMessage.Content != "Capital of France?" {
+		t.Errorf("turn = %+v", turn)
+	}
+
+	got, err := c.Conversation(ctx, conv.ID)
+	if err != nil || len(got.Messages) != 3 {
+		t.Fatalf("Conversation = %+v, %v", got, err)
+	}
+	list, err := c.Conversations(ctx)
+	if err != nil || len(list) != 1 || list[0].Name != "Geography" {
+		t.Fatalf("Conversations = %+v, %v", list, err)
+	}
+
+	transcript, err := c.Export(ctx, conv.ID, "md")
+	if err != nil || !strings.Contains(string(transcript), "Paris.") {
+		t.Errorf("Export = %q, %v", transcript, err)
+	}
+
+	if usage, err := c.Usage(ctx, api.UsageQuery{GroupBy: []string{"model"}}); err != nil || len(usage.Usage) != 1 {
+		t.Errorf("Usage = %+v, %v", usage, err)
+	}
+	if quota, err := c.Quota(ctx); err != nil || quota.User == nil || quota.User.ID == "" {
+		t.Errorf("Quota = %+v, %v", quota, err)
+	}
+
+	if err := c.DeleteConversation(ctx, conv.ID); err != nil {
+		t.Fatalf("DeleteConversation: %v", err)
+	}
+	if _, err := c.Conversation(ctx, conv.ID); !client.IsNotFound(err) {
+		t.Errorf("Conversation after delete: err = %v, want not found", err)
+	}
+}
+
+func TestStreamMessage(t *testing.T) {
+	c, fake := newServer(t)
+	ctx := context.Background()
+	conv, err := c.CreateConversation(ctx, api.CreateConversationRequest{Name: "stream"})
+	if err != nil {
+		t.Fatalf("CreateConversation: %v", err)
+	}
+
+	fake.Respond("Once upon a time.")
+	stream, err := c.StreamMessage(ctx, conv.ID, api.SendMessageRequest{Content: "Tell me a story"})
+	if err != nil {
+		t.Fatalf("StreamMessage: %v", err)
+	}
+	var text strings.Builder
+	tokens := 0
+	for token := range stream.Tokens() {
+		text.WriteString(token)
+		tokens++
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if tokens < 2 || text.String() != "Once upon a time." {
+		t.Errorf("streamed %d tokens %q", tokens, text.String())
+	}
+	if turn := stream.Response(); turn == nil || turn.AssistantMessage.Content != text.String() {
+		t.Errorf("Response = %+v", turn)
+	}
+
+	// content sent with tool calls is dropped once the reply starts over
+	if _, err := c.SetTools(ctx, conv.ID, "calculate"); err != nil {
+		t.Fatalf("SetTools: %v", err)
+	}
+	fake.Script(fakeollama.Reply{
+		Content:   "Let me work it out.",
+		ToolCalls: []fakeollama.ToolCall{fakeollama.Call("calculate", `{"expression": "6 * 7"}`)},
+	})
+	fake.Respond("It is 42.")
+	stream, err = c.StreamMessage(ctx, conv.ID, api.SendMessageRequest{Content: "What is 6 * 7?"})
+	if err != nil {
+		t.Fatalf("StreamMessage: %v", err)
+	}
+	text.Reset()
+	stream.OnReset = text.Reset
+	for token := range stream.Tokens() {
+		text.WriteString(token)
+	}
+	if err := stream.Err(); err != nil || text.String() != "It is 42." {
+		t.Errorf("stream with tools: %q, %v", text.String(), err)
+	}
+}
+
+func TestRetryMessage(t *testing.T) {
+	t.Setenv("AI_RETRIES", "0")
+	c, fake := newServer(t)
+	ctx := context.Background()
+	conv, err := c.CreateConversation(ctx, api.CreateConversationRequest{Name: "retry"})
+	if err != nil {
+		t.Fatalf("CreateConversation: %v", err)
+	}
+
+	fake.FailNext(1, http.StatusServiceUnavailable)
+	_, err = c.SendMessage(ctx, conv.ID, api.SendMessageRequest{Content: "hi"})
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.Code != "upstream_unavailable" {
+		t.Fatalf("SendMessage err = %#v, want a 503 upstream_unavailable *Error", err)
+	}
+
+	got, err := c.Conversation(ctx, conv.ID)
+	if err != nil {
+		t.Fatalf("Conversation: %v", err)
+	}
+	failed := got.Messages[len(got.Messages)-1]
+
+	fake.Respond("Hello!")
+	stream, err := c.StreamRetry(ctx, conv.ID, failed.ID)
+	if err != nil {
+		t.Fatalf("StreamRetry: %v", err)
+	}
+	for range stream.Tokens() {
+	}
+	if turn := stream.Response(); stream.Err() != nil || turn.AssistantMessage.Content != "Hello!" {
+		t.Errorf("retry: %+v, %v", turn, stream.Err())
+	}
+}
+
+func TestImagesAndDocuments(t *testing.T) {
+	c, fake := newServer(t)
+	fake.SetModels(fakeollama.DefaultModel, "nomic-embed-text")
+	fake.SetVision(fakeollama.DefaultModel)
+	ctx := context.Background()
+	conv, err := c.CreateConversation(ctx, api.CreateConversationRequest{Name: "files"})
+	if err != nil {
+		t.Fatalf("CreateConversation: %v", err)
+	}
+
+	doc, err := c.UploadDocument(ctx, conv.ID, "notes.txt", []byte("The launch code is 1234."))
+	if err != nil {
+		t.Fatalf("UploadDocument: %v", err)
+	}
+	if docs, err := c.Documents(ctx, conv.ID); err != nil || len(docs) != 1 || docs[0].ID != doc.ID {
+		t.Errorf("Documents = %+v, %v", docs, err)
+	}
+	if err := c.DeleteDocument(ctx, conv.ID, doc.ID); err != nil {
+		t.Errorf("DeleteDocument: %v", err)
+	}
+
+	var pic bytes.Buffer
+	png.Encode(&pic, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	fake.Respond("A black square.")
+	turn, err := c.SendMessage(ctx, conv.ID, api.SendMessageRequest{
+		Content: "What is this?",
+		Images:  []api.ImageUpload{{Name: "square.png", Data: pic.Bytes()}},
+	})
+	if err != nil {
+		t.Fatalf("SendMessage with image: %v", err)
+	}
+	if len(turn.UserMessage.Images) != 1 {
+		t.Fatalf("user message images = %+v", turn.UserMessage.Images)
+	}
+	data, mediaType, err := c.Image(ctx, conv.ID, turn.UserMessage.Images[0].ID)
+	if err != nil || mediaType != "image/png" || !bytes.Equal(data, pic.Bytes()) {
+		t.Errorf("Image = %d bytes of %s, %v", len(data), mediaType, err)
+	}
+}
+
+func TestToolsAndImport(t *testing.T) {
+	c, _ := newServer(t)
+	ctx := context.Background()
+
+	available, err := c.Tools(ctx)
+	if err != nil || len(available) == 0 {
+		t.Fatalf("Tools = %+v, %v", available, err)
+	}
+	conv, err := c.CreateConversation(ctx, api.CreateConversationRequest{Name: "tools"})
+	if err != nil {
+		t.Fatalf("CreateConversation: %v", err)
+	}
+	updated, err := c.SetTools(ctx, conv.ID, available[0].Function.Name)
+	if err != nil || len(updated.Tools) != 1 {
+		t.Errorf("SetTools = %+v, %v", updated, err)
+	}
+	if updated, err := c.SetTools(ctx, conv.ID); err != nil || len(updated.Tools) != 0 {
+		t.Errorf("SetTools() = %+v, %v", updated, err)
+	}
+
+	saved := `{"meta": {"id": "default", "name": "Go help"}, "messages": [
+		{"role": "user", "content": "hi"}, {"role": "assistant", "content": "hello"}]}`
+	report, err := c.Import(ctx, []byte(saved))
+	if err != nil || report.Imported != 1 || report.Conversations[0].Messages != 3 {
+		t.Errorf("Import = %+v, %v", report, err)
+	}
+	if _, err := c.Import(ctx, []byte(`{"nope":true}`)); err == nil || !strings.Contains(err.Error(), "unrecognized") {
+		t.Errorf("Import of unknown format: err = %v", err)
+	}
+}
+
+func TestAuthAndOwnership(t *testing.T) {
+	alice, _ := newServer(t)
+	ctx := context.Background()
+	conv, err := alice.CreateConversation(ctx, api.CreateConversationRequest{Name: "private"})
+	if err != nil {
+		t.Fatalf("CreateConversation: %v", err)
+	}
+
+	bob := client.New(alice.BaseURL(), "")
+	var apiErr *client.Error
+	if _, err := bob.Register(ctx, "alice", "another password"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("Register of a taken name: err = %v, want 409", err)
+	}
+	if _, err := bob.Conversations(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Conversations without a session: err = %v, want 401", err)
+	}
+	if _, err := bob.Register(ctx, "bob", "correct horse battery"); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if _, err := bob.Login(ctx, "bob", "wrong horse battery"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Login with a wrong password: err = %v, want 401", err)
+	}
+	if _, err := bob.Login(ctx, "bob", "correct horse battery"); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	// alice's conversation does not exist as far as bob is concerned
+	if _, err := bob.Conversation(ctx, conv.ID); !client.IsNotFound(err) {
+		t.Errorf("bob reads alice's conversation: err = %v, want not found", err)
+	}
+	if _, err := bob.SendMessage(ctx, conv.ID, api.SendMessageRequest{Content: "hi"}); !client.IsNotFound(err) {
+		t.Errorf("bob writes to alice's conversation: err = %v, want not found", err)
+	}
+	if err := bob.DeleteConversation(ctx, conv.ID); !client.IsNotFound(err) {
+		t.Errorf("bob deletes alice's conversation: err = %v, want not found", err)
+	}
+	if list, err := bob.Conversations(ctx); err != nil || len(list) != 0 {
+		t.Errorf("bob's conversations = %+v, %v", list, err)
+	}
+	if _, err := alice.Conversation(ctx, conv.ID); err != nil {
+		t.Errorf("alice lost her conversation: %v", err)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	c, _ := newServer(t)
+	ctx := context.Background()
+
+	created, err := c.CreateAPIKey(ctx, api.CreateAPIKeyRequest{Name: "ci", Scopes: []string{"read"}})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	keyClient := client.New(strings.TrimSuffix(c.BaseURL(), "/")+"/api/v1/", created.Key)
+	if list, err := keyClient.Conversations(ctx); err != nil || len(list) != 0 {
+		t.Errorf("Conversations with API key = %+v, %v", list, err)
+	}
+	_, err = keyClient.CreateConversation(ctx, api.CreateConversationRequest{Name: "denied"})
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Errorf("write with a read-only key: err = %v, want 403", err)
+	}
+
+	// keys cannot mint keys, not even with the write scope
+	writer, err := c.CreateAPIKey(ctx, api.CreateAPIKeyRequest{Name: "deploy", Scopes: []string{"read", "write"}})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	writerClient := client.New(strings.TrimSuffix(c.BaseURL(), "/")+"/api/v1/", writer.Key)
+	_, err = writerClient.CreateAPIKey(ctx, api.CreateAPIKeyRequest{Name: "forever"})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Errorf("CreateAPIKey with an API key: err = %v, want 403", err)
+	}
+	if err := c.RevokeAPIKey(ctx, writer.APIKey.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+
+	if err := c.RevokeAPIKey(ctx, created.APIKey.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if _, err := keyClient.Conversations(ctx); !errors.As(err, &apiErr) || apiErr.Code != api.CodeUnauthorized {
+		t.Errorf("revoked key: err = %v, want 401", err)
+	}
+	if keys, err := c.APIKeys(ctx); err != nil || len(keys) != 2 || keys[0].RevokedAt == nil || keys[1].RevokedAt == nil {
+		t.Errorf("APIKeys = %+v, %v", keys, err)
+	}
+
+	_, err = c.Register(ctx, "bob", "short")
+	if !errors.As(err, &apiErr) || apiErr.Code != api.CodeValidationFailed || apiErr.Field != "password" {
+		t.Errorf("Register with a short password: err = %#v, want a validation error on password", err)
+	}
+
+	if err := c.Logout(ctx); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if _, err := c.Me(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Me after logout: err = %v, want 401", err)
+	}
+}
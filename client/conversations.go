@@ -0,0 +1,211 @@
+package client
+
+import (
+	"ai-chatbot-web/api"
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+)
+
+// conversationPath returns the path of a conversation, or of something
+// under it when elem is given.
+func conversationPath(id string, elem ...string) string {
+	path := "/conversations/" + url.PathEscape(id)
+	for _, e := range elem {
+		path += "/" + url.PathEscape(e)
+	}
+	return path
+}
+
+// Conversations lists the user's conversations, without their messages.
+func (c *Client) Conversations(ctx context.Context) ([]api.Conversation, error) {
+	var list api.ConversationList
+	if err := c.get(ctx, "/conversations", &list); err != nil {
+		return nil, err
+	}
+	return list.Conversations, nil
+}
+
+// CreateConversation starts a conversation.
+func (c *Client) CreateConversation(ctx context.Context, req api.CreateConversationRequest) (*api.Conversation, error) {
+	var created api.ConversationResponse
+	if err := c.call(ctx, http.MethodPost, "/conversations", req, &created); err != nil {
+		return nil, err
+	}
+	return created.Conversation, nil
+}
+
+// Conversation returns a conversation with its messages.
+func (c *Client) Conversation(ctx context.Context, id string) (*api.Conversation, error) {
+	var conversation api.ConversationResponse
+	if err := c.get(ctx, conversationPath(id), &conversation); err != nil {
+		return nil, err
+	}
+	return conversation.Conversation, nil
+}
+
+// DeleteConversation deletes a conversation and everything in it.
+func (c *Client) DeleteConversation(ctx context.Context, id string) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: conversationPath(id)}, nil)
+}
+
+// messageRequest encodes req for POST /conversations/{id}/messages: JSON,
+// or a multipart form when it carries images.
+func messageRequest(id string, req api.SendMessageRequest, stream bool) (request, error) {
+	path := conversationPath(id, "messages")
+	if stream {
+		path += "?stream=true"
+	}
+	if len(req.Images) == 0 {
+		return jsonRequest(http.MethodPost, path, req)
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("content", req.Content)
+	if req.Role != "" {
+		form.WriteField("role", req.Role)
+	}
+	for i, image := range req.Images {
+		name := image.Name
+		if name == "" {
+			name = fmt.Sprintf("image%d", i+1)
+		}
+		part, err := form.CreateFormFile("images", name)
+		if err != nil {
+			return request{}, err
+		}
+		part.Write(image.Data)
+	}
+	if err := form.Close(); err != nil {
+		return request{}, err
+	}
+	return request{method: http.MethodPost, path: path, body: &body, contentType: form.FormDataContentType()}, nil
+}
+
+// SendMessage adds a message to a conversation and waits for the reply.
+func (c *Client) SendMessage(ctx context.Context, id string, req api.SendMessageRequest) (*api.SendMessageResponse, error) {
+	r, err := messageRequest(id, req, false)
+	if err != nil {
+		return nil, err
+	}
+	var turn api.SendMessageResponse
+	if err := c.do(ctx, r, &turn); err != nil {
+		return nil, err
+	}
+	return &turn, nil
+}
+
+// StreamMessage adds a message to a conversation and streams the reply as
+// the model writes it.
+func (c *Client) StreamMessage(ctx context.Context, id string, req api.SendMessageRequest) (*Stream, error) {
+	r, err := messageRequest(id, req, true)
+	if err != nil {
+		return nil, err
+	}
+	return c.stream(ctx, r)
+}
+
+// RetryMessage generates the reply to a user message again, after it
+// failed or was interrupted, and waits for it.
+func (c *Client) RetryMessage(ctx context.Context, id, messageID string) (*api.SendMessageResponse, error) {
+	var turn api.SendMessageResponse
+	err := c.do(ctx, request{method: http.MethodPost, path: conversationPath(id, "messages", messageID, "retry")}, &turn)
+	if err != nil {
+		return nil, err
+	}
+	return &turn, nil
+}
+
+// StreamRetry is RetryMessage with the reply streamed.
+func (c *Client) StreamRetry(ctx context.Context, id, messageID string) (*Stream, error) {
+	return c.stream(ctx, request{method: http.MethodPost, path: conversationPath(id, "messages", messageID, "retry") + "?stream=true"})
+}
+
+// Tools lists the tools conversations can enable.
+func (c *Client) Tools(ctx context.Context) ([]api.Tool, error) {
+	var list api.ToolList
+	if err := c.get(ctx, "/tools", &list); err != nil {
+		return nil, err
+	}
+	return list.Tools, nil
+}
+
+// SetTools chooses the tools a conversation's model may call. No tools
+// turns tool use off.
+func (c *Client) SetTools(ctx context.Context, id string, tools ...string) (*api.Conversation, error) {
+	if tools == nil {
+		tools = []string{}
+	}
+	var updated api.ConversationResponse
+	err := c.call(ctx, http.MethodPut, conversationPath(id, "tools"), api.SetToolsRequest{Tools: tools}, &updated)
+	if err != nil {
+		return nil, err
+	}
+	return updated.Conversation, nil
+}
+
+// UploadDocument adds a document to a conversation for its replies to
+// draw on.
+func (c *Client) UploadDocument(ctx context.Context, id, name string, data []byte) (*api.Document, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		return nil, err
+	}
+	part.Write(data)
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	var uploaded api.DocumentResponse
+	r := request{method: http.MethodPost, path: conversationPath(id, "documents"), body: &body, contentType: form.FormDataContentType()}
+	if err := c.do(ctx, r, &uploaded); err != nil {
+		return nil, err
+	}
+	return uploaded.Document, nil
+}
+
+// Documents lists the documents of a conversation.
+func (c *Client) Documents(ctx context.Context, id string) ([]api.Document, error) {
+	var list api.DocumentList
+	if err := c.get(ctx, conversationPath(id, "documents"), &list); err != nil {
+		return nil, err
+	}
+	return list.Documents, nil
+}
+
+// DeleteDocument removes a document from a conversation.
+func (c *Client) DeleteDocument(ctx context.Context, id, documentID string) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: conversationPath(id, "documents", documentID)}, nil)
+}
+
+// Image returns an image sent with a message and its media type.
+func (c *Client) Image(ctx context.Context, id, imageID string) ([]byte, string, error) {
+	return c.download(ctx, conversationPath(id, "images", imageID))
+}
+
+// Export returns a conversation as a transcript in format:
+// md (the default), html, json or jsonl.
+func (c *Client) Export(ctx context.Context, id, format string) ([]byte, error) {
+	path := conversationPath(id, "export")
+	if format != "" {
+		path += "?format=" + url.QueryEscape(format)
+	}
+	data, _, err := c.download(ctx, path)
+	return data, err
+}
+
+// Import adds conversations saved by the CLI or exported from ChatGPT.
+func (c *Client) Import(ctx context.Context, data []byte) (*api.ImportResponse, error) {
+	var report api.ImportResponse
+	r := request{method: http.MethodPost, path: "/conversations/import", body: bytes.NewReader(data), contentType: "application/json"}
+	if err := c.do(ctx, r, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"ai-chatbot-web/api"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strings"
+)
+
+// Stream is a reply being streamed by the server. Range over Tokens to
+// read it as the model writes it, then check Err and take the whole turn
+// from Response:
+//
+//	stream, err := c.StreamMessage(ctx, id, api.SendMessageRequest{Content: "Hi"})
+//	if err != nil { ... }
+//	defer stream.Close()
+//	for token := range stream.Tokens() {
+//		fmt.Print(token)
+//	}
+//	if err := stream.Err(); err != nil { ... }
+type Stream struct {
+	// OnReset, if set, is called when the server drops the tokens sent
+	// so far and starts the reply over; the tokens that follow make up
+	// the new reply. Set it before ranging over Tokens.
+	OnReset func()
+
+	body     io.ReadCloser
+	response *api.SendMessageResponse
+	err      error
+}
+
+// stream makes the request and returns its reply as a Stream.
+func (c *Client) stream(ctx context.Context, r request) (*Stream, error) {
+	resp, err := c.send(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return &Stream{body: resp.Body}, nil
+}
+
+// Tokens yields the pieces of the reply until the turn ends. It can be
+// ranged over once.
+func (s *Stream) Tokens() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		defer s.Close()
+
+		scanner := bufio.NewScanner(s.body)
+		scanner.Buffer(make([]byte, 64<<10), 16<<20)
+
+		event, data := "", ""
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+				continue
+			case strings.HasPrefix(line, "data:"):
+				data = strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+				continue
+			case line != "":
+				continue
+			}
+
+			// a blank line ends the event
+			switch event {
+			case api.EventToken:
+				var token api.StreamToken
+				if err := json.Unmarshal([]byte(data), &token); err != nil {
+					s.err = fmt.Errorf("invalid token event: %v", err)
+					return
+				}
+				if !yield(token.Content) {
+					return
+				}
+			case api.EventReset:
+				if s.OnReset != nil {
+					s.OnReset()
+				}
+			case api.EventDone:
+				var turn api.SendMessageResponse
+				if err := json.Unmarshal([]byte(data), &turn); err != nil {
+					s.err = fmt.Errorf("invalid done event: %v", err)
+					return
+				}
+				s.response = &turn
+				return
+			case api.EventError:
+				var body api.Error
+				json.Unmarshal([]byte(data), &body)
+				s.err = newError(eventStatus(body.Code), body)
+				return
+			}
+			event, data = "", ""
+		}
+		if err := scanner.Err(); err != nil {
+			s.err = err
+			return
+		}
+		s.err = io.ErrUnexpectedEOF
+	}
+}
+
+// eventStatus is the status the server would have answered an error
+// event with, had the status line not gone out with the first token.
+func eventStatus(code string) int {
+	switch code {
+	case api.CodeUpstreamUnavailable, api.CodeInterrupted:
+		return http.StatusServiceUnavailable
+	case api.CodeUpstreamTimeout:
+		return http.StatusGatewayTimeout
+	case api.CodeUpstreamError:
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// Err returns why the stream ended early, if it did. An error the server
+// reported is an *Error.
+func (s *Stream) Err() error {
+	return s.err
+}
+
+// Response returns the whole turn once Tokens is done, or nil if the
+// stream failed.
+func (s *Stream) Response() *api.SendMessageResponse {
+	return s.response
+}
+
+// Close stops reading the reply.
+func (s *Stream) Close() error {
+	return s.body.Close()
+}
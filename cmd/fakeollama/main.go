@@ -0,0 +1,82 @@
+// Command fakeollama serves a fake Ollama API for demos and for running the
+// server and CLI without a model:
+//
+//	go run ./cmd/fakeollama -addr 127.0.0.1:11434 -latency 200ms -token-delay 30ms
+//
+// Replies echo the last message. With -script, replies are read from a
+// file, one per line, and used in order before falling back to echoing.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"ai-chatbot-web/internal/fakeollama"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:11434", "address to listen on")
+	models := flag.String("models", fakeollama.DefaultModel, "comma separated list of models to serve")
+	vision := flag.String("vision", "", "comma separated list of served models that can read images")
+	latency := flag.Duration("latency", 0, "delay before each response starts")
+	tokenDelay := flag.Duration("token-delay", 20*time.Millisecond, "delay between streamed chunks")
+	failRate := flag.Float64("fail-rate", 0, "fraction of chat requests to fail with 500")
+	dimensions := flag.Int("dimensions", fakeollama.DefaultDimensions, "length of the embeddings returned")
+	script := flag.String("script", "", "file with scripted replies, one per line")
+	flag.Parse()
+
+	fake := fakeollama.New()
+	fake.SetModels(strings.Split(*models, ",")...)
+	if *vision != "" {
+		fake.SetVision(strings.Split(*vision, ",")...)
+	}
+	fake.SetLatency(*latency)
+	fake.SetTokenDelay(*tokenDelay)
+	fake.SetFailRate(*failRate)
+	fake.SetDimensions(*dimensions)
+
+	if *script != "" {
+		replies, err := readScript(*script)
+		if err != nil {
+			slog.Error("failed to read script", "error", err)
+			os.Exit(1)
+		}
+		fake.Respond(replies...)
+	}
+
+	slog.Info("fake ollama listening", "addr", *addr, "models", *models)
+	if err := http.ListenAndServe(*addr, logRequests(fake)); err != nil {
+		slog.Error("server failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+func readScript(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var replies []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			replies = append(replies, line)
+		}
+	}
+	return replies, scanner.Err()
+}
+
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		slog.Info("request", "method", r.Method, "path", r.URL.Path, "duration_ms", time.Since(start).Milliseconds())
+	})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"ai-chatbot-web/internal/database"
+	"ai-chatbot-web/internal/importer"
+	"ai-chatbot-web/internal/models"
+	"ai-chatbot-web/internal/services"
+	"ai-chatbot-web/internal/store"
+
+	"gorm.io/gorm"
+)
+
+const importUsage = `usage: server import -user <username> <file|directory>...
+
+Imports conversations saved by the CLI (./conversations/*.json) or a
+ChatGPT export's conversations.json for the given user. Directories are
+searched for *.json files. Importing again only adds new messages.`
+
+// runImport implements the import subcommand and returns the exit code.
+func runImport(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, importUsage) }
+	username := flags.String("user", "", "username to import the conversations for")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *username == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	files, err := importFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	db, err := database.NewDatabase()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if os.Getenv("DB_AUTO_MIGRATE") != "false" {
+		if _, err := db.MigrateUp(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to migrate database: %v\n", err)
+			return 1
+		}
+	}
+
+	var user models.User
+	if err := db.DB.Where("username = ?", *username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fmt.Fprintf(os.Stderr, "no user named %q\n", *username)
+		} else {
+			fmt.Fprintf(os.Stderr, "failed to look up user: %v\n", err)
+		}
+		return 1
+	}
+
+	aiClient, err := services.NewAIClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize AI client: %v\n", err)
+		return 1
+	}
+	stores := store.NewDatabaseStore(db)
+	imp := importer.New(stores.Conversations(), stores.Messages(), aiClient.GetModel())
+
+	var total importer.Report
+	failed := 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err == nil {
+			var report *importer.Report
+			report, err = imp.Import(ctx, user.ID, data)
+			if report != nil {
+				for _, result := range report.Conversations {
+					fmt.Printf("%-8s %s: %s (%d messages added)\n", result.Status, file, result.Name, result.Messages)
+				}
+				total.Imported += report.Imported
+				total.Updated += report.Updated
+				total.Skipped += report.Skipped
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed   %s: %v\n", file, err)
+			failed++
+		}
+	}
+
+	fmt.Printf("%d imported, %d updated, %d skipped, %d file(s) failed\n", total.Imported, total.Updated, total.Skipped, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// importFiles expands directories among paths into their *.json files.
+func importFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no *.json files in %s", path)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
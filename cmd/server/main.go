@@ -1,12 +1,27 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 	
+	"ai-chatbot-web/internal/blobs"
 	"ai-chatbot-web/internal/database"
 	"ai-chatbot-web/internal/handlers"
+	"ai-chatbot-web/internal/logging"
+	"ai-chatbot-web/internal/metrics"
+	"ai-chatbot-web/internal/middleware"
+	"ai-chatbot-web/internal/rag"
+	"ai-chatbot-web/internal/ratelimit"
 	"ai-chatbot-web/internal/services"
+	"ai-chatbot-web/internal/store"
+	"ai-chatbot-web/internal/tools"
+	"ai-chatbot-web/internal/tracing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -14,44 +29,148 @@ import (
 
 func main() {
 	// Load environment variables from .env file
-	err := godotenv.Load()
+	envErr := godotenv.Load()
+
+	// Structured logging, configured from the environment
+	logging.Setup()
+	if envErr != nil {
+		slog.Info("no .env file found, using system environment variables")
+	}
+
+	// server migrate up|down|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
+	// server import -user name files...
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		os.Exit(runImport(os.Args[2:]))
+	}
+
+	// Tracing, exported via OTLP when configured
+	shutdownTracing, err := tracing.Setup(context.Background())
 	if err != nil {
-		log.Println("No .env file found, using system environment variables")
+		slog.Error("failed to initialize tracing", "error", err)
+		os.Exit(1)
 	}
 
 	// Initialize database
 	db, err := database.NewDatabase()
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		slog.Error("failed to initialize database", "error", err)
+		os.Exit(1)
+	}
+
+	// Apply pending migrations unless they are run separately with
+	// "server migrate up"
+	if os.Getenv("DB_AUTO_MIGRATE") != "false" {
+		applied, err := db.MigrateUp(context.Background())
+		if err != nil {
+			slog.Error("failed to migrate database", "error", err)
+			os.Exit(1)
+		}
+		for _, m := range applied {
+			slog.Info("migration applied", "version", m.Version, "name", m.Name)
+		}
+	}
+
+	// Repair turns left pending by a crash and any pre-status rows. Nothing
+	// is generating yet, so every pending turn was cut off unless another
+	// instance shares the database: those set RECONCILE_PENDING_AFTER above
+	// the model timeout to leave each other's turns alone.
+	var pendingAfter time.Duration
+	if v := os.Getenv("RECONCILE_PENDING_AFTER"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			pendingAfter = d
+		}
+	}
+	reconciled, err := services.ReconcileMessages(context.Background(), db, pendingAfter)
+	if err != nil {
+		slog.Error("failed to reconcile messages", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("messages reconciled",
+		"backfilled", reconciled.Backfilled,
+		"interrupted", reconciled.Interrupted,
+		"system_messages", reconciled.SystemMessages,
+	)
+
+	// Export connection pool stats
+	if sqlDB, err := db.DB.DB(); err == nil {
+		if err := metrics.RegisterDB(sqlDB, db.Type); err != nil {
+			slog.Warn("failed to register database metrics", "error", err)
+		}
+	}
+
+	// Initialize AI client and start checking its backends
+	aiClient, err := services.NewAIClient()
+	if err != nil {
+		slog.Error("failed to initialize AI client", "error", err)
+		os.Exit(1)
+	}
+	healthChecks, stopHealthChecks := context.WithCancel(context.Background())
+	aiClient.StartHealthChecks(healthChecks)
+
+	// Initialize auth
+	authService := services.NewAuthService(db)
+	apiKeyService := services.NewAPIKeyService(db)
+
+	// Initialize rate limits and quotas
+	quota := ratelimit.NewQuota(db)
+
+	// Tools the model can call in conversations that enable them
+	registry := tools.NewRegistry()
+	if err := tools.RegisterBuiltins(registry); err != nil {
+		slog.Error("failed to register tools", "error", err)
+		os.Exit(1)
 	}
-	defer db.Close()
 
-	// Initialize AI client
-	aiClient := services.NewAIClient()
+	// Track in-flight generations so shutdown can drain them
+	generations := services.NewGenerationTracker()
+
+	// Images sent with messages, on disk or in the database
+	images, err := blobs.New(db)
+	if err != nil {
+		slog.Error("failed to initialize image store", "error", err)
+		os.Exit(1)
+	}
 
 	// Initialize handlers
-	handler := handlers.NewAPIHandler(db, aiClient)
+	stores := store.NewDatabaseStore(db)
+	documents := rag.NewIndex(aiClient, stores.Documents())
+	handler := handlers.NewAPIHandler(stores.Conversations(), stores.Messages(), aiClient, generations, registry, documents, images)
+	usageHandler := handlers.NewUsageHandler(db)
+	authHandler := handlers.NewAuthHandler(authService)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+	quotaHandler := handlers.NewQuotaHandler(quota)
 
 	// Set up Gin router
 	if os.Getenv("GIN_MODE") == "release" {
 		gin.SetMode(gin.ReleaseMode)
 	}
-	router := gin.Default()
+	router := gin.New()
 
 	// Middleware
-	router.Use(gin.Logger())
+	router.Use(middleware.RequestID())
+	router.Use(tracing.Middleware())
+	router.Use(middleware.RequestLogger())
 	router.Use(gin.Recovery())
+	router.Use(metrics.Middleware())
+
+	// Prometheus scrape endpoint, deliberately outside the authenticated API
+	router.GET("/metrics", metrics.Handler())
 
 	// API routes
-	api := router.Group("/api/v1")
-	{
-		api.GET("/health", handler.HealthCheck)
-		api.GET("/conversations", handler.GetConversations)
-		api.POST("/conversations", handler.CreateConversation)
-		api.GET("/conversations/:id", handler.GetConversation)
-		api.POST("/conversations/:id/messages", handler.SendMessage)
-		api.DELETE("/conversations/:id", handler.DeleteConversation)
-	}
+	handlers.Routes{
+		API:           handler,
+		Auth:          authHandler,
+		APIKeys:       apiKeyHandler,
+		Usage:         usageHandler,
+		Quota:         quotaHandler,
+		AuthService:   authService,
+		APIKeyService: apiKeyService,
+		Limits:        quota,
+	}.Register(router)
 
 	// Serve static files
 	router.Static("/static", "./web/static")
@@ -70,12 +189,80 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("🚀 Server starting on port %s", port)
-	log.Printf("📊 Health check: http://localhost:%s/api/v1/health", port)
-	log.Printf("🤖 AI Model: %s", aiClient.GetModel())
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: router,
+	}
+
+	slog.Info("server starting",
+		"port", port,
+		"health_check", "http://localhost:"+port+"/api/v1/health",
+		"model", aiClient.GetModel(),
+		"backends", len(aiClient.Backends()),
+	)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	// Wait for a shutdown signal
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err := <-serverErr:
+		slog.Error("failed to run server", "error", err)
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+
+	stopHealthChecks()
+	shutdown(srv, generations, db, shutdownTracing)
+}
+
+// shutdown stops accepting requests, lets in-flight generations finish
+// until SHUTDOWN_TIMEOUT (default 30s) passes, interrupts whatever is still
+// running, and then closes the database.
+func shutdown(srv *http.Server, generations *services.GenerationTracker, db *database.Database, shutdownTracing func(context.Context) error) {
+	timeout := 30 * time.Second
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			timeout = d
+		}
+	}
+
+	slog.Info("shutting down", "timeout", timeout.String(), "active_generations", generations.Active())
+	generations.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		// Deadline passed with generations still running: interrupt them
+		// and give their handlers a moment to record it
+		interrupted := generations.Interrupt()
+		slog.Warn("shutdown deadline reached, interrupting generations", "interrupted", interrupted)
+
+		graceCtx, graceCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := generations.Wait(graceCtx); err != nil {
+			slog.Error("generations did not stop after interrupt", "error", err)
+		}
+		graceCancel()
+		srv.Close()
+	}
+
+	if err := db.Close(); err != nil {
+		slog.Error("failed to close database", "error", err)
+	}
 
-if err := router.Run(":" + port); err != nil {
-		log.Fatalf("Failed to run server: %v", err)
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer flushCancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("failed to flush traces", "error", err)
 	}
 
+	slog.Info("server stopped")
 }
@@ -0,0 +1,52 @@
+package blobs
+
+import (
+	"ai-chatbot-web/internal/database"
+	"ai-chatbot-web/internal/models"
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// DatabaseStore keeps blobs in the image_blobs table, so they are backed
+// up and shared between server instances with the rest of the data.
+type DatabaseStore struct {
+	db *database.Database
+}
+
+func NewDatabaseStore(db *database.Database) *DatabaseStore {
+	return &DatabaseStore{
+		db: db,
+	}
+}
+
+func (d *DatabaseStore) Put(ctx context.Context, id string, data []byte) error {
+	if err := d.db.DB.WithContext(ctx).Create(&models.ImageBlob{ID: id, Data: data}).Error; err != nil {
+		return fmt.Errorf("failed to store blob: %v", err)
+	}
+	return nil
+}
+
+func (d *DatabaseStore) Get(ctx context.Context, id string) ([]byte, error) {
+	var blob models.ImageBlob
+	err := d.db.DB.WithContext(ctx).Where("id = ?", id).First(&blob).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob: %v", err)
+	}
+	return blob.Data, nil
+}
+
+func (d *DatabaseStore) Delete(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := d.db.DB.WithContext(ctx).Where("id IN ?", ids).Delete(&models.ImageBlob{}).Error; err != nil {
+		return fmt.Errorf("failed to delete blob: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package blobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileStore keeps each blob in its own file under a directory.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates dir if needed and returns a store using it.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create image directory: %v", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (f *FileStore) Put(ctx context.Context, id string, data []byte) error {
+	path, err := f.path(id)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial blob
+	tmp, err := os.CreateTemp(f.dir, ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to store blob: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to store blob: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to store blob: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to store blob: %v", err)
+	}
+	return nil
+}
+
+func (f *FileStore) Get(ctx context.Context, id string) ([]byte, error) {
+	path, err := f.path(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob: %v", err)
+	}
+	return data, nil
+}
+
+func (f *FileStore) Delete(ctx context.Context, ids ...string) error {
+	for _, id := range ids {
+		path, err := f.path(id)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to delete blob: %v", err)
+		}
+	}
+	return nil
+}
+
+// path maps an ID to its file, refusing IDs that would leave the directory.
+func (f *FileStore) path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("invalid blob id %q", id)
+	}
+	return filepath.Join(f.dir, id), nil
+}
@@ -0,0 +1,44 @@
+// Package blobs stores the bytes of images sent with messages, either on
+// the filesystem or in the database.
+package blobs
+
+import (
+	"ai-chatbot-web/internal/database"
+	"ai-chatbot-web/internal/logging"
+	"context"
+	"errors"
+	"os"
+)
+
+// ErrNotFound is returned by Get for an unknown ID.
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps blobs by ID. IDs are chosen by the caller and must be safe
+// to use as file names; the handlers use UUIDs.
+type Store interface {
+	Put(ctx context.Context, id string, data []byte) error
+	Get(ctx context.Context, id string) ([]byte, error)
+	// Delete removes the blobs; unknown IDs are ignored.
+	Delete(ctx context.Context, ids ...string) error
+}
+
+// New creates a Store configured from environment variables:
+//
+//	IMAGE_STORE  file (default) or database
+//	IMAGE_DIR    directory of the file store (default ./data/images)
+func New(db *database.Database) (Store, error) {
+	dir := os.Getenv("IMAGE_DIR")
+	if dir == "" {
+		dir = "./data/images"
+	}
+
+	switch backend := os.Getenv("IMAGE_STORE"); backend {
+	case "database":
+		return NewDatabaseStore(db), nil
+	case "", "file":
+		return NewFileStore(dir)
+	default:
+		logging.For("blobs").Warn("unknown IMAGE_STORE, using file", "backend", backend)
+		return NewFileStore(dir)
+	}
+}
@@ -1,22 +1,24 @@
 package database
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"os"
 	
-	"ai-chatbot-web/internal/models"
+	"ai-chatbot-web/internal/logging"
+	"ai-chatbot-web/internal/tracing"
 	"gorm.io/driver/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
 type Database struct {
-	DB *gorm.DB
+	DB   *gorm.DB
+	Type string // sqlite or postgres
 }
 
 // NewDatabase initializes the database connection based on environment variables.
+// The schema is managed separately, see MigrateUp.
 func NewDatabase() (*Database, error) {
 	dbType := os.Getenv("DB_TYPE")
 
@@ -27,6 +29,11 @@ func NewDatabase() (*Database, error) {
 	var db *gorm.DB
 	var err error
 
+	log := logging.For("database")
+	gormConfig := &gorm.Config{
+		Logger: logging.NewGormLogger(log),
+	}
+
 	switch dbType {
 	case "sqlite":
 		dbPath := os.Getenv("DB_PATH")
@@ -39,9 +46,7 @@ func NewDatabase() (*Database, error) {
 			return nil, fmt.Errorf("failed to create data directory: %v", err)
 		}
 
-		db, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{
-			Logger: logger.Default.LogMode(logger.Info),
-		})
+		db, err = gorm.Open(sqlite.Open(dbPath), gormConfig)
 
 	case "postgres":
 		dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
@@ -51,7 +56,7 @@ func NewDatabase() (*Database, error) {
 			os.Getenv("DB_NAME"),
 			os.Getenv("DB_PORT"),
 			)
-		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		db, err = gorm.Open(postgres.Open(dsn), gormConfig)
 	default:
 		return nil, fmt.Errorf("Unsupported DB_TYPE: %s", dbType)
 	}
@@ -60,14 +65,18 @@ func NewDatabase() (*Database, error) {
 		return nil, fmt.Errorf("failed to connect database: %v", err)
 	}
 
-	// auto migrate the schema
-	if err := db.AutoMigrate(&models.User{}, &models.Conversation{}, &models.Message{}); err != nil {
-		return nil, fmt.Errorf("failed to migrate database: %v", err)
+	// trace every query
+	system := dbType
+	if dbType == "postgres" {
+		system = "postgresql"
+	}
+	if err := db.Use(&tracing.GormPlugin{System: system}); err != nil {
+		return nil, fmt.Errorf("failed to register tracing plugin: %v", err)
 	}
 
-	log.Printf("✅ Database connected using %s", dbType)
+	log.Info("database connected", "type", dbType)
 
-	return &Database{DB: db}, nil
+	return &Database{DB: db, Type: dbType}, nil
 
 }
 
@@ -88,3 +97,15 @@ func (d *Database) Ping() error {
 	}
 	return sqlDB.Ping()
 }	
+
+// IsUniqueViolation reports whether err is the database refusing a row
+// that duplicates a unique column.
+func (d *Database) IsUniqueViolation(err error) bool {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	if translator, ok := d.DB.Dialector.(gorm.ErrorTranslator); ok {
+		return errors.Is(translator.Translate(err), gorm.ErrDuplicatedKey)
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+// Package databasetest opens throwaway SQLite databases for tests, with
+// foreign keys enforced as Postgres does.
+package databasetest
+
+import (
+	"ai-chatbot-web/internal/database"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// Open returns a migrated database in a temporary directory. It is closed
+// when the test ends.
+func Open(t testing.TB) *database.Database {
+	t.Helper()
+	db := OpenEmpty(t)
+	if _, err := db.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// OpenEmpty is Open without the migrations, for tests of the schema itself.
+func OpenEmpty(t testing.TB) *database.Database {
+	t.Helper()
+	gdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=on"), &gorm.Config{
+		Logger: gormlogger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	db := &database.Database{DB: gdb, Type: "sqlite"}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
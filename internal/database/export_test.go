@@ -0,0 +1,14 @@
+package database
+
+// Unexported names the external tests use.
+const LegacyVersion = legacyVersion
+
+type (
+	LegacyUser         = legacyUser
+	LegacyConversation = legacyConversation
+)
+
+var (
+	SplitStatements = splitStatements
+	StripComments   = stripComments
+)
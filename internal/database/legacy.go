@@ -0,0 +1,118 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// legacyVersion is the last migration whose schema AutoMigrate used to
+// create. Databases created before versioned migrations are adopted at
+// this version.
+const legacyVersion = 2
+
+// Snapshot of the models as of legacyVersion. These must not change when
+// the models in internal/models do; later schema changes belong in a new
+// migration instead.
+type legacyUser struct {
+	ID           string `gorm:"primaryKey"`
+	Username     string `gorm:"unique"`
+	PasswordHash string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type legacySession struct {
+	ID        string `gorm:"primaryKey"`
+	UserID    string `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type legacyAPIKey struct {
+	ID         string `gorm:"primaryKey"`
+	UserID     string `gorm:"index"`
+	Name       string
+	Prefix     string
+	KeyHash    string `gorm:"uniqueIndex"`
+	Scopes     string
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+type legacyConversation struct {
+	ID           string `gorm:"primaryKey"`
+	Name         string
+	UserID       string
+	Model        string
+	SystemPrompt string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type legacyMessage struct {
+	ID                 string `gorm:"primaryKey"`
+	ConversationID     string
+	APIKeyID           string `gorm:"index"`
+	Role               string
+	Content            string
+	TokenCount         int
+	Status             string `gorm:"index"`
+	CreatedAt          time.Time
+	Model              string
+	PromptTokens       int
+	CompletionTokens   int
+	LatencyMs          int64
+	TimeToFirstTokenMs int64
+}
+
+type legacyRateLimitHit struct {
+	ID        uint      `gorm:"primaryKey"`
+	Key       string    `gorm:"index:idx_rate_limit_key_time,priority:1"`
+	CreatedAt time.Time `gorm:"index:idx_rate_limit_key_time,priority:2"`
+}
+
+func (legacyUser) TableName() string         { return "users" }
+func (legacySession) TableName() string      { return "sessions" }
+func (legacyAPIKey) TableName() string       { return "api_keys" }
+func (legacyConversation) TableName() string { return "conversations" }
+func (legacyMessage) TableName() string      { return "messages" }
+func (legacyRateLimitHit) TableName() string { return "rate_limit_hits" }
+
+// adoptLegacySchema brings a database created by AutoMigrate under
+// versioned migrations. It runs AutoMigrate one last time against the
+// legacyVersion snapshot, which fills in whatever an older binary had not
+// created yet, and records migrations up to legacyVersion as applied. A
+// fresh database is left alone.
+func adoptLegacySchema(tx *gorm.DB, dialect string) error {
+	if !tx.Migrator().HasTable(&legacyUser{}) {
+		return nil
+	}
+
+	err := tx.AutoMigrate(
+		&legacyUser{}, &legacySession{}, &legacyAPIKey{},
+		&legacyConversation{}, &legacyMessage{}, &legacyRateLimitHit{},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to adopt existing schema: %v", err)
+	}
+
+	migrations, err := Migrations(dialect)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if m.Version > legacyVersion {
+			break
+		}
+		row := schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}
+		if err := tx.Create(&row).Error; err != nil {
+			return fmt.Errorf("failed to record adopted migration %d: %v", m.Version, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+// Migration is one versioned schema change with its up and down SQL for
+// the database's dialect.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState reports whether a migration has been applied.
+type MigrationState struct {
+	Migration
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// schemaMigration is a row of the schema_migrations table.
+type schemaMigration struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string { return "schema_migrations" }
+
+// Migrations loads the embedded migrations for the given dialect, ordered
+// by version. Files are named NNNN_name.up.sql and NNNN_name.down.sql.
+func Migrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for dialect %s: %v", dialect, err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		base, direction, ok := splitMigrationName(name)
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", name)
+		}
+		number, label, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %v", name, err)
+		}
+
+		body, err := fs.ReadFile(migrationFiles, path.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %v", name, err)
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func splitMigrationName(name string) (base, direction string, ok bool) {
+	for _, direction := range []string{"up", "down"} {
+		suffix := "." + direction + ".sql"
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix), direction, true
+		}
+	}
+	return "", "", false
+}
+
+// MigrateUp applies every pending migration in order and returns the ones
+// it applied.
+func (d *Database) MigrateUp(ctx context.Context) ([]Migration, error) {
+	migrations, applied, err := d.prepareMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		skipped := false
+		err := d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := d.lockMigrations(tx); err != nil {
+				return err
+			}
+			// another server may have applied it in the meantime
+			var count int64
+			if err := tx.Model(&schemaMigration{}).Where("version = ?", m.Version).Count(&count).Error; err != nil {
+				return err
+			}
+			if skipped = count > 0; skipped {
+				return nil
+			}
+			if err := execScript(tx, m.Up); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("failed to apply migration %d_%s: %v", m.Version, m.Name, err)
+		}
+		if !skipped {
+			ran = append(ran, m)
+		}
+	}
+	return ran, nil
+}
+
+// MigrateDown rolls back the latest steps applied migrations and returns
+// the ones it rolled back.
+func (d *Database) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	migrations, applied, err := d.prepareMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for i := len(migrations) - 1; i >= 0 && len(ran) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return ran, fmt.Errorf("migration %d_%s cannot be rolled back", m.Version, m.Name)
+		}
+		err := d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := execScript(tx, m.Down); err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{}, "version = ?", m.Version).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("failed to roll back migration %d_%s: %v", m.Version, m.Name, err)
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// MigrationStatus lists every known migration and whether it is applied.
+func (d *Database) MigrationStatus(ctx context.Context) ([]MigrationState, error) {
+	migrations, applied, err := d.prepareMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := MigrationState{Migration: m}
+		if row, ok := applied[m.Version]; ok {
+			state.Applied = true
+			state.AppliedAt = &row.AppliedAt
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// prepareMigrations loads the migrations for this dialect, makes sure the
+// schema_migrations table exists and returns the applied versions. The
+// table is created in one transaction with the adoption of a legacy
+// schema, so a failed adoption is tried again on the next run.
+func (d *Database) prepareMigrations(ctx context.Context) ([]Migration, map[int]schemaMigration, error) {
+	migrations, err := Migrations(d.Type)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := d.lockMigrations(tx); err != nil {
+			return err
+		}
+		if tx.Migrator().HasTable(&schemaMigration{}) {
+			return nil
+		}
+		if err := tx.Exec(`CREATE TABLE schema_migrations (
+			version integer PRIMARY KEY,
+			name text NOT NULL,
+			applied_at timestamp NOT NULL
+		)`).Error; err != nil {
+			return fmt.Errorf("failed to create schema_migrations: %v", err)
+		}
+		return adoptLegacySchema(tx, d.Type)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rows []schemaMigration
+	if err := d.DB.WithContext(ctx).Order("version").Find(&rows).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+	applied := make(map[int]schemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return migrations, applied, nil
+}
+
+// migrationLock is the Postgres advisory lock held while the schema
+// changes, so servers starting together migrate one at a time.
+const migrationLock = 0x6d696772617465 // "migrate"
+
+// lockMigrations takes migrationLock until tx ends. SQLite needs no lock,
+// as its database is not shared between servers.
+func (d *Database) lockMigrations(tx *gorm.DB) error {
+	if d.Type != "postgres" {
+		return nil
+	}
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLock).Error; err != nil {
+		return fmt.Errorf("failed to lock migrations: %v", err)
+	}
+	return nil
+}
+
+// execScript runs each statement of a migration script. Statements are
+// separated by a semicolon at the end of a line, except inside a
+// dollar-quoted ($$) block such as the body of a Postgres DO statement.
+func execScript(tx *gorm.DB, script string) error {
+	for _, statement := range splitStatements(script) {
+		if strings.TrimSpace(stripComments(statement)) == "" {
+			continue
+		}
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	quoted := false
+	for _, line := range strings.SplitAfter(script, "\n") {
+		current.WriteString(line)
+		if strings.Count(line, "$$")%2 == 1 {
+			quoted = !quoted
+		}
+		if !quoted && strings.HasSuffix(strings.TrimRight(line, "\r\n"), ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimRight(current.String(), "\r\n"), ";"))
+			current.Reset()
+		}
+	}
+	return append(statements, current.String())
+}
+
+func stripComments(statement string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(statement, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
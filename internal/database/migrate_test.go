@@ -0,0 +1,196 @@
+package database_test
+
+import (
+	"ai-chatbot-web/internal/database"
+	"ai-chatbot-web/internal/database/databasetest"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// versions lists the versions of migrations, in order.
+func versions(migrations []database.Migration) []int {
+	out := make([]int, len(migrations))
+	for i, m := range migrations {
+		out[i] = m.Version
+	}
+	return out
+}
+
+func TestMigrations(t *testing.T) {
+	sqliteMigrations, err := database.Migrations("sqlite")
+	if err != nil {
+		t.Fatalf("database.Migrations(sqlite): %v", err)
+	}
+	postgresMigrations, err := database.Migrations("postgres")
+	if err != nil {
+		t.Fatalf("database.Migrations(postgres): %v", err)
+	}
+
+	// both dialects go through the same steps, each of which can be undone
+	if a, b := versions(sqliteMigrations), versions(postgresMigrations); !slices.Equal(a, b) {
+		t.Errorf("sqlite migrations %v, postgres %v", a, b)
+	}
+	for i, m := range append(sqliteMigrations, postgresMigrations...) {
+		if m.Down == "" {
+			t.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+		}
+		if i < len(sqliteMigrations) && m.Version != i+1 {
+			t.Errorf("migration %d_%s out of sequence at %d", m.Version, m.Name, i)
+		}
+	}
+
+	if _, err := database.Migrations("oracle"); err == nil {
+		t.Error("migrations found for an unknown dialect")
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	db := databasetest.OpenEmpty(t)
+	ctx := context.Background()
+	all, _ := database.Migrations("sqlite")
+
+	ran, err := db.MigrateUp(ctx)
+	if err != nil || len(ran) != len(all) {
+		t.Fatalf("MigrateUp ran %v, %v; want all %d", versions(ran), err, len(all))
+	}
+	if ran, err := db.MigrateUp(ctx); err != nil || len(ran) != 0 {
+		t.Errorf("second MigrateUp ran %v, %v", versions(ran), err)
+	}
+	for _, table := range []string{"users", "conversations", "messages", "documents", "document_chunks", "image_blobs"} {
+		if !db.DB.Migrator().HasTable(table) {
+			t.Errorf("table %s missing after MigrateUp", table)
+		}
+	}
+
+	ran, err = db.MigrateDown(ctx, 2)
+	if err != nil || !slices.Equal(versions(ran), []int{len(all), len(all) - 1}) {
+		t.Fatalf("MigrateDown(2) ran %v, %v", versions(ran), err)
+	}
+	states, err := db.MigrationStatus(ctx)
+	if err != nil || len(states) != len(all) {
+		t.Fatalf("MigrationStatus = %+v, %v", states, err)
+	}
+	for _, state := range states {
+		if want := state.Version <= len(all)-2; state.Applied != want || (state.AppliedAt != nil) != want {
+			t.Errorf("migration %d: applied %v at %v", state.Version, state.Applied, state.AppliedAt)
+		}
+	}
+
+	// everything can be undone and redone
+	if ran, err := db.MigrateDown(ctx, len(all)); err != nil || len(ran) != len(all)-2 {
+		t.Fatalf("MigrateDown(all) ran %v, %v", versions(ran), err)
+	}
+	if db.DB.Migrator().HasTable("users") || db.DB.Migrator().HasTable("conversations") {
+		t.Error("tables left after rolling back every migration")
+	}
+	if ran, err := db.MigrateUp(ctx); err != nil || len(ran) != len(all) {
+		t.Errorf("MigrateUp after rolling back ran %v, %v", versions(ran), err)
+	}
+}
+
+func TestMigrateUpAdoptsLegacySchema(t *testing.T) {
+	db := databasetest.OpenEmpty(t)
+	ctx := context.Background()
+
+	// an old binary created part of the schema with AutoMigrate
+	if err := db.DB.AutoMigrate(&database.LegacyUser{}, &database.LegacyConversation{}); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	user := database.LegacyUser{ID: "u1", Username: "alice", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	conversation := database.LegacyConversation{ID: "c1", Name: "old", UserID: "u1", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := db.DB.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := db.DB.Create(&conversation).Error; err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+
+	ran, err := db.MigrateUp(ctx)
+	if err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	if len(ran) == 0 || ran[0].Version != database.LegacyVersion+1 {
+		t.Errorf("MigrateUp ran %v, want from %d", versions(ran), database.LegacyVersion+1)
+	}
+
+	// the adopted versions are recorded, and nothing was lost
+	states, _ := db.MigrationStatus(ctx)
+	for _, state := range states {
+		if !state.Applied {
+			t.Errorf("migration %d not applied", state.Version)
+		}
+	}
+	for _, table := range []string{"sessions", "api_keys", "messages", "rate_limit_hits"} {
+		if !db.DB.Migrator().HasTable(table) {
+			t.Errorf("table %s not created on adoption", table)
+		}
+	}
+	var name, importKey *string
+	if err := db.DB.Raw("SELECT name, import_key FROM conversations WHERE id = ?", "c1").Row().Scan(&name, &importKey); err != nil || name == nil || *name != "old" {
+		t.Errorf("legacy conversation after adoption: %v, %v", name, err)
+	}
+
+	// a fresh database is not mistaken for a legacy one
+	fresh := databasetest.OpenEmpty(t)
+	if ran, err := fresh.MigrateUp(ctx); err != nil || len(ran) == 0 || ran[0].Version != 1 {
+		t.Errorf("MigrateUp on a fresh database ran %v, %v", versions(ran), err)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- comment
+CREATE TABLE a (id text);
+DO $$
+BEGIN
+    CREATE EXTENSION IF NOT EXISTS vector;
+EXCEPTION WHEN OTHERS THEN
+    RAISE NOTICE 'skipped';
+END
+$$;
+ALTER TABLE a ADD COLUMN b text;
+`
+	var got []string
+	for _, statement := range database.SplitStatements(script) {
+		if s := strings.TrimSpace(database.StripComments(statement)); s != "" {
+			got = append(got, s)
+		}
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d statements: %q", len(got), got)
+	}
+	if !strings.HasPrefix(got[1], "DO $$") || !strings.HasSuffix(got[1], "END\n$$") {
+		t.Errorf("DO block split up: %q", got[1])
+	}
+	if got[2] != "ALTER TABLE a ADD COLUMN b text" {
+		t.Errorf("last statement = %q", got[2])
+	}
+}
+
+func TestMigrateUpRetriesFailedAdoption(t *testing.T) {
+	db := databasetest.OpenEmpty(t)
+	ctx := context.Background()
+
+	// a view where adoption wants a table makes it fail part way
+	if err := db.DB.AutoMigrate(&database.LegacyUser{}); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	if err := db.DB.Exec("CREATE VIEW sessions AS SELECT id FROM users").Error; err != nil {
+		t.Fatalf("create view: %v", err)
+	}
+	if _, err := db.MigrateUp(ctx); err == nil {
+		t.Fatal("MigrateUp succeeded despite the failed adoption")
+	}
+	if db.DB.Migrator().HasTable("schema_migrations") {
+		t.Error("schema_migrations kept after the adoption failed")
+	}
+
+	// once the problem is fixed, adoption runs again
+	db.DB.Exec("DROP VIEW sessions")
+	ran, err := db.MigrateUp(ctx)
+	if err != nil || len(ran) == 0 || ran[0].Version != database.LegacyVersion+1 {
+		t.Errorf("MigrateUp after fixing the schema ran %v, %v", versions(ran), err)
+	}
+}
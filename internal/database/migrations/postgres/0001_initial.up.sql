@@ -0,0 +1,26 @@
+-- Schema as originally created by AutoMigrate.
+CREATE TABLE IF NOT EXISTS users (
+    id text PRIMARY KEY,
+    username text CONSTRAINT uni_users_username UNIQUE,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS conversations (
+    id text PRIMARY KEY,
+    name text,
+    user_id text,
+    model text,
+    system_prompt text,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id text PRIMARY KEY,
+    conversation_id text CONSTRAINT fk_conversations_messages REFERENCES conversations(id),
+    role text,
+    content text,
+    token_count bigint,
+    created_at timestamptz
+);
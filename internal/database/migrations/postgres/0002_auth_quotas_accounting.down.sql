@@ -0,0 +1,14 @@
+ALTER TABLE messages
+    DROP COLUMN IF EXISTS time_to_first_token_ms,
+    DROP COLUMN IF EXISTS latency_ms,
+    DROP COLUMN IF EXISTS completion_tokens,
+    DROP COLUMN IF EXISTS prompt_tokens,
+    DROP COLUMN IF EXISTS model,
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS api_key_id;
+
+DROP TABLE IF EXISTS rate_limit_hits;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS sessions;
+
+ALTER TABLE users DROP COLUMN IF EXISTS password_hash;
@@ -0,0 +1,3 @@
+CREATE INDEX idx_messages_conversation_created ON messages (conversation_id, created_at);
+CREATE INDEX idx_messages_created_at ON messages (created_at);
+CREATE INDEX idx_conversations_user_id ON conversations (user_id);
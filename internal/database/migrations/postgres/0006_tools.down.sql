@@ -0,0 +1,4 @@
+ALTER TABLE conversations DROP COLUMN tools;
+ALTER TABLE messages
+    DROP COLUMN tool_name,
+    DROP COLUMN tool_calls;
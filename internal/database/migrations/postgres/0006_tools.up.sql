@@ -0,0 +1,4 @@
+ALTER TABLE messages
+    ADD COLUMN tool_calls text,
+    ADD COLUMN tool_name text;
+ALTER TABLE conversations ADD COLUMN tools text;
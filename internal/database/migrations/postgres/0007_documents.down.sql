@@ -0,0 +1,3 @@
+ALTER TABLE messages DROP COLUMN citations;
+DROP TABLE document_chunks;
+DROP TABLE documents;
@@ -0,0 +1,38 @@
+-- Documents uploaded to conversations and their embedded chunks
+CREATE TABLE documents (
+    id text PRIMARY KEY,
+    conversation_id text CONSTRAINT fk_conversations_documents REFERENCES conversations(id),
+    name text,
+    kind text,
+    size bigint,
+    chunks integer,
+    embedding_model text,
+    created_at timestamptz
+);
+CREATE INDEX idx_documents_conversation_id ON documents (conversation_id);
+
+CREATE TABLE document_chunks (
+    id text PRIMARY KEY,
+    document_id text CONSTRAINT fk_documents_chunks REFERENCES documents(id),
+    conversation_id text,
+    position integer,
+    content text,
+    embedding text,
+    created_at timestamptz
+);
+CREATE INDEX idx_document_chunks_document_id ON document_chunks (document_id);
+CREATE INDEX idx_document_chunks_conversation_id ON document_chunks (conversation_id);
+
+-- Searched with pgvector when the extension can be installed; without it
+-- the JSON embeddings are searched by brute force as on SQLite
+DO $$
+BEGIN
+    CREATE EXTENSION IF NOT EXISTS vector;
+    ALTER TABLE document_chunks ADD COLUMN embedding_vector vector;
+EXCEPTION WHEN OTHERS THEN
+    RAISE NOTICE 'pgvector not available, using brute-force search: %', SQLERRM;
+END
+$$;
+
+-- Citations on replies
+ALTER TABLE messages ADD COLUMN citations text;
@@ -0,0 +1,2 @@
+DROP INDEX idx_conversations_import_key;
+ALTER TABLE conversations DROP COLUMN import_key;
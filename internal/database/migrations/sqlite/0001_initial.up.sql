@@ -0,0 +1,31 @@
+-- Schema as originally created by AutoMigrate.
+CREATE TABLE IF NOT EXISTS `users` (
+    `id` text,
+    `username` text,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`id`),
+    CONSTRAINT `uni_users_username` UNIQUE (`username`)
+);
+
+CREATE TABLE IF NOT EXISTS `conversations` (
+    `id` text,
+    `name` text,
+    `user_id` text,
+    `model` text,
+    `system_prompt` text,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `messages` (
+    `id` text,
+    `conversation_id` text,
+    `role` text,
+    `content` text,
+    `token_count` integer,
+    `created_at` datetime,
+    PRIMARY KEY (`id`),
+    CONSTRAINT `fk_conversations_messages` FOREIGN KEY (`conversation_id`) REFERENCES `conversations`(`id`)
+);
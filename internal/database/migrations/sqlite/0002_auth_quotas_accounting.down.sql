@@ -0,0 +1,15 @@
+DROP INDEX IF EXISTS `idx_messages_status`;
+DROP INDEX IF EXISTS `idx_messages_api_key_id`;
+ALTER TABLE `messages` DROP COLUMN `time_to_first_token_ms`;
+ALTER TABLE `messages` DROP COLUMN `latency_ms`;
+ALTER TABLE `messages` DROP COLUMN `completion_tokens`;
+ALTER TABLE `messages` DROP COLUMN `prompt_tokens`;
+ALTER TABLE `messages` DROP COLUMN `model`;
+ALTER TABLE `messages` DROP COLUMN `status`;
+ALTER TABLE `messages` DROP COLUMN `api_key_id`;
+
+DROP TABLE IF EXISTS `rate_limit_hits`;
+DROP TABLE IF EXISTS `api_keys`;
+DROP TABLE IF EXISTS `sessions`;
+
+ALTER TABLE `users` DROP COLUMN `password_hash`;
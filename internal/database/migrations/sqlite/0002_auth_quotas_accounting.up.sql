@@ -0,0 +1,49 @@
+-- Accounts and sessions
+ALTER TABLE `users` ADD COLUMN `password_hash` text;
+
+CREATE TABLE `sessions` (
+    `id` text,
+    `user_id` text,
+    `token_hash` text,
+    `expires_at` datetime,
+    `created_at` datetime,
+    PRIMARY KEY (`id`)
+);
+CREATE UNIQUE INDEX `idx_sessions_token_hash` ON `sessions`(`token_hash`);
+CREATE INDEX `idx_sessions_user_id` ON `sessions`(`user_id`);
+
+-- API keys
+CREATE TABLE `api_keys` (
+    `id` text,
+    `user_id` text,
+    `name` text,
+    `prefix` text,
+    `key_hash` text,
+    `scopes` text,
+    `last_used_at` datetime,
+    `expires_at` datetime,
+    `revoked_at` datetime,
+    `created_at` datetime,
+    PRIMARY KEY (`id`)
+);
+CREATE UNIQUE INDEX `idx_api_keys_key_hash` ON `api_keys`(`key_hash`);
+CREATE INDEX `idx_api_keys_user_id` ON `api_keys`(`user_id`);
+
+-- Rate limiting
+CREATE TABLE `rate_limit_hits` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `key` text,
+    `created_at` datetime
+);
+CREATE INDEX `idx_rate_limit_key_time` ON `rate_limit_hits`(`key`, `created_at`);
+
+-- Per-key attribution, turn status and usage accounting on messages
+ALTER TABLE `messages` ADD COLUMN `api_key_id` text;
+ALTER TABLE `messages` ADD COLUMN `status` text;
+ALTER TABLE `messages` ADD COLUMN `model` text;
+ALTER TABLE `messages` ADD COLUMN `prompt_tokens` integer;
+ALTER TABLE `messages` ADD COLUMN `completion_tokens` integer;
+ALTER TABLE `messages` ADD COLUMN `latency_ms` integer;
+ALTER TABLE `messages` ADD COLUMN `time_to_first_token_ms` integer;
+CREATE INDEX `idx_messages_api_key_id` ON `messages`(`api_key_id`);
+CREATE INDEX `idx_messages_status` ON `messages`(`status`);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS `idx_conversations_user_id`;
+DROP INDEX IF EXISTS `idx_messages_created_at`;
+DROP INDEX IF EXISTS `idx_messages_conversation_created`;
@@ -0,0 +1 @@
+ALTER TABLE `conversations` ADD COLUMN `fallback_models` text;
@@ -0,0 +1,3 @@
+ALTER TABLE `conversations` DROP COLUMN `tools`;
+ALTER TABLE `messages` DROP COLUMN `tool_name`;
+ALTER TABLE `messages` DROP COLUMN `tool_calls`;
@@ -0,0 +1,3 @@
+ALTER TABLE `messages` ADD COLUMN `tool_calls` text;
+ALTER TABLE `messages` ADD COLUMN `tool_name` text;
+ALTER TABLE `conversations` ADD COLUMN `tools` text;
@@ -0,0 +1,32 @@
+-- Documents uploaded to conversations and their embedded chunks
+CREATE TABLE `documents` (
+    `id` text,
+    `conversation_id` text,
+    `name` text,
+    `kind` text,
+    `size` integer,
+    `chunks` integer,
+    `embedding_model` text,
+    `created_at` datetime,
+    PRIMARY KEY (`id`),
+    CONSTRAINT `fk_conversations_documents` FOREIGN KEY (`conversation_id`) REFERENCES `conversations`(`id`)
+);
+CREATE INDEX `idx_documents_conversation_id` ON `documents`(`conversation_id`);
+
+-- Embeddings are JSON arrays, searched by brute force
+CREATE TABLE `document_chunks` (
+    `id` text,
+    `document_id` text,
+    `conversation_id` text,
+    `position` integer,
+    `content` text,
+    `embedding` text,
+    `created_at` datetime,
+    PRIMARY KEY (`id`),
+    CONSTRAINT `fk_documents_chunks` FOREIGN KEY (`document_id`) REFERENCES `documents`(`id`)
+);
+CREATE INDEX `idx_document_chunks_document_id` ON `document_chunks`(`document_id`);
+CREATE INDEX `idx_document_chunks_conversation_id` ON `document_chunks`(`conversation_id`);
+
+-- Citations on replies
+ALTER TABLE `messages` ADD COLUMN `citations` text;
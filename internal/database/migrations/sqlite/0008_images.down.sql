@@ -0,0 +1,2 @@
+ALTER TABLE `messages` DROP COLUMN `images`;
+DROP TABLE `image_blobs`;
@@ -0,0 +1,9 @@
+-- Images sent with messages; the bytes live here when IMAGE_STORE=database
+CREATE TABLE `image_blobs` (
+    `id` text,
+    `data` blob,
+    `created_at` datetime,
+    PRIMARY KEY (`id`)
+);
+
+ALTER TABLE `messages` ADD COLUMN `images` text;
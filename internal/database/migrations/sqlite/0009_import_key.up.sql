@@ -0,0 +1,4 @@
+-- Conversations imported from CLI saves or ChatGPT exports, for
+-- deduplicating re-imports
+ALTER TABLE `conversations` ADD COLUMN `import_key` text;
+CREATE INDEX `idx_conversations_import_key` ON `conversations`(`import_key`);
@@ -0,0 +1,157 @@
+// Package export writes conversations as readable transcripts (Markdown
+// and HTML), as JSON, and as JSONL in the chat fine-tuning format, one
+// conversation per line, so exports can be concatenated into a dataset.
+//
+// It only depends on the standard library so both the server and the CLI
+// can export through it:
+//
+//	t := export.Transcript{Title: "Debugging", Messages: messages}
+//	err := export.Write(w, export.Markdown, t)
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Formats.
+const (
+	Markdown = "md"
+	HTML     = "html"
+	JSON     = "json"
+	JSONL    = "jsonl"
+)
+
+// Formats lists the supported formats.
+var Formats = []string{Markdown, HTML, JSON, JSONL}
+
+// ErrUnknownFormat is returned for a format not in Formats.
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Transcript is a conversation to export.
+type Transcript struct {
+	ID       string    `json:"id,omitempty"`
+	Title    string    `json:"title"`
+	Model    string    `json:"model,omitempty"`
+	Created  time.Time `json:"created_at"`
+	Messages []Message `json:"messages"`
+}
+
+// Message is one message of a transcript.
+type Message struct {
+	Role    string    `json:"role"` // system, user, assistant or tool
+	Content string    `json:"content"`
+	Time    time.Time `json:"time"`
+	Model   string    `json:"model,omitempty"` // model that wrote an assistant message
+
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	ToolName  string     `json:"tool_name,omitempty"`
+
+	// Attachments names the files and images sent with a user message
+	Attachments []string `json:"attachments,omitempty"`
+}
+
+// ToolCall is a tool the model called from an assistant message.
+type ToolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// Write writes t to w in format.
+func Write(w io.Writer, format string, t Transcript) error {
+	switch format {
+	case Markdown:
+		return writeMarkdown(w, t)
+	case HTML:
+		return writeHTML(w, t)
+	case JSON:
+		return writeJSON(w, t)
+	case JSONL:
+		return writeJSONL(w, t)
+	default:
+		return fmt.Errorf("%w %q, use one of %s", ErrUnknownFormat, format, strings.Join(Formats, ", "))
+	}
+}
+
+// ContentType is the media type of format.
+func ContentType(format string) string {
+	switch format {
+	case Markdown:
+		return "text/markdown; charset=utf-8"
+	case HTML:
+		return "text/html; charset=utf-8"
+	case JSON:
+		return "application/json"
+	case JSONL:
+		return "application/jsonl"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// Filename suggests a file name for t exported in format, built from its
+// title, or ID when the title has no usable characters.
+func Filename(t Transcript, format string) string {
+	var name strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(t.Title) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			name.WriteRune(r)
+			dash = false
+		case !dash && name.Len() > 0:
+			name.WriteByte('-')
+			dash = true
+		}
+	}
+	base := strings.TrimSuffix(name.String(), "-")
+	if base == "" {
+		base = "conversation"
+		if t.ID != "" {
+			base += "-" + t.ID
+		}
+	}
+	return base + "." + format
+}
+
+// title is the transcript's title, or a stand-in for untitled ones.
+func (t Transcript) title() string {
+	if strings.TrimSpace(t.Title) == "" {
+		return "Untitled conversation"
+	}
+	return t.Title
+}
+
+// heading is the label of a message: its role, with the model for
+// assistant messages and the tool for tool messages.
+func (m Message) heading() string {
+	var heading string
+	switch m.Role {
+	case "tool":
+		heading = "Tool"
+		if m.ToolName != "" {
+			heading += ": " + m.ToolName
+		}
+	case "assistant":
+		heading = "Assistant"
+		if m.Model != "" {
+			heading += " (" + m.Model + ")"
+		}
+	default:
+		heading = strings.ToUpper(m.Role[:min(1, len(m.Role))]) + m.Role[min(1, len(m.Role)):]
+	}
+	return heading
+}
+
+// timestamp formats t for transcripts, or returns "" for the zero time.
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05 MST")
+}
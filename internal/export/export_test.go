@@ -0,0 +1,109 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func transcript() Transcript {
+	at := time.Date(2026, 5, 1, 9, 30, 0, 0, time.UTC)
+	return Transcript{
+		ID:      "c1",
+		Title:   "Go <help>",
+		Model:   "llama3.1:8b",
+		Created: at,
+		Messages: []Message{
+			{Role: "system", Content: "Be brief.", Time: at},
+			{Role: "user", Content: "Reverse a slice?", Time: at, Attachments: []string{"main.go"}},
+			{Role: "assistant", Time: at, Model: "llama3.1:8b", ToolCalls: []ToolCall{{Name: "calculator", Arguments: json.RawMessage(`{"expression":"1+1"}`)}}},
+			{Role: "tool", ToolName: "calculator", Content: "2", Time: at},
+			{Role: "assistant", Content: "Use `slices.Reverse`:\n\n```go\nslices.Reverse(s) // a < b\n```\nDone.", Time: at, Model: "llama3.1:8b"},
+			{Role: "user", Content: "And a map?\n```\nunclosed", Time: at},
+		},
+	}
+}
+
+func export(t *testing.T, format string) string {
+	t.Helper()
+	var b bytes.Buffer
+	if err := Write(&b, format, transcript()); err != nil {
+		t.Fatalf("Write %s: %v", format, err)
+	}
+	return b.String()
+}
+
+func TestMarkdown(t *testing.T) {
+	md := export(t, Markdown)
+	for _, want := range []string{
+		"# Go <help>\n",
+		"- **Model:** llama3.1:8b\n",
+		"### User · 2026-05-01 09:30:00 UTC\n\n_Attachments: main.go_\n\nReverse a slice?\n",
+		"Called `calculator`:\n\n```json\n{\"expression\":\"1+1\"}\n```\n",
+		"### Tool: calculator · 2026-05-01 09:30:00 UTC\n\n```\n2\n```\n",
+		"### Assistant (llama3.1:8b)",
+		"```go\nslices.Reverse(s) // a < b\n```\nDone.\n",
+		"And a map?\n```\nunclosed\n```\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown lacks %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	page := export(t, HTML)
+	for _, want := range []string{
+		"<title>Go &lt;help&gt;</title>",
+		`<section class="message assistant">`,
+		"<p>Use <code>slices.Reverse</code>:</p>",
+		`<pre><code class="language-go">slices.Reverse(s) // a &lt; b</code></pre>`,
+		"<pre><code>unclosed</code></pre>",
+		"Attachments: main.go",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("html lacks %q:\n%s", want, page)
+		}
+	}
+	if strings.Contains(page, "<help>") {
+		t.Error("title not escaped")
+	}
+}
+
+func TestJSONAndJSONL(t *testing.T) {
+	var decoded Transcript
+	if err := json.Unmarshal([]byte(export(t, JSON)), &decoded); err != nil || len(decoded.Messages) != 6 || decoded.Messages[2].ToolCalls[0].Name != "calculator" {
+		t.Errorf("json round trip = %+v, %v", decoded, err)
+	}
+
+	line := export(t, JSONL)
+	if strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "\n") {
+		t.Errorf("jsonl is not one line: %q", line)
+	}
+	var example struct {
+		Messages []map[string]string `json:"messages"`
+	}
+	json.Unmarshal([]byte(line), &example)
+	roles := []string{}
+	for _, m := range example.Messages {
+		roles = append(roles, m["role"])
+	}
+	if strings.Join(roles, ",") != "system,user,assistant,user" || len(example.Messages[0]) != 2 {
+		t.Errorf("fine-tuning messages = %v", example.Messages)
+	}
+}
+
+func TestWriteUnknownFormatAndFilename(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, "pdf", transcript()); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Write pdf: %v", err)
+	}
+	if got := Filename(transcript(), Markdown); got != "go-help.md" {
+		t.Errorf("Filename = %q", got)
+	}
+	if got := Filename(Transcript{ID: "c1", Title: "!!"}, JSONL); got != "conversation-c1.jsonl" {
+		t.Errorf("Filename without a usable title = %q", got)
+	}
+}
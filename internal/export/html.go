@@ -0,0 +1,118 @@
+package export
+
+import (
+	"html"
+	"html/template"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var page = template.Must(template.New("transcript").Funcs(template.FuncMap{
+	"content":   renderContent,
+	"timestamp": timestamp,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<title>{{ .Title }}</title>
+<style>
+body { font-family: Arial, sans-serif; max-width: 800px; margin: 0 auto; padding: 20px; background: #f5f5f5; color: #222; }
+header, .message { background: white; border-radius: 8px; padding: 12px 20px; margin-bottom: 12px; box-shadow: 0 2px 4px rgba(0,0,0,0.1); }
+.meta, time { color: #666; font-size: 0.85em; }
+.role { font-weight: bold; margin-right: 8px; }
+.user .role { color: #007bff; }
+.assistant .role { color: #28a745; }
+.system, .tool { background: #f8f9fa; }
+pre { background: #272822; color: #f8f8f2; padding: 10px; border-radius: 4px; overflow-x: auto; }
+code { font-family: monospace; }
+p code { background: #eee; padding: 1px 4px; border-radius: 3px; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{ .Title }}</h1>
+<p class="meta">{{ with .Model }}Model: {{ . }} · {{ end }}{{ with timestamp .Created }}Created: {{ . }} · {{ end }}{{ len .Messages }} messages</p>
+</header>
+{{ range .Messages }}<section class="message {{ .Role }}">
+<p><span class="role">{{ .Heading }}</span>{{ with timestamp .Time }}<time>{{ . }}</time>{{ end }}</p>
+{{ with .Attachments }}<p class="meta">Attachments: {{ range $i, $a := . }}{{ if $i }}, {{ end }}{{ $a }}{{ end }}</p>
+{{ end }}{{ if eq .Role "tool" }}<pre><code>{{ .Content }}</code></pre>{{ else }}{{ content .Content }}{{ end }}
+{{ range .ToolCalls }}<p>Called <code>{{ .Name }}</code>:</p>
+<pre><code class="language-json">{{ printf "%s" .Arguments }}</code></pre>
+{{ end }}</section>
+{{ end }}</body>
+</html>
+`))
+
+// htmlMessage adds the heading, which templates cannot compute.
+type htmlMessage struct {
+	Message
+	Heading string
+}
+
+// writeHTML writes a standalone page with the messages' Markdown code
+// blocks and inline code kept as code. Everything else is shown as plain
+// paragraphs.
+func writeHTML(w io.Writer, t Transcript) error {
+	messages := make([]htmlMessage, len(t.Messages))
+	for i, m := range t.Messages {
+		messages[i] = htmlMessage{Message: m, Heading: m.heading()}
+	}
+	return page.Execute(w, struct {
+		Transcript
+		Title    string
+		Messages []htmlMessage
+	}{t, t.title(), messages})
+}
+
+var inlineCode = regexp.MustCompile("`([^`\n]+)`")
+
+// renderContent turns message text into HTML: fenced code blocks become
+// <pre><code> elements, and the text between them paragraphs.
+func renderContent(content string) template.HTML {
+	var out, text, code strings.Builder
+	fence, lang := "", ""
+
+	flushText := func() {
+		for _, paragraph := range strings.Split(text.String(), "\n\n") {
+			if paragraph = strings.Trim(paragraph, "\n"); strings.TrimSpace(paragraph) == "" {
+				continue
+			}
+			escaped := inlineCode.ReplaceAllString(html.EscapeString(paragraph), "<code>$1</code>")
+			out.WriteString("<p>" + strings.ReplaceAll(escaped, "\n", "<br>\n") + "</p>\n")
+		}
+		text.Reset()
+	}
+	flushCode := func() {
+		out.WriteString("<pre><code")
+		if lang != "" {
+			out.WriteString(` class="language-` + html.EscapeString(lang) + `"`)
+		}
+		out.WriteString(">" + html.EscapeString(strings.TrimSuffix(code.String(), "\n")) + "</code></pre>\n")
+		code.Reset()
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		marker := fenceMarker(trimmed)
+		switch {
+		case fence == "" && marker != "" && len(line)-len(trimmed) <= 3:
+			flushText()
+			fence = marker
+			lang, _, _ = strings.Cut(strings.TrimSpace(trimmed[len(marker):]), " ")
+		case fence != "" && strings.HasPrefix(marker, fence) && strings.TrimSpace(trimmed[len(marker):]) == "":
+			flushCode()
+			fence = ""
+		case fence != "":
+			code.WriteString(line + "\n")
+		default:
+			text.WriteString(line + "\n")
+		}
+	}
+	if fence != "" {
+		flushCode()
+	}
+	flushText()
+	return template.HTML(out.String())
+}
@@ -0,0 +1,38 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// writeJSON writes the whole transcript, metadata included.
+func writeJSON(w io.Writer, t Transcript) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(t)
+}
+
+// fineTuningMessage is a message in the chat fine-tuning format.
+type fineTuningMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// writeJSONL writes the conversation as a single line of
+// {"messages": [{"role": ..., "content": ...}, ...]}, the format chat
+// fine-tuning expects. Tool calls and results are left out, as is any
+// message without text, so each example is plain dialogue.
+func writeJSONL(w io.Writer, t Transcript) error {
+	messages := make([]fineTuningMessage, 0, len(t.Messages))
+	for _, m := range t.Messages {
+		if m.Role == "tool" || strings.TrimSpace(m.Content) == "" {
+			continue
+		}
+		messages = append(messages, fineTuningMessage{Role: m.Role, Content: m.Content})
+	}
+	// Encode ends the line
+	return json.NewEncoder(w).Encode(struct {
+		Messages []fineTuningMessage `json:"messages"`
+	}{messages})
+}
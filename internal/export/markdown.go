@@ -0,0 +1,98 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// writeMarkdown writes a heading per message followed by its content as
+// is, so code blocks and other Markdown in replies render unchanged.
+func writeMarkdown(w io.Writer, t Transcript) error {
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintf(b, "# %s\n\n", t.title())
+	if t.Model != "" {
+		fmt.Fprintf(b, "- **Model:** %s\n", t.Model)
+	}
+	if created := timestamp(t.Created); created != "" {
+		fmt.Fprintf(b, "- **Created:** %s\n", created)
+	}
+	fmt.Fprintf(b, "- **Messages:** %d\n", len(t.Messages))
+
+	for _, m := range t.Messages {
+		b.WriteString("\n---\n\n### " + m.heading())
+		if at := timestamp(m.Time); at != "" {
+			b.WriteString(" · " + at)
+		}
+		b.WriteString("\n\n")
+
+		var blocks []string
+		if len(m.Attachments) > 0 {
+			blocks = append(blocks, fmt.Sprintf("_Attachments: %s_", strings.Join(m.Attachments, ", ")))
+		}
+		switch {
+		case m.Role == "tool":
+			blocks = append(blocks, fenced("", m.Content))
+		case strings.TrimSpace(m.Content) != "":
+			blocks = append(blocks, closeFences(strings.TrimRight(m.Content, "\n")))
+		}
+		for _, call := range m.ToolCalls {
+			blocks = append(blocks, fmt.Sprintf("Called `%s`:\n\n%s", call.Name, fenced("json", string(call.Arguments))))
+		}
+		b.WriteString(strings.Join(blocks, "\n\n") + "\n")
+	}
+	return b.Flush()
+}
+
+// fenced formats content as a fenced code block, with a fence longer than
+// any run of backticks inside it.
+func fenced(lang, content string) string {
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	return fence + lang + "\n" + strings.TrimRight(content, "\n") + "\n" + fence
+}
+
+// closeFences closes a code block left open at the end of content, as a
+// reply cut off mid-block would, so it does not swallow the rest of the
+// transcript.
+func closeFences(content string) string {
+	open := ""
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if len(line)-len(trimmed) > 3 {
+			continue
+		}
+		marker := fenceMarker(trimmed)
+		switch {
+		case marker == "":
+		case open == "":
+			open = marker
+		case strings.HasPrefix(marker, open) && strings.TrimSpace(trimmed[len(marker):]) == "":
+			open = ""
+		}
+	}
+	if open != "" {
+		return content + "\n" + open
+	}
+	return content
+}
+
+// fenceMarker returns the run of three or more backticks or tildes that
+// opens line, if any.
+func fenceMarker(line string) string {
+	if line == "" || (line[0] != '`' && line[0] != '~') {
+		return ""
+	}
+	n := 0
+	for n < len(line) && line[n] == line[0] {
+		n++
+	}
+	if n < 3 {
+		return ""
+	}
+	return line[:n]
+}
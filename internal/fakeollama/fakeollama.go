@@ -0,0 +1,549 @@
+// Package fakeollama is a stand-in for the parts of the Ollama API used by
+// the server and the CLI: /api/chat (streaming and batch), /api/tags,
+// /api/show, /api/embeddings and /api/embed. Replies echo the last message unless a
+// script is queued, and latency and failures can be injected.
+//
+// It only depends on the standard library so both the server and the CLI
+// can use it in tests:
+//
+//	fake := fakeollama.New()
+//	srv := httptest.NewServer(fake)
+//	defer srv.Close()
+//	t.Setenv("OLLAMA_HOST", srv.URL)
+package fakeollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultModel is the model served when none are configured.
+const DefaultModel = "llama3.1:8b"
+
+// DefaultDimensions is the length of the embeddings returned.
+const DefaultDimensions = 64
+
+// Message is a chat message as sent to /api/chat.
+type Message struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	Images    []string   `json:"images,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	ToolName  string     `json:"tool_name,omitempty"`
+}
+
+// ToolCall is a call to one of the tools offered in a request.
+type ToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// Call builds a ToolCall.
+func Call(name, arguments string) ToolCall {
+	var call ToolCall
+	call.Function.Name = name
+	call.Function.Arguments = json.RawMessage(arguments)
+	return call
+}
+
+// ChatRequest is a request received on /api/chat.
+type ChatRequest struct {
+	Model    string            `json:"model"`
+	Messages []Message         `json:"messages"`
+	Tools    []json.RawMessage `json:"tools,omitempty"`
+	Stream   *bool             `json:"stream,omitempty"`
+}
+
+// streaming reports whether the client asked for a stream. Like Ollama,
+// streaming is the default.
+func (r ChatRequest) streaming() bool {
+	return r.Stream == nil || *r.Stream
+}
+
+type chatResponse struct {
+	Model           string  `json:"model"`
+	CreatedAt       string  `json:"created_at"`
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	DoneReason      string  `json:"done_reason,omitempty"`
+	PromptEvalCount int     `json:"prompt_eval_count,omitempty"`
+	EvalCount       int     `json:"eval_count,omitempty"`
+	TotalDuration   int64   `json:"total_duration,omitempty"`
+}
+
+// Reply is a scripted response to one chat request.
+type Reply struct {
+	// Content is streamed back word by word, or sent whole in batch mode.
+	Content string
+	// Status, when set, fails the request with this HTTP status instead.
+	Status int
+	// Error is the error message sent with Status. Without a Status it
+	// is sent in the stream after Content, as Ollama reports a model that
+	// fails part way through a reply.
+	Error string
+	// Cut ends the stream after Content without the final chunk, as a
+	// model server that dies part way through a reply does.
+	Cut bool
+	// ToolCalls are returned with the reply, as a model does when it
+	// wants to use the tools offered in the request.
+	ToolCalls []ToolCall
+}
+
+// Server implements http.Handler. Configure it before serving or through
+// its methods, which are safe to call while requests are in flight.
+type Server struct {
+	mu         sync.Mutex
+	models     []string
+	latency    time.Duration
+	tokenDelay time.Duration
+	failRate   float64
+	dimensions int
+	vision     []string
+	script     []Reply
+	requests   []ChatRequest
+	mux        *http.ServeMux
+}
+
+// New returns a server that knows DefaultModel and echoes every message.
+func New() *Server {
+	s := &Server{
+		models:     []string{DefaultModel},
+		dimensions: DefaultDimensions,
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("POST /api/chat", s.handleChat)
+	s.mux.HandleFunc("GET /api/tags", s.handleTags)
+	s.mux.HandleFunc("POST /api/show", s.handleShow)
+	s.mux.HandleFunc("POST /api/embeddings", s.handleEmbeddings)
+	s.mux.HandleFunc("POST /api/embed", s.handleEmbed)
+	s.mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		fmt.Fprint(w, "Ollama is running")
+	})
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// SetModels replaces the models the server knows. Chat and embedding
+// requests for any other model fail with 404, as they do on Ollama.
+func (s *Server) SetModels(models ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.models = models
+}
+
+// SetVision marks models as able to read images. /api/show reports the
+// vision capability for them only.
+func (s *Server) SetVision(models ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.vision = models
+}
+
+// SetLatency delays the start of every chat and embedding response.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// SetTokenDelay sets the pause between streamed chunks.
+func (s *Server) SetTokenDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenDelay = d
+}
+
+// SetFailRate makes that fraction of chat requests, chosen at random,
+// fail with 500. Scripted replies take precedence.
+func (s *Server) SetFailRate(rate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failRate = rate
+}
+
+// SetDimensions sets the length of the embeddings returned.
+func (s *Server) SetDimensions(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dimensions = n
+}
+
+// Script queues replies for the next chat requests, in order. Once the
+// script runs out the server goes back to echoing.
+func (s *Server) Script(replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.script = append(s.script, replies...)
+}
+
+// Respond queues plain text replies.
+func (s *Server) Respond(contents ...string) {
+	for _, content := range contents {
+		s.Script(Reply{Content: content})
+	}
+}
+
+// FailNext makes the next n chat requests fail with status.
+func (s *Server) FailNext(n, status int) {
+	for i := 0; i < n; i++ {
+		s.Script(Reply{Status: status, Error: "injected failure"})
+	}
+}
+
+// Requests returns the chat requests received so far.
+func (s *Server) Requests() []ChatRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ChatRequest(nil), s.requests...)
+}
+
+// LastRequest returns the most recent chat request, if any.
+func (s *Server) LastRequest() (ChatRequest, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) == 0 {
+		return ChatRequest{}, false
+	}
+	return s.requests[len(s.requests)-1], true
+}
+
+func (s *Server) hasModel(model string) bool {
+	for _, m := range s.models {
+		if m == model || strings.TrimSuffix(m, ":latest") == model {
+			return true
+		}
+	}
+	return false
+}
+
+// nextReply records req and decides how to answer it.
+func (s *Server) nextReply(req ChatRequest) (Reply, time.Duration, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, req)
+
+	if !s.hasModel(req.Model) {
+		return Reply{Status: http.StatusNotFound, Error: fmt.Sprintf("model %q not found, try pulling it first", req.Model)}, 0, 0
+	}
+
+	if len(s.script) > 0 {
+		reply := s.script[0]
+		s.script = s.script[1:]
+		return reply, s.latency, s.tokenDelay
+	}
+
+	if s.failRate > 0 && rand.Float64() < s.failRate {
+		return Reply{Status: http.StatusInternalServerError, Error: "injected failure"}, s.latency, s.tokenDelay
+	}
+
+	var last string
+	if len(req.Messages) > 0 {
+		last = req.Messages[len(req.Messages)-1].Content
+	}
+	return Reply{Content: "echo: " + last}, s.latency, s.tokenDelay
+}
+
+func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
+	var req ChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+
+	start := time.Now()
+	reply, latency, tokenDelay := s.nextReply(req)
+	if !sleep(r.Context(), latency) {
+		return
+	}
+
+	if reply.Status != 0 && reply.Status != http.StatusOK {
+		writeError(w, reply.Status, reply.Error)
+		return
+	}
+	if !req.streaming() && (reply.Error != "" || reply.Cut) {
+		writeError(w, http.StatusInternalServerError, reply.Error)
+		return
+	}
+
+	promptTokens := 0
+	for _, m := range req.Messages {
+		promptTokens += countTokens(m.Content)
+	}
+
+	final := chatResponse{
+		Model:           req.Model,
+		Message:         Message{Role: "assistant"},
+		Done:            true,
+		DoneReason:      "stop",
+		PromptEvalCount: promptTokens,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !req.streaming() {
+		final.CreatedAt = now()
+		final.Message.Content = reply.Content
+		final.Message.ToolCalls = reply.ToolCalls
+		final.EvalCount = countTokens(reply.Content)
+		final.TotalDuration = time.Since(start).Nanoseconds()
+		json.NewEncoder(w).Encode(final)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	for i, chunk := range splitTokens(reply.Content) {
+		if i > 0 && !sleep(r.Context(), tokenDelay) {
+			return
+		}
+		enc.Encode(chatResponse{
+			Model:     req.Model,
+			CreatedAt: now(),
+			Message:   Message{Role: "assistant", Content: chunk},
+		})
+		if flusher != nil {
+			flusher.Flush()
+		}
+		final.EvalCount++
+	}
+
+	if reply.Error != "" {
+		enc.Encode(map[string]string{"error": reply.Error})
+		return
+	}
+	if reply.Cut {
+		return
+	}
+
+	// like Ollama, tool calls come in a chunk of their own
+	if len(reply.ToolCalls) > 0 {
+		enc.Encode(chatResponse{
+			Model:     req.Model,
+			CreatedAt: now(),
+			Message:   Message{Role: "assistant", ToolCalls: reply.ToolCalls},
+		})
+	}
+
+	final.CreatedAt = now()
+	final.TotalDuration = time.Since(start).Nanoseconds()
+	enc.Encode(final)
+}
+
+func (s *Server) handleTags(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	models := append([]string(nil), s.models...)
+	s.mu.Unlock()
+
+	type tag struct {
+		Name       string `json:"name"`
+		Model      string `json:"model"`
+		ModifiedAt string `json:"modified_at"`
+		Size       int64  `json:"size"`
+	}
+	tags := make([]tag, len(models))
+	for i, m := range models {
+		tags[i] = tag{Name: m, Model: m, ModifiedAt: now()}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"models": tags})
+}
+
+// handleShow describes a model. Only the capabilities are filled in.
+func (s *Server) handleShow(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model string `json:"model"`
+		Name  string `json:"name"` // older clients
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	if req.Model == "" {
+		req.Model = req.Name
+	}
+
+	s.mu.Lock()
+	known := s.hasModel(req.Model)
+	capabilities := []string{"completion"}
+	for _, m := range s.vision {
+		if m == req.Model || strings.TrimSuffix(m, ":latest") == req.Model {
+			capabilities = append(capabilities, "vision")
+		}
+	}
+	s.mu.Unlock()
+
+	if !known {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("model '%s' not found", req.Model))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"details":      map[string]any{"format": "gguf"},
+		"capabilities": capabilities,
+		"modified_at":  now(),
+	})
+}
+
+// handleEmbeddings serves the legacy single-prompt embeddings endpoint.
+func (s *Server) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model  string `json:"model"`
+		Prompt string `json:"prompt"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+
+	dimensions, ok := s.prepareEmbedding(w, r, req.Model)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"embedding": Embed(req.Prompt, dimensions)})
+}
+
+// handleEmbed serves the batch embeddings endpoint, whose input is a
+// string or a list of strings.
+func (s *Server) handleEmbed(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model string          `json:"model"`
+		Input json.RawMessage `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+
+	var inputs []string
+	if err := json.Unmarshal(req.Input, &inputs); err != nil {
+		var single string
+		if err := json.Unmarshal(req.Input, &single); err != nil {
+			writeError(w, http.StatusBadRequest, "input must be a string or a list of strings")
+			return
+		}
+		inputs = []string{single}
+	}
+
+	dimensions, ok := s.prepareEmbedding(w, r, req.Model)
+	if !ok {
+		return
+	}
+
+	embeddings := make([][]float64, len(inputs))
+	for i, input := range inputs {
+		embeddings[i] = Embed(input, dimensions)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"model": req.Model, "embeddings": embeddings})
+}
+
+// prepareEmbedding checks the model and applies the configured latency.
+func (s *Server) prepareEmbedding(w http.ResponseWriter, r *http.Request, model string) (int, bool) {
+	s.mu.Lock()
+	known := s.hasModel(model)
+	latency, dimensions := s.latency, s.dimensions
+	s.mu.Unlock()
+
+	if !known {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("model %q not found, try pulling it first", model))
+		return 0, false
+	}
+	return dimensions, sleep(r.Context(), latency)
+}
+
+// Embed returns a deterministic, normalized bag-of-words embedding: texts
+// sharing words have a higher cosine similarity, which is enough to
+// exercise retrieval without a real model.
+func Embed(text string, dimensions int) []float64 {
+	vector := make([]float64, dimensions)
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		word = strings.Trim(word, ".,;:!?\"'()[]{}")
+		if word == "" {
+			continue
+		}
+		h := fnv.New32a()
+		h.Write([]byte(word))
+		vector[h.Sum32()%uint32(dimensions)]++
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += v * v
+	}
+	if norm == 0 {
+		return vector
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] /= norm
+	}
+	return vector
+}
+
+// splitTokens splits content into word-sized chunks that keep their
+// trailing whitespace, so joining them gives back content.
+func splitTokens(content string) []string {
+	var chunks []string
+	start := 0
+	for i := 1; i < len(content); i++ {
+		if content[i-1] == ' ' && content[i] != ' ' {
+			chunks = append(chunks, content[start:i])
+			start = i
+		}
+	}
+	if start < len(content) {
+		chunks = append(chunks, content[start:])
+	}
+	return chunks
+}
+
+func countTokens(text string) int {
+	return len(strings.Fields(text))
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,215 @@
+package fakeollama
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func post(t *testing.T, url string, body any) *http.Response {
+	t.Helper()
+	payload, _ := json.Marshal(body)
+	resp, err := http.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("POST %s: %v", url, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func chat(content string, stream bool) map[string]any {
+	return map[string]any{
+		"model":    DefaultModel,
+		"stream":   stream,
+		"messages": []Message{{Role: "user", Content: content}},
+	}
+}
+
+func TestChatStreaming(t *testing.T) {
+	srv := httptest.NewServer(New())
+	defer srv.Close()
+
+	resp := post(t, srv.URL+"/api/chat", chat("hello there", true))
+	dec := json.NewDecoder(resp.Body)
+
+	var content strings.Builder
+	var chunks int
+	for {
+		var chunk chatResponse
+		if err := dec.Decode(&chunk); err != nil {
+			t.Fatalf("decode chunk: %v", err)
+		}
+		content.WriteString(chunk.Message.Content)
+		if chunk.Done {
+			if chunk.EvalCount != chunks || chunk.PromptEvalCount != 2 {
+				t.Errorf("final counts: eval %d over %d chunks, prompt %d", chunk.EvalCount, chunks, chunk.PromptEvalCount)
+			}
+			break
+		}
+		chunks++
+	}
+
+	if content.String() != "echo: hello there" {
+		t.Errorf("content = %q", content.String())
+	}
+	if chunks != 3 {
+		t.Errorf("expected 3 chunks, got %d", chunks)
+	}
+}
+
+func TestChatBatchScriptAndFailures(t *testing.T) {
+	fake := New()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	fake.FailNext(1, http.StatusServiceUnavailable)
+	fake.Respond("scripted")
+
+	if resp := post(t, srv.URL+"/api/chat", chat("a", false)); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("injected failure: status %d", resp.StatusCode)
+	}
+
+	for _, want := range []string{"scripted", "echo: c"} {
+		var reply chatResponse
+		json.NewDecoder(post(t, srv.URL+"/api/chat", chat(strings.TrimPrefix(want, "echo: "), false)).Body).Decode(&reply)
+		if reply.Message.Content != want || !reply.Done {
+			t.Errorf("reply = %+v, want %q", reply, want)
+		}
+	}
+
+	if n := len(fake.Requests()); n != 3 {
+		t.Errorf("recorded %d requests, want 3", n)
+	}
+
+	body := chat("x", false)
+	body["model"] = "unknown"
+	if resp := post(t, srv.URL+"/api/chat", body); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown model: status %d", resp.StatusCode)
+	}
+}
+
+func TestChatStreamFailures(t *testing.T) {
+	fake := New()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	fake.Script(Reply{Content: "half a", Error: "out of memory"}, Reply{Content: "half a", Cut: true})
+	for _, want := range []string{"out of memory", ""} {
+		var lines []map[string]any
+		dec := json.NewDecoder(post(t, srv.URL+"/api/chat", chat("a", true)).Body)
+		for {
+			var line map[string]any
+			if dec.Decode(&line) != nil {
+				break
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) == 0 || lines[len(lines)-1]["done"] == true {
+			t.Fatalf("stream %v ended with its done chunk", lines)
+		}
+		if got, _ := lines[len(lines)-1]["error"].(string); got != want {
+			t.Errorf("stream ended with error %q, want %q", got, want)
+		}
+	}
+}
+
+func TestLatencyRespectsCancellation(t *testing.T) {
+	fake := New()
+	fake.SetLatency(time.Second)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	payload, _ := json.Marshal(chat("slow", false))
+	start := time.Now()
+	if _, err := client.Post(srv.URL+"/api/chat", "application/json", bytes.NewReader(payload)); err == nil {
+		t.Fatal("expected the client to time out")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("latency was not applied as a delay the client can cut short")
+	}
+}
+
+func TestTags(t *testing.T) {
+	fake := New()
+	fake.SetModels("a:latest", "b")
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/tags")
+	if err != nil {
+		t.Fatalf("GET /api/tags: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var tags struct {
+		Models []struct{ Name string } `json:"models"`
+	}
+	json.NewDecoder(resp.Body).Decode(&tags)
+	if len(tags.Models) != 2 || tags.Models[0].Name != "a:latest" {
+		t.Errorf("tags = %+v", tags)
+	}
+}
+
+func TestShow(t *testing.T) {
+	fake := New()
+	fake.SetModels("llava:latest", DefaultModel)
+	fake.SetVision("llava:latest")
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	capabilities := func(model string) []string {
+		var show struct {
+			Capabilities []string `json:"capabilities"`
+		}
+		json.NewDecoder(post(t, srv.URL+"/api/show", map[string]string{"model": model}).Body).Decode(&show)
+		return show.Capabilities
+	}
+	if got := capabilities("llava"); len(got) != 2 || got[1] != "vision" {
+		t.Errorf("llava capabilities = %v", got)
+	}
+	if got := capabilities(DefaultModel); len(got) != 1 {
+		t.Errorf("%s capabilities = %v", DefaultModel, got)
+	}
+	if resp := post(t, srv.URL+"/api/show", map[string]string{"model": "missing"}); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown model: status %d", resp.StatusCode)
+	}
+}
+
+func TestEmbeddings(t *testing.T) {
+	srv := httptest.NewServer(New())
+	defer srv.Close()
+
+	var single struct{ Embedding []float64 }
+	json.NewDecoder(post(t, srv.URL+"/api/embeddings", map[string]string{
+		"model": DefaultModel, "prompt": "the cat sat",
+	}).Body).Decode(&single)
+	if len(single.Embedding) != DefaultDimensions {
+		t.Fatalf("embedding has %d dimensions", len(single.Embedding))
+	}
+
+	var batch struct{ Embeddings [][]float64 }
+	json.NewDecoder(post(t, srv.URL+"/api/embed", map[string]any{
+		"model": DefaultModel, "input": []string{"the cat sat", "a cat sat down", "quarterly revenue report"},
+	}).Body).Decode(&batch)
+	if len(batch.Embeddings) != 3 {
+		t.Fatalf("got %d embeddings", len(batch.Embeddings))
+	}
+
+	dot := func(a, b []float64) (sum float64) {
+		for i := range a {
+			sum += a[i] * b[i]
+		}
+		return sum
+	}
+	if dot(single.Embedding, batch.Embeddings[0]) < 0.999 {
+		t.Error("embeddings are not deterministic")
+	}
+	if dot(batch.Embeddings[0], batch.Embeddings[1]) <= dot(batch.Embeddings[0], batch.Embeddings[2]) {
+		t.Error("related texts should be closer than unrelated ones")
+	}
+}
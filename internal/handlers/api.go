@@ -1,254 +1,463 @@
 package handlers
 
 import (
-	"ai-chatbot-web/internal/database"
+	"ai-chatbot-web/api"
+	"ai-chatbot-web/internal/blobs"
+	"ai-chatbot-web/internal/middleware"
 	"ai-chatbot-web/internal/models"
+	"ai-chatbot-web/internal/rag"
 	"ai-chatbot-web/internal/services"
+	"ai-chatbot-web/internal/store"
+	"ai-chatbot-web/internal/tools"
+	"context"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	 "github.com/gin-gonic/gin"
+	 "github.com/gin-gonic/gin/binding"
 )
 
 type APIHandler struct {
-	aiClient *services.AIClient
-	db       *database.Database
+	aiClient      services.ChatProvider
+	conversations store.ConversationStore
+	messages      store.MessageStore
+	generations   *services.GenerationTracker
+	tools         *tools.Registry
+	documents     *rag.Index
+	images        blobs.Store
 }
 
 // Handler interface defines methods for handling API requests.
-func NewAPIHandler(db *database.Database, aiClient *services.AIClient) *APIHandler {
+func NewAPIHandler(conversations store.ConversationStore, messages store.MessageStore, aiClient services.ChatProvider, generations *services.GenerationTracker, registry *tools.Registry, documents *rag.Index, images blobs.Store) *APIHandler {
 	return &APIHandler{
-		db: 	 db,
-		aiClient: aiClient,
+		conversations: conversations,
+		messages:      messages,
+		aiClient:      aiClient,
+		generations:   generations,
+		tools:         registry,
+		documents:     documents,
+		images:        images,
 	}
 }
 
 // HealthCheck handles the health check endpoint.
 func (h *APIHandler) HealthCheck(c *gin.Context) {
-    if err := h.db.Ping(); err != nil {
-        c.JSON(http.StatusServiceUnavailable, gin.H{
-			"status":  "error",
-			"message": "Database connection failed",
-		})
+    if err := h.ping(c.Request.Context()); err != nil {
+        respondError(c, http.StatusServiceUnavailable, "Database connection failed")
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"status":  "success",
-		"message": "API is healthy",
-		"model":   h.aiClient.GetModel(),
-	})
+	response := api.HealthResponse{
+		Status:  "success",
+		Message: "API is healthy",
+		Model:   h.aiClient.GetModel(),
+	}
+	if r, ok := h.aiClient.(services.BackendReporter); ok {
+		for _, backend := range r.Backends() {
+			response.Backends = append(response.Backends, api.BackendStatus(backend))
+		}
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-// GetConversations retrieves conversations for a given user.
-func (h *APIHandler) GetConversations(c *gin.Context) {
-	userID := c.Query("user_id")
-	if userID == "" {
-		userID = "default_user"
+// ping checks the stores' backing connection, if they have one.
+func (h *APIHandler) ping(ctx context.Context) error {
+	if p, ok := h.conversations.(store.Pinger); ok {
+		return p.Ping(ctx)
 	}
+	return nil
+}
+
+// GetConversations retrieves conversations for the authenticated user.
+func (h *APIHandler) GetConversations(c *gin.Context) {
+	user := middleware.CurrentUser(c)
 
-	var conversations []models.Conversation
-	if err := h.db.DB.Where("user_id = ?", userID).Find(&conversations).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "error",
-			"message": "Failed to retrieve conversations",
-		})
+	conversations, err := h.conversations.ListByUser(c.Request.Context(), user.ID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve conversations")
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"conversations": conversations,
-		"count":         len(conversations),
+	c.JSON(http.StatusOK, api.ConversationList{
+		Conversations: conversations,
+		Count:         len(conversations),
 	})
 }
 
 // Create a new conversation.
 func (h *APIHandler) CreateConversation(c *gin.Context) {
-	var req struct {
-		Name   string `json:"name"`
-		UserID string `json:"user_id"`
-		SystemPrompt string `json:"system_prompt"`
-	}
+	user := middleware.CurrentUser(c)
+
+	var req api.CreateConversationRequest
 
 	// Bind JSON request body to struct
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "error",
-			"message": "Invalid request payload",
-		})
+		respondBindError(c, err)
 		return
 	}
 
-	if req.UserID == "" {
-		req.UserID = "default_user"
-	}
-
 	if req.SystemPrompt == "" {
 		req.SystemPrompt = "You are a helpful assistant."
 	}
 
-	conversation := models.Conversation{
-		Name:         req.Name,
-		UserID:       req.UserID,
-		SystemPrompt: req.SystemPrompt,
-		Model:        h.aiClient.GetModel(),
+	if req.Model == "" {
+		req.Model = h.aiClient.GetModel()
 	}
 
-	// Save the new conversation to the database
-	if err := h.db.DB.Create(&conversation).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "error",
-			"message": "Failed to create conversation",
-		})
+	if err := h.checkTools(req.Tools); err != nil {
+		respondInvalid(c, "tools", err.Error())
 		return
 	}
 
+	conversation := models.Conversation{
+		Name:         req.Name,
+		UserID:       user.ID,
+		SystemPrompt: req.SystemPrompt,
+		Model:        req.Model,
+		FallbackModels: req.FallbackModels,
+		Tools:        req.Tools,
+	}
+
 	// add a system message to the conversation
 	systemMessage := models.Message{
-		ConversationID: conversation.ID,
 		Role:           "system",
 		Content:        req.SystemPrompt,
 		TokenCount:    h.aiClient.EstimateTokens(req.SystemPrompt),
+		Status:         models.MessageStatusComplete,
 	}
-	// Save the system message to the database
-	if err := h.db.DB.Create(&systemMessage).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "error",
-			"message": "Failed to create system message",
-		})
+
+	// Save the conversation and its system message together
+	if err := h.conversations.Create(c.Request.Context(), &conversation, &systemMessage); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to create conversation")
 		return
 	}
 	
 	// Return the created conversation
-	c.JSON(http.StatusCreated, gin.H{
-		"status":       "success",
-		"conversation": conversation,
-		"message":      "Conversation created successfully",
+	c.JSON(http.StatusCreated, api.ConversationResponse{
+		Status:       "success",
+		Conversation: &conversation,
+		Message:      "Conversation created successfully",
 	})
 }
 
 // Get conversation with messages.
 func (h *APIHandler) GetConversation(c *gin.Context) {
 	conversationID := c.Param("id")
+	user := middleware.CurrentUser(c)
 
-	var conversation models.Conversation
-	if err := h.db.DB.Preload("Messages").First(&conversation, "id = ?", conversationID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"status":  "error",
-			"message": "Conversation not found",
-		})
+	conversation, err := h.conversations.GetWithMessages(c.Request.Context(), conversationID, user.ID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "Conversation not found")
 		return
 	}
 
 	// Return the conversation
-	c.JSON(http.StatusOK, gin.H{
-		"status":       "success",
-		"conversation": conversation,
+	c.JSON(http.StatusOK, api.ConversationResponse{
+		Status:       "success",
+		Conversation: conversation,
 	})
 }
 
-// Send a message in a conversation and get AI response.
+// Send a message in a conversation and get AI response. The message is
+// JSON, or a multipart form with the same fields plus up to
+// maxImagesPerMessage PNG or JPEG "images" files for vision models. With
+// ?stream=true the reply is sent as server-sent events; see tokenStream.
 func (h *APIHandler) SendMessage(c *gin.Context) {
     conversationID := c.Param("id")
+    user := middleware.CurrentUser(c)
     
-    var req struct {
-        Content string `json:"content" binding:"required"`
-        Role    string `json:"role"`
-    }
+    var req api.SendMessageRequest
     
-    if err := c.ShouldBindJSON(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{
-            "error": "invalid request format",
-        })
+    var uploads []imageUpload
+    var err error
+    if c.ContentType() == binding.MIMEMultipartPOSTForm {
+        err = c.ShouldBindWith(&req, binding.FormMultipart)
+    } else {
+        err = c.ShouldBindJSON(&req)
+    }
+    if err != nil {
+        respondBindError(c, err)
         return
     }
+    if form := c.Request.MultipartForm; form != nil && len(form.File["images"]) > 0 {
+        var status int
+        uploads, status, err = readImages(form.File["images"])
+        if err != nil {
+            respondError(c, status, err.Error())
+            return
+        }
+    }
     
     if req.Role == "" {
         req.Role = "user"
     }
     
-    // Verify conversation exists
-    var conversation models.Conversation
-    if err := h.db.DB.First(&conversation, "id = ?", conversationID).Error; err != nil {
-        c.JSON(http.StatusNotFound, gin.H{
-            "error": "conversation not found",
-        })
+    // Verify conversation exists and belongs to the user
+    conversation, err := h.conversations.Get(c.Request.Context(), conversationID, user.ID)
+    if err != nil {
+        respondError(c, http.StatusNotFound, "conversation not found")
+        return
+    }
+    
+    // Refuse images up front unless a model of the conversation can see
+    if len(uploads) > 0 {
+        if _, err := h.visionModels(c.Request.Context(), conversation.ModelChain()); err != nil {
+            respondVisionError(c, err)
+            return
+        }
+    }
+    
+    // Register the generation so shutdown waits for it
+    ctx, done, err := h.generations.Start(c.Request.Context())
+    if err != nil {
+        respondError(c, http.StatusServiceUnavailable, err.Error())
         return
     }
+    defer done()
+    
+    // Attribute messages to the API key, if any, for per-key quotas
+    apiKeyID := ""
+    if key := middleware.CurrentAPIKey(c); key != nil {
+        apiKeyID = key.ID
+    }
     
-    // Create user message
+    // Create user message; it stays pending until the reply is saved
     userMessage := models.Message{
         ConversationID: conversationID,
+        APIKeyID:       apiKeyID,
         Role:           req.Role,
         Content:        req.Content,
         TokenCount:     h.aiClient.EstimateTokens(req.Content),
+        Status:         models.MessageStatusPending,
     }
     
-    if err := h.db.DB.Create(&userMessage).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{
-            "error": "failed to save message",
-        })
+    if userMessage.Images, err = h.storeImages(ctx, uploads); err != nil {
+        respondError(c, http.StatusInternalServerError, "failed to save images")
         return
     }
     
-    // Get all messages for context
-    var messages []models.Message
-    if err := h.db.DB.Where("conversation_id = ?", conversationID).Order("created_at ASC").Find(&messages).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{
-            "error": "failed to load conversation history",
-        })
+    if err := h.messages.Create(ctx, &userMessage); err != nil {
+        h.deleteImages(ctx, userMessage.Images)
+        respondError(c, http.StatusInternalServerError, "failed to save message")
         return
     }
     
+    h.completeTurn(c, ctx, conversation, &userMessage, apiKeyID)
+}
+
+// RetryMessage re-runs generation for the latest user message in a
+// conversation after its reply failed or was interrupted. Like
+// SendMessage it can stream the reply.
+func (h *APIHandler) RetryMessage(c *gin.Context) {
+    conversationID := c.Param("id")
+    messageID := c.Param("message_id")
+    user := middleware.CurrentUser(c)
+    
+    conversation, err := h.conversations.Get(c.Request.Context(), conversationID, user.ID)
+    if err != nil {
+        respondError(c, http.StatusNotFound, "conversation not found")
+        return
+    }
+    
+    userMessage, err := h.messages.Get(c.Request.Context(), messageID, conversationID)
+    if err != nil {
+        respondError(c, http.StatusNotFound, "message not found")
+        return
+    }
+    
+    if userMessage.Status != models.MessageStatusFailed && userMessage.Status != models.MessageStatusInterrupted {
+        c.JSON(http.StatusConflict, api.NewError(api.CodeNotRetryable, "only failed or interrupted messages can be retried"))
+        return
+    }
+    
+    // Replying to an older turn would put the answer out of order
+    latest, err := h.messages.IsLatest(c.Request.Context(), userMessage)
+    if err != nil {
+        respondError(c, http.StatusInternalServerError, "failed to load conversation history")
+        return
+    }
+    if !latest {
+        c.JSON(http.StatusConflict, api.NewError(api.CodeNotRetryable, "only the latest message can be retried"))
+        return
+    }
+    
+    ctx, done, err := h.generations.Start(c.Request.Context())
+    if err != nil {
+        respondError(c, http.StatusServiceUnavailable, err.Error())
+        return
+    }
+    defer done()
+    
+    if err := h.messages.SetStatus(ctx, userMessage, models.MessageStatusPending); err != nil {
+        respondError(c, http.StatusInternalServerError, "failed to update message")
+        return
+    }
+    
+    h.completeTurn(c, ctx, conversation, userMessage, userMessage.APIKeyID)
+}
+
+// completeTurn generates the reply to a pending user message. The reply is
+// saved and the user message marked complete in one transaction; if
+// generation fails the user message is marked failed (or interrupted) so
+// it can be retried. The conversation's models are tried in order, and
+// any tool calls made on the way are saved with the reply. Excerpts of the
+// conversation's documents relevant to the message are given to the model
+// and cited on the reply. Images in the history are sent along, and only
+// the models that can see them are tried. The reply is streamed when the
+// request asks for it.
+func (h *APIHandler) completeTurn(c *gin.Context, ctx context.Context, conversation *models.Conversation, userMessage *models.Message, apiKeyID string) {
+    conversationID := userMessage.ConversationID
+    
+    // Get all answered messages, plus this one, for context
+    messages, err := h.messages.History(ctx, conversationID, userMessage.ID)
+    if err != nil {
+        h.markTurn(ctx, userMessage, models.MessageStatusFailed)
+        respondTurn(c, http.StatusInternalServerError, api.NewError(api.CodeInternal, "failed to load conversation history"))
+        return
+    }
+    
+    // Images go to the model with their messages
+    chain := conversation.ModelChain()
+    if hasImages(messages) {
+        if chain, err = h.visionModels(ctx, chain); err != nil {
+            h.markTurn(ctx, userMessage, models.MessageStatusFailed)
+            respondVisionError(c, err)
+            return
+        }
+        if err := h.loadImages(ctx, messages); err != nil {
+            h.markTurn(ctx, userMessage, models.MessageStatusFailed)
+            respondTurn(c, http.StatusInternalServerError, api.NewError(api.CodeInternal, "failed to load images"))
+            return
+        }
+    }
+    
+    // Look up context in the conversation's documents
+    retrieval, err := h.documents.Retrieve(ctx, conversationID, userMessage.Content)
+    if err != nil {
+        h.failTurn(c, ctx, userMessage, "document search failed: ", err)
+        return
+    }
+    messages = retrieval.Inject(messages)
+    
     // Send to AI
-    aiResponse, err := h.aiClient.SendMessage(messages)
+    options := services.ChatOptions{Models: chain}
+    if stream := turnStream(c); stream != nil {
+        options.OnToken = stream.token
+        options.OnReset = stream.reset
+    }
+    if len(conversation.Tools) > 0 {
+        options.Tools = h.tools.Definitions(conversation.Tools...)
+    }
+    turn, err := services.CompleteWithTools(ctx, h.aiClient, h.tools, messages, options)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{
-            "error": "AI request failed: " + err.Error(),
-        })
+        h.failTurn(c, ctx, userMessage, "AI request failed: ", err)
         return
     }
     
-    // Save AI response
+    // Save the tool calls, if any, then the AI response
+    aiResponse := turn.Result
+    replies := make([]*models.Message, 0, len(turn.Steps)+1)
+    tokensUsed := userMessage.TokenCount
+    for i := range turn.Steps {
+        step := &turn.Steps[i]
+        step.ConversationID = conversationID
+        step.APIKeyID = apiKeyID
+        replies = append(replies, step)
+        tokensUsed += step.TokenCount
+    }
+    
     assistantMessage := models.Message{
-        ConversationID: conversationID,
-        Role:           "assistant",
-        Content:        aiResponse,
-        TokenCount:     h.aiClient.EstimateTokens(aiResponse),
+        ConversationID:     conversationID,
+        APIKeyID:           apiKeyID,
+        Role:               "assistant",
+        Content:            aiResponse.Content,
+        TokenCount:         aiResponse.CompletionTokens,
+        Status:             models.MessageStatusComplete,
+        Model:              aiResponse.Model,
+        PromptTokens:       aiResponse.PromptTokens,
+        CompletionTokens:   aiResponse.CompletionTokens,
+        LatencyMs:          aiResponse.Latency.Milliseconds(),
+        TimeToFirstTokenMs: aiResponse.TimeToFirstToken.Milliseconds(),
+        Backend:            aiResponse.Backend,
+    }
+    if retrieval != nil {
+        assistantMessage.Citations = retrieval.Citations
     }
     
-    if err := h.db.DB.Create(&assistantMessage).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{
-            "error": "failed to save AI response",
-        })
+    replies = append(replies, &assistantMessage)
+    if err := h.messages.CompleteTurn(context.WithoutCancel(ctx), userMessage, replies...); err != nil {
+        h.markTurn(ctx, userMessage, models.MessageStatusFailed)
+        respondTurn(c, http.StatusInternalServerError, api.NewError(api.CodeInternal, "failed to save AI response"))
         return
     }
     
-    c.JSON(http.StatusOK, gin.H{
-        "user_message":      userMessage,
-        "assistant_message": assistantMessage,
-        "success":           true,
-    })
+    middleware.SetTokensUsed(c, tokensUsed+assistantMessage.TokenCount)
+    
+    response := api.SendMessageResponse{
+        UserMessage:      userMessage,
+        AssistantMessage: &assistantMessage,
+        ToolMessages:     turn.Steps,
+        Success:          true,
+    }
+    respondTurn(c, http.StatusOK, response)
+}
+
+// failTurn marks a turn that could not be answered and responds with the
+// error, prefixed with what failed.
+func (h *APIHandler) failTurn(c *gin.Context, ctx context.Context, userMessage *models.Message, prefix string, err error) {
+    status, body := turnError(c, ctx, prefix, err)
+    if body.Code == api.CodeInterrupted {
+        // Shutdown cut the reply off; flag the turn so it can be retried
+        h.markTurn(ctx, userMessage, models.MessageStatusInterrupted)
+    } else {
+        h.markTurn(ctx, userMessage, models.MessageStatusFailed)
+    }
+    respondTurn(c, status, body)
+}
+
+// turnError describes a failed generation, telling upstream failures
+// (502/503/504) and shutdown apart from our own. It passes on the model
+// server's Retry-After.
+func turnError(c *gin.Context, ctx context.Context, prefix string, err error) (int, api.Error) {
+    if services.Interrupted(ctx) {
+        return http.StatusServiceUnavailable, api.NewError(api.CodeInterrupted, "generation interrupted by server shutdown")
+    }
+    var upstream *services.UpstreamError
+    if errors.As(err, &upstream) {
+        if upstream.RetryAfter > 0 {
+            c.Header("Retry-After", strconv.Itoa(int(math.Ceil(upstream.RetryAfter.Seconds()))))
+        }
+        return upstream.HTTPStatus(), api.NewError(upstream.Kind, prefix+err.Error())
+    }
+    return http.StatusInternalServerError, api.NewError(api.CodeInternal, prefix + err.Error())
+}
+
+// markTurn records the outcome of a turn that produced no reply. It runs
+// even if ctx was cancelled so the status is never lost.
+func (h *APIHandler) markTurn(ctx context.Context, userMessage *models.Message, status string) {
+    h.messages.SetStatus(context.WithoutCancel(ctx), userMessage, status)
 }
 
 // Delete a conversation
 func (h *APIHandler) DeleteConversation(c *gin.Context) {
     conversationID := c.Param("id")
+    user := middleware.CurrentUser(c)
     
-    // Delete messages first (due to foreign key constraint)
-    if err := h.db.DB.Where("conversation_id = ?", conversationID).Delete(&models.Message{}).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{
-            "error": "failed to delete messages",
-        })
+    // Verify conversation exists and belongs to the user
+    conversation, err := h.conversations.GetWithMessages(c.Request.Context(), conversationID, user.ID)
+    if err != nil {
+        respondError(c, http.StatusNotFound, "conversation not found")
         return
     }
     
-    // Delete conversation
-    if err := h.db.DB.Delete(&models.Conversation{}, "id = ?", conversationID).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{
-            "error": "failed to delete conversation",
-        })
+    // Delete the conversation along with its messages, then their images
+    if err := h.conversations.Delete(c.Request.Context(), conversationID); err != nil {
+        respondError(c, http.StatusInternalServerError, "failed to delete conversation")
         return
     }
+    h.deleteImages(c.Request.Context(), imageRefs(conversation.Messages))
     
-    c.JSON(http.StatusOK, gin.H{
-        "message": "conversation deleted successfully",
+    c.JSON(http.StatusOK, api.StatusResponse{
+        Message: "conversation deleted successfully",
     })
 }
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"ai-chatbot-web/api"
+	"ai-chatbot-web/internal/middleware"
+	"ai-chatbot-web/internal/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyHandler struct {
+	keys *services.APIKeyService
+}
+
+func NewAPIKeyHandler(keys *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		keys: keys,
+	}
+}
+
+// CreateAPIKey issues a new API key for the authenticated user. The raw key
+// is only included in this response. Keys are created from a session: a
+// key could otherwise outlive itself, or grant scopes it lacks.
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if middleware.CurrentAPIKey(c) != nil {
+		respondError(c, http.StatusForbidden, "API keys cannot create API keys; log in to create one")
+		return
+	}
+
+	var req api.CreateAPIKeyRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	raw, key, err := h.keys.Create(user.ID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		respondRequestError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, api.APIKeyCreated{
+		Status:  "success",
+		Key:     raw,
+		APIKey:  key,
+		Message: "Store this key now, it will not be shown again",
+	})
+}
+
+// ListAPIKeys lists the authenticated user's API keys.
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	keys, err := h.keys.List(user.ID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve API keys")
+		return
+	}
+
+	c.JSON(http.StatusOK, api.APIKeyList{
+		APIKeys: keys,
+		Count:   len(keys),
+	})
+}
+
+// RevokeAPIKey revokes one of the authenticated user's API keys.
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	if err := h.keys.Revoke(user.ID, c.Param("id")); err != nil {
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			respondError(c, http.StatusNotFound, "API key not found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Failed to revoke API key")
+		return
+	}
+
+	c.JSON(http.StatusOK, api.StatusResponse{
+		Status:  "success",
+		Message: "API key revoked",
+	})
+}
@@ -0,0 +1,489 @@
+package handlers
+
+import (
+	"ai-chatbot-web/api"
+	"ai-chatbot-web/internal/blobs"
+	"ai-chatbot-web/internal/database/databasetest"
+	"ai-chatbot-web/internal/fakeollama"
+	"ai-chatbot-web/internal/middleware"
+	"ai-chatbot-web/internal/models"
+	"ai-chatbot-web/internal/rag"
+	"ai-chatbot-web/internal/services"
+	"ai-chatbot-web/internal/store"
+	"ai-chatbot-web/internal/tools"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeProvider is a ChatProvider that echoes the last message as the first
+// model of the chain, or fails while err is set. While tools are offered
+// it returns the queued toolCalls first. It records the history of every
+// call. Every model can see images except those in blind.
+type fakeProvider struct {
+	mu        sync.Mutex
+	err       error
+	toolCalls [][]tools.Call
+	calls     [][]models.Message
+	blind     map[string]bool
+}
+
+func (f *fakeProvider) SendMessage(ctx context.Context, messages []models.Message, options services.ChatOptions) (*services.ChatResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, messages)
+	if f.err != nil {
+		return nil, f.err
+	}
+	model := "fake-model"
+	if len(options.Models) > 0 {
+		model = options.Models[0]
+	}
+	if len(options.Tools) > 0 && len(f.toolCalls) > 0 {
+		calls := f.toolCalls[0]
+		f.toolCalls = f.toolCalls[1:]
+		return &services.ChatResult{Model: model, ToolCalls: calls, CompletionTokens: 5}, nil
+	}
+	content := "echo: " + messages[len(messages)-1].Content
+	if options.OnToken != nil {
+		for _, word := range strings.SplitAfter(content, " ") {
+			options.OnToken(word)
+		}
+	}
+	return &services.ChatResult{
+		Content:          content,
+		Model:            model,
+		PromptTokens:     7,
+		CompletionTokens: 3,
+		Latency:          20 * time.Millisecond,
+	}, nil
+}
+
+func (f *fakeProvider) EstimateTokens(text string) int { return len(text) / 4 }
+
+func (f *fakeProvider) GetModel() string { return "fake-model" }
+
+func (f *fakeProvider) SupportsVision(ctx context.Context, model string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !f.blind[model], nil
+}
+
+func (f *fakeProvider) setBlind(models ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.blind = map[string]bool{}
+	for _, model := range models {
+		f.blind[model] = true
+	}
+}
+
+func (f *fakeProvider) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+func (f *fakeProvider) lastCall() []models.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.calls) == 0 {
+		return nil
+	}
+	return f.calls[len(f.calls)-1]
+}
+
+// fakeEmbedder embeds texts with fakeollama's bag-of-words embedding, or
+// fails while err is set.
+type fakeEmbedder struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (f *fakeEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return nil, f.err
+	}
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		for _, v := range fakeollama.Embed(text, fakeollama.DefaultDimensions) {
+			embeddings[i] = append(embeddings[i], float32(v))
+		}
+	}
+	return embeddings, nil
+}
+
+func (f *fakeEmbedder) EmbeddingModel() string { return "fake-embed" }
+
+func (f *fakeEmbedder) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+type testServer struct {
+	router      *gin.Engine
+	ai          *fakeProvider
+	embedder    *fakeEmbedder
+	images      blobs.Store
+	generations *services.GenerationTracker
+}
+
+// testStores are the stores an APIHandler is built on.
+type testStores struct {
+	conversations store.ConversationStore
+	messages      store.MessageStore
+	documents     store.DocumentStore
+	images        blobs.Store
+}
+
+type storeFactory func(t *testing.T) testStores
+
+// storeFactories runs every handler test against both store
+// implementations so they stay interchangeable.
+var storeFactories = map[string]storeFactory{
+	"memory": func(t *testing.T) testStores {
+		s := store.NewMemoryStore()
+		images, err := blobs.NewFileStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("image store: %v", err)
+		}
+		return testStores{s.Conversations(), s.Messages(), s.Documents(), images}
+	},
+	"database": func(t *testing.T) testStores {
+		db := databasetest.Open(t)
+		s := store.NewDatabaseStore(db)
+		return testStores{s.Conversations(), s.Messages(), s.Documents(), blobs.NewDatabaseStore(db)}
+	},
+}
+
+// newTestServer wires an APIHandler using the fake provider into a router.
+func newTestServer(t *testing.T, stores storeFactory) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	s := stores(t)
+	ts := &testServer{
+		ai:          &fakeProvider{},
+		embedder:    &fakeEmbedder{},
+		images:      s.images,
+		generations: services.NewGenerationTracker(),
+	}
+	h := NewAPIHandler(s.conversations, s.messages, ts.ai, ts.generations, newRegistry(t), rag.NewIndex(ts.embedder, s.documents), s.images)
+	ts.router = newTestRouter(h)
+	return ts
+}
+
+// newRegistry returns a registry with the built-in tools.
+func newRegistry(t *testing.T) *tools.Registry {
+	t.Helper()
+	registry := tools.NewRegistry()
+	if err := tools.RegisterBuiltins(registry); err != nil {
+		t.Fatalf("RegisterBuiltins: %v", err)
+	}
+	return registry
+}
+
+// newTestRouter routes the conversation API and the OpenAI-compatible
+// routes to h. Requests are
+// authenticated as the user named in the X-Test-User header.
+func newTestRouter(h *APIHandler) *gin.Engine {
+	registerFieldNames()
+	router := gin.New()
+	router.GET("/api/v1/health", h.HealthCheck)
+	auth := func(c *gin.Context) {
+		id := c.GetHeader("X-Test-User")
+		if id == "" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		middleware.SetCurrentUser(c, &models.User{ID: id, Username: id})
+	}
+	api := router.Group("/api/v1")
+	api.Use(auth)
+	api.GET("/conversations", h.GetConversations)
+	api.POST("/conversations", h.CreateConversation)
+	api.POST("/conversations/import", h.ImportConversations)
+	api.GET("/conversations/:id", h.GetConversation)
+	api.GET("/conversations/:id/export", h.ExportConversation)
+	api.PUT("/conversations/:id/tools", h.SetConversationTools)
+	api.GET("/tools", h.ListTools)
+	api.GET("/conversations/:id/documents", h.ListDocuments)
+	api.POST("/conversations/:id/documents", h.UploadDocument)
+	api.DELETE("/conversations/:id/documents/:document_id", h.DeleteDocument)
+	api.GET("/conversations/:id/images/:image_id", h.GetImage)
+	api.POST("/conversations/:id/messages", h.SendMessage)
+	api.POST("/conversations/:id/messages/:message_id/retry", h.RetryMessage)
+	api.DELETE("/conversations/:id", h.DeleteConversation)
+
+	openai := router.Group("/v1")
+	openai.Use(middleware.RenderErrors(OpenAIError), auth)
+	openai.GET("/models", h.ListModels)
+	openai.POST("/chat/completions", h.ChatCompletions)
+	return router
+}
+
+func (ts *testServer) do(t *testing.T, user, method, path string, body any) (int, map[string]any) {
+	t.Helper()
+
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			t.Fatalf("marshal body: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	if user != "" {
+		req.Header.Set("X-Test-User", user)
+	}
+	rec := httptest.NewRecorder()
+	ts.router.ServeHTTP(rec, req)
+
+	var decoded map[string]any
+	if rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+			t.Fatalf("%s %s: invalid JSON %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code, decoded
+}
+
+// createConversation creates a conversation for user and returns its ID.
+func (ts *testServer) createConversation(t *testing.T, user string) string {
+	t.Helper()
+	code, body := ts.do(t, user, http.MethodPost, "/api/v1/conversations", gin.H{
+		"name":          "test",
+		"system_prompt": "Be brief.",
+	})
+	if code != http.StatusCreated {
+		t.Fatalf("create conversation: status %d, body %v", code, body)
+	}
+	return body["conversation"].(map[string]any)["id"].(string)
+}
+
+func messagesOf(body map[string]any) []map[string]any {
+	raw, _ := body["conversation"].(map[string]any)["messages"].([]any)
+	messages := make([]map[string]any, len(raw))
+	for i, m := range raw {
+		messages[i] = m.(map[string]any)
+	}
+	return messages
+}
+
+func forEachStore(t *testing.T, test func(t *testing.T, ts *testServer)) {
+	for name, factory := range storeFactories {
+		t.Run(name, func(t *testing.T) {
+			test(t, newTestServer(t, factory))
+		})
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ts *testServer) {
+		code, body := ts.do(t, "", http.MethodGet, "/api/v1/health", nil)
+		if code != http.StatusOK || body["model"] != "fake-model" {
+			t.Errorf("health: status %d, body %v", code, body)
+		}
+	})
+}
+
+func TestCreateAndGetConversation(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ts *testServer) {
+		id := ts.createConversation(t, "alice")
+
+		code, body := ts.do(t, "alice", http.MethodGet, "/api/v1/conversations/"+id, nil)
+		if code != http.StatusOK {
+			t.Fatalf("get: status %d", code)
+		}
+		messages := messagesOf(body)
+		if len(messages) != 1 || messages[0]["role"] != "system" || messages[0]["content"] != "Be brief." {
+			t.Errorf("expected only the system message, got %v", messages)
+		}
+	})
+}
+
+func TestConversationsAreScopedToTheirOwner(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ts *testServer) {
+		id := ts.createConversation(t, "alice")
+		ts.createConversation(t, "bob")
+
+		_, body := ts.do(t, "alice", http.MethodGet, "/api/v1/conversations", nil)
+		if body["count"] != float64(1) {
+			t.Errorf("alice should see 1 conversation, got %v", body["count"])
+		}
+
+		path := "/api/v1/conversations/" + id
+		requests := []struct {
+			method, path string
+			body         any
+		}{
+			{http.MethodGet, path, nil},
+			{http.MethodPost, path + "/messages", gin.H{"content": "hi"}},
+			{http.MethodDelete, path, nil},
+		}
+		for _, r := range requests {
+			if code, _ := ts.do(t, "bob", r.method, r.path, r.body); code != http.StatusNotFound {
+				t.Errorf("bob %s %s: status %d, want 404", r.method, r.path, code)
+			}
+		}
+	})
+}
+
+func TestSendMessage(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ts *testServer) {
+		id := ts.createConversation(t, "alice")
+		path := "/api/v1/conversations/" + id + "/messages"
+
+		code, body := ts.do(t, "alice", http.MethodPost, path, gin.H{"content": "first"})
+		if code != http.StatusOK {
+			t.Fatalf("send: status %d, body %v", code, body)
+		}
+		reply := body["assistant_message"].(map[string]any)
+		if reply["content"] != "echo: first" || reply["model"] != "fake-model" {
+			t.Errorf("unexpected reply %v", reply)
+		}
+		if status := body["user_message"].(map[string]any)["status"]; status != models.MessageStatusComplete {
+			t.Errorf("user message status = %v", status)
+		}
+
+		ts.do(t, "alice", http.MethodPost, path, gin.H{"content": "second"})
+		var roles []string
+		for _, m := range ts.ai.lastCall() {
+			roles = append(roles, m.Role+":"+m.Content)
+		}
+		want := "system:Be brief.,user:first,assistant:echo: first,user:second"
+		if strings.Join(roles, ",") != want {
+			t.Errorf("history sent to the model = %v, want %s", roles, want)
+		}
+
+		_, body = ts.do(t, "alice", http.MethodGet, "/api/v1/conversations/"+id, nil)
+		if n := len(messagesOf(body)); n != 5 {
+			t.Errorf("expected 5 stored messages, got %d", n)
+		}
+	})
+}
+
+func TestSendMessageValidation(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ts *testServer) {
+		id := ts.createConversation(t, "alice")
+		code, body := ts.do(t, "alice", http.MethodPost, "/api/v1/conversations/"+id+"/messages", gin.H{})
+		if code != http.StatusBadRequest || body["code"] != api.CodeValidationFailed || body["field"] != "content" {
+			t.Errorf("missing content: status %d, body %v", code, body)
+		}
+	})
+}
+
+func TestFailedTurnCanBeRetried(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ts *testServer) {
+		id := ts.createConversation(t, "alice")
+		path := "/api/v1/conversations/" + id
+
+		ts.ai.setErr(errors.New("model unavailable"))
+		code, _ := ts.do(t, "alice", http.MethodPost, path+"/messages", gin.H{"content": "hello"})
+		if code != http.StatusInternalServerError {
+			t.Fatalf("send with failing model: status %d, want 500", code)
+		}
+
+		_, body := ts.do(t, "alice", http.MethodGet, path, nil)
+		messages := messagesOf(body)
+		failed := messages[len(messages)-1]
+		if failed["status"] != models.MessageStatusFailed {
+			t.Fatalf("user message status = %v, want failed", failed["status"])
+		}
+
+		ts.ai.setErr(nil)
+		retry := path + "/messages/" + failed["id"].(string) + "/retry"
+		code, body = ts.do(t, "alice", http.MethodPost, retry, nil)
+		if code != http.StatusOK {
+			t.Fatalf("retry: status %d, body %v", code, body)
+		}
+		if body["assistant_message"].(map[string]any)["content"] != "echo: hello" {
+			t.Errorf("unexpected retry reply %v", body["assistant_message"])
+		}
+
+		// the turn is complete now, so it cannot be retried again
+		if code, _ := ts.do(t, "alice", http.MethodPost, retry, nil); code != http.StatusConflict {
+			t.Errorf("second retry: status %d, want 409", code)
+		}
+	})
+}
+
+func TestOnlyLatestMessageCanBeRetried(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ts *testServer) {
+		id := ts.createConversation(t, "alice")
+		path := "/api/v1/conversations/" + id
+
+		ts.ai.setErr(errors.New("model unavailable"))
+		ts.do(t, "alice", http.MethodPost, path+"/messages", gin.H{"content": "lost"})
+		ts.ai.setErr(nil)
+		ts.do(t, "alice", http.MethodPost, path+"/messages", gin.H{"content": "later"})
+
+		_, body := ts.do(t, "alice", http.MethodGet, path, nil)
+		var failedID string
+		for _, m := range messagesOf(body) {
+			if m["status"] == models.MessageStatusFailed {
+				failedID = m["id"].(string)
+			}
+		}
+		if failedID == "" {
+			t.Fatal("no failed message recorded")
+		}
+
+		code, _ := ts.do(t, "alice", http.MethodPost, path+"/messages/"+failedID+"/retry", nil)
+		if code != http.StatusConflict {
+			t.Errorf("retry of an older message: status %d, want 409", code)
+		}
+
+		// failed turns are left out of the context sent to the model
+		for _, m := range ts.ai.lastCall() {
+			if m.Content == "lost" {
+				t.Error("failed message was sent to the model")
+			}
+		}
+	})
+}
+
+func TestDeleteConversation(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ts *testServer) {
+		id := ts.createConversation(t, "alice")
+		ts.do(t, "alice", http.MethodPost, "/api/v1/conversations/"+id+"/messages", gin.H{"content": "hi"})
+
+		if code, _ := ts.do(t, "alice", http.MethodDelete, "/api/v1/conversations/"+id, nil); code != http.StatusOK {
+			t.Fatalf("delete: status %d", code)
+		}
+		if code, _ := ts.do(t, "alice", http.MethodGet, "/api/v1/conversations/"+id, nil); code != http.StatusNotFound {
+			t.Errorf("get after delete: status %d, want 404", code)
+		}
+	})
+}
+
+func TestSendMessageDuringShutdown(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ts *testServer) {
+		id := ts.createConversation(t, "alice")
+		ts.generations.Close()
+
+		code, _ := ts.do(t, "alice", http.MethodPost, "/api/v1/conversations/"+id+"/messages", gin.H{"content": "hi"})
+		if code != http.StatusServiceUnavailable {
+			t.Errorf("send after Close: status %d, want 503", code)
+		}
+		if len(ts.ai.calls) != 0 {
+			t.Error("model was called during shutdown")
+		}
+	})
+}
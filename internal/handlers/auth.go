@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"ai-chatbot-web/api"
+	"ai-chatbot-web/internal/middleware"
+	"ai-chatbot-web/internal/services"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuthHandler struct {
+	auth *services.AuthService
+}
+
+func NewAuthHandler(auth *services.AuthService) *AuthHandler {
+	return &AuthHandler{
+		auth: auth,
+	}
+}
+
+// Register creates a new user account.
+func (h *AuthHandler) Register(c *gin.Context) {
+	var req api.Credentials
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	user, err := h.auth.Register(req.Username, req.Password)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrUsernameTaken) {
+			status = http.StatusConflict
+		}
+		respondRequestError(c, status, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, api.UserResponse{
+		Status:  "success",
+		User:    user,
+		Message: "User registered successfully",
+	})
+}
+
+// Login exchanges credentials for a session token. The token is returned in
+// the body for API clients and set as a cookie for browsers.
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req api.Credentials
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	token, session, err := h.auth.Login(req.Username, req.Password)
+	if err != nil {
+		status := http.StatusInternalServerError
+		message := "Login failed"
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			status = http.StatusUnauthorized
+			message = err.Error()
+		}
+		respondError(c, status, message)
+		return
+	}
+
+	maxAge := int(time.Until(session.ExpiresAt).Seconds())
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(middleware.SessionCookie, token, maxAge, "/", "", c.Request.TLS != nil, true)
+
+	c.JSON(http.StatusOK, api.LoginResponse{
+		Status:    "success",
+		Token:     token,
+		ExpiresAt: session.ExpiresAt,
+	})
+}
+
+// Logout revokes the current session.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if err := h.auth.Logout(middleware.CurrentToken(c)); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to log out")
+		return
+	}
+
+	c.SetCookie(middleware.SessionCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+	c.JSON(http.StatusOK, api.StatusResponse{
+		Status:  "success",
+		Message: "Logged out",
+	})
+}
+
+// Me returns the authenticated user.
+func (h *AuthHandler) Me(c *gin.Context) {
+	c.JSON(http.StatusOK, api.UserResponse{
+		Status: "success",
+		User:   middleware.CurrentUser(c),
+	})
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"ai-chatbot-web/api"
+	"ai-chatbot-web/internal/middleware"
+	"ai-chatbot-web/internal/rag"
+	"ai-chatbot-web/internal/services"
+	"ai-chatbot-web/internal/store"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UploadDocument adds a plain text, Markdown or PDF file, sent as the
+// "file" field of a multipart form, to a conversation. Its text is
+// chunked and embedded before the response is sent.
+func (h *APIHandler) UploadDocument(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	conversation, err := h.conversations.Get(c.Request.Context(), c.Param("id"), user.ID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "Conversation not found")
+		return
+	}
+
+	// leave room for the multipart framing around the file
+	limit := h.documents.MaxDocumentBytes()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+64<<10)
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Document is larger than %d bytes", limit))
+			return
+		}
+		respondError(c, http.StatusBadRequest, "Upload the document as the \"file\" field of a multipart form")
+		return
+	}
+	defer file.Close()
+
+	if header.Size > limit {
+		respondError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Document is larger than %d bytes", limit))
+		return
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Failed to read upload")
+		return
+	}
+
+	document, err := h.documents.Add(c.Request.Context(), conversation.ID, filepath.Base(header.Filename), data)
+	if err != nil {
+		var upstream *services.UpstreamError
+		switch {
+		case errors.Is(err, rag.ErrUnsupportedType):
+			respondError(c, http.StatusUnsupportedMediaType, err.Error())
+		case errors.As(err, &upstream):
+			c.JSON(upstream.HTTPStatus(), api.NewError(upstream.Kind, "Embedding failed: "+err.Error()))
+		case errors.Is(err, rag.ErrNoText), errors.Is(err, rag.ErrUnreadable):
+			respondError(c, http.StatusUnprocessableEntity, err.Error())
+		default:
+			respondError(c, http.StatusInternalServerError, "Failed to add document")
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, api.DocumentResponse{
+		Status:   "success",
+		Document: document,
+	})
+}
+
+// ListDocuments lists the documents uploaded to a conversation.
+func (h *APIHandler) ListDocuments(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	conversation, err := h.conversations.Get(c.Request.Context(), c.Param("id"), user.ID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "Conversation not found")
+		return
+	}
+
+	documents, err := h.documents.Documents(c.Request.Context(), conversation.ID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve documents")
+		return
+	}
+	c.JSON(http.StatusOK, api.DocumentList{
+		Documents: documents,
+		Count:     len(documents),
+	})
+}
+
+// DeleteDocument removes a document and its chunks from a conversation.
+func (h *APIHandler) DeleteDocument(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	conversation, err := h.conversations.Get(c.Request.Context(), c.Param("id"), user.ID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "Conversation not found")
+		return
+	}
+
+	if err := h.documents.Delete(c.Request.Context(), c.Param("document_id"), conversation.ID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "Document not found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Failed to delete document")
+		return
+	}
+	c.JSON(http.StatusOK, api.StatusResponse{
+		Status:  "success",
+		Message: "Document deleted successfully",
+	})
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"ai-chatbot-web/internal/fakeollama"
+	"ai-chatbot-web/internal/services"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const runbook = `# Database runbook
+
+Disk full on the database host: rotate the logs with logrotate.
+
+Certificate expired: renew the certificate with certbot and reload nginx.`
+
+// upload posts content as a multipart file named name.
+func (ts *testServer) upload(t *testing.T, user, conversationID, name, content string) (int, map[string]any) {
+	t.Helper()
+
+	var payload bytes.Buffer
+	form := multipart.NewWriter(&payload)
+	part, _ := form.CreateFormFile("file", name)
+	part.Write([]byte(content))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/conversations/"+conversationID+"/documents", &payload)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("X-Test-User", user)
+	rec := httptest.NewRecorder()
+	ts.router.ServeHTTP(rec, req)
+
+	var decoded map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("upload %s: invalid JSON %q: %v", name, rec.Body.String(), err)
+	}
+	return rec.Code, decoded
+}
+
+func TestDocuments(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ts *testServer) {
+		id := ts.createConversation(t, "alice")
+		path := "/api/v1/conversations/" + id
+
+		code, body := ts.upload(t, "alice", id, "runbook.md", runbook)
+		if code != http.StatusCreated {
+			t.Fatalf("upload: status %d, body %v", code, body)
+		}
+		document := body["document"].(map[string]any)
+		if document["kind"] != "markdown" || document["chunks"] != float64(1) || document["embedding_model"] != "fake-embed" {
+			t.Errorf("document = %v", document)
+		}
+
+		if code, _ := ts.upload(t, "bob", id, "runbook.md", runbook); code != http.StatusNotFound {
+			t.Errorf("upload to other user's conversation: status %d", code)
+		}
+		if code, _ := ts.upload(t, "alice", id, "photo.png", "\x89PNG\r\n\x1a\n\x00"); code != http.StatusUnsupportedMediaType {
+			t.Errorf("unsupported type: status %d", code)
+		}
+		if code, _ := ts.upload(t, "alice", id, "empty.txt", " \n"); code != http.StatusUnprocessableEntity {
+			t.Errorf("empty document: status %d", code)
+		}
+
+		code, body = ts.do(t, "alice", http.MethodGet, path+"/documents", nil)
+		if code != http.StatusOK || body["count"] != float64(1) {
+			t.Fatalf("list: status %d, body %v", code, body)
+		}
+
+		documentID := document["id"].(string)
+		if code, _ := ts.do(t, "alice", http.MethodDelete, path+"/documents/missing", nil); code != http.StatusNotFound {
+			t.Errorf("delete missing document: status %d", code)
+		}
+		if code, _ := ts.do(t, "bob", http.MethodDelete, path+"/documents/"+documentID, nil); code != http.StatusNotFound {
+			t.Errorf("delete other user's document: status %d", code)
+		}
+		if code, _ := ts.do(t, "alice", http.MethodDelete, path+"/documents/"+documentID, nil); code != http.StatusOK {
+			t.Errorf("delete: status %d", code)
+		}
+		if _, body := ts.do(t, "alice", http.MethodGet, path+"/documents", nil); body["count"] != float64(0) {
+			t.Errorf("document still listed after delete: %v", body)
+		}
+	})
+}
+
+func TestSendMessageCitesDocuments(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ts *testServer) {
+		id := ts.createConversation(t, "alice")
+		path := "/api/v1/conversations/" + id
+
+		// without documents nothing is added to the context
+		ts.do(t, "alice", http.MethodPost, path+"/messages", gin.H{"content": "hello"})
+		if n := len(ts.ai.lastCall()); n != 2 {
+			t.Fatalf("context has %d messages without documents", n)
+		}
+
+		ts.upload(t, "alice", id, "runbook.md", runbook)
+		code, body := ts.do(t, "alice", http.MethodPost, path+"/messages", gin.H{"content": "the certificate expired"})
+		if code != http.StatusOK {
+			t.Fatalf("send: status %d, body %v", code, body)
+		}
+
+		sent := ts.ai.lastCall()
+		excerpts := sent[len(sent)-2]
+		if excerpts.Role != "system" || !strings.Contains(excerpts.Content, "[1] runbook.md, part 1:\n# Database runbook") ||
+			sent[len(sent)-1].Content != "the certificate expired" {
+			t.Errorf("excerpts not given to the model before the message: %+v", sent)
+		}
+
+		citations, _ := body["assistant_message"].(map[string]any)["citations"].([]any)
+		if len(citations) != 1 {
+			t.Fatalf("citations = %v", body["assistant_message"])
+		}
+		citation := citations[0].(map[string]any)
+		if citation["source"] != float64(1) || citation["document"] != "runbook.md" || citation["score"].(float64) <= 0 {
+			t.Errorf("citation = %v", citation)
+		}
+
+		// citations are saved, the excerpts are not
+		_, body = ts.do(t, "alice", http.MethodGet, path, nil)
+		messages := messagesOf(body)
+		if len(messages) != 5 || messages[4]["citations"] == nil {
+			t.Errorf("saved messages = %v", messages)
+		}
+
+		// embedding failures fail the turn like model failures
+		ts.embedder.setErr(&services.UpstreamError{Kind: services.UpstreamUnavailable, Err: errors.New("embedding model down")})
+		code, body = ts.do(t, "alice", http.MethodPost, path+"/messages", gin.H{"content": "again"})
+		if code != http.StatusServiceUnavailable || body["code"] != services.UpstreamUnavailable {
+			t.Errorf("embedding failure: status %d, body %v", code, body)
+		}
+		if code, body := ts.upload(t, "alice", id, "more.md", runbook); code != http.StatusServiceUnavailable {
+			t.Errorf("upload with embedding failure: status %d, body %v", code, body)
+		}
+
+		// deleting the conversation deletes its documents
+		if code, _ := ts.do(t, "alice", http.MethodDelete, path, nil); code != http.StatusOK {
+			t.Fatalf("delete conversation: status %d", code)
+		}
+	})
+}
+
+func TestIntegrationDocuments(t *testing.T) {
+	ts, fake := newIntegrationServer(t)
+	fake.SetModels(fakeollama.DefaultModel, "nomic-embed-text")
+	id := ts.createConversation(t, "alice")
+
+	code, body := ts.upload(t, "alice", id, "runbook.txt", runbook)
+	if code != http.StatusCreated {
+		t.Fatalf("upload: status %d, body %v", code, body)
+	}
+
+	fake.Respond("Renew it with certbot [1].")
+	code, body = ts.do(t, "alice", http.MethodPost, "/api/v1/conversations/"+id+"/messages", gin.H{"content": "certificate expired?"})
+	if code != http.StatusOK {
+		t.Fatalf("send: status %d, body %v", code, body)
+	}
+	if citations, _ := body["assistant_message"].(map[string]any)["citations"].([]any); len(citations) != 1 {
+		t.Errorf("citations = %v", body["assistant_message"])
+	}
+
+	requests := fake.Requests()
+	sent := requests[len(requests)-1].Messages
+	if !strings.Contains(sent[len(sent)-2].Content, "certbot") {
+		t.Errorf("excerpts not sent to Ollama: %+v", sent)
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"ai-chatbot-web/api"
+	"ai-chatbot-web/internal/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// registerFieldNames makes the binding validator name fields in its
+// errors as clients send them, after their json or form tags.
+func registerFieldNames() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			for _, tag := range []string{"json", "form"} {
+				if name, _, _ := strings.Cut(field.Tag.Get(tag), ","); name != "" && name != "-" {
+					return name
+				}
+			}
+			return field.Name
+		})
+	}
+}
+
+// notFound answers requests for routes that do not exist.
+func notFound(c *gin.Context) {
+	respondError(c, http.StatusNotFound, fmt.Sprintf("no route for %s %s", c.Request.Method, c.Request.URL.Path))
+}
+
+// methodNotAllowed answers requests for routes that exist, but not for
+// their method.
+func methodNotAllowed(c *gin.Context) {
+	respondError(c, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed for %s", c.Request.Method, c.Request.URL.Path))
+}
+
+// respondError answers with the error envelope, coded after status.
+func respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, api.NewError(api.CodeForStatus(status), message))
+}
+
+// respondInvalid answers a request with a bad value in field.
+func respondInvalid(c *gin.Context, field, message string) {
+	c.JSON(http.StatusBadRequest, fieldError(field, message))
+}
+
+// fieldError returns a validation error naming field.
+func fieldError(field, message string) api.Error {
+	body := api.NewError(api.CodeValidationFailed, message)
+	body.Field = field
+	return body
+}
+
+// respondRequestError answers a request the services rejected: a 400
+// naming the field for a *services.ValidationError, status otherwise.
+func respondRequestError(c *gin.Context, status int, err error) {
+	var invalid *services.ValidationError
+	if errors.As(err, &invalid) {
+		respondInvalid(c, invalid.Field, invalid.Message)
+		return
+	}
+	respondError(c, status, err.Error())
+}
+
+// respondBindError answers a request whose body could not be bound,
+// naming the field at fault when there is one.
+func respondBindError(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, bindError(err))
+}
+
+// bindError describes why a request body could not be bound.
+func bindError(err error) api.Error {
+	var invalid validator.ValidationErrors
+	var syntax *json.SyntaxError
+	var wrongType *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &invalid):
+		return fieldError(invalid[0].Field(), validationMessage(invalid[0]))
+	case errors.As(err, &wrongType) && wrongType.Field == "":
+		return api.NewError(api.CodeInvalidRequest, "Request body must be a JSON object")
+	case errors.As(err, &wrongType):
+		return fieldError(wrongType.Field, fmt.Sprintf("%s must be %s", wrongType.Field, jsonKind(wrongType.Type)))
+	case errors.As(err, &syntax), errors.Is(err, io.ErrUnexpectedEOF):
+		return api.NewError(api.CodeInvalidRequest, "Request body is not valid JSON")
+	case errors.Is(err, io.EOF):
+		return api.NewError(api.CodeInvalidRequest, "Request body is required")
+	}
+	return api.NewError(api.CodeInvalidRequest, "Invalid request payload")
+}
+
+// validationMessage explains a failed validation rule.
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fe.Field() + " is required"
+	case "max", "min":
+		limit := "at most"
+		if fe.Tag() == "min" {
+			limit = "at least"
+		}
+		switch fe.Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return fmt.Sprintf("%s must have %s %s items", fe.Field(), limit, fe.Param())
+		case reflect.String:
+			return fmt.Sprintf("%s must be %s %s characters", fe.Field(), limit, fe.Param())
+		}
+		return fmt.Sprintf("%s must be %s %s", fe.Field(), limit, fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of %s", fe.Field(), strings.ReplaceAll(fe.Param(), " ", ", "))
+	}
+	return fmt.Sprintf("%s is invalid (%s)", fe.Field(), fe.Tag())
+}
+
+// jsonKind names the JSON type of values of t.
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	}
+	return "a " + t.String()
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"ai-chatbot-web/internal/export"
+	"ai-chatbot-web/internal/middleware"
+	"ai-chatbot-web/internal/models"
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportConversation downloads a conversation as a Markdown or HTML
+// transcript, as JSON, or as a JSONL fine-tuning example, chosen with
+// ?format=md|html|json|jsonl (default md). Only answered turns are
+// included.
+func (h *APIHandler) ExportConversation(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	format := c.DefaultQuery("format", export.Markdown)
+
+	conversation, err := h.conversations.GetWithMessages(c.Request.Context(), c.Param("id"), user.ID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "Conversation not found")
+		return
+	}
+
+	transcript := transcriptOf(conversation)
+	var body bytes.Buffer
+	if err := export.Write(&body, format, transcript); err != nil {
+		respondInvalid(c, "format", fmt.Sprintf("Unsupported format %q, use one of %s", format, strings.Join(export.Formats, ", ")))
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.Filename(transcript, format)))
+	c.Data(http.StatusOK, export.ContentType(format), body.Bytes())
+}
+
+// transcriptOf converts a conversation for export, leaving out user
+// messages that were never answered.
+func transcriptOf(conversation *models.Conversation) export.Transcript {
+	transcript := export.Transcript{
+		ID:      conversation.ID,
+		Title:   conversation.Name,
+		Model:   conversation.Model,
+		Created: conversation.CreatedAt,
+	}
+	for _, msg := range conversation.Messages {
+		if msg.Status != "" && msg.Status != models.MessageStatusComplete {
+			continue
+		}
+		m := export.Message{
+			Role:     msg.Role,
+			Content:  msg.Content,
+			Time:     msg.CreatedAt,
+			Model:    msg.Model,
+			ToolName: msg.ToolName,
+		}
+		for _, call := range msg.ToolCalls {
+			m.ToolCalls = append(m.ToolCalls, export.ToolCall{Name: call.Function.Name, Arguments: call.Function.Arguments})
+		}
+		for _, image := range msg.Images {
+			m.Attachments = append(m.Attachments, image.Name)
+		}
+		transcript.Messages = append(transcript.Messages, m)
+	}
+	return transcript
+}
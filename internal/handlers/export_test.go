@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// get makes a GET request as user and returns the raw response.
+func (ts *testServer) get(t *testing.T, user, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("X-Test-User", user)
+	rec := httptest.NewRecorder()
+	ts.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestExportConversation(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ts *testServer) {
+		id := ts.createConversation(t, "alice")
+		path := "/api/v1/conversations/" + id
+
+		ts.do(t, "alice", http.MethodPost, path+"/messages", gin.H{"content": "Show me:\n```go\nfmt.Println()\n```"})
+		ts.ai.setErr(errors.New("model down"))
+		ts.do(t, "alice", http.MethodPost, path+"/messages", gin.H{"content": "never answered"})
+		ts.ai.setErr(nil)
+
+		rec := ts.get(t, "alice", path+"/export")
+		md := rec.Body.String()
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/markdown; charset=utf-8" {
+			t.Fatalf("export md: status %d, type %s", rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(md, "# test\n") || !strings.Contains(md, "### Assistant (fake-model)") ||
+			!strings.Contains(md, "```go\nfmt.Println()\n```") {
+			t.Errorf("markdown transcript:\n%s", md)
+		}
+		if strings.Contains(md, "never answered") {
+			t.Error("unanswered message exported")
+		}
+		if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="test.md"` {
+			t.Errorf("Content-Disposition = %s", got)
+		}
+
+		rec = ts.get(t, "alice", path+"/export?format=jsonl")
+		var example struct {
+			Messages []struct{ Role, Content string } `json:"messages"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &example); err != nil || len(example.Messages) != 3 || example.Messages[2].Role != "assistant" {
+			t.Errorf("jsonl = %q, %v", rec.Body.String(), err)
+		}
+
+		if rec := ts.get(t, "alice", path+"/export?format=html"); !strings.Contains(rec.Body.String(), `<pre><code class="language-go">fmt.Println()</code></pre>`) {
+			t.Errorf("html transcript:\n%s", rec.Body.String())
+		}
+		if rec := ts.get(t, "alice", path+"/export?format=json"); !json.Valid(rec.Body.Bytes()) {
+			t.Errorf("json export is not JSON: %s", rec.Body.String())
+		}
+		if code, body := ts.do(t, "alice", http.MethodGet, path+"/export?format=pdf", nil); code != http.StatusBadRequest {
+			t.Errorf("unknown format: status %d, body %v", code, body)
+		}
+		if code, _ := ts.do(t, "bob", http.MethodGet, path+"/export", nil); code != http.StatusNotFound {
+			t.Errorf("export other user's conversation: status %d", code)
+		}
+	})
+}
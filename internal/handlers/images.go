@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"ai-chatbot-web/api"
+	"ai-chatbot-web/internal/middleware"
+	"ai-chatbot-web/internal/models"
+	"ai-chatbot-web/internal/services"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Limits on the images sent with one message.
+var (
+	maxImageBytes       int64 = 10 << 20
+	maxImagesPerMessage       = 4
+)
+
+// imageTypes are the formats vision models accept.
+var imageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+}
+
+// errNoVision is returned by visionModels when no model can see.
+var errNoVision = errors.New("does not support images")
+
+// imageUpload is an image read from a multipart form, not yet stored.
+type imageUpload struct {
+	ref  models.Image
+	data []byte
+}
+
+// readImages reads the "images" files of a multipart form. On failure it
+// returns the status to answer with.
+func readImages(files []*multipart.FileHeader) ([]imageUpload, int, error) {
+	if len(files) > maxImagesPerMessage {
+		return nil, http.StatusBadRequest, fmt.Errorf("at most %d images can be sent with a message", maxImagesPerMessage)
+	}
+
+	uploads := make([]imageUpload, 0, len(files))
+	for _, header := range files {
+		name := filepath.Base(header.Filename)
+		if header.Size > maxImageBytes {
+			return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("image %s is larger than %d bytes", name, maxImageBytes)
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("failed to read image %s", name)
+		}
+		data, err := io.ReadAll(io.LimitReader(file, maxImageBytes+1))
+		file.Close()
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("failed to read image %s", name)
+		}
+
+		upload, status, err := newImageUpload(name, data)
+		if err != nil {
+			return nil, status, err
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, 0, nil
+}
+
+// newImageUpload checks the size and format of an image. On failure it
+// returns the status to answer with.
+func newImageUpload(name string, data []byte) (imageUpload, int, error) {
+	if int64(len(data)) > maxImageBytes {
+		return imageUpload{}, http.StatusRequestEntityTooLarge, fmt.Errorf("image %s is larger than %d bytes", name, maxImageBytes)
+	}
+	mediaType := http.DetectContentType(data)
+	if !imageTypes[mediaType] {
+		return imageUpload{}, http.StatusUnsupportedMediaType, fmt.Errorf("image %s is %s; only PNG and JPEG images are supported", name, mediaType)
+	}
+	return imageUpload{
+		ref:  models.Image{ID: uuid.New().String(), Name: name, MediaType: mediaType, Size: int64(len(data))},
+		data: data,
+	}, 0, nil
+}
+
+// storeImages saves the uploads and returns their references. Nothing is
+// left behind if one fails.
+func (h *APIHandler) storeImages(ctx context.Context, uploads []imageUpload) ([]models.Image, error) {
+	refs := make([]models.Image, 0, len(uploads))
+	for _, upload := range uploads {
+		if err := h.images.Put(ctx, upload.ref.ID, upload.data); err != nil {
+			h.deleteImages(ctx, refs)
+			return nil, err
+		}
+		refs = append(refs, upload.ref)
+	}
+	return refs, nil
+}
+
+// deleteImages removes stored images. Failures only leave orphaned blobs
+// behind, so they are not reported.
+func (h *APIHandler) deleteImages(ctx context.Context, refs []models.Image) {
+	ids := make([]string, len(refs))
+	for i, ref := range refs {
+		ids[i] = ref.ID
+	}
+	h.images.Delete(context.WithoutCancel(ctx), ids...)
+}
+
+// loadImages fills in ImageData on the messages that have images.
+func (h *APIHandler) loadImages(ctx context.Context, messages []models.Message) error {
+	for i := range messages {
+		for _, ref := range messages[i].Images {
+			data, err := h.images.Get(ctx, ref.ID)
+			if err != nil {
+				return fmt.Errorf("image %s: %v", ref.ID, err)
+			}
+			messages[i].ImageData = append(messages[i].ImageData, data)
+		}
+	}
+	return nil
+}
+
+// visionModels returns the models of chain that can read images, in
+// order. If the provider cannot tell, every model is assumed to. It fails
+// with errNoVision, naming the models, when none can.
+func (h *APIHandler) visionModels(ctx context.Context, chain []string) ([]string, error) {
+	checker, ok := h.aiClient.(services.VisionChecker)
+	if !ok {
+		return chain, nil
+	}
+
+	var capable []string
+	for _, model := range chain {
+		vision, err := checker.SupportsVision(ctx, model)
+		if err != nil {
+			return nil, err
+		}
+		if vision {
+			capable = append(capable, model)
+		}
+	}
+	if len(capable) == 0 {
+		return nil, fmt.Errorf("model %s %w; use a vision model such as llava", strings.Join(chain, ", "), errNoVision)
+	}
+	return capable, nil
+}
+
+// respondVisionError answers for a failed visionModels.
+func respondVisionError(c *gin.Context, err error) {
+	c.JSON(visionError(err))
+}
+
+// visionError describes a failed visionModels: 400 when no model can see,
+// or the upstream status when the check itself failed.
+func visionError(err error) (int, api.Error) {
+	var upstream *services.UpstreamError
+	switch {
+	case errors.Is(err, errNoVision):
+		return http.StatusBadRequest, api.NewError(api.CodeVisionUnsupported, err.Error())
+	case errors.As(err, &upstream):
+		return upstream.HTTPStatus(), api.NewError(upstream.Kind, "vision check failed: "+err.Error())
+	}
+	return http.StatusInternalServerError, api.NewError(api.CodeInternal, "vision check failed: "+err.Error())
+}
+
+// hasImages reports whether any of the messages carries images.
+func hasImages(messages []models.Message) bool {
+	for _, msg := range messages {
+		if len(msg.Images) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// GetImage serves an image sent with a message of the conversation.
+func (h *APIHandler) GetImage(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	imageID := c.Param("image_id")
+
+	conversation, err := h.conversations.GetWithMessages(c.Request.Context(), c.Param("id"), user.ID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "Conversation not found")
+		return
+	}
+
+	for _, msg := range conversation.Messages {
+		for _, ref := range msg.Images {
+			if ref.ID != imageID {
+				continue
+			}
+			data, err := h.images.Get(c.Request.Context(), ref.ID)
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, "Failed to read image")
+				return
+			}
+			c.Data(http.StatusOK, ref.MediaType, data)
+			return
+		}
+	}
+
+	respondError(c, http.StatusNotFound, "Image not found")
+}
+
+// imageRefs lists the images of a conversation's messages.
+func imageRefs(messages []models.Message) []models.Image {
+	var refs []models.Image
+	for _, msg := range messages {
+		refs = append(refs, msg.Images...)
+	}
+	return refs
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"ai-chatbot-web/api"
+	"ai-chatbot-web/internal/blobs"
+	"ai-chatbot-web/internal/fakeollama"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	png  = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+	jpeg = "\xff\xd8\xff\xe0\x00\x10JFIF\x00"
+	gif  = "GIF89a\x01\x00\x01\x00"
+)
+
+// sendImages posts a message with images as a multipart form. Images are
+// named image1, image2 and so on.
+func (ts *testServer) sendImages(t *testing.T, user, conversationID, content string, images ...string) (int, map[string]any) {
+	t.Helper()
+
+	var payload bytes.Buffer
+	form := multipart.NewWriter(&payload)
+	form.WriteField("content", content)
+	for i, image := range images {
+		part, _ := form.CreateFormFile("images", "image"+string(rune('1'+i)))
+		part.Write([]byte(image))
+	}
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/conversations/"+conversationID+"/messages", &payload)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("X-Test-User", user)
+	rec := httptest.NewRecorder()
+	ts.router.ServeHTTP(rec, req)
+
+	var decoded map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("send images: invalid JSON %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, decoded
+}
+
+func TestSendMessageWithImages(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ts *testServer) {
+		id := ts.createConversation(t, "alice")
+		path := "/api/v1/conversations/" + id
+
+		code, body := ts.sendImages(t, "alice", id, "what is in these?", png, jpeg)
+		if code != http.StatusOK {
+			t.Fatalf("send: status %d, body %v", code, body)
+		}
+		images, _ := body["user_message"].(map[string]any)["images"].([]any)
+		if len(images) != 2 {
+			t.Fatalf("images on the user message = %v", body["user_message"])
+		}
+		first := images[0].(map[string]any)
+		if first["media_type"] != "image/png" || first["name"] != "image1" || first["size"] != float64(len(png)) {
+			t.Errorf("image = %v", first)
+		}
+		sent := ts.ai.lastCall()
+		if data := sent[len(sent)-1].ImageData; len(data) != 2 || string(data[0]) != png || string(data[1]) != jpeg {
+			t.Errorf("image data given to the model = %q", data)
+		}
+
+		// stored images are served to the owner only
+		imagePath := path + "/images/" + first["id"].(string)
+		req := httptest.NewRequest(http.MethodGet, imagePath, nil)
+		req.Header.Set("X-Test-User", "alice")
+		rec := httptest.NewRecorder()
+		ts.router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Body.String() != png || rec.Header().Get("Content-Type") != "image/png" {
+			t.Errorf("get image: status %d, type %s", rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if code, _ := ts.do(t, "bob", http.MethodGet, imagePath, nil); code != http.StatusNotFound {
+			t.Errorf("get other user's image: status %d", code)
+		}
+		if code, _ := ts.do(t, "alice", http.MethodGet, path+"/images/missing", nil); code != http.StatusNotFound {
+			t.Errorf("get missing image: status %d", code)
+		}
+
+		// later turns still show the model the images
+		ts.do(t, "alice", http.MethodPost, path+"/messages", gin.H{"content": "and now?"})
+		sent = ts.ai.lastCall()
+		if len(sent[1].ImageData) != 2 || sent[len(sent)-1].ImageData != nil {
+			t.Errorf("history sent without its images: %+v", sent)
+		}
+
+		if code, body := ts.sendImages(t, "alice", id, "animated?", gif); code != http.StatusUnsupportedMediaType {
+			t.Errorf("GIF: status %d, body %v", code, body)
+		}
+		if code, _ := ts.sendImages(t, "alice", id, "many", png, png, png, png, png); code != http.StatusBadRequest {
+			t.Errorf("too many images: status %d", code)
+		}
+		limit := maxImageBytes
+		maxImageBytes = 8
+		if code, _ := ts.sendImages(t, "alice", id, "big", png); code != http.StatusRequestEntityTooLarge {
+			t.Errorf("image over the limit: status %d", code)
+		}
+		maxImageBytes = limit
+
+		// deleting the conversation deletes its images
+		if code, _ := ts.do(t, "alice", http.MethodDelete, path, nil); code != http.StatusOK {
+			t.Fatalf("delete conversation: status %d", code)
+		}
+		if _, err := ts.images.Get(context.Background(), first["id"].(string)); !errors.Is(err, blobs.ErrNotFound) {
+			t.Errorf("image kept after its conversation was deleted: %v", err)
+		}
+	})
+}
+
+func TestSendMessageImagesNeedVision(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ts *testServer) {
+		ts.ai.setBlind("fake-model")
+		id := ts.createConversation(t, "alice")
+
+		code, body := ts.sendImages(t, "alice", id, "what is this?", png)
+		if code != http.StatusBadRequest || body["code"] != api.CodeVisionUnsupported || !strings.Contains(body["message"].(string), "model fake-model does not support images") {
+			t.Errorf("image for a blind model: status %d, body %v", code, body)
+		}
+		_, body = ts.do(t, "alice", http.MethodGet, "/api/v1/conversations/"+id, nil)
+		if n := len(messagesOf(body)); n != 1 {
+			t.Errorf("refused message was saved: %d messages", n)
+		}
+
+		// text still works, and images go to the first fallback that can see
+		if code, _ := ts.do(t, "alice", http.MethodPost, "/api/v1/conversations/"+id+"/messages", gin.H{"content": "hi"}); code != http.StatusOK {
+			t.Errorf("text message: status %d", code)
+		}
+		code, body = ts.do(t, "alice", http.MethodPost, "/api/v1/conversations", gin.H{
+			"model":           "fake-model",
+			"fallback_models": []string{"llava"},
+		})
+		if code != http.StatusCreated {
+			t.Fatalf("create conversation: status %d, body %v", code, body)
+		}
+		id = body["conversation"].(map[string]any)["id"].(string)
+		code, body = ts.sendImages(t, "alice", id, "what is this?", png)
+		if code != http.StatusOK || body["assistant_message"].(map[string]any)["model"] != "llava" {
+			t.Errorf("image with a vision fallback: status %d, body %v", code, body)
+		}
+	})
+}
+
+func TestIntegrationImages(t *testing.T) {
+	ts, fake := newIntegrationServer(t)
+	fake.SetModels(fakeollama.DefaultModel, "llava")
+	fake.SetVision("llava")
+
+	id := ts.createConversation(t, "alice")
+	if code, body := ts.sendImages(t, "alice", id, "what is this?", png); code != http.StatusBadRequest {
+		t.Errorf("image for %s: status %d, body %v", fakeollama.DefaultModel, code, body)
+	}
+
+	_, body := ts.do(t, "alice", http.MethodPost, "/api/v1/conversations", gin.H{"model": "llava"})
+	id = body["conversation"].(map[string]any)["id"].(string)
+	fake.Respond("A PNG header.")
+	code, body := ts.sendImages(t, "alice", id, "what is this?", png)
+	if code != http.StatusOK {
+		t.Fatalf("send: status %d, body %v", code, body)
+	}
+
+	req, _ := fake.LastRequest()
+	last := req.Messages[len(req.Messages)-1]
+	if len(last.Images) != 1 || last.Images[0] != base64.StdEncoding.EncodeToString([]byte(png)) {
+		t.Errorf("images sent to Ollama = %v", last.Images)
+	}
+}
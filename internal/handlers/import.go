@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"ai-chatbot-web/api"
+	"ai-chatbot-web/internal/importer"
+	"ai-chatbot-web/internal/middleware"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportBytes bounds the body of an import; ChatGPT exports of long
+// histories run to tens of megabytes.
+var maxImportBytes int64 = 64 << 20
+
+// ImportConversations saves conversations posted as JSON: a file saved by
+// the CLI, the conversations.json of a ChatGPT export, or an array of
+// either. Importing the same conversations again only adds new messages.
+func (h *APIHandler) ImportConversations(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Import is larger than %d bytes", maxImportBytes))
+			return
+		}
+		respondError(c, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+
+	conversations, err := importer.Parse(data)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := importer.New(h.conversations, h.messages, h.aiClient.GetModel()).
+		Save(c.Request.Context(), user.ID, conversations)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	status := http.StatusOK
+	if report.Imported > 0 {
+		status = http.StatusCreated
+	}
+	response := api.ImportResponse{
+		Status:        "success",
+		Imported:      report.Imported,
+		Updated:       report.Updated,
+		Skipped:       report.Skipped,
+		Conversations: make([]api.ImportResult, len(report.Conversations)),
+	}
+	for i, result := range report.Conversations {
+		response.Conversations[i] = api.ImportResult(result)
+	}
+	c.JSON(status, response)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const cliSave = `{
+  "meta": {"id": "default", "name": "Go help", "created": "2026-03-01T10:00:00Z"},
+  "messages": [
+    {"role": "user", "content": "Reverse a slice?", "time": "2026-03-01T10:01:00Z"},
+    {"role": "assistant", "content": "slices.Reverse(s)", "time": "2026-03-01T10:01:02Z", "model": "llama3.1:8b"}
+  ],
+  "config": {"model": "llama3.1:8b", "max_tokens": 4000}
+}`
+
+func TestImportConversations(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ts *testServer) {
+		path := "/api/v1/conversations/import"
+
+		code, body := ts.do(t, "alice", http.MethodPost, path, json.RawMessage(cliSave))
+		if code != http.StatusCreated || body["imported"] != float64(1) {
+			t.Fatalf("import: status %d, body %v", code, body)
+		}
+		id := body["conversations"].([]any)[0].(map[string]any)["id"].(string)
+
+		_, body = ts.do(t, "alice", http.MethodGet, "/api/v1/conversations/"+id, nil)
+		messages := messagesOf(body)
+		if len(messages) != 3 || messages[0]["role"] != "system" || messages[2]["created_at"] != "2026-03-01T10:01:02Z" {
+			t.Errorf("imported messages = %v", messages)
+		}
+		if body["conversation"].(map[string]any)["model"] != "llama3.1:8b" {
+			t.Errorf("imported conversation = %v", body["conversation"])
+		}
+
+		// the assistant can carry on the conversation
+		if code, _ := ts.do(t, "alice", http.MethodPost, "/api/v1/conversations/"+id+"/messages", map[string]string{"content": "thanks"}); code != http.StatusOK {
+			t.Errorf("send to imported conversation: status %d", code)
+		}
+
+		code, body = ts.do(t, "alice", http.MethodPost, path, json.RawMessage(cliSave))
+		if code != http.StatusOK || body["skipped"] != float64(1) {
+			t.Errorf("re-import: status %d, body %v", code, body)
+		}
+		if code, _ := ts.do(t, "bob", http.MethodGet, "/api/v1/conversations/"+id, nil); code != http.StatusNotFound {
+			t.Errorf("other user's import: status %d", code)
+		}
+
+		code, body = ts.do(t, "alice", http.MethodPost, path, json.RawMessage(`{"title": "?"}`))
+		if code != http.StatusBadRequest || !strings.Contains(body["message"].(string), "unrecognized") {
+			t.Errorf("unknown format: status %d, body %v", code, body)
+		}
+
+		limit := maxImportBytes
+		maxImportBytes = 16
+		if code, _ := ts.do(t, "alice", http.MethodPost, path, json.RawMessage(cliSave)); code != http.StatusRequestEntityTooLarge {
+			t.Errorf("import over the limit: status %d", code)
+		}
+		maxImportBytes = limit
+	})
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"ai-chatbot-web/internal/fakeollama"
+	"ai-chatbot-web/internal/models"
+	"ai-chatbot-web/internal/rag"
+	"ai-chatbot-web/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newIntegrationServer runs the handlers with the real AIClient and
+// database store against a fake Ollama.
+func newIntegrationServer(t *testing.T) (*testServer, *fakeollama.Server) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	fake := fakeollama.New()
+	fake.SetTokenDelay(time.Millisecond)
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	t.Setenv("OLLAMA_HOST", srv.URL)
+	t.Setenv("OLLAMA_MODEL", fakeollama.DefaultModel)
+	t.Setenv("AI_RETRY_BASE_DELAY", "1ms")
+
+	aiClient, err := services.NewAIClient()
+	if err != nil {
+		t.Fatalf("NewAIClient: %v", err)
+	}
+
+	s := storeFactories["database"](t)
+	ts := &testServer{generations: services.NewGenerationTracker()}
+	ts.router = newTestRouter(NewAPIHandler(s.conversations, s.messages, aiClient, ts.generations, newRegistry(t), rag.NewIndex(aiClient, s.documents), s.images))
+	return ts, fake
+}
+
+func TestIntegrationConversation(t *testing.T) {
+	ts, fake := newIntegrationServer(t)
+	id := ts.createConversation(t, "alice")
+	path := "/api/v1/conversations/" + id
+
+	fake.Respond("Paris is the capital of France.")
+	code, body := ts.do(t, "alice", http.MethodPost, path+"/messages", gin.H{"content": "Capital of France?"})
+	if code != http.StatusOK {
+		t.Fatalf("send: status %d, body %v", code, body)
+	}
+	reply := body["assistant_message"].(map[string]any)
+	if reply["content"] != "Paris is the capital of France." {
+		t.Errorf("content = %v", reply["content"])
+	}
+	if reply["model"] != fakeollama.DefaultModel || reply["completion_tokens"] != float64(6) {
+		t.Errorf("accounting not recorded from the model response: %v", reply)
+	}
+	if reply["backend"] == nil || reply["backend"] == "" {
+		t.Errorf("answering backend not recorded: %v", reply)
+	}
+
+	code, body = ts.do(t, "alice", http.MethodPost, path+"/messages", gin.H{"content": "And Spain?"})
+	if code != http.StatusOK {
+		t.Fatalf("second send: status %d", code)
+	}
+	req, _ := fake.LastRequest()
+	if len(req.Messages) != 4 || req.Messages[2].Role != "assistant" {
+		t.Errorf("history sent to the model: %+v", req.Messages)
+	}
+}
+
+func TestIntegrationHealthListsBackends(t *testing.T) {
+	ts, _ := newIntegrationServer(t)
+
+	code, body := ts.do(t, "", http.MethodGet, "/api/v1/health", nil)
+	backends, _ := body["backends"].([]any)
+	if code != http.StatusOK || len(backends) != 1 {
+		t.Fatalf("health: status %d, body %v", code, body)
+	}
+	if b := backends[0].(map[string]any); b["healthy"] != true || b["circuit"] != services.CircuitClosed {
+		t.Errorf("backend status = %v", b)
+	}
+}
+
+func TestIntegrationFallbackModels(t *testing.T) {
+	ts, fake := newIntegrationServer(t)
+	fake.SetModels("small")
+
+	code, body := ts.do(t, "alice", http.MethodPost, "/api/v1/conversations", gin.H{
+		"name":            "fallback",
+		"model":           "big",
+		"fallback_models": []string{"small"},
+	})
+	if code != http.StatusCreated {
+		t.Fatalf("create: status %d, body %v", code, body)
+	}
+	path := "/api/v1/conversations/" + body["conversation"].(map[string]any)["id"].(string)
+
+	code, body = ts.do(t, "alice", http.MethodPost, path+"/messages", gin.H{"content": "hi"})
+	if code != http.StatusOK {
+		t.Fatalf("send: status %d, body %v", code, body)
+	}
+	if model := body["assistant_message"].(map[string]any)["model"]; model != "small" {
+		t.Errorf("answering model = %v, want small", model)
+	}
+
+	_, body = ts.do(t, "alice", http.MethodGet, path, nil)
+	conv := body["conversation"].(map[string]any)
+	if conv["model"] != "big" || len(conv["fallback_models"].([]any)) != 1 {
+		t.Errorf("model chain not stored: %v", conv)
+	}
+	if messages := messagesOf(body); messages[len(messages)-1]["model"] != "small" {
+		t.Errorf("answering model not stored: %v", messages[len(messages)-1])
+	}
+}
+
+func TestIntegrationUpstreamFailureAndRetry(t *testing.T) {
+	t.Setenv("AI_RETRIES", "0")
+	ts, fake := newIntegrationServer(t)
+	id := ts.createConversation(t, "alice")
+	path := "/api/v1/conversations/" + id
+
+	fake.FailNext(1, http.StatusInternalServerError)
+	code, body := ts.do(t, "alice", http.MethodPost, path+"/messages", gin.H{"content": "hello"})
+	if code != http.StatusBadGateway || body["code"] != services.UpstreamFailed {
+		t.Fatalf("send with failing model: status %d, body %v", code, body)
+	}
+
+	_, body = ts.do(t, "alice", http.MethodGet, path, nil)
+	messages := messagesOf(body)
+	failed := messages[len(messages)-1]
+	if failed["status"] != models.MessageStatusFailed {
+		t.Fatalf("status = %v, want failed", failed["status"])
+	}
+
+	code, body = ts.do(t, "alice", http.MethodPost, path+"/messages/"+failed["id"].(string)+"/retry", nil)
+	if code != http.StatusOK {
+		t.Fatalf("retry: status %d, body %v", code, body)
+	}
+	if body["assistant_message"].(map[string]any)["content"] != "echo: hello" {
+		t.Errorf("retry reply = %v", body["assistant_message"])
+	}
+}
+
+func TestIntegrationTransientFailuresAreRetried(t *testing.T) {
+	ts, fake := newIntegrationServer(t)
+	id := ts.createConversation(t, "alice")
+
+	fake.FailNext(2, http.StatusServiceUnavailable)
+	code, body := ts.do(t, "alice", http.MethodPost, "/api/v1/conversations/"+id+"/messages", gin.H{"content": "hello"})
+	if code != http.StatusOK {
+		t.Fatalf("send: status %d, body %v", code, body)
+	}
+	if n := len(fake.Requests()); n != 3 {
+		t.Errorf("model server saw %d requests, want 3", n)
+	}
+}
+
+func TestIntegrationUpstreamStatusCodes(t *testing.T) {
+	t.Setenv("AI_BREAKER_THRESHOLD", "2")
+	t.Setenv("AI_BREAKER_COOLDOWN", "1m")
+	ts, fake := newIntegrationServer(t)
+	id := ts.createConversation(t, "alice")
+	path := "/api/v1/conversations/" + id + "/messages"
+
+	// client errors from the model server are not retried
+	fake.SetModels("some-other-model")
+	code, body := ts.do(t, "alice", http.MethodPost, path, gin.H{"content": "hi"})
+	if code != http.StatusBadGateway || len(fake.Requests()) != 1 {
+		t.Errorf("unknown model: status %d after %d requests, body %v", code, len(fake.Requests()), body)
+	}
+	fake.SetModels(fakeollama.DefaultModel)
+
+	// two calls that exhaust their retries open the circuit
+	fake.FailNext(6, http.StatusServiceUnavailable)
+	for i := 0; i < 2; i++ {
+		code, body = ts.do(t, "alice", http.MethodPost, path, gin.H{"content": "hi"})
+		if code != http.StatusServiceUnavailable || body["code"] != services.UpstreamUnavailable {
+			t.Fatalf("call %d: status %d, body %v", i, code, body)
+		}
+	}
+
+	before := len(fake.Requests())
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"content":"hi"}`))
+	req.Header.Set("X-Test-User", "alice")
+	rec := httptest.NewRecorder()
+	ts.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("open circuit: status %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if len(fake.Requests()) != before {
+		t.Error("open circuit still called the model server")
+	}
+}
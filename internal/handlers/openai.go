@@ -0,0 +1,626 @@
+package handlers
+
+import (
+	"ai-chatbot-web/api"
+	"ai-chatbot-web/internal/middleware"
+	"ai-chatbot-web/internal/models"
+	"ai-chatbot-web/internal/services"
+	"ai-chatbot-web/internal/tools"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// The /v1 routes speak OpenAI's chat completions protocol, so SDKs and
+// editors built for it can use the server. Requests are authenticated,
+// rate limited and charged like the rest of the API.
+
+// ConversationHeader asks for a chat completion to be saved in a
+// conversation: the ID of one of the user's conversations, or "new" to
+// start one. The response carries the conversation's ID in it.
+const ConversationHeader = "X-Conversation-ID"
+
+// chatCompletionRequest is the body of POST /v1/chat/completions. Sampling
+// settings such as temperature are accepted and ignored.
+type chatCompletionRequest struct {
+	Model         string        `json:"model"`
+	Messages      []chatMessage `json:"messages" binding:"required,min=1"`
+	Stream        bool          `json:"stream"`
+	StreamOptions struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+	Tools []tools.Definition `json:"tools"`
+	N     int                `json:"n"`
+}
+
+type chatMessage struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content"` // a string, or an array of contentParts
+	ToolCalls  []chatToolCall  `json:"tool_calls"`
+	ToolCallID string          `json:"tool_call_id"`
+	Name       string          `json:"name"`
+}
+
+type contentPart struct {
+	Type     string `json:"type"` // text or image_url
+	Text     string `json:"text"`
+	ImageURL struct {
+		URL string `json:"url"`
+	} `json:"image_url"`
+}
+
+type chatToolCall struct {
+	Index    *int             `json:"index,omitempty"` // in streamed deltas only
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function chatFunctionCall `json:"function"`
+}
+
+type chatFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"` // JSON, as a string
+}
+
+// chatCompletion is a reply, or one chunk of a streamed reply.
+type chatCompletion struct {
+	ID      string             `json:"id"`
+	Object  string             `json:"object"` // chat.completion or chat.completion.chunk
+	Created int64              `json:"created"`
+	Model   string             `json:"model"`
+	Choices []completionChoice `json:"choices"`
+	Usage   *completionUsage   `json:"usage,omitempty"`
+}
+
+type completionChoice struct {
+	Index        int        `json:"index"`
+	Message      *chatReply `json:"message,omitempty"`
+	Delta        *chatReply `json:"delta,omitempty"`
+	FinishReason *string    `json:"finish_reason"`
+}
+
+type chatReply struct {
+	Role      string         `json:"role,omitempty"`
+	Content   *string        `json:"content,omitempty"`
+	ToolCalls []chatToolCall `json:"tool_calls,omitempty"`
+}
+
+type completionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type modelList struct {
+	Object string      `json:"object"` // always "list"
+	Data   []modelInfo `json:"data"`
+}
+
+type modelInfo struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"` // always "model"
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// openAIError is the error body of the /v1 routes.
+type openAIError struct {
+	Error struct {
+		Message string  `json:"message"`
+		Type    string  `json:"type"`
+		Param   *string `json:"param"`
+		Code    string  `json:"code"`
+	} `json:"error"`
+}
+
+// OpenAIError renders the error envelope the way OpenAI does, keeping its
+// code. It is the middleware.ErrorRenderer of the /v1 routes.
+func OpenAIError(status int, body api.Error) any {
+	var rendered openAIError
+	rendered.Error.Message = body.Message
+	rendered.Error.Code = body.Code
+	if body.Field != "" {
+		rendered.Error.Param = &body.Field
+	}
+	switch {
+	case status == http.StatusUnauthorized:
+		rendered.Error.Type = "authentication_error"
+	case status == http.StatusForbidden:
+		rendered.Error.Type = "permission_error"
+	case status == http.StatusNotFound:
+		rendered.Error.Type = "not_found_error"
+	case status == http.StatusTooManyRequests:
+		rendered.Error.Type = "rate_limit_error"
+	case status >= 500:
+		rendered.Error.Type = "server_error"
+	default:
+		rendered.Error.Type = "invalid_request_error"
+	}
+	return rendered
+}
+
+// respondCompletionError answers a chat completion that failed with an
+// OpenAI error: as JSON, or as the last event once the reply is streaming.
+func respondCompletionError(c *gin.Context, stream *completionStream, status int, body api.Error) {
+	if stream != nil && stream.started {
+		stream.write(OpenAIError(status, body))
+		return
+	}
+	c.JSON(status, OpenAIError(status, body))
+}
+
+// completionRequestError describes a request chatHistory rejected, naming
+// the field for a *services.ValidationError.
+func completionRequestError(status int, err error) api.Error {
+	var invalid *services.ValidationError
+	if errors.As(err, &invalid) {
+		return fieldError(invalid.Field, invalid.Message)
+	}
+	return api.NewError(api.CodeForStatus(status), err.Error())
+}
+
+// ChatCompletions answers POST /v1/chat/completions. The messages of the
+// request are the whole context, as with OpenAI; the model is the
+// request's, or that of the conversation named by ConversationHeader, or
+// the default. With the header set the turn is saved: the request's last
+// message and the reply are added to the conversation, and a new
+// conversation also gets the messages before them. Tools are the
+// client's to run, so tool calls end the reply with finish_reason
+// "tool_calls".
+func (h *APIHandler) ChatCompletions(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var req chatCompletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondCompletionError(c, nil, http.StatusBadRequest, bindError(err))
+		return
+	}
+	if req.N > 1 {
+		respondCompletionError(c, nil, http.StatusBadRequest, fieldError("n", "only one choice can be generated"))
+		return
+	}
+	messages, uploads, status, err := h.chatHistory(req.Messages)
+	if err != nil {
+		respondCompletionError(c, nil, status, completionRequestError(status, err))
+		return
+	}
+
+	// Find the conversation to save the turn in, if any
+	var conversation *models.Conversation
+	switch id := c.GetHeader(ConversationHeader); id {
+	case "":
+	case "new":
+		// Created with the turn, once the request has been checked
+		conversation = &models.Conversation{UserID: user.ID, Name: conversationName(messages)}
+	default:
+		if conversation, err = h.conversations.Get(c.Request.Context(), id, user.ID); err != nil {
+			respondCompletionError(c, nil, http.StatusNotFound, api.NewError(api.CodeNotFound, "conversation not found"))
+			return
+		}
+	}
+
+	chain := []string{cmp.Or(req.Model, h.aiClient.GetModel())}
+	if req.Model == "" && conversation != nil && len(conversation.ModelChain()) > 0 {
+		chain = conversation.ModelChain()
+	}
+	if hasImageData(messages) {
+		if chain, err = h.visionModels(c.Request.Context(), chain); err != nil {
+			status, body := visionError(err)
+			respondCompletionError(c, nil, status, body)
+			return
+		}
+	}
+
+	// Register the generation so shutdown waits for it
+	ctx, done, err := h.generations.Start(c.Request.Context())
+	if err != nil {
+		respondCompletionError(c, nil, http.StatusServiceUnavailable, api.NewError(api.CodeUnavailable, err.Error()))
+		return
+	}
+	defer done()
+
+	apiKeyID := ""
+	if key := middleware.CurrentAPIKey(c); key != nil {
+		apiKeyID = key.ID
+	}
+
+	var userMessage *models.Message
+	if conversation != nil {
+		if conversation.ID == "" {
+			conversation.Model = chain[0]
+		}
+		if userMessage, err = h.saveCompletionRequest(ctx, conversation, messages, uploads, apiKeyID); err != nil {
+			respondCompletionError(c, nil, http.StatusInternalServerError, api.NewError(api.CodeInternal, err.Error()))
+			return
+		}
+		c.Header(ConversationHeader, conversation.ID)
+	}
+
+	completion := chatCompletion{
+		ID:      "chatcmpl-" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		Created: time.Now().Unix(),
+		Model:   chain[0],
+	}
+	options := services.ChatOptions{Models: chain, Tools: req.Tools}
+	var stream *completionStream
+	if req.Stream {
+		stream = &completionStream{c: c, chunk: completion}
+		options.OnToken = stream.token
+	}
+
+	result, err := h.aiClient.SendMessage(ctx, messages, options)
+	if err != nil {
+		status, body := turnError(c, ctx, "AI request failed: ", err)
+		if userMessage != nil && body.Code == api.CodeInterrupted {
+			h.markTurn(ctx, userMessage, models.MessageStatusInterrupted)
+		} else if userMessage != nil {
+			h.markTurn(ctx, userMessage, models.MessageStatusFailed)
+		}
+		respondCompletionError(c, stream, status, body)
+		return
+	}
+	if len(req.Tools) == 0 {
+		result.ToolCalls = nil
+	}
+
+	if userMessage != nil {
+		assistantMessage := models.Message{
+			ConversationID:     conversation.ID,
+			APIKeyID:           apiKeyID,
+			Role:               "assistant",
+			Content:            result.Content,
+			TokenCount:         result.CompletionTokens,
+			Status:             models.MessageStatusComplete,
+			Model:              result.Model,
+			PromptTokens:       result.PromptTokens,
+			CompletionTokens:   result.CompletionTokens,
+			LatencyMs:          result.Latency.Milliseconds(),
+			TimeToFirstTokenMs: result.TimeToFirstToken.Milliseconds(),
+			Backend:            result.Backend,
+			ToolCalls:          result.ToolCalls,
+		}
+		if err := h.messages.CompleteTurn(context.WithoutCancel(ctx), userMessage, &assistantMessage); err != nil {
+			h.markTurn(ctx, userMessage, models.MessageStatusFailed)
+			respondCompletionError(c, stream, http.StatusInternalServerError, api.NewError(api.CodeInternal, "failed to save AI response"))
+			return
+		}
+	}
+
+	// Charge the whole context: the client resends it with every request
+	usage := completionUsage{
+		PromptTokens:     result.PromptTokens,
+		CompletionTokens: result.CompletionTokens,
+	}
+	if usage.PromptTokens == 0 {
+		for _, msg := range messages {
+			usage.PromptTokens += msg.TokenCount
+		}
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	middleware.SetTokensUsed(c, usage.TotalTokens)
+
+	completion.Model = result.Model
+	finish := "stop"
+	if len(result.ToolCalls) > 0 {
+		finish = "tool_calls"
+	}
+	if stream != nil {
+		stream.finish(result, finish, &usage, req.StreamOptions.IncludeUsage)
+		return
+	}
+	reply := chatReply{Role: "assistant", ToolCalls: openAIToolCalls(result.ToolCalls, false)}
+	if len(reply.ToolCalls) == 0 || result.Content != "" {
+		reply.Content = &result.Content
+	}
+	completion.Object = "chat.completion"
+	completion.Choices = []completionChoice{{Message: &reply, FinishReason: &finish}}
+	completion.Usage = &usage
+	c.JSON(http.StatusOK, completion)
+}
+
+// chatHistory converts the messages of a chat completion request, with
+// their images decoded. On failure it returns the status to answer with.
+func (h *APIHandler) chatHistory(in []chatMessage) ([]models.Message, [][]imageUpload, int, error) {
+	messages := make([]models.Message, len(in))
+	uploads := make([][]imageUpload, len(in))
+	toolNames := map[string]string{} // tool call ID to tool name
+	for i, msg := range in {
+		field := fmt.Sprintf("messages[%d]", i)
+		role := msg.Role
+		switch role {
+		case "system", "user", "assistant", "tool":
+		case "developer":
+			role = "system"
+		default:
+			return nil, nil, http.StatusBadRequest, &services.ValidationError{Field: field + ".role",
+				Message: field + ".role must be one of system, developer, user, assistant, tool"}
+		}
+
+		content, images, status, err := readContent(msg.Content, field+".content")
+		if err != nil {
+			return nil, nil, status, err
+		}
+		if len(images) > 0 && role != "user" {
+			return nil, nil, http.StatusBadRequest, &services.ValidationError{Field: field + ".content",
+				Message: "only user messages can carry images"}
+		}
+
+		messages[i] = models.Message{
+			Role:       role,
+			Content:    content,
+			TokenCount: h.aiClient.EstimateTokens(content),
+			Status:     models.MessageStatusComplete,
+		}
+		uploads[i] = images
+		for _, image := range images {
+			messages[i].ImageData = append(messages[i].ImageData, image.data)
+		}
+		for _, call := range msg.ToolCalls {
+			toolNames[call.ID] = call.Function.Name
+			arguments := json.RawMessage(call.Function.Arguments)
+			if !json.Valid(arguments) {
+				arguments, _ = json.Marshal(call.Function.Arguments)
+			}
+			messages[i].ToolCalls = append(messages[i].ToolCalls, tools.Call{
+				Function: tools.FunctionCall{Name: call.Function.Name, Arguments: arguments},
+			})
+		}
+		if role == "tool" {
+			messages[i].ToolName = cmp.Or(toolNames[msg.ToolCallID], msg.Name)
+		}
+	}
+	return messages, uploads, 0, nil
+}
+
+// readContent reads the content of a message: a string, or an array of
+// text and image_url parts. Images must be inline data: URLs. On failure
+// it returns the status to answer with.
+func readContent(raw json.RawMessage, field string) (string, []imageUpload, int, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil, 0, nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil, 0, nil
+	}
+	var parts []contentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", nil, http.StatusBadRequest, &services.ValidationError{Field: field,
+			Message: field + " must be a string or an array of content parts"}
+	}
+
+	var texts []string
+	var images []imageUpload
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			texts = append(texts, part.Text)
+		case "image_url":
+			if len(images) == maxImagesPerMessage {
+				return "", nil, http.StatusBadRequest, &services.ValidationError{Field: field,
+					Message: fmt.Sprintf("at most %d images can be sent with a message", maxImagesPerMessage)}
+			}
+			data, err := decodeDataURL(part.ImageURL.URL)
+			if err != nil {
+				return "", nil, http.StatusBadRequest, &services.ValidationError{Field: field, Message: err.Error()}
+			}
+			image, status, err := newImageUpload(fmt.Sprintf("image%d", len(images)+1), data)
+			if err != nil {
+				return "", nil, status, err
+			}
+			images = append(images, image)
+		default:
+			return "", nil, http.StatusBadRequest, &services.ValidationError{Field: field,
+				Message: fmt.Sprintf("content parts of type %q are not supported", part.Type)}
+		}
+	}
+	return strings.Join(texts, "\n"), images, 0, nil
+}
+
+// decodeDataURL returns the bytes of a base64 data: URL.
+func decodeDataURL(url string) ([]byte, error) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return nil, errors.New("images must be sent as base64 data: URLs")
+	}
+	meta, payload, ok := strings.Cut(rest, ",")
+	if !ok || !strings.HasSuffix(meta, ";base64") {
+		return nil, errors.New("images must be sent as base64 data: URLs")
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errors.New("image data is not valid base64")
+	}
+	if int64(len(data)) > maxImageBytes {
+		return nil, fmt.Errorf("image is larger than %d bytes", maxImageBytes)
+	}
+	return data, nil
+}
+
+// hasImageData reports whether any of the messages carries image bytes.
+func hasImageData(messages []models.Message) bool {
+	for _, msg := range messages {
+		if len(msg.ImageData) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// conversationName names a conversation after its first user message.
+func conversationName(messages []models.Message) string {
+	for _, msg := range messages {
+		if msg.Role == "user" && msg.Content != "" {
+			name := []rune(strings.Join(strings.Fields(msg.Content), " "))
+			if len(name) > 60 {
+				return string(name[:60]) + "…"
+			}
+			return string(name)
+		}
+	}
+	return "Chat completion"
+}
+
+// saveCompletionRequest saves the last of messages, pending, in the
+// conversation and returns it. A conversation not saved yet is created
+// first, with the messages before it. Their images are stored too.
+func (h *APIHandler) saveCompletionRequest(ctx context.Context, conversation *models.Conversation, messages []models.Message, uploads [][]imageUpload, apiKeyID string) (*models.Message, error) {
+	saved := make([]*models.Message, len(messages))
+	var stored []models.Image
+	for i := range messages {
+		msg := messages[i]
+		msg.ImageData = nil
+		msg.APIKeyID = apiKeyID
+		refs, err := h.storeImages(ctx, uploads[i])
+		if err != nil {
+			h.deleteImages(ctx, stored)
+			return nil, errors.New("failed to save images")
+		}
+		msg.Images = refs
+		stored = append(stored, refs...)
+		saved[i] = &msg
+	}
+	last := saved[len(saved)-1]
+	last.Status = models.MessageStatusPending
+
+	if conversation.ID == "" {
+		// Date the earlier messages a little in the past, a millisecond
+		// apart, so they keep their order ahead of the turn
+		start := time.Now().Add(-time.Duration(len(saved)) * time.Millisecond)
+		conversation.CreatedAt = start
+		for i, msg := range saved[:len(saved)-1] {
+			msg.CreatedAt = start.Add(time.Duration(i) * time.Millisecond)
+			if msg.Role == "system" && conversation.SystemPrompt == "" {
+				conversation.SystemPrompt = msg.Content
+			}
+		}
+		if err := h.conversations.Create(ctx, conversation, saved[:len(saved)-1]...); err != nil {
+			h.deleteImages(ctx, stored)
+			return nil, errors.New("failed to create conversation")
+		}
+	}
+
+	last.ConversationID = conversation.ID
+	if err := h.messages.Create(ctx, last); err != nil {
+		h.deleteImages(ctx, stored)
+		return nil, errors.New("failed to save message")
+	}
+	return last, nil
+}
+
+// openAIToolCalls converts tool calls to OpenAI's format, numbering them
+// when they are streamed.
+func openAIToolCalls(calls []tools.Call, indexed bool) []chatToolCall {
+	converted := make([]chatToolCall, len(calls))
+	for i, call := range calls {
+		arguments := string(call.Function.Arguments)
+		if arguments == "" {
+			arguments = "{}"
+		}
+		converted[i] = chatToolCall{
+			ID:       "call_" + strings.ReplaceAll(uuid.New().String(), "-", "")[:24],
+			Type:     "function",
+			Function: chatFunctionCall{Name: call.Function.Name, Arguments: arguments},
+		}
+		if indexed {
+			converted[i].Index = &i
+		}
+	}
+	return converted
+}
+
+// completionStream relays a chat completion as OpenAI streams it: server-
+// sent "chat.completion.chunk" events, a chunk with the finish reason, an
+// optional usage chunk and "[DONE]". Like tokenStream it writes nothing
+// until the first token, so early failures get a plain error response.
+type completionStream struct {
+	c       *gin.Context
+	chunk   chatCompletion // the ID, creation time and model of every chunk
+	started bool
+}
+
+// token sends a piece of the reply, the first along with the role.
+func (s *completionStream) token(content string) {
+	delta := &chatReply{Content: &content}
+	if !s.started {
+		delta.Role = "assistant"
+	}
+	s.send(delta, nil)
+}
+
+// finish sends the tool calls, if any, the finish reason, the usage if
+// asked for, and ends the stream.
+func (s *completionStream) finish(result *services.ChatResult, reason string, usage *completionUsage, includeUsage bool) {
+	s.chunk.Model = result.Model
+	if len(result.ToolCalls) > 0 || !s.started {
+		delta := &chatReply{Role: "assistant", ToolCalls: openAIToolCalls(result.ToolCalls, true)}
+		if len(result.ToolCalls) == 0 {
+			delta.Content = &result.Content
+		}
+		s.send(delta, nil)
+	}
+	s.send(&chatReply{}, &reason)
+	if includeUsage {
+		chunk := s.chunk
+		chunk.Object = "chat.completion.chunk"
+		chunk.Choices = []completionChoice{}
+		chunk.Usage = usage
+		s.write(chunk)
+	}
+	s.write("[DONE]")
+}
+
+func (s *completionStream) send(delta *chatReply, reason *string) {
+	chunk := s.chunk
+	chunk.Object = "chat.completion.chunk"
+	chunk.Choices = []completionChoice{{Delta: delta, FinishReason: reason}}
+	s.write(chunk)
+}
+
+// write sends one event: data as is if it is a string, JSON otherwise.
+func (s *completionStream) write(data any) {
+	if !s.started {
+		s.started = true
+		s.c.Header("Content-Type", "text/event-stream")
+		s.c.Header("Cache-Control", "no-cache")
+		s.c.Header("X-Accel-Buffering", "no") // keep proxies from holding events back
+		s.c.Status(http.StatusOK)
+	}
+	payload, ok := data.(string)
+	if !ok {
+		encoded, _ := json.Marshal(data)
+		payload = string(encoded)
+	}
+	fmt.Fprintf(s.c.Writer, "data: %s\n\n", payload)
+	s.c.Writer.Flush()
+}
+
+// ListModels answers GET /v1/models: the default model and those the
+// model servers report, in OpenAI's format.
+func (h *APIHandler) ListModels(c *gin.Context) {
+	list := modelList{Object: "list", Data: []modelInfo{}}
+	seen := map[string]bool{}
+	add := func(id string) {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			list.Data = append(list.Data, modelInfo{ID: id, Object: "model", OwnedBy: "ollama"})
+		}
+	}
+	add(h.aiClient.GetModel())
+	if r, ok := h.aiClient.(services.BackendReporter); ok {
+		for _, backend := range r.Backends() {
+			for _, model := range backend.Models {
+				add(model)
+			}
+		}
+	}
+	c.JSON(http.StatusOK, list)
+}
@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"ai-chatbot-web/internal/fakeollama"
+	"ai-chatbot-web/internal/services"
+	"ai-chatbot-web/internal/tools"
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// complete posts a chat completion as user, saving it in the conversation
+// named, if any.
+func (ts *testServer) complete(t *testing.T, user, conversation string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal body: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Test-User", user)
+	if conversation != "" {
+		req.Header.Set(ConversationHeader, conversation)
+	}
+	rec := httptest.NewRecorder()
+	ts.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON %q: %v", rec.Body.String(), err)
+	}
+	return body
+}
+
+func TestChatCompletions(t *testing.T) {
+	ts := newTestServer(t, storeFactories["memory"])
+
+	rec := ts.complete(t, "alice", "", gin.H{
+		"model": "llama3",
+		"messages": []gin.H{
+			{"role": "developer", "content": "Be brief."},
+			{"role": "user", "content": []gin.H{{"type": "text", "text": "hello"}, {"type": "text", "text": "there"}}},
+		},
+		"temperature": 0.2,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+	body := decode(t, rec)
+	choice := body["choices"].([]any)[0].(map[string]any)
+	message := choice["message"].(map[string]any)
+	if body["object"] != "chat.completion" || body["model"] != "llama3" || !strings.HasPrefix(body["id"].(string), "chatcmpl-") {
+		t.Errorf("completion = %v", body)
+	}
+	if message["role"] != "assistant" || message["content"] != "echo: hello\nthere" || choice["finish_reason"] != "stop" {
+		t.Errorf("choice = %v", choice)
+	}
+	if usage := body["usage"].(map[string]any); usage["prompt_tokens"] != 7.0 || usage["total_tokens"] != 10.0 {
+		t.Errorf("usage = %v", usage)
+	}
+	if rec.Header().Get(ConversationHeader) != "" {
+		t.Error("a completion without the header was saved")
+	}
+
+	sent := ts.ai.lastCall()
+	if len(sent) != 2 || sent[0].Role != "system" || sent[0].Content != "Be brief." || sent[1].Role != "user" {
+		t.Errorf("sent %+v", sent)
+	}
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	ts := newTestServer(t, storeFactories["memory"])
+
+	rec := ts.complete(t, "alice", "", gin.H{
+		"messages":       []gin.H{{"role": "user", "content": "hello there"}},
+		"stream":         true,
+		"stream_options": gin.H{"include_usage": true},
+	})
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+
+	var chunks []map[string]any
+	var done bool
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk map[string]any
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("chunk %q: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if !done || len(chunks) < 4 {
+		t.Fatalf("done %v, chunks %v", done, chunks)
+	}
+
+	var content strings.Builder
+	for i, chunk := range chunks[:len(chunks)-2] {
+		delta := chunk["choices"].([]any)[0].(map[string]any)["delta"].(map[string]any)
+		if (i == 0) != (delta["role"] == "assistant") {
+			t.Errorf("chunk %d: delta %v", i, delta)
+		}
+		content.WriteString(delta["content"].(string))
+	}
+	if content.String() != "echo: hello there" {
+		t.Errorf("streamed %q", content.String())
+	}
+	last := chunks[len(chunks)-2]["choices"].([]any)[0].(map[string]any)
+	if last["finish_reason"] != "stop" {
+		t.Errorf("last chunk %v", last)
+	}
+	usage := chunks[len(chunks)-1]
+	if len(usage["choices"].([]any)) != 0 || usage["usage"].(map[string]any)["completion_tokens"] != 3.0 {
+		t.Errorf("usage chunk %v", usage)
+	}
+}
+
+func TestChatCompletionsSaveConversation(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ts *testServer) {
+		history := []gin.H{
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": "hi"},
+			{"role": "assistant", "content": "hello"},
+			{"role": "user", "content": "how are you?"},
+		}
+		rec := ts.complete(t, "alice", "new", gin.H{"model": "llama3", "messages": history})
+		id := rec.Header().Get(ConversationHeader)
+		if rec.Code != http.StatusOK || id == "" {
+			t.Fatalf("status %d, conversation %q, body %s", rec.Code, id, rec.Body)
+		}
+
+		_, body := ts.do(t, "alice", http.MethodGet, "/api/v1/conversations/"+id, nil)
+		conversation := body["conversation"].(map[string]any)
+		if conversation["name"] != "hi" || conversation["model"] != "llama3" || conversation["system_prompt"] != "Be brief." {
+			t.Errorf("conversation = %v", conversation)
+		}
+		messages := messagesOf(body)
+		want := []string{"Be brief.", "hi", "hello", "how are you?", "echo: how are you?"}
+		if len(messages) != len(want) {
+			t.Fatalf("saved %d messages, want %d: %v", len(messages), len(want), messages)
+		}
+		for i, msg := range messages {
+			if msg["content"] != want[i] || msg["status"] != "complete" {
+				t.Errorf("message %d = %v, want %q", i, msg, want[i])
+			}
+		}
+		if messages[4]["model"] != "llama3" || messages[4]["completion_tokens"] != 3.0 {
+			t.Errorf("reply = %v", messages[4])
+		}
+
+		// The next turn uses the conversation's model and only adds itself
+		history = append(history, gin.H{"role": "assistant", "content": "echo: how are you?"}, gin.H{"role": "user", "content": "bye"})
+		rec = ts.complete(t, "alice", id, gin.H{"messages": history})
+		if rec.Code != http.StatusOK || decode(t, rec)["model"] != "llama3" || rec.Header().Get(ConversationHeader) != id {
+			t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+		}
+		_, body = ts.do(t, "alice", http.MethodGet, "/api/v1/conversations/"+id, nil)
+		if messages := messagesOf(body); len(messages) != 7 || messages[5]["content"] != "bye" || messages[6]["content"] != "echo: bye" {
+			t.Errorf("messages = %v", messages)
+		}
+
+		// A failed reply leaves the turn retryable
+		ts.ai.setErr(&services.UpstreamError{Kind: services.UpstreamUnavailable, Err: errors.New("model down")})
+		rec = ts.complete(t, "alice", id, gin.H{"messages": []gin.H{{"role": "user", "content": "again"}}})
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+		}
+		_, body = ts.do(t, "alice", http.MethodGet, "/api/v1/conversations/"+id, nil)
+		if messages := messagesOf(body); messages[len(messages)-1]["status"] != "failed" {
+			t.Errorf("failed turn saved as %v", messages[len(messages)-1])
+		}
+
+		// Other users' conversations are out of reach
+		rec = ts.complete(t, "bob", id, gin.H{"messages": history})
+		if rec.Code != http.StatusNotFound || decode(t, rec)["error"].(map[string]any)["type"] != "not_found_error" {
+			t.Errorf("bob: status %d, body %s", rec.Code, rec.Body)
+		}
+	})
+}
+
+func TestChatCompletionsToolCalls(t *testing.T) {
+	ts := newTestServer(t, storeFactories["memory"])
+	ts.ai.toolCalls = [][]tools.Call{{calculateCall("6 * 7")}}
+	calculate := gin.H{"type": "function", "function": gin.H{"name": "calculate", "parameters": gin.H{"type": "object"}}}
+
+	rec := ts.complete(t, "alice", "", gin.H{
+		"messages": []gin.H{{"role": "user", "content": "what is 6 * 7?"}},
+		"tools":    []gin.H{calculate},
+	})
+	body := decode(t, rec)
+	choice := body["choices"].([]any)[0].(map[string]any)
+	if rec.Code != http.StatusOK || choice["finish_reason"] != "tool_calls" {
+		t.Fatalf("status %d, body %v", rec.Code, body)
+	}
+	call := choice["message"].(map[string]any)["tool_calls"].([]any)[0].(map[string]any)
+	function := call["function"].(map[string]any)
+	if call["type"] != "function" || call["id"] == "" || function["name"] != "calculate" || !strings.Contains(function["arguments"].(string), "6 * 7") {
+		t.Errorf("tool call = %v", call)
+	}
+
+	// The client runs the tool and sends back its result
+	rec = ts.complete(t, "alice", "", gin.H{
+		"messages": []gin.H{
+			{"role": "user", "content": "what is 6 * 7?"},
+			{"role": "assistant", "content": nil, "tool_calls": []any{call}},
+			{"role": "tool", "tool_call_id": call["id"], "content": "42"},
+		},
+		"tools": []gin.H{calculate},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+	sent := ts.ai.lastCall()
+	if len(sent) != 3 || len(sent[1].ToolCalls) != 1 || sent[1].ToolCalls[0].Function.Name != "calculate" ||
+		sent[2].Role != "tool" || sent[2].ToolName != "calculate" || sent[2].Content != "42" {
+		t.Errorf("sent %+v", sent)
+	}
+}
+
+func TestChatCompletionsImages(t *testing.T) {
+	ts := newTestServer(t, storeFactories["memory"])
+	image := func(url string) gin.H {
+		return gin.H{"messages": []gin.H{{"role": "user", "content": []gin.H{
+			{"type": "text", "text": "what is this?"},
+			{"type": "image_url", "image_url": gin.H{"url": url}},
+		}}}}
+	}
+	dataURL := "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte(png))
+
+	rec := ts.complete(t, "alice", "new", image(dataURL))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+	if sent := ts.ai.lastCall(); len(sent) != 1 || len(sent[0].ImageData) != 1 || string(sent[0].ImageData[0]) != png {
+		t.Errorf("sent %+v", sent)
+	}
+	_, body := ts.do(t, "alice", http.MethodGet, "/api/v1/conversations/"+rec.Header().Get(ConversationHeader), nil)
+	if images, _ := messagesOf(body)[0]["images"].([]any); len(images) != 1 {
+		t.Errorf("saved message = %v", messagesOf(body)[0])
+	}
+
+	rec = ts.complete(t, "alice", "", image("https://example.com/cat.png"))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("remote image: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	ts.ai.setBlind("fake-model")
+	rec = ts.complete(t, "alice", "", image(dataURL))
+	if rec.Code != http.StatusBadRequest || decode(t, rec)["error"].(map[string]any)["code"] != "vision_unsupported" {
+		t.Errorf("blind model: status %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestChatCompletionsErrors(t *testing.T) {
+	ts := newTestServer(t, storeFactories["memory"])
+	hello := []gin.H{{"role": "user", "content": "hello"}}
+
+	tests := []struct {
+		name   string
+		body   any
+		status int
+		kind   string
+		param  any
+	}{
+		{"no messages", gin.H{"model": "llama3"}, http.StatusBadRequest, "invalid_request_error", "messages"},
+		{"bad role", gin.H{"messages": []gin.H{{"role": "robot", "content": "hi"}}}, http.StatusBadRequest, "invalid_request_error", "messages[0].role"},
+		{"bad content", gin.H{"messages": []gin.H{{"role": "user", "content": 42}}}, http.StatusBadRequest, "invalid_request_error", "messages[0].content"},
+		{"several choices", gin.H{"messages": hello, "n": 2}, http.StatusBadRequest, "invalid_request_error", "n"},
+	}
+	for _, tt := range tests {
+		rec := ts.complete(t, "alice", "", tt.body)
+		failure, _ := decode(t, rec)["error"].(map[string]any)
+		if rec.Code != tt.status || failure["type"] != tt.kind || failure["param"] != tt.param || failure["message"] == "" {
+			t.Errorf("%s: status %d, body %s", tt.name, rec.Code, rec.Body)
+		}
+	}
+
+	ts.ai.setErr(&services.UpstreamError{Kind: services.UpstreamFailed, Err: errors.New("model crashed")})
+	rec := ts.complete(t, "alice", "", gin.H{"messages": hello})
+	if failure := decode(t, rec)["error"].(map[string]any); rec.Code != http.StatusBadGateway || failure["type"] != "server_error" || failure["param"] != nil {
+		t.Errorf("upstream failure: status %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestListModels(t *testing.T) {
+	ts := newTestServer(t, storeFactories["memory"])
+	rec := ts.get(t, "alice", "/v1/models")
+	body := decode(t, rec)
+	data := body["data"].([]any)
+	if rec.Code != http.StatusOK || body["object"] != "list" || len(data) != 1 {
+		t.Fatalf("status %d, body %v", rec.Code, body)
+	}
+	if model := data[0].(map[string]any); model["id"] != "fake-model" || model["object"] != "model" {
+		t.Errorf("model = %v", model)
+	}
+}
+
+func TestIntegrationChatCompletions(t *testing.T) {
+	ts, _ := newIntegrationServer(t)
+
+	rec := ts.complete(t, "alice", "new", gin.H{
+		"messages": []gin.H{{"role": "user", "content": "hello"}},
+		"stream":   true,
+	})
+	if rec.Code != http.StatusOK || !strings.HasSuffix(rec.Body.String(), "data: [DONE]\n\n") {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body)
+	}
+	_, body := ts.do(t, "alice", http.MethodGet, "/api/v1/conversations/"+rec.Header().Get(ConversationHeader), nil)
+	messages := messagesOf(body)
+	if len(messages) != 2 || messages[1]["role"] != "assistant" || messages[1]["content"] == "" || messages[1]["backend"] == "" {
+		t.Errorf("messages = %v", messages)
+	}
+
+	rec = ts.get(t, "alice", "/v1/models")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"id":"`+fakeollama.DefaultModel+`"`) {
+		t.Errorf("models: status %d, body %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"ai-chatbot-web/api"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAPI builds the OpenAPI document once.
+var openAPI = sync.OnceValues(api.OpenAPI)
+
+// OpenAPI serves the OpenAPI 3 document of the API.
+func OpenAPI(c *gin.Context) {
+	doc, err := openAPI()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to describe the API")
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", doc)
+}
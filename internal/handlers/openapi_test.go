@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"ai-chatbot-web/api"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// document is the part of an OpenAPI document the tests look at.
+type document struct {
+	Paths      map[string]map[string]map[string]any `json:"paths"`
+	Components struct {
+		Schemas map[string]any `json:"schemas"`
+	} `json:"components"`
+}
+
+func TestOpenAPIMatchesRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	Routes{}.Register(router)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("openapi.json: status %d", rec.Code)
+	}
+	var doc document
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("openapi.json is not JSON: %v", err)
+	}
+
+	param := regexp.MustCompile(`:(\w+)`)
+	var routed []string
+	for _, route := range router.Routes() {
+		if path, ok := strings.CutPrefix(route.Path, "/api/v1"); ok {
+			routed = append(routed, route.Method+" "+param.ReplaceAllString(path, "{$1}"))
+		}
+	}
+	var documented []string
+	for path, ops := range doc.Paths {
+		for method, op := range ops {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+			if _, ok := op["responses"].(map[string]any)["default"]; !ok {
+				t.Errorf("%s %s does not document its errors", method, path)
+			}
+		}
+	}
+	slices.Sort(routed)
+	slices.Sort(documented)
+	if !slices.Equal(routed, documented) {
+		t.Errorf("documented routes differ from the router:\nrouted:     %v\ndocumented: %v", routed, documented)
+	}
+
+	// every schema referenced is defined
+	refs := regexp.MustCompile(`"#/components/schemas/(\w+)"`).FindAllStringSubmatch(rec.Body.String(), -1)
+	for _, ref := range refs {
+		if doc.Components.Schemas[ref[1]] == nil {
+			t.Errorf("schema %s is referenced but not defined", ref[1])
+		}
+	}
+	errorSchema, _ := json.Marshal(doc.Components.Schemas["Error"])
+	for _, field := range []string{"code", "message", "field"} {
+		if !strings.Contains(string(errorSchema), `"`+field+`"`) {
+			t.Errorf("Error schema lacks %s: %s", field, errorSchema)
+		}
+	}
+}
+
+func TestUnknownRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	Routes{}.Register(router)
+
+	tests := []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{http.MethodGet, "/api/v1/nothing-here", http.StatusNotFound, api.CodeNotFound},
+		{http.MethodGet, "/v1/nothing-here", http.StatusNotFound, api.CodeNotFound},
+		{http.MethodDelete, "/api/v1/health", http.StatusMethodNotAllowed, api.CodeMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		var body api.Error
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s %s: body is not JSON: %q", tt.method, tt.path, rec.Body)
+			continue
+		}
+		if rec.Code != tt.status || body.Code != tt.code || body.Message == "" {
+			t.Errorf("%s %s = %d %+v, want %d %s", tt.method, tt.path, rec.Code, body, tt.status, tt.code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/health", nil))
+	if allow := rec.Header().Get("Allow"); !strings.Contains(allow, http.MethodGet) {
+		t.Errorf("Allow = %q, want GET listed", allow)
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	ts := newTestServer(t, storeFactories["memory"])
+	id := ts.createConversation(t, "alice")
+	path := "/api/v1/conversations/" + id
+	_, conversation := ts.do(t, "alice", http.MethodGet, path, nil)
+	systemMessage := messagesOf(conversation)[0]["id"].(string)
+
+	tests := []struct {
+		name         string
+		method, path string
+		body         any
+		status       int
+		code, field  string
+	}{
+		{"unknown conversation", http.MethodGet, "/api/v1/conversations/nope", nil, http.StatusNotFound, api.CodeNotFound, ""},
+		{"not an object", http.MethodPost, path + "/messages", []string{"hi"}, http.StatusBadRequest, api.CodeInvalidRequest, ""},
+		{"wrong type", http.MethodPost, path + "/messages", gin.H{"content": 42}, http.StatusBadRequest, api.CodeValidationFailed, "content"},
+		{"too many fallbacks", http.MethodPost, "/api/v1/conversations", gin.H{"fallback_models": []string{"a", "b", "c", "d", "e", "f"}},
+			http.StatusBadRequest, api.CodeValidationFailed, "fallback_models"},
+		{"unknown tool", http.MethodPut, path + "/tools", gin.H{"tools": []string{"nope"}}, http.StatusBadRequest, api.CodeValidationFailed, "tools"},
+		{"unknown export format", http.MethodGet, path + "/export?format=doc", nil, http.StatusBadRequest, api.CodeValidationFailed, "format"},
+		{"retry a complete message", http.MethodPost, path + "/messages/" + systemMessage + "/retry", nil,
+			http.StatusConflict, api.CodeNotRetryable, ""},
+	}
+	for _, tt := range tests {
+		code, body := ts.do(t, "alice", tt.method, tt.path, tt.body)
+		if code != tt.status || body["status"] != "error" || body["code"] != tt.code || body["message"] == "" {
+			t.Errorf("%s: status %d, body %v; want %d %s", tt.name, code, body, tt.status, tt.code)
+		}
+		if field, _ := body["field"].(string); field != tt.field {
+			t.Errorf("%s: field = %q, want %q", tt.name, field, tt.field)
+		}
+	}
+}
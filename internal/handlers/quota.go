@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"ai-chatbot-web/api"
+	"ai-chatbot-web/internal/middleware"
+	"ai-chatbot-web/internal/ratelimit"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type QuotaHandler struct {
+	quota *ratelimit.Quota
+}
+
+func NewQuotaHandler(quota *ratelimit.Quota) *QuotaHandler {
+	return &QuotaHandler{
+		quota: quota,
+	}
+}
+
+// GetQuota reports the caller's request and token usage against its limits.
+func (h *QuotaHandler) GetQuota(c *gin.Context) {
+	response := api.QuotaResponse{
+		Status: "success",
+	}
+
+	for _, subject := range middleware.Subjects(c) {
+		usage, err := h.quota.Usage(subject)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to retrieve usage")
+			return
+		}
+		subjectUsage := api.SubjectUsage{
+			ID:       usage.ID,
+			Requests: api.BucketUsage(usage.Requests),
+			Tokens:   api.BucketUsage(usage.Tokens),
+		}
+		switch subject.Kind {
+		case ratelimit.KindUser:
+			response.User = &subjectUsage
+		case ratelimit.KindAPIKey:
+			response.APIKey = &subjectUsage
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"ai-chatbot-web/internal/middleware"
+	"ai-chatbot-web/internal/ratelimit"
+	"ai-chatbot-web/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Routes holds the handlers served under /api/v1 and the services their
+// middleware authenticates and limits requests with.
+type Routes struct {
+	API     *APIHandler
+	Auth    *AuthHandler
+	APIKeys *APIKeyHandler
+	Usage   *UsageHandler
+	Quota   *QuotaHandler
+
+	AuthService   *services.AuthService
+	APIKeyService *services.APIKeyService
+	Limits        *ratelimit.Quota
+}
+
+// Register adds the /api/v1 routes to router. They are described by
+// api.OpenAPI, which must list every route added here. The
+// OpenAI-compatible /v1 routes are added too. Unknown routes and methods
+// are answered with the error envelope, and request fields are named in
+// validation errors as clients send them.
+func (r Routes) Register(router *gin.Engine) {
+	registerFieldNames()
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(notFound)
+	router.NoMethod(methodNotAllowed)
+
+	api := router.Group("/api/v1")
+	api.Use(middleware.APIKeyAuth(r.APIKeyService))
+	{
+		api.GET("/health", r.API.HealthCheck)
+		api.GET("/openapi.json", OpenAPI)
+		api.POST("/auth/register", r.Auth.Register)
+		api.POST("/auth/login", r.Auth.Login)
+	}
+
+	// Routes below require a valid session token or API key
+	protected := api.Group("")
+	protected.Use(middleware.RequireAuth(r.AuthService))
+	protected.Use(middleware.RateLimit(r.Limits))
+	{
+		protected.POST("/auth/logout", r.Auth.Logout)
+		protected.GET("/auth/me", r.Auth.Me)
+		protected.GET("/api-keys", r.APIKeys.ListAPIKeys)
+		protected.POST("/api-keys", r.APIKeys.CreateAPIKey)
+		protected.DELETE("/api-keys/:id", r.APIKeys.RevokeAPIKey)
+		protected.GET("/usage", r.Usage.GetUsage)
+		protected.GET("/usage/quota", r.Quota.GetQuota)
+		protected.GET("/conversations", r.API.GetConversations)
+		protected.POST("/conversations", r.API.CreateConversation)
+		protected.POST("/conversations/import", r.API.ImportConversations)
+		protected.GET("/conversations/:id", r.API.GetConversation)
+		protected.GET("/conversations/:id/export", r.API.ExportConversation)
+		protected.PUT("/conversations/:id/tools", r.API.SetConversationTools)
+		protected.GET("/tools", r.API.ListTools)
+		protected.GET("/conversations/:id/documents", r.API.ListDocuments)
+		protected.POST("/conversations/:id/documents", r.API.UploadDocument)
+		protected.DELETE("/conversations/:id/documents/:document_id", r.API.DeleteDocument)
+		protected.GET("/conversations/:id/images/:image_id", r.API.GetImage)
+		protected.POST("/conversations/:id/messages", middleware.TokenQuota(r.Limits), r.API.SendMessage)
+		protected.POST("/conversations/:id/messages/:message_id/retry", middleware.TokenQuota(r.Limits), r.API.RetryMessage)
+		protected.DELETE("/conversations/:id", r.API.DeleteConversation)
+	}
+
+	// OpenAI's protocol, errors included, for SDKs and editors built for it
+	openai := router.Group("/v1")
+	openai.Use(middleware.RenderErrors(OpenAIError))
+	openai.Use(middleware.APIKeyAuth(r.APIKeyService))
+	openai.Use(middleware.RequireAuth(r.AuthService))
+	openai.Use(middleware.RateLimit(r.Limits))
+	{
+		openai.GET("/models", r.API.ListModels)
+		openai.POST("/chat/completions", middleware.TokenQuota(r.Limits), r.API.ChatCompletions)
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"ai-chatbot-web/api"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamKey holds the *tokenStream of a request on the gin context.
+const streamKey = "token_stream"
+
+// tokenStream relays a reply as server-sent events while the model writes
+// it, for requests made with ?stream=true. Each piece of the reply is a
+// "token" event with {"content": ...}. A "reset" event drops the tokens
+// sent so far when the reply starts over, from a fallback model or after
+// tool calls. The turn ends with a "done" event carrying the usual
+// response body, or an "error" event.
+//
+// Nothing is written until the first token, so a turn that fails before
+// the model starts answering gets a plain JSON error and status code.
+type tokenStream struct {
+	c       *gin.Context
+	started bool
+}
+
+// turnStream returns the stream of the request, or nil when the reply is
+// not to be streamed.
+func turnStream(c *gin.Context) *tokenStream {
+	if value, ok := c.Get(streamKey); ok {
+		return value.(*tokenStream)
+	}
+	if c.Query("stream") != "true" {
+		return nil
+	}
+	stream := &tokenStream{c: c}
+	c.Set(streamKey, stream)
+	return stream
+}
+
+// token sends a piece of the reply.
+func (s *tokenStream) token(content string) {
+	s.send(api.EventToken, api.StreamToken{Content: content})
+}
+
+// reset tells the client to drop the tokens sent so far, if any.
+func (s *tokenStream) reset() {
+	if s.started {
+		s.send(api.EventReset, struct{}{})
+	}
+}
+
+func (s *tokenStream) send(event string, body any) {
+	if !s.started {
+		s.started = true
+		s.c.Header("X-Accel-Buffering", "no") // keep proxies from holding events back
+		s.c.Status(http.StatusOK)
+	}
+	s.c.SSEvent(event, body)
+	s.c.Writer.Flush()
+}
+
+// respondTurn ends a turn with status and body: as JSON, or as the last
+// event when the reply is streamed. Errors before the first token are
+// still answered with JSON.
+func respondTurn(c *gin.Context, status int, body any) {
+	stream := turnStream(c)
+	if stream == nil || (!stream.started && status != http.StatusOK) {
+		c.JSON(status, body)
+		return
+	}
+	if status == http.StatusOK {
+		stream.send(api.EventDone, body)
+	} else {
+		stream.send(api.EventError, body)
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"ai-chatbot-web/internal/fakeollama"
+	"ai-chatbot-web/internal/services"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// event is a server-sent event with its data decoded.
+type event struct {
+	name string
+	data map[string]any
+}
+
+// stream posts path with ?stream=true and returns the response and the
+// events it holds.
+func (ts *testServer) stream(t *testing.T, user, path string, body any) (*httptest.ResponseRecorder, []event) {
+	t.Helper()
+
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path+"?stream=true", strings.NewReader(string(payload)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Test-User", user)
+	rec := httptest.NewRecorder()
+	ts.router.ServeHTTP(rec, req)
+
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/event-stream") {
+		return rec, nil
+	}
+	var events []event
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			events = append(events, event{name: strings.TrimPrefix(line, "event:")})
+		case strings.HasPrefix(line, "data:"):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &events[len(events)-1].data); err != nil {
+				t.Fatalf("event data %q: %v", line, err)
+			}
+		}
+	}
+	return rec, events
+}
+
+func TestSendMessageStream(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ts *testServer) {
+		id := ts.createConversation(t, "alice")
+		path := "/api/v1/conversations/" + id + "/messages"
+
+		rec, events := ts.stream(t, "alice", path, gin.H{"content": "hello there"})
+		if rec.Code != http.StatusOK || len(events) != 4 {
+			t.Fatalf("stream: status %d, events %+v, body %s", rec.Code, events, rec.Body)
+		}
+		var reply strings.Builder
+		for _, e := range events[:3] {
+			if e.name != "token" {
+				t.Fatalf("event %+v before the reply ended", e)
+			}
+			reply.WriteString(e.data["content"].(string))
+		}
+		if reply.String() != "echo: hello there" {
+			t.Errorf("streamed reply = %q", reply.String())
+		}
+		done := events[3]
+		if done.name != "done" || done.data["assistant_message"].(map[string]any)["content"] != "echo: hello there" {
+			t.Errorf("last event = %+v", done)
+		}
+
+		_, body := ts.do(t, "alice", http.MethodGet, "/api/v1/conversations/"+id, nil)
+		if n := len(messagesOf(body)); n != 3 {
+			t.Errorf("streamed turn not saved: %d messages", n)
+		}
+
+		// failures before the first token are plain JSON errors
+		ts.ai.setErr(&services.UpstreamError{Kind: services.UpstreamUnavailable, Err: errors.New("model down")})
+		rec, events = ts.stream(t, "alice", path, gin.H{"content": "again"})
+		if rec.Code != http.StatusServiceUnavailable || events != nil || !strings.Contains(rec.Body.String(), "model down") {
+			t.Errorf("failed stream: status %d, body %s", rec.Code, rec.Body)
+		}
+	})
+}
+
+func TestIntegrationStream(t *testing.T) {
+	ts, fake := newIntegrationServer(t)
+	id := ts.createConversation(t, "alice")
+
+	fake.Respond("Streaming works fine.")
+	rec, events := ts.stream(t, "alice", "/api/v1/conversations/"+id+"/messages", gin.H{"content": "Does it?"})
+	if rec.Code != http.StatusOK || len(events) < 3 {
+		t.Fatalf("stream: status %d, body %s", rec.Code, rec.Body)
+	}
+	var reply strings.Builder
+	for _, e := range events[:len(events)-1] {
+		reply.WriteString(e.data["content"].(string))
+	}
+	last := events[len(events)-1]
+	if reply.String() != "Streaming works fine." || last.name != "done" {
+		t.Errorf("streamed %q, then %+v", reply.String(), last)
+	}
+}
+
+func TestIntegrationStreamResetsAfterToolCalls(t *testing.T) {
+	ts, fake := newIntegrationServer(t)
+	code, body := ts.do(t, "alice", http.MethodPost, "/api/v1/conversations", gin.H{
+		"name":  "tools",
+		"tools": []string{"calculate"},
+	})
+	if code != http.StatusCreated {
+		t.Fatalf("create: status %d, body %v", code, body)
+	}
+	id := body["conversation"].(map[string]any)["id"].(string)
+
+	fake.Script(fakeollama.Reply{
+		Content:   "Let me work it out.",
+		ToolCalls: []fakeollama.ToolCall{fakeollama.Call("calculate", `{"expression": "6 * 7"}`)},
+	})
+	fake.Respond("It is 42.")
+	rec, events := ts.stream(t, "alice", "/api/v1/conversations/"+id+"/messages", gin.H{"content": "what is 6 * 7?"})
+	if rec.Code != http.StatusOK || len(events) < 3 {
+		t.Fatalf("stream: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	// what a client shows: the tokens since the last reset
+	var reply strings.Builder
+	resets := 0
+	for _, e := range events[:len(events)-1] {
+		switch e.name {
+		case "reset":
+			reply.Reset()
+			resets++
+		case "token":
+			reply.WriteString(e.data["content"].(string))
+		}
+	}
+	last := events[len(events)-1]
+	if resets != 1 || reply.String() != "It is 42." || last.name != "done" {
+		t.Errorf("%d resets, shown %q, then %+v", resets, reply.String(), last)
+	}
+}
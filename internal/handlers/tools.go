@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"ai-chatbot-web/api"
+	"ai-chatbot-web/internal/middleware"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListTools describes the tools conversations can enable.
+func (h *APIHandler) ListTools(c *gin.Context) {
+	definitions := h.tools.Definitions()
+	c.JSON(http.StatusOK, api.ToolList{
+		Tools: definitions,
+		Count: len(definitions),
+	})
+}
+
+// SetConversationTools replaces the tools the model may call in a
+// conversation. An empty list turns tool use off.
+func (h *APIHandler) SetConversationTools(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var req api.SetToolsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if err := h.checkTools(req.Tools); err != nil {
+		respondInvalid(c, "tools", err.Error())
+		return
+	}
+
+	conversation, err := h.conversations.Get(c.Request.Context(), c.Param("id"), user.ID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "Conversation not found")
+		return
+	}
+
+	conversation.Tools = req.Tools
+	if err := h.conversations.Update(c.Request.Context(), conversation); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to update conversation")
+		return
+	}
+
+	c.JSON(http.StatusOK, api.ConversationResponse{
+		Status:       "success",
+		Conversation: conversation,
+	})
+}
+
+// checkTools rejects names that are not in the registry.
+func (h *APIHandler) checkTools(names []string) error {
+	for _, name := range names {
+		if !h.tools.Has(name) {
+			return fmt.Errorf("unknown tool: %s", name)
+		}
+	}
+	return nil
+}
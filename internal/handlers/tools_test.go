@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"ai-chatbot-web/internal/fakeollama"
+	"ai-chatbot-web/internal/tools"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func calculateCall(expression string) tools.Call {
+	return tools.Call{Function: tools.FunctionCall{
+		Name:      "calculate",
+		Arguments: json.RawMessage(`{"expression": "` + expression + `"}`),
+	}}
+}
+
+func TestListTools(t *testing.T) {
+	ts := newTestServer(t, storeFactories["memory"])
+
+	code, body := ts.do(t, "alice", http.MethodGet, "/api/v1/tools", nil)
+	if code != http.StatusOK || body["count"] != float64(2) {
+		t.Errorf("list tools: status %d, body %v", code, body)
+	}
+}
+
+func TestConversationTools(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ts *testServer) {
+		id := ts.createConversation(t, "alice")
+		path := "/api/v1/conversations/" + id
+
+		code, body := ts.do(t, "alice", http.MethodPut, path+"/tools", gin.H{"tools": []string{"calculate", "nope"}})
+		if code != http.StatusBadRequest || !strings.Contains(body["message"].(string), "nope") {
+			t.Errorf("unknown tool: status %d, body %v", code, body)
+		}
+		if code, _ := ts.do(t, "bob", http.MethodPut, path+"/tools", gin.H{"tools": []string{"calculate"}}); code != http.StatusNotFound {
+			t.Errorf("other user's conversation: status %d", code)
+		}
+
+		// without tools enabled the model is not offered any
+		ts.ai.toolCalls = [][]tools.Call{{calculateCall("6 * 7")}}
+		ts.do(t, "alice", http.MethodPost, path+"/messages", gin.H{"content": "first"})
+		_, body = ts.do(t, "alice", http.MethodGet, path, nil)
+		if n := len(messagesOf(body)); n != 3 {
+			t.Fatalf("tool called while disabled: %d messages", n)
+		}
+
+		code, body = ts.do(t, "alice", http.MethodPut, path+"/tools", gin.H{"tools": []string{"calculate"}})
+		if code != http.StatusOK {
+			t.Fatalf("enable tools: status %d, body %v", code, body)
+		}
+
+		code, body = ts.do(t, "alice", http.MethodPost, path+"/messages", gin.H{"content": "what is 6 * 7?"})
+		if code != http.StatusOK {
+			t.Fatalf("send: status %d, body %v", code, body)
+		}
+		if steps, _ := body["tool_messages"].([]any); len(steps) != 2 {
+			t.Errorf("tool messages in response: %v", body["tool_messages"])
+		}
+
+		// the model saw the tool result before answering
+		history := ts.ai.lastCall()
+		last := history[len(history)-1]
+		if last.Role != "tool" || last.ToolName != "calculate" || last.Content != "42" {
+			t.Errorf("last message sent to the model: %+v", last)
+		}
+
+		_, body = ts.do(t, "alice", http.MethodGet, path, nil)
+		messages := messagesOf(body)
+		var roles []string
+		for _, m := range messages[3:] {
+			roles = append(roles, m["role"].(string))
+		}
+		if got := strings.Join(roles, ","); got != "user,assistant,tool,assistant" {
+			t.Fatalf("saved turn = %s", got)
+		}
+		if calls, _ := messages[4]["tool_calls"].([]any); len(calls) != 1 {
+			t.Errorf("tool calls not saved: %v", messages[4])
+		}
+	})
+}
+
+func TestIntegrationToolCalls(t *testing.T) {
+	ts, fake := newIntegrationServer(t)
+
+	code, body := ts.do(t, "alice", http.MethodPost, "/api/v1/conversations", gin.H{
+		"name":  "tools",
+		"tools": []string{"calculate"},
+	})
+	if code != http.StatusCreated {
+		t.Fatalf("create: status %d, body %v", code, body)
+	}
+	path := "/api/v1/conversations/" + body["conversation"].(map[string]any)["id"].(string)
+
+	fake.Script(fakeollama.Reply{ToolCalls: []fakeollama.ToolCall{fakeollama.Call("calculate", `{"expression": "6 * 7"}`)}})
+	fake.Respond("It is 42.")
+	code, body = ts.do(t, "alice", http.MethodPost, path+"/messages", gin.H{"content": "what is 6 * 7?"})
+	if code != http.StatusOK {
+		t.Fatalf("send: status %d, body %v", code, body)
+	}
+	if reply := body["assistant_message"].(map[string]any); reply["content"] != "It is 42." {
+		t.Errorf("reply = %v", reply["content"])
+	}
+
+	requests := fake.Requests()
+	if len(requests) != 2 || len(requests[0].Tools) != 1 {
+		t.Fatalf("requests to the model: %+v", requests)
+	}
+	sent := requests[1].Messages
+	call, result := sent[len(sent)-2], sent[len(sent)-1]
+	if len(call.ToolCalls) != 1 || result.Role != "tool" || result.ToolName != "calculate" || result.Content != "42" {
+		t.Errorf("tool round trip: call %+v, result %+v", call, result)
+	}
+}
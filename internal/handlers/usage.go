@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"ai-chatbot-web/api"
+	"ai-chatbot-web/internal/database"
+	"ai-chatbot-web/internal/middleware"
+	"ai-chatbot-web/internal/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// usageGroupColumns maps the group_by values accepted by GetUsage to the SQL
+// selecting them. DATE() is cast to text so SQLite and Postgres agree.
+var usageGroupColumns = map[string]string{
+	"user":  "conversations.user_id AS user_id, users.username AS username",
+	"model": "messages.model AS model",
+	"day":   "CAST(DATE(messages.created_at) AS TEXT) AS day",
+}
+
+var usageGroupKeys = map[string]string{
+	"user":  "conversations.user_id, users.username",
+	"model": "messages.model",
+	"day":   "CAST(DATE(messages.created_at) AS TEXT)",
+}
+
+// UsageHandler serves usage reports. The aggregation is plain SQL over the
+// messages table, so unlike APIHandler it works on the database directly.
+type UsageHandler struct {
+	db *database.Database
+}
+
+func NewUsageHandler(db *database.Database) *UsageHandler {
+	return &UsageHandler{
+		db: db,
+	}
+}
+
+// GetUsage aggregates assistant responses by any combination of user, model
+// and day. Query parameters:
+//
+//	group_by   comma separated list of user, model, day (default all three)
+//	from, to   inclusive date range as YYYY-MM-DD
+//	all_users  include every user; requires the caller to be an admin
+func (h *UsageHandler) GetUsage(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	groupBy := []string{"user", "model", "day"}
+	if v := c.Query("group_by"); v != "" {
+		groupBy = strings.Split(v, ",")
+	}
+
+	selects := []string{
+		"COUNT(*) AS requests",
+		"COALESCE(SUM(messages.prompt_tokens), 0) AS prompt_tokens",
+		"COALESCE(SUM(messages.completion_tokens), 0) AS completion_tokens",
+		"COALESCE(AVG(messages.latency_ms), 0) AS avg_latency_ms",
+		"COALESCE(AVG(messages.time_to_first_token_ms), 0) AS avg_time_to_first_token_ms",
+	}
+	var groups []string
+	for _, g := range groupBy {
+		g = strings.TrimSpace(g)
+		column, ok := usageGroupColumns[g]
+		if !ok {
+			respondInvalid(c, "group_by", "Invalid group_by value: "+g)
+			return
+		}
+		selects = append(selects, column)
+		groups = append(groups, usageGroupKeys[g])
+	}
+
+	query := h.db.DB.WithContext(c.Request.Context()).Model(&models.Message{}).
+		Select(strings.Join(selects, ", ")).
+		Joins("JOIN conversations ON conversations.id = messages.conversation_id").
+		Joins("LEFT JOIN users ON users.id = conversations.user_id").
+		Where("messages.role = ?", "assistant")
+
+	if c.Query("all_users") == "true" {
+		if !middleware.IsAdmin(c) {
+			respondError(c, http.StatusForbidden, "Only admins can view usage for all users")
+			return
+		}
+	} else {
+		query = query.Where("conversations.user_id = ?", user.ID)
+	}
+
+	if v := c.Query("from"); v != "" {
+		from, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			respondInvalid(c, "from", "Invalid from date, expected YYYY-MM-DD")
+			return
+		}
+		query = query.Where("messages.created_at >= ?", from)
+	}
+	if v := c.Query("to"); v != "" {
+		to, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			respondInvalid(c, "to", "Invalid to date, expected YYYY-MM-DD")
+			return
+		}
+		query = query.Where("messages.created_at < ?", to.AddDate(0, 0, 1))
+	}
+
+	if len(groups) > 0 {
+		query = query.Group(strings.Join(groups, ", ")).Order(strings.Join(groups, ", "))
+	}
+
+	var rows []api.UsageRow
+	if err := query.Scan(&rows).Error; err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to aggregate usage")
+		return
+	}
+
+	c.JSON(http.StatusOK, api.UsageResponse{
+		Status:  "success",
+		GroupBy: groupBy,
+		Usage:   rows,
+		Count:   len(rows),
+	})
+}
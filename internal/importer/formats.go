@@ -0,0 +1,217 @@
+package importer
+
+import (
+	"ai-chatbot-web/internal/models"
+	"ai-chatbot-web/internal/tools"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// taconiteConversation is a conversation saved by the CLI.
+type taconiteConversation struct {
+	Meta struct {
+		ID       string    `json:"id"`
+		Name     string    `json:"name"`
+		Created  time.Time `json:"created"`
+		LastUsed time.Time `json:"last_used"`
+	} `json:"meta"`
+	Messages []struct {
+		Role               string       `json:"role"`
+		Content            string       `json:"content"`
+		Time               time.Time    `json:"time"`
+		Model              string       `json:"model"`
+		PromptTokens       int          `json:"prompt_tokens"`
+		CompletionTokens   int          `json:"completion_tokens"`
+		LatencyMs          int64        `json:"latency_ms"`
+		TimeToFirstTokenMs int64        `json:"time_to_first_token_ms"`
+		ToolCalls          []tools.Call `json:"tool_calls"`
+		ToolName           string       `json:"tool_name"`
+	} `json:"messages"`
+	Config struct {
+		Model          string   `json:"model"`
+		SystemPrompt   string   `json:"system_prompt"`
+		FallbackModels []string `json:"fallback_models"`
+	} `json:"config"`
+}
+
+func parseTaconite(data json.RawMessage) (*Conversation, error) {
+	var saved taconiteConversation
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+
+	meta := saved.Meta
+	c := &Conversation{
+		Source: "taconite",
+		Conversation: models.Conversation{
+			Name:           meta.Name,
+			Model:          saved.Config.Model,
+			FallbackModels: saved.Config.FallbackModels,
+			SystemPrompt:   saved.Config.SystemPrompt,
+			ImportKey:      fmt.Sprintf("taconite:%s:%s", meta.ID, meta.Created.UTC().Format(time.RFC3339Nano)),
+			CreatedAt:      meta.Created,
+			UpdatedAt:      cmp.Or(meta.LastUsed, meta.Created),
+		},
+	}
+	for _, msg := range saved.Messages {
+		c.Messages = append(c.Messages, models.Message{
+			Role:               msg.Role,
+			Content:            msg.Content,
+			CreatedAt:          msg.Time,
+			Model:              msg.Model,
+			PromptTokens:       msg.PromptTokens,
+			CompletionTokens:   msg.CompletionTokens,
+			LatencyMs:          msg.LatencyMs,
+			TimeToFirstTokenMs: msg.TimeToFirstTokenMs,
+			ToolCalls:          msg.ToolCalls,
+			ToolName:           msg.ToolName,
+		})
+	}
+	return c, nil
+}
+
+// chatGPTConversation is a conversation in the conversations.json of a
+// ChatGPT data export. Messages form a tree, since edits and regenerated
+// replies branch; current_node is the last message of the branch shown.
+type chatGPTConversation struct {
+	ID             string                 `json:"id"`
+	ConversationID string                 `json:"conversation_id"`
+	Title          string                 `json:"title"`
+	CreateTime     float64                `json:"create_time"`
+	UpdateTime     float64                `json:"update_time"`
+	CurrentNode    string                 `json:"current_node"`
+	DefaultModel   string                 `json:"default_model_slug"`
+	Mapping        map[string]chatGPTNode `json:"mapping"`
+}
+
+type chatGPTNode struct {
+	Parent  string `json:"parent"`
+	Message *struct {
+		Author struct {
+			Role string `json:"role"`
+			Name string `json:"name"`
+		} `json:"author"`
+		CreateTime *float64 `json:"create_time"`
+		Content    struct {
+			ContentType string            `json:"content_type"`
+			Parts       []json.RawMessage `json:"parts"`
+			Text        string            `json:"text"`
+		} `json:"content"`
+		Metadata struct {
+			ModelSlug string `json:"model_slug"`
+		} `json:"metadata"`
+	} `json:"message"`
+}
+
+func parseChatGPT(data json.RawMessage) (*Conversation, error) {
+	var export chatGPTConversation
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, err
+	}
+
+	// without an ID there is no telling re-imports apart, so they are not
+	// deduplicated
+	var importKey string
+	if id := cmp.Or(export.ConversationID, export.ID); id != "" {
+		importKey = "chatgpt:" + id
+	}
+
+	created := unixTime(export.CreateTime)
+	c := &Conversation{
+		Source: "chatgpt",
+		Conversation: models.Conversation{
+			Name:      export.Title,
+			ImportKey: importKey,
+			CreatedAt: created,
+			UpdatedAt: cmp.Or(unixTime(export.UpdateTime), created),
+		},
+	}
+
+	for _, id := range branch(export) {
+		node := export.Mapping[id].Message
+		if node == nil {
+			continue
+		}
+		var parts []string
+		for _, raw := range node.Content.Parts {
+			// images and other attachments are objects; only text is kept
+			var text string
+			if json.Unmarshal(raw, &text) == nil && text != "" {
+				parts = append(parts, text)
+			}
+		}
+		content := strings.Join(parts, "\n\n")
+		if node.Content.ContentType == "code" {
+			content = "```\n" + node.Content.Text + "\n```"
+		}
+		if strings.TrimSpace(content) == "" {
+			continue
+		}
+
+		msg := models.Message{
+			Role:    node.Author.Role,
+			Content: content,
+			Model:   node.Metadata.ModelSlug,
+		}
+		if node.CreateTime != nil {
+			msg.CreatedAt = unixTime(*node.CreateTime)
+		}
+		if msg.Role == "tool" {
+			msg.ToolName = node.Author.Name
+		}
+		if msg.Role == "system" && c.Conversation.SystemPrompt == "" {
+			c.Conversation.SystemPrompt = content
+		}
+		c.Messages = append(c.Messages, msg)
+	}
+	return c, nil
+}
+
+// branch returns the node IDs from the root to current_node, or, without
+// one, every node in creation order.
+func branch(export chatGPTConversation) []string {
+	if _, ok := export.Mapping[export.CurrentNode]; ok {
+		var ids []string
+		seen := map[string]bool{}
+		for id := export.CurrentNode; id != "" && !seen[id]; id = export.Mapping[id].Parent {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+		for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+			ids[i], ids[j] = ids[j], ids[i]
+		}
+		return ids
+	}
+
+	ids := make([]string, 0, len(export.Mapping))
+	for id := range export.Mapping {
+		ids = append(ids, id)
+	}
+	created := func(id string) float64 {
+		if m := export.Mapping[id].Message; m != nil && m.CreateTime != nil {
+			return *m.CreateTime
+		}
+		return 0
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		if created(ids[i]) != created(ids[j]) {
+			return created(ids[i]) < created(ids[j])
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// unixTime converts fractional Unix seconds, as ChatGPT exports them.
+func unixTime(seconds float64) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*1e9)).UTC()
+}
@@ -0,0 +1,255 @@
+// Package importer loads conversations saved elsewhere into the stores:
+// the JSON files the CLI saves (SavedConversation) and the
+// conversations.json of a ChatGPT data export. Each imported conversation
+// remembers where it came from, so importing the same file again only
+// adds the messages written since.
+package importer
+
+import (
+	"ai-chatbot-web/internal/models"
+	"ai-chatbot-web/internal/store"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrUnknownFormat is returned by Parse for JSON that is neither a CLI
+// save nor a ChatGPT export.
+var ErrUnknownFormat = errors.New("unrecognized conversation format")
+
+// defaultSystemPrompt is given to imports without a system message, as
+// it is to conversations created without one.
+const defaultSystemPrompt = "You are a helpful assistant."
+
+// Import outcomes.
+const (
+	StatusImported = "imported" // new conversation
+	StatusUpdated  = "updated"  // messages added to an earlier import
+	StatusSkipped  = "skipped"  // nothing new, or the earlier import has diverged
+)
+
+// Conversation is a parsed conversation, ready to save.
+type Conversation struct {
+	Source       string // taconite or chatgpt
+	Conversation models.Conversation
+	Messages     []models.Message
+}
+
+// Result is the outcome of importing one conversation.
+type Result struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Source   string `json:"source"`
+	Status   string `json:"status"`   // see Status*
+	Messages int    `json:"messages"` // messages added
+}
+
+// Report sums up an import.
+type Report struct {
+	Imported      int      `json:"imported"`
+	Updated       int      `json:"updated"`
+	Skipped       int      `json:"skipped"`
+	Conversations []Result `json:"conversations"`
+}
+
+func (r *Report) add(result Result) {
+	switch result.Status {
+	case StatusImported:
+		r.Imported++
+	case StatusUpdated:
+		r.Updated++
+	default:
+		r.Skipped++
+	}
+	r.Conversations = append(r.Conversations, result)
+}
+
+// Parse reads one conversation or an array of them, in either format.
+func Parse(data []byte) ([]*Conversation, error) {
+	data = bytes.TrimSpace(data)
+	var raws []json.RawMessage
+	if bytes.HasPrefix(data, []byte("[")) {
+		if err := json.Unmarshal(data, &raws); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		}
+	} else {
+		raws = []json.RawMessage{data}
+	}
+
+	conversations := make([]*Conversation, 0, len(raws))
+	for i, raw := range raws {
+		c, err := parseOne(raw)
+		if err != nil && len(raws) > 1 {
+			err = fmt.Errorf("conversation %d: %w", i+1, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, c)
+	}
+	return conversations, nil
+}
+
+// parseOne tells the formats apart by their top-level fields.
+func parseOne(raw json.RawMessage) (*Conversation, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	parse, format := parseTaconite, "CLI"
+	switch {
+	case fields["meta"] != nil && fields["messages"] != nil:
+	case fields["mapping"] != nil:
+		parse, format = parseChatGPT, "ChatGPT"
+	default:
+		return nil, ErrUnknownFormat
+	}
+	c, err := parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s conversation: %v", format, err)
+	}
+	return c, nil
+}
+
+// normalize fills in what the server expects of a conversation: a model,
+// a leading system message, known roles, statuses, token counts and
+// strictly increasing timestamps so the order survives the store.
+func (c *Conversation) normalize(defaultModel string) {
+	now := time.Now()
+	conversation := &c.Conversation
+	conversation.Model = cmp.Or(conversation.Model, defaultModel)
+	if conversation.CreatedAt.IsZero() {
+		conversation.CreatedAt = now
+	}
+	conversation.UpdatedAt = cmp.Or(conversation.UpdatedAt, conversation.CreatedAt)
+
+	var messages []models.Message
+	for _, msg := range c.Messages {
+		switch msg.Role {
+		case "system", "user", "assistant", "tool":
+			messages = append(messages, msg)
+		}
+	}
+	if len(messages) == 0 || messages[0].Role != "system" {
+		conversation.SystemPrompt = cmp.Or(conversation.SystemPrompt, defaultSystemPrompt)
+		messages = append([]models.Message{{Role: "system", Content: conversation.SystemPrompt}}, messages...)
+	}
+	conversation.SystemPrompt = cmp.Or(conversation.SystemPrompt, messages[0].Content)
+
+	previous := conversation.CreatedAt.Add(-time.Millisecond)
+	for i := range messages {
+		msg := &messages[i]
+		if !msg.CreatedAt.After(previous) {
+			msg.CreatedAt = previous.Add(time.Millisecond)
+		}
+		previous = msg.CreatedAt
+		msg.ID = ""
+		msg.Status = models.MessageStatusComplete
+		msg.TokenCount = len(msg.Content) / 4
+	}
+	c.Messages = messages
+}
+
+// Importer saves parsed conversations for a user.
+type Importer struct {
+	conversations store.ConversationStore
+	messages      store.MessageStore
+	defaultModel  string
+}
+
+// New returns an Importer. Conversations that do not name a model, such
+// as ChatGPT exports, get defaultModel.
+func New(conversations store.ConversationStore, messages store.MessageStore, defaultModel string) *Importer {
+	return &Importer{
+		conversations: conversations,
+		messages:      messages,
+		defaultModel:  defaultModel,
+	}
+}
+
+// Import parses data and saves its conversations for userID. Nothing is
+// saved if data does not parse.
+func (im *Importer) Import(ctx context.Context, userID string, data []byte) (*Report, error) {
+	conversations, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return im.Save(ctx, userID, conversations)
+}
+
+// Save saves parsed conversations for userID. If saving fails part way,
+// the report covers the conversations saved before the error.
+func (im *Importer) Save(ctx context.Context, userID string, conversations []*Conversation) (*Report, error) {
+	report := &Report{Conversations: []Result{}}
+	for _, c := range conversations {
+		result, err := im.save(ctx, userID, c)
+		if err != nil {
+			return report, fmt.Errorf("failed to import %q: %v", c.Conversation.Name, err)
+		}
+		report.add(result)
+	}
+	return report, nil
+}
+
+// save creates c, or adds its new messages to an earlier import of it.
+// An earlier import is only extended while its messages are still the
+// start of c; once it has been continued on the server it is left alone.
+func (im *Importer) save(ctx context.Context, userID string, c *Conversation) (Result, error) {
+	c.normalize(im.defaultModel)
+	conversation := c.Conversation
+	conversation.UserID = userID
+	result := Result{Name: conversation.Name, Source: c.Source}
+
+	existing, err := im.conversations.FindImported(ctx, userID, conversation.ImportKey)
+	if errors.Is(err, store.ErrNotFound) {
+		messages := make([]*models.Message, len(c.Messages))
+		for i := range c.Messages {
+			messages[i] = &c.Messages[i]
+		}
+		if err := im.conversations.Create(ctx, &conversation, messages...); err != nil {
+			return result, err
+		}
+		result.ID, result.Status, result.Messages = conversation.ID, StatusImported, len(messages)
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+
+	result.ID, result.Name, result.Status = existing.ID, existing.Name, StatusSkipped
+	if !isPrefix(existing.Messages, c.Messages) {
+		return result, nil
+	}
+	added := c.Messages[len(existing.Messages):]
+	if len(added) == 0 {
+		return result, nil
+	}
+	messages := make([]*models.Message, len(added))
+	for i := range added {
+		added[i].ConversationID = existing.ID
+		messages[i] = &added[i]
+	}
+	if err := im.messages.Append(ctx, messages...); err != nil {
+		return result, err
+	}
+	result.Status, result.Messages = StatusUpdated, len(messages)
+	return result, nil
+}
+
+// isPrefix reports whether the saved messages begin the imported ones.
+func isPrefix(saved, imported []models.Message) bool {
+	if len(saved) > len(imported) {
+		return false
+	}
+	for i := range saved {
+		if saved[i].Role != imported[i].Role || saved[i].Content != imported[i].Content {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,154 @@
+package importer
+
+import (
+	"ai-chatbot-web/internal/store"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const saved = `{
+  "meta": {"id": "default", "name": "Go help", "created": "2026-03-01T10:00:00Z", "last_used": "2026-03-01T10:05:00Z"},
+  "messages": [
+    {"role": "system", "content": "Be brief.", "time": "2026-03-01T10:00:00Z"},
+    {"role": "user", "content": "Reverse a slice?", "time": "2026-03-01T10:01:00Z"},
+    {"role": "assistant", "content": "slices.Reverse(s)", "time": "2026-03-01T10:01:02Z", "model": "llama3.1:8b", "completion_tokens": 4}
+  ],
+  "config": {"model": "llama3.1:8b", "system_prompt": "Be brief.", "max_tokens": 4000}
+}`
+
+// chatGPT has an edited first message: the branch shown ends at node a2.
+const chatGPT = `[{
+  "id": "gpt-1", "title": "Trip ideas", "create_time": 1767225600.5, "update_time": 1767225700,
+  "current_node": "a2",
+  "mapping": {
+    "root": {"message": null, "parent": null},
+    "s": {"parent": "root", "message": {"author": {"role": "system"}, "content": {"content_type": "text", "parts": [""]}}},
+    "u1": {"parent": "s", "message": {"author": {"role": "user"}, "create_time": 1767225610, "content": {"content_type": "text", "parts": ["Where to in May?"]}}},
+    "u2": {"parent": "s", "message": {"author": {"role": "user"}, "create_time": 1767225620, "content": {"content_type": "text", "parts": ["Where to in June?"]}}},
+    "a2": {"parent": "u2", "message": {"author": {"role": "assistant"}, "create_time": 1767225630, "metadata": {"model_slug": "gpt-4o"},
+           "content": {"content_type": "multimodal_text", "parts": [{"asset_pointer": "file-1"}, "Try Lisbon."]}}}
+  }
+}]`
+
+func newImporter() (*Importer, *store.MemoryStore) {
+	s := store.NewMemoryStore()
+	return New(s.Conversations(), s.Messages(), "default-model"), s
+}
+
+func TestImportSavedConversation(t *testing.T) {
+	ctx := context.Background()
+	im, s := newImporter()
+
+	report, err := im.Import(ctx, "alice", []byte(saved))
+	if err != nil || report.Imported != 1 {
+		t.Fatalf("Import = %+v, %v", report, err)
+	}
+	conversation, err := s.Conversations().GetWithMessages(ctx, report.Conversations[0].ID, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conversation.Name != "Go help" || conversation.Model != "llama3.1:8b" || conversation.SystemPrompt != "Be brief." ||
+		!conversation.CreatedAt.Equal(time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("conversation = %+v", conversation)
+	}
+	messages := conversation.Messages
+	if len(messages) != 3 || messages[2].Model != "llama3.1:8b" || messages[2].CompletionTokens != 4 ||
+		!messages[1].CreatedAt.Equal(time.Date(2026, 3, 1, 10, 1, 0, 0, time.UTC)) || messages[1].Status != "complete" {
+		t.Errorf("messages = %+v", messages)
+	}
+
+	// importing again changes nothing
+	report, _ = im.Import(ctx, "alice", []byte(saved))
+	if report.Skipped != 1 || report.Imported != 0 {
+		t.Errorf("re-import = %+v", report)
+	}
+
+	// messages added in the CLI since are appended
+	longer := strings.Replace(saved, `"completion_tokens": 4}`,
+		`"completion_tokens": 4}, {"role": "user", "content": "Thanks!", "time": "2026-03-02T09:00:00Z"}`, 1)
+	report, _ = im.Import(ctx, "alice", []byte(longer))
+	if report.Updated != 1 || report.Conversations[0].Messages != 1 {
+		t.Errorf("import with a new message = %+v", report)
+	}
+
+	// another user gets their own copy
+	if report, _ := im.Import(ctx, "bob", []byte(saved)); report.Imported != 1 {
+		t.Errorf("import for another user = %+v", report)
+	}
+}
+
+func TestImportLeavesContinuedConversations(t *testing.T) {
+	ctx := context.Background()
+	im, _ := newImporter()
+
+	im.Import(ctx, "alice", []byte(saved))
+	continued := strings.Replace(saved, "slices.Reverse(s)", "something else", 1)
+
+	report, err := im.Import(ctx, "alice", []byte(continued))
+	if err != nil || report.Skipped != 1 {
+		t.Errorf("import of a diverged conversation = %+v, %v", report, err)
+	}
+}
+
+func TestImportChatGPT(t *testing.T) {
+	ctx := context.Background()
+	im, s := newImporter()
+
+	report, err := im.Import(ctx, "alice", []byte(chatGPT))
+	if err != nil || report.Imported != 1 {
+		t.Fatalf("Import = %+v, %v", report, err)
+	}
+	conversation, _ := s.Conversations().GetWithMessages(ctx, report.Conversations[0].ID, "alice")
+	if conversation.Name != "Trip ideas" || conversation.Model != "default-model" || conversation.ImportKey != "chatgpt:gpt-1" {
+		t.Errorf("conversation = %+v", conversation)
+	}
+
+	var got []string
+	for _, msg := range conversation.Messages {
+		got = append(got, msg.Role+": "+msg.Content)
+	}
+	want := "system: You are a helpful assistant.|user: Where to in June?|assistant: Try Lisbon."
+	if strings.Join(got, "|") != want {
+		t.Errorf("messages = %q", got)
+	}
+	if m := conversation.Messages[2]; m.Model != "gpt-4o" || m.CreatedAt.Unix() != 1767225630 {
+		t.Errorf("assistant message = %+v", m)
+	}
+}
+
+func TestImportChatGPTWithoutIDs(t *testing.T) {
+	ctx := context.Background()
+	im, s := newImporter()
+
+	// conversations without an ID are all imported, and again on re-import
+	anonymous := strings.Replace(chatGPT, `"id": "gpt-1", `, "", 1)
+	export := "[" + strings.Trim(anonymous, "[]") + "," + strings.Replace(strings.Trim(anonymous, "[]"), "Trip ideas", "More trips", 1) + "]"
+	for range 2 {
+		report, err := im.Import(ctx, "alice", []byte(export))
+		if err != nil || report.Imported != 2 {
+			t.Fatalf("Import = %+v, %v", report, err)
+		}
+	}
+	conversations, _ := s.Conversations().ListByUser(ctx, "alice")
+	if len(conversations) != 4 || conversations[0].ImportKey != "" {
+		t.Errorf("conversations = %+v", conversations)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	if _, err := Parse([]byte(`{"title": "x"}`)); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("unknown format: %v", err)
+	}
+	if _, err := Parse([]byte(`[` + saved + `, {"nope": 1}]`)); err == nil || !strings.Contains(err.Error(), "conversation 2") {
+		t.Errorf("bad second conversation: %v", err)
+	}
+	if _, err := Parse([]byte(`{"meta": {}, "messages": "x"}`)); err == nil || !strings.Contains(err.Error(), "invalid CLI conversation") {
+		t.Errorf("malformed save: %v", err)
+	}
+	if _, err := Parse([]byte(`not json`)); err == nil {
+		t.Error("invalid JSON accepted")
+	}
+}
@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// slowQueryThreshold is the duration above which queries are logged as
+// warnings.
+const slowQueryThreshold = 200 * time.Millisecond
+
+// GormLogger adapts slog to GORM's logger interface. Statements are logged
+// at debug level; SQL parameters are omitted unless content logging is on,
+// since they include message bodies.
+type GormLogger struct {
+	log *slog.Logger
+}
+
+func NewGormLogger(log *slog.Logger) *GormLogger {
+	return &GormLogger{log: log}
+}
+
+// LogMode is a no-op; levels are controlled through LOG_LEVELS.
+func (l *GormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return l
+}
+
+func (l *GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	l.log.InfoContext(ctx, msg, "args", args)
+}
+
+func (l *GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	l.log.WarnContext(ctx, msg, "args", args)
+}
+
+func (l *GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	l.log.ErrorContext(ctx, msg, "args", args)
+}
+
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		l.log.ErrorContext(ctx, "query failed", "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds(), "error", err)
+	case elapsed > slowQueryThreshold:
+		sql, rows := fc()
+		l.log.WarnContext(ctx, "slow query", "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds())
+	case l.log.Enabled(ctx, slog.LevelDebug):
+		sql, rows := fc()
+		l.log.DebugContext(ctx, "query", "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds())
+	}
+}
+
+// ParamsFilter drops bound parameters from logged SQL unless content
+// logging is enabled.
+func (l *GormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if ContentEnabled() {
+		return sql, params
+	}
+	return sql, nil
+}
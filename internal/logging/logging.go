@@ -0,0 +1,136 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Configuration is read once from the environment:
+//
+//	LOG_LEVEL            default level: debug, info (default), warn, error
+//	LOG_LEVELS           per component overrides, e.g. "database=debug,ai=warn"
+//	LOG_FORMAT           json (default) or text
+//	LOG_MESSAGE_CONTENT  set to true to log message content and SQL parameters
+type config struct {
+	level   slog.Level
+	levels  map[string]slog.Level
+	format  string
+	content bool
+}
+
+var (
+	cfg      config
+	loadOnce sync.Once
+	output   io.Writer = os.Stdout
+)
+
+type requestIDKey struct{}
+
+// Setup loads the configuration and installs the "server" logger as the
+// slog default. Call it after environment variables have been loaded.
+func Setup() {
+	load()
+	slog.SetDefault(For("server"))
+}
+
+// For returns a logger for component, honouring any per-component level.
+// Records logged with a context carrying a request ID include it.
+func For(component string) *slog.Logger {
+	load()
+
+	level := cfg.level
+	if l, ok := cfg.levels[component]; ok {
+		level = l
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if cfg.format == "text" {
+		handler = slog.NewTextHandler(output, opts)
+	} else {
+		handler = slog.NewJSONHandler(output, opts)
+	}
+
+	return slog.New(contextHandler{handler}).With("component", component)
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID stored in ctx, if any.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ContentEnabled reports whether message content may be logged.
+func ContentEnabled() bool {
+	load()
+	return cfg.content
+}
+
+// Content returns s if content logging is enabled, otherwise a placeholder
+// recording only its length.
+func Content(s string) string {
+	if ContentEnabled() {
+		return s
+	}
+	return fmt.Sprintf("[redacted %d chars]", len(s))
+}
+
+func load() {
+	loadOnce.Do(func() {
+		cfg = config{
+			level:   parseLevel(os.Getenv("LOG_LEVEL"), slog.LevelInfo),
+			levels:  make(map[string]slog.Level),
+			format:  strings.ToLower(os.Getenv("LOG_FORMAT")),
+			content: os.Getenv("LOG_MESSAGE_CONTENT") == "true",
+		}
+
+		for _, pair := range strings.Split(os.Getenv("LOG_LEVELS"), ",") {
+			component, level, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				continue
+			}
+			cfg.levels[strings.TrimSpace(component)] = parseLevel(level, cfg.level)
+		}
+	})
+}
+
+func parseLevel(s string, fallback slog.Level) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return fallback
+	}
+	return level
+}
+
+// contextHandler adds the request ID from the record's context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,179 @@
+package metrics
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "chatbot"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	modelDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "model_request_duration_seconds",
+		Help:      "Upstream model call latency by provider and model.",
+		Buckets:   []float64{0.25, 0.5, 1, 2.5, 5, 10, 20, 40, 60, 120, 300},
+	}, []string{"provider", "model"})
+
+	modelErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "model_request_errors_total",
+		Help:      "Failed upstream model calls by provider and model.",
+	}, []string{"provider", "model"})
+
+	tokensGenerated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "model_tokens_generated_total",
+		Help:      "Completion tokens generated by provider and model.",
+	}, []string{"provider", "model"})
+
+	modelRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "model_request_retries_total",
+		Help:      "Retried upstream model requests by provider and model.",
+	}, []string{"provider", "model"})
+
+	modelFallbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "model_fallbacks_total",
+		Help:      "Requests handed to the next model in a fallback chain, by the model that failed.",
+	}, []string{"provider", "model"})
+
+	toolCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tool_calls_total",
+		Help:      "Tool calls made by the model, by tool and outcome.",
+	}, []string{"tool", "outcome"})
+
+	circuitOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "model_circuit_open",
+		Help:      "1 while the circuit breaker for a model backend is open or half open.",
+	}, []string{"backend"})
+
+	backendUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "model_backend_up",
+		Help:      "1 if the model backend passed its last health check.",
+	}, []string{"backend"})
+
+	backendInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "model_backend_in_flight",
+		Help:      "Requests in flight per model backend.",
+	}, []string{"backend"})
+
+	activeStreams = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_streams",
+		Help:      "Model responses currently being streamed.",
+	})
+)
+
+// Middleware records request counts and latency per Gin route. The route
+// template (e.g. /api/v1/conversations/:id) is used rather than the raw
+// path to keep label cardinality bounded.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		httpRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the Prometheus exposition format.
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// RegisterDB exports connection pool statistics for db.
+func RegisterDB(db *sql.DB, name string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// ObserveModelCall records the outcome of one upstream model call.
+func ObserveModelCall(provider, model string, duration time.Duration, completionTokens int, err error) {
+	modelDuration.WithLabelValues(provider, model).Observe(duration.Seconds())
+	if err != nil {
+		modelErrors.WithLabelValues(provider, model).Inc()
+		return
+	}
+	tokensGenerated.WithLabelValues(provider, model).Add(float64(completionTokens))
+}
+
+// ModelRetry counts a retried upstream model request.
+func ModelRetry(provider, model string) {
+	modelRetries.WithLabelValues(provider, model).Inc()
+}
+
+// ModelFallback counts a request that model failed and that moved on to
+// the next model in its fallback chain.
+func ModelFallback(provider, model string) {
+	modelFallbacks.WithLabelValues(provider, model).Inc()
+}
+
+// ToolCall counts a tool call; outcome is "ok" or "error".
+func ToolCall(tool string, err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	toolCalls.WithLabelValues(tool, outcome).Inc()
+}
+
+// SetCircuitState records the circuit breaker state for backend.
+func SetCircuitState(backend, state string) {
+	open := 0.0
+	if state != "closed" {
+		open = 1
+	}
+	circuitOpen.WithLabelValues(backend).Set(open)
+}
+
+// SetBackendUp records the result of a backend health check.
+func SetBackendUp(backend string, up bool) {
+	value := 0.0
+	if up {
+		value = 1
+	}
+	backendUp.WithLabelValues(backend).Set(value)
+}
+
+// SetBackendInFlight records the requests in flight on backend.
+func SetBackendInFlight(backend string, n int64) {
+	backendInFlight.WithLabelValues(backend).Set(float64(n))
+}
+
+// StreamStarted marks a model stream as active. Call the returned func when
+// the stream ends.
+func StreamStarted() func() {
+	activeStreams.Inc()
+	return activeStreams.Dec
+}
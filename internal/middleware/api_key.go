@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"ai-chatbot-web/api"
+	"ai-chatbot-web/internal/logging"
+	"ai-chatbot-web/internal/models"
+	"ai-chatbot-web/internal/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const apiKeyContextKey = "api_key"
+
+// APIKeyAuth authenticates requests that carry an API key as their bearer
+// token. Requests without one pass through untouched so session auth and
+// public routes keep working. Read-only requests need the read scope and
+// all others the write scope. Unknown, expired and revoked keys get a 401;
+// a failure to look the key up is a 503, so clients do not take an outage
+// for bad credentials.
+func APIKeyAuth(keys *services.APIKeyService) gin.HandlerFunc {
+	log := logging.For("auth")
+
+	return func(c *gin.Context) {
+		token := BearerToken(c)
+		if !services.IsAPIKey(token) {
+			c.Next()
+			return
+		}
+
+		key, user, err := keys.Authenticate(token)
+		if errors.Is(err, services.ErrInvalidAPIKey) {
+			abort(c, http.StatusUnauthorized, api.NewError(api.CodeUnauthorized, "Invalid API key"))
+			return
+		}
+		if err != nil {
+			log.ErrorContext(c.Request.Context(), "API key lookup failed", "error", err)
+			abort(c, http.StatusServiceUnavailable, api.NewError(api.CodeUnavailable, "Could not check the API key; try again later"))
+			return
+		}
+
+		scope := services.ScopeWrite
+		if isReadOnlyMethod(c.Request.Method) {
+			scope = services.ScopeRead
+		}
+		if !key.HasScope(scope) {
+			abort(c, http.StatusForbidden, api.NewError(api.CodeForbidden, "API key does not have the "+scope+" scope"))
+			return
+		}
+
+		SetCurrentUser(c, user)
+		c.Set(apiKeyContextKey, key)
+		c.Next()
+	}
+}
+
+// CurrentAPIKey returns the API key the request was authenticated with, or
+// nil for session-authenticated requests.
+func CurrentAPIKey(c *gin.Context) *models.APIKey {
+	if v, ok := c.Get(apiKeyContextKey); ok {
+		if key, ok := v.(*models.APIKey); ok {
+			return key
+		}
+	}
+	return nil
+}
+
+func isReadOnlyMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
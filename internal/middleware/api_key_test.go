@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"ai-chatbot-web/internal/database/databasetest"
+	"ai-chatbot-web/internal/models"
+	"ai-chatbot-web/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// newKeyRouter returns a router that answers GET and POST /thing with the
+// name of the user and key that made the request, behind APIKeyAuth.
+func newKeyRouter(t *testing.T) (*gin.Engine, *services.APIKeyService, *gorm.DB, *models.User) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db := databasetest.Open(t)
+	gdb := db.DB
+
+	user := &models.User{Username: "alice", PasswordHash: "x"}
+	if err := gdb.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	keys := services.NewAPIKeyService(db)
+	router := gin.New()
+	router.Use(APIKeyAuth(keys))
+	answer := func(c *gin.Context) {
+		name := "anonymous"
+		if key := CurrentAPIKey(c); key != nil {
+			name = CurrentUser(c).Username + "/" + key.Name
+		}
+		c.String(http.StatusOK, name)
+	}
+	router.GET("/thing", answer)
+	router.POST("/thing", answer)
+	return router, keys, gdb, user
+}
+
+func TestAPIKeyAuthScopes(t *testing.T) {
+	router, keys, gdb, user := newKeyRouter(t)
+	create := func(name string, scopes ...string) (string, *models.APIKey) {
+		raw, key, err := keys.Create(user.ID, name, scopes, nil)
+		if err != nil {
+			t.Fatalf("create key: %v", err)
+		}
+		return raw, key
+	}
+	reader, _ := create("reader", "read")
+	writer, _ := create("writer", "write")
+	both, _ := create("both")
+
+	revoked, key := create("revoked")
+	if err := keys.Revoke(user.ID, key.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	expired, key := create("expired")
+	if err := gdb.Model(key).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("expire key: %v", err)
+	}
+
+	for _, tc := range []struct {
+		method, token string
+		want          int
+		body          string
+	}{
+		{http.MethodGet, "", http.StatusOK, "anonymous"},
+		{http.MethodGet, "session-token", http.StatusOK, "anonymous"},
+		{http.MethodGet, reader, http.StatusOK, "alice/reader"},
+		{http.MethodPost, reader, http.StatusForbidden, ""},
+		{http.MethodGet, writer, http.StatusForbidden, ""},
+		{http.MethodPost, writer, http.StatusOK, "alice/writer"},
+		{http.MethodGet, both, http.StatusOK, "alice/both"},
+		{http.MethodPost, both, http.StatusOK, "alice/both"},
+		{http.MethodGet, services.APIKeyPrefix + "unknown", http.StatusUnauthorized, ""},
+		{http.MethodGet, revoked, http.StatusUnauthorized, ""},
+		{http.MethodGet, expired, http.StatusUnauthorized, ""},
+	} {
+		req := httptest.NewRequest(tc.method, "/thing", nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tc.want || (tc.body != "" && rec.Body.String() != tc.body) {
+			t.Errorf("%s with %.12s: status %d, body %s; want %d", tc.method, tc.token, rec.Code, rec.Body, tc.want)
+		}
+	}
+
+	// a database outage is not a bad key
+	if sqlDB, err := gdb.DB(); err == nil {
+		sqlDB.Close()
+	}
+	req := httptest.NewRequest(http.MethodGet, "/thing", nil)
+	req.Header.Set("Authorization", "Bearer "+reader)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("with the database down: status %d, body %s; want 503", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"ai-chatbot-web/api"
+	"ai-chatbot-web/internal/models"
+	"ai-chatbot-web/internal/services"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	userContextKey  = "user"
+	tokenContextKey = "token"
+
+	// SessionCookie is the cookie browsers use to carry the session token.
+	SessionCookie = "session_token"
+)
+
+// RequireAuth rejects requests without a valid session token and stores the
+// authenticated user on the context for handlers to read via CurrentUser.
+// Requests already authenticated by APIKeyAuth are let through.
+func RequireAuth(auth *services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if CurrentUser(c) != nil {
+			c.Next()
+			return
+		}
+
+		token := BearerToken(c)
+
+		user, err := auth.Authenticate(token)
+		if err != nil {
+			abort(c, http.StatusUnauthorized, api.NewError(api.CodeUnauthorized, "Authentication required"))
+			return
+		}
+
+		SetCurrentUser(c, user)
+		c.Set(tokenContextKey, token)
+		c.Next()
+	}
+}
+
+// BearerToken extracts the token from the Authorization header, falling back
+// to the session cookie.
+func BearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+
+	if cookie, err := c.Cookie(SessionCookie); err == nil {
+		return cookie
+	}
+	return ""
+}
+
+// CurrentUser returns the user set by RequireAuth, or nil.
+func CurrentUser(c *gin.Context) *models.User {
+	if v, ok := c.Get(userContextKey); ok {
+		if user, ok := v.(*models.User); ok {
+			return user
+		}
+	}
+	return nil
+}
+
+// SetCurrentUser stores the authenticated user on the context.
+func SetCurrentUser(c *gin.Context, user *models.User) {
+	c.Set(userContextKey, user)
+}
+
+// CurrentToken returns the token the request was authenticated with.
+func CurrentToken(c *gin.Context) string {
+	return c.GetString(tokenContextKey)
+}
+
+// IsAdmin reports whether the authenticated user is listed in the
+// comma-separated ADMIN_USERS environment variable.
+func IsAdmin(c *gin.Context) bool {
+	user := CurrentUser(c)
+	if user == nil {
+		return false
+	}
+	for _, name := range strings.Split(os.Getenv("ADMIN_USERS"), ",") {
+		if strings.TrimSpace(name) == user.Username {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"ai-chatbot-web/api"
+
+	"github.com/gin-gonic/gin"
+)
+
+const errorRendererContextKey = "error_renderer"
+
+// ErrorRenderer turns the error envelope into the body a group of routes
+// answers errors with.
+type ErrorRenderer func(status int, body api.Error) any
+
+// RenderErrors makes the middleware after it answer errors in the format
+// render returns rather than as an api.Error, for routes that speak
+// another protocol.
+func RenderErrors(render ErrorRenderer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(errorRendererContextKey, render)
+		c.Next()
+	}
+}
+
+// abort stops the request with an error, rendered for its routes.
+func abort(c *gin.Context, status int, body api.Error) {
+	if v, ok := c.Get(errorRendererContextKey); ok {
+		if render, ok := v.(ErrorRenderer); ok {
+			c.AbortWithStatusJSON(status, render(status, body))
+			return
+		}
+	}
+	c.AbortWithStatusJSON(status, body)
+}
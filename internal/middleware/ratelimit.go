@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"ai-chatbot-web/api"
+	"ai-chatbot-web/internal/logging"
+	"ai-chatbot-web/internal/ratelimit"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const tokensUsedContextKey = "tokens_used"
+
+// RateLimit enforces per-user and per-API-key requests-per-minute limits.
+// It must run after authentication.
+func RateLimit(q *ratelimit.Quota) gin.HandlerFunc {
+	log := logging.For("ratelimit")
+
+	return func(c *gin.Context) {
+		decision, err := q.AllowRequest(Subjects(c)...)
+		if err != nil {
+			// Fail open: a broken limiter store should not take the API down
+			log.ErrorContext(c.Request.Context(), "rate limiter failed", "error", err)
+			c.Next()
+			return
+		}
+		if !decision.Allowed {
+			abortTooManyRequests(c, decision)
+			return
+		}
+		c.Next()
+	}
+}
+
+// TokenQuota rejects requests once the caller has used up its daily token
+// quota and records the tokens a handler reports through SetTokensUsed.
+func TokenQuota(q *ratelimit.Quota) gin.HandlerFunc {
+	log := logging.For("ratelimit")
+
+	return func(c *gin.Context) {
+		subjects := Subjects(c)
+
+		decision, err := q.AllowTokens(subjects...)
+		if err != nil {
+			log.ErrorContext(c.Request.Context(), "token quota check failed", "error", err)
+		} else if !decision.Allowed {
+			abortTooManyRequests(c, decision)
+			return
+		}
+
+		c.Next()
+
+		if tokens := c.GetInt(tokensUsedContextKey); tokens > 0 {
+			if err := q.RecordTokens(tokens, subjects...); err != nil {
+				log.ErrorContext(c.Request.Context(), "failed to record token usage", "error", err)
+			}
+		}
+	}
+}
+
+// SetTokensUsed lets a handler report how many tokens a request consumed.
+func SetTokensUsed(c *gin.Context, tokens int) {
+	c.Set(tokensUsedContextKey, tokens)
+}
+
+// Subjects returns the rate limit subjects for the authenticated caller:
+// the user, plus the API key when one was used.
+func Subjects(c *gin.Context) []ratelimit.Subject {
+	var subjects []ratelimit.Subject
+	if user := CurrentUser(c); user != nil {
+		subjects = append(subjects, ratelimit.Subject{Kind: ratelimit.KindUser, ID: user.ID})
+	}
+	if key := CurrentAPIKey(c); key != nil {
+		subjects = append(subjects, ratelimit.Subject{Kind: ratelimit.KindAPIKey, ID: key.ID})
+	}
+	return subjects
+}
+
+func abortTooManyRequests(c *gin.Context, decision ratelimit.Decision) {
+	seconds := int(math.Ceil(decision.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	body := api.NewError(api.CodeRateLimited, decision.Reason)
+	body.RetryAfter = seconds
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	abort(c, http.StatusTooManyRequests, body)
+}
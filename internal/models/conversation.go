@@ -2,6 +2,7 @@
 package models
 
 import (
+    "ai-chatbot-web/internal/tools"
     "time"
     "github.com/google/uuid"
     "gorm.io/gorm"
@@ -12,26 +13,77 @@ type Conversation struct {
     Name        string    `json:"name"`
     UserID      string    `json:"user_id"`
     Model       string    `json:"model"`
+    FallbackModels []string `json:"fallback_models,omitempty" gorm:"serializer:json"` // tried in order when Model fails
+    Tools       []string  `json:"tools,omitempty" gorm:"serializer:json"` // names of the tools the model may call
     SystemPrompt string   `json:"system_prompt"`
+    ImportKey   string    `json:"import_key,omitempty" gorm:"index"` // identifies the source of an imported conversation
     CreatedAt   time.Time `json:"created_at"`
     UpdatedAt   time.Time `json:"updated_at"`
     Messages    []Message `json:"messages,omitempty" gorm:"foreignKey:ConversationID"`
 }
 
+// ModelChain returns the models to try for a reply, in order: Model, then
+// each fallback. Blanks and repeats are skipped.
+func (c *Conversation) ModelChain() []string {
+    seen := map[string]bool{}
+    var chain []string
+    for _, model := range append([]string{c.Model}, c.FallbackModels...) {
+        if model == "" || seen[model] {
+            continue
+        }
+        seen[model] = true
+        chain = append(chain, model)
+    }
+    return chain
+}
+
 type Message struct {
     ID             string    `json:"id" gorm:"primaryKey"`
     ConversationID string    `json:"conversation_id"`
-    Role           string    `json:"role"` // system, user, assistant
+    APIKeyID       string    `json:"api_key_id,omitempty" gorm:"index"` // set when sent with an API key
+    Role           string    `json:"role"` // system, user, assistant, tool
     Content        string    `json:"content"`
     TokenCount     int       `json:"token_count"`
+    Status         string    `json:"status" gorm:"index"` // see MessageStatus*
     CreatedAt      time.Time `json:"created_at"`
+
+    // Accounting, recorded on assistant messages only
+    Model              string `json:"model,omitempty"`
+    PromptTokens       int    `json:"prompt_tokens,omitempty"`
+    CompletionTokens   int    `json:"completion_tokens,omitempty"`
+    LatencyMs          int64  `json:"latency_ms,omitempty"`
+    TimeToFirstTokenMs int64  `json:"time_to_first_token_ms,omitempty"`
+    Backend            string `json:"backend,omitempty"` // model server that answered
+
+    // Tool use: an assistant message may call tools instead of answering,
+    // and each result follows as a tool message
+    ToolCalls []tools.Call `json:"tool_calls,omitempty" gorm:"serializer:json"`
+    ToolName  string       `json:"tool_name,omitempty"`
+
+    // Document excerpts given to the model as context for this reply
+    Citations []Citation `json:"citations,omitempty" gorm:"serializer:json"`
+
+    // Images sent with a user message. ImageData holds their bytes, in the
+    // same order, while the message is sent to the model; it is not saved.
+    Images    []Image  `json:"images,omitempty" gorm:"serializer:json"`
+    ImageData [][]byte `json:"-" gorm:"-"`
 }
 
+// Message statuses. User messages are pending until their reply is saved;
+// failed and interrupted turns can be retried.
+const (
+    MessageStatusPending     = "pending"
+    MessageStatusComplete    = "complete"
+    MessageStatusFailed      = "failed"
+    MessageStatusInterrupted = "interrupted" // cut off by a shutdown or crash
+)
+
 type User struct {
-    ID        string    `json:"id" gorm:"primaryKey"`
-    Username  string    `json:"username" gorm:"unique"`
-    CreatedAt time.Time `json:"created_at"`
-    UpdatedAt time.Time `json:"updated_at"`
+    ID           string    `json:"id" gorm:"primaryKey"`
+    Username     string    `json:"username" gorm:"unique"`
+    PasswordHash string    `json:"-"`
+    CreatedAt    time.Time `json:"created_at"`
+    UpdatedAt    time.Time `json:"updated_at"`
 }
 
 // BeforeCreate hook for generating UUIDs
@@ -0,0 +1,59 @@
+// internal/models/document.go
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Document is a file uploaded to a conversation. Its text is split into
+// chunks that are embedded and searched for context when the conversation
+// gets a message.
+type Document struct {
+	ID             string    `json:"id" gorm:"primaryKey"`
+	ConversationID string    `json:"conversation_id" gorm:"index"`
+	Name           string    `json:"name"`
+	Kind           string    `json:"kind"` // text, markdown or pdf
+	Size           int64     `json:"size"` // bytes uploaded
+	Chunks         int       `json:"chunks"`
+	EmbeddingModel string    `json:"embedding_model"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// DocumentChunk is a piece of a document with its embedding.
+type DocumentChunk struct {
+	ID             string    `json:"id" gorm:"primaryKey"`
+	DocumentID     string    `json:"document_id" gorm:"index"`
+	ConversationID string    `json:"conversation_id" gorm:"index"`
+	Position       int       `json:"position"` // order within the document, from 0
+	Content        string    `json:"content"`
+	Embedding      []float32 `json:"-" gorm:"serializer:json"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Citation is a document chunk that was given to the model as context
+// for a reply. The model refers to it as [Source].
+type Citation struct {
+	Source     int     `json:"source"`
+	DocumentID string  `json:"document_id"`
+	Document   string  `json:"document"` // document name
+	Position   int     `json:"position"`
+	Score      float64 `json:"score"` // cosine similarity to the question
+	Excerpt    string  `json:"excerpt"`
+}
+
+func (d *Document) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == "" {
+		d.ID = uuid.New().String()
+	}
+	return nil
+}
+
+func (c *DocumentChunk) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	return nil
+}
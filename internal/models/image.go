@@ -0,0 +1,20 @@
+// internal/models/image.go
+package models
+
+import "time"
+
+// Image is an image sent with a message, for models that can see. The
+// bytes are kept in a blob store under ID; messages only reference them.
+type Image struct {
+	ID        string `json:"id"`
+	Name      string `json:"name,omitempty"`
+	MediaType string `json:"media_type"` // image/png or image/jpeg
+	Size      int64  `json:"size"`
+}
+
+// ImageBlob holds image bytes when images are stored in the database.
+type ImageBlob struct {
+	ID        string `gorm:"primaryKey"`
+	Data      []byte
+	CreatedAt time.Time
+}
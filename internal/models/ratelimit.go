@@ -0,0 +1,12 @@
+// internal/models/ratelimit.go
+package models
+
+import "time"
+
+// RateLimitHit records one request against a rate limit bucket. It backs
+// the database rate limiter so limits hold across restarts and replicas.
+type RateLimitHit struct {
+	ID        uint      `gorm:"primaryKey"`
+	Key       string    `gorm:"index:idx_rate_limit_key_time"`
+	CreatedAt time.Time `gorm:"index:idx_rate_limit_key_time"`
+}
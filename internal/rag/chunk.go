@@ -0,0 +1,100 @@
+package rag
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var blankLines = regexp.MustCompile(`\n\s*\n`)
+
+// Split cuts text into chunks of at most size bytes for embedding.
+// Paragraphs are kept whole where they fit; longer ones are cut between
+// words. Each chunk after the first repeats up to overlap bytes from the
+// end of the previous one so a passage cut at a boundary is still found.
+// Sizes below utf8.UTFMax are raised to it, as no smaller size can hold
+// every character.
+func Split(text string, size, overlap int) []string {
+	size = max(size, utf8.UTFMax)
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var pieces []string
+	for _, paragraph := range blankLines.Split(text, -1) {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			pieces = append(pieces, splitLong(paragraph, size)...)
+		}
+	}
+
+	var chunks []string
+	var current strings.Builder
+	for _, piece := range pieces {
+		if current.Len() > 0 && current.Len()+2+len(piece) > size {
+			chunk := current.String()
+			chunks = append(chunks, chunk)
+			current.Reset()
+			if tail := tailWords(chunk, overlap); tail != "" && len(tail)+2+len(piece) <= size {
+				current.WriteString(tail)
+			}
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n\n")
+		}
+		current.WriteString(piece)
+	}
+	if current.Len() > 0 {
+		chunks = append(chunks, current.String())
+	}
+	return chunks
+}
+
+// splitLong cuts a paragraph longer than size between words, and words
+// longer than size anywhere on a character boundary.
+func splitLong(paragraph string, size int) []string {
+	if len(paragraph) <= size {
+		return []string{paragraph}
+	}
+
+	var pieces []string
+	var current strings.Builder
+	for _, word := range strings.Fields(paragraph) {
+		for len(word) > size {
+			cut := size
+			for cut > 0 && !utf8.RuneStart(word[cut]) {
+				cut--
+			}
+			if current.Len() > 0 {
+				pieces = append(pieces, current.String())
+				current.Reset()
+			}
+			pieces = append(pieces, word[:cut])
+			word = word[cut:]
+		}
+		if current.Len() > 0 && current.Len()+1+len(word) > size {
+			pieces = append(pieces, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteByte(' ')
+		}
+		current.WriteString(word)
+	}
+	if current.Len() > 0 {
+		pieces = append(pieces, current.String())
+	}
+	return pieces
+}
+
+// tailWords returns the whole words within the last n bytes of s.
+func tailWords(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(s) <= n {
+		return s
+	}
+	tail := s[len(s)-n:]
+	if i := strings.IndexAny(tail, " \n"); i >= 0 {
+		return strings.TrimSpace(tail[i:])
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package rag
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Document kinds.
+const (
+	KindText     = "text"
+	KindMarkdown = "markdown"
+	KindPDF      = "pdf"
+)
+
+// ErrUnsupportedType is returned for uploads that are not plain text,
+// Markdown or PDF.
+var ErrUnsupportedType = errors.New("unsupported document type, upload plain text, Markdown or PDF")
+
+// ErrNoText is returned for documents without any text to index.
+var ErrNoText = errors.New("document has no text")
+
+// ErrUnreadable is returned for documents of a supported type that cannot
+// be decoded.
+var ErrUnreadable = errors.New("document cannot be read")
+
+// Extract returns the text of an uploaded file and its kind, which is
+// taken from the file name's extension or else from the content.
+func Extract(name string, data []byte) (text, kind string, err error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".md", ".markdown":
+		kind = KindMarkdown
+	case ".txt", ".text", ".log":
+		kind = KindText
+	case ".pdf":
+		kind = KindPDF
+	default:
+		switch {
+		case bytes.HasPrefix(data, []byte("%PDF-")):
+			kind = KindPDF
+		case strings.HasPrefix(http.DetectContentType(data), "text/plain"):
+			kind = KindText
+		default:
+			return "", "", ErrUnsupportedType
+		}
+	}
+
+	if kind == KindPDF {
+		text, err = pdfText(data)
+	} else {
+		text, err = plainText(data)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", "", ErrNoText
+	}
+	return text, kind, nil
+}
+
+func plainText(data []byte) (string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("%w: text is not UTF-8", ErrUnreadable)
+	}
+	return string(data), nil
+}
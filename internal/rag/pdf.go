@@ -0,0 +1,332 @@
+package rag
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxStreamBytes bounds a decompressed PDF stream.
+const maxStreamBytes = 32 << 20
+
+var (
+	streamStart = regexp.MustCompile(`stream\r?\n`)
+	spaceRuns   = regexp.MustCompile(`[ \t]+`)
+	lineRuns    = regexp.MustCompile(`\n{3,}`)
+)
+
+// pdfText extracts the text drawn by a PDF's content streams. It reads
+// uncompressed and Flate-compressed streams and strings in single-byte or
+// UTF-16 encodings, which covers PDFs exported by most editors. Text in
+// scanned pages or in fonts with custom glyph codes is not recovered.
+func pdfText(data []byte) (string, error) {
+	var out strings.Builder
+	for _, content := range pdfStreams(data) {
+		showText(&out, content)
+	}
+
+	text := spaceRuns.ReplaceAllString(out.String(), " ")
+	lines := strings.Split(text, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	text = strings.TrimSpace(lineRuns.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+	if text == "" {
+		return "", fmt.Errorf("%w (scanned PDFs are not supported)", ErrNoText)
+	}
+	return text, nil
+}
+
+// pdfStreams returns the decoded streams that may hold page content.
+// Images, fonts and streams with filters other than Flate are skipped.
+func pdfStreams(data []byte) [][]byte {
+	var streams [][]byte
+	for _, loc := range streamStart.FindAllIndex(data, -1) {
+		// the stream dictionary is what precedes the keyword in its object
+		dictStart := bytes.LastIndex(data[:loc[0]], []byte("obj"))
+		if dictStart < 0 || (loc[0] > 0 && data[loc[0]-1] == 'd') { // "endstream"
+			continue
+		}
+		dict := string(data[dictStart:loc[0]])
+
+		end := bytes.Index(data[loc[1]:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		body := data[loc[1] : loc[1]+end]
+
+		if strings.Contains(dict, "/Image") || strings.Contains(dict, "/Length1") ||
+			strings.Contains(dict, "/XRef") || strings.Contains(dict, "/ObjStm") {
+			continue
+		}
+		if strings.Contains(dict, "/Filter") {
+			if !strings.Contains(dict, "/FlateDecode") || strings.Contains(dict, "/DCTDecode") {
+				continue
+			}
+			r, err := zlib.NewReader(bytes.NewReader(body))
+			if err != nil {
+				continue
+			}
+			// a truncated stream still yields what was decoded
+			body, _ = io.ReadAll(io.LimitReader(r, maxStreamBytes))
+		}
+		streams = append(streams, body)
+	}
+	return streams
+}
+
+// pdfToken is a lexical token of a content stream.
+type pdfToken struct {
+	kind byte // s: string, n: number, o: operator or name, [ or ]
+	text string
+	num  float64
+}
+
+// showText interprets the text operators of a content stream and writes
+// the text they draw to out.
+func showText(out *strings.Builder, content []byte) {
+	lex := &pdfLexer{data: content}
+	var operands []pdfToken
+	lastY, haveY := 0.0, false
+
+	newline := func() {
+		if s := out.String(); s != "" && !strings.HasSuffix(s, "\n") {
+			out.WriteByte('\n')
+		}
+	}
+
+	for {
+		tok, ok := lex.next()
+		if !ok {
+			return
+		}
+		if tok.kind != 'o' || strings.HasPrefix(tok.text, "/") {
+			operands = append(operands, tok)
+			continue
+		}
+
+		switch tok.text {
+		case "Tj":
+			writeStrings(out, operands)
+		case "'", "\"":
+			newline()
+			writeStrings(out, operands)
+		case "TJ":
+			for _, op := range operands {
+				switch {
+				case op.kind == 's':
+					out.WriteString(op.text)
+				case op.kind == 'n' && op.num < -200:
+					out.WriteByte(' ') // a gap wide enough to be a space
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 && operands[len(operands)-1].num != 0 {
+				newline()
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				y := operands[len(operands)-1].num
+				if haveY && y != lastY {
+					newline()
+				}
+				lastY, haveY = y, true
+			}
+		case "T*", "ET":
+			newline()
+		case "ID":
+			lex.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
+
+func writeStrings(out *strings.Builder, operands []pdfToken) {
+	for _, op := range operands {
+		if op.kind == 's' {
+			out.WriteString(op.text)
+		}
+	}
+}
+
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *pdfLexer) next() (pdfToken, bool) {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		case c == '(':
+			l.pos++
+			return pdfToken{kind: 's', text: decodePDFString(l.literal())}, true
+		case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<',
+			c == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+			l.pos += 2
+			return pdfToken{kind: 'o', text: string(c) + string(c)}, true
+		case c == '<':
+			l.pos++
+			return pdfToken{kind: 's', text: decodePDFString(l.hex())}, true
+		case c == '[' || c == ']':
+			l.pos++
+			return pdfToken{kind: c}, true
+		default:
+			start := l.pos
+			l.pos++
+			for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+				l.pos++
+			}
+			word := string(l.data[start:l.pos])
+			if n, err := strconv.ParseFloat(word, 64); err == nil {
+				return pdfToken{kind: 'n', text: word, num: n}, true
+			}
+			return pdfToken{kind: 'o', text: word}, true
+		}
+	}
+	return pdfToken{}, false
+}
+
+// literal reads a (string) after its opening parenthesis.
+func (l *pdfLexer) literal() []byte {
+	var s []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return s
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return s
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// line continuation
+				if e == '\r' && l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					n := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						n = n*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(n)
+				} else {
+					c = e
+				}
+			}
+		}
+		s = append(s, c)
+	}
+	return s
+}
+
+// hex reads a <hex string> after its opening bracket.
+func (l *pdfLexer) hex() []byte {
+	end := bytes.IndexByte(l.data[l.pos:], '>')
+	if end < 0 {
+		end = len(l.data) - l.pos
+	}
+	var digits []byte
+	for _, c := range l.data[l.pos : l.pos+end] {
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	l.pos += end + 1
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	s := make([]byte, len(digits)/2)
+	for i := range s {
+		n, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		s[i] = byte(n)
+	}
+	return s
+}
+
+// skipInlineImage skips the data of an inline image up to its EI operator.
+func (l *pdfLexer) skipInlineImage() {
+	for i := l.pos; i+2 < len(l.data); i++ {
+		if isPDFSpace(l.data[i]) && l.data[i+1] == 'E' && l.data[i+2] == 'I' &&
+			(i+3 == len(l.data) || isPDFSpace(l.data[i+3])) {
+			l.pos = i + 3
+			return
+		}
+	}
+	l.pos = len(l.data)
+}
+
+// winAnsi maps the printable characters of WinAnsiEncoding that differ
+// from Latin-1.
+var winAnsi = map[byte]rune{
+	0x80: '€', 0x85: '…', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”',
+	0x95: '•', 0x96: '–', 0x97: '—', 0x99: '™',
+}
+
+// decodePDFString converts a string operand to text. Strings starting
+// with a byte order mark are UTF-16; anything else is read as WinAnsi.
+func decodePDFString(s []byte) string {
+	if len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff {
+		units := make([]uint16, 0, len(s)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+
+	var b strings.Builder
+	for _, c := range s {
+		switch r, ok := winAnsi[c]; {
+		case ok:
+			b.WriteRune(r)
+		case c == '\n' || c == '\r' || c == '\t':
+			b.WriteByte(' ')
+		case c < 0x20 || (c >= 0x7f && c < 0xa0):
+			// control characters, usually glyph codes of an unreadable font
+		default:
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,249 @@
+// Package rag answers questions about documents uploaded to a
+// conversation. Uploads are split into chunks and embedded; when a message
+// arrives the chunks closest to it are given to the model as context and
+// returned with the reply as citations.
+package rag
+
+import (
+	"ai-chatbot-web/internal/logging"
+	"ai-chatbot-web/internal/models"
+	"ai-chatbot-web/internal/store"
+	"ai-chatbot-web/internal/tracing"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// excerptLength bounds the excerpt of a chunk returned in a citation.
+const excerptLength = 200
+
+// minChunkSize is the smallest RAG_CHUNK_SIZE accepted; smaller chunks
+// carry too little text to be worth an embedding.
+const minChunkSize = 100
+
+// Embedder turns texts into embedding vectors. services.AIClient
+// implements it with Ollama's /api/embed.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	EmbeddingModel() string
+}
+
+// Index adds documents to conversations and retrieves context from them.
+type Index struct {
+	embedder  Embedder
+	documents store.DocumentStore
+
+	chunkSize    int
+	chunkOverlap int
+	topK         int
+	minScore     float64
+	maxBytes     int64
+}
+
+// NewIndex reads its settings from the environment: RAG_CHUNK_SIZE
+// (default 1200 bytes), RAG_CHUNK_OVERLAP (200), RAG_TOP_K (4 chunks per
+// message), RAG_MIN_SCORE (0, the cosine similarity below which chunks
+// are not used) and RAG_MAX_DOCUMENT_BYTES (10 MiB). A chunk size below
+// minChunkSize falls back to the default, and an overlap that is not
+// smaller than the chunk size to a quarter of it.
+func NewIndex(embedder Embedder, documents store.DocumentStore) *Index {
+	log := logging.For("rag")
+	chunkSize := envInt("RAG_CHUNK_SIZE", 1200)
+	if chunkSize < minChunkSize {
+		log.Warn("RAG_CHUNK_SIZE too small, using the default", "value", chunkSize, "minimum", minChunkSize)
+		chunkSize = 1200
+	}
+	chunkOverlap := envInt("RAG_CHUNK_OVERLAP", 200)
+	if chunkOverlap >= chunkSize {
+		log.Warn("RAG_CHUNK_OVERLAP not smaller than the chunk size, using a quarter of it",
+			"value", chunkOverlap, "chunk_size", chunkSize)
+		chunkOverlap = chunkSize / 4
+	}
+
+	return &Index{
+		embedder:     embedder,
+		documents:    documents,
+		chunkSize:    chunkSize,
+		chunkOverlap: chunkOverlap,
+		topK:         envInt("RAG_TOP_K", 4),
+		minScore:     envFloat("RAG_MIN_SCORE", 0),
+		maxBytes:     int64(envInt("RAG_MAX_DOCUMENT_BYTES", 10<<20)),
+	}
+}
+
+func envInt(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v >= 0 {
+		return v
+	}
+	return def
+}
+
+func envFloat(name string, def float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil {
+		return v
+	}
+	return def
+}
+
+// MaxDocumentBytes is the largest upload accepted.
+func (x *Index) MaxDocumentBytes() int64 {
+	return x.maxBytes
+}
+
+// Documents lists the documents of a conversation.
+func (x *Index) Documents(ctx context.Context, conversationID string) ([]models.Document, error) {
+	return x.documents.ListByConversation(ctx, conversationID)
+}
+
+// Delete removes a document from a conversation.
+func (x *Index) Delete(ctx context.Context, id, conversationID string) error {
+	return x.documents.Delete(ctx, id, conversationID)
+}
+
+// Add extracts, chunks and embeds an uploaded file and saves it to a
+// conversation. Files that cannot be indexed fail with ErrUnsupportedType,
+// ErrUnreadable or ErrNoText; embedding failures are returned as they come
+// from the Embedder.
+func (x *Index) Add(ctx context.Context, conversationID, name string, data []byte) (*models.Document, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "rag.add")
+	defer span.End()
+
+	text, kind, err := Extract(name, data)
+	if err != nil {
+		return nil, err
+	}
+
+	pieces := Split(text, x.chunkSize, x.chunkOverlap)
+	embeddings, err := x.embedder.Embed(ctx, pieces)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	chunks := make([]models.DocumentChunk, len(pieces))
+	for i, piece := range pieces {
+		chunks[i] = models.DocumentChunk{
+			Position:  i,
+			Content:   piece,
+			Embedding: embeddings[i],
+		}
+	}
+
+	document := &models.Document{
+		ConversationID: conversationID,
+		Name:           name,
+		Kind:           kind,
+		Size:           int64(len(data)),
+		Chunks:         len(chunks),
+		EmbeddingModel: x.embedder.EmbeddingModel(),
+	}
+	if err := x.documents.Create(ctx, document, chunks); err != nil {
+		return nil, fmt.Errorf("failed to save document: %v", err)
+	}
+
+	span.SetAttributes(attribute.String("rag.kind", kind), attribute.Int("rag.chunks", len(chunks)))
+	logging.For("rag").InfoContext(ctx, "document added", "document_id", document.ID,
+		"conversation_id", conversationID, "kind", kind, "bytes", len(data), "chunks", len(chunks))
+	return document, nil
+}
+
+// Retrieval is the context found for a message.
+type Retrieval struct {
+	Citations []models.Citation
+	sources   []string // the full chunk of each citation
+}
+
+// Retrieve finds the chunks of a conversation's documents closest to
+// query. It returns nil, without calling the embedder, if the
+// conversation has no documents.
+func (x *Index) Retrieve(ctx context.Context, conversationID, query string) (*Retrieval, error) {
+	documents, err := x.documents.ListByConversation(ctx, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load documents: %v", err)
+	}
+	if len(documents) == 0 || x.topK == 0 {
+		return nil, nil
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "rag.retrieve")
+	defer span.End()
+
+	embeddings, err := x.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	matches, err := x.documents.Search(ctx, conversationID, embeddings[0], x.topK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search documents: %v", err)
+	}
+
+	names := make(map[string]string, len(documents))
+	for _, document := range documents {
+		names[document.ID] = document.Name
+	}
+
+	retrieval := &Retrieval{}
+	for _, match := range matches {
+		if match.Score < x.minScore {
+			continue
+		}
+		retrieval.Citations = append(retrieval.Citations, models.Citation{
+			Source:     len(retrieval.Citations) + 1,
+			DocumentID: match.Chunk.DocumentID,
+			Document:   names[match.Chunk.DocumentID],
+			Position:   match.Chunk.Position,
+			Score:      match.Score,
+			Excerpt:    excerpt(match.Chunk.Content),
+		})
+		retrieval.sources = append(retrieval.sources, match.Chunk.Content)
+	}
+
+	span.SetAttributes(attribute.Int("rag.documents", len(documents)), attribute.Int("rag.citations", len(retrieval.Citations)))
+	if len(retrieval.Citations) == 0 {
+		return nil, nil
+	}
+	return retrieval, nil
+}
+
+// Inject returns messages with the retrieved excerpts added as a system
+// message just before the last one, the message being answered. The
+// excerpts are only sent to the model, not saved in the conversation.
+func (r *Retrieval) Inject(messages []models.Message) []models.Message {
+	if r == nil || len(messages) == 0 {
+		return messages
+	}
+
+	var prompt strings.Builder
+	prompt.WriteString("Excerpts from documents uploaded to this conversation follow. " +
+		"Use them to answer when they are relevant and cite them by number, like [1]. " +
+		"If a question is about the documents but they do not contain the answer, say so rather than guessing.")
+	for i, citation := range r.Citations {
+		fmt.Fprintf(&prompt, "\n\n[%d] %s, part %d:\n%s", citation.Source, citation.Document, citation.Position+1, r.sources[i])
+	}
+
+	last := len(messages) - 1
+	injected := append([]models.Message(nil), messages[:last]...)
+	injected = append(injected, models.Message{Role: "system", Content: prompt.String()})
+	return append(injected, messages[last])
+}
+
+// excerpt shortens a chunk for a citation.
+func excerpt(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	if len(content) <= excerptLength {
+		return content
+	}
+	cut := strings.LastIndexByte(content[:excerptLength], ' ')
+	if cut <= 0 {
+		cut = excerptLength
+	}
+	return strings.ToValidUTF8(content[:cut], "") + "…"
+}
@@ -0,0 +1,184 @@
+package rag
+
+import (
+	"ai-chatbot-web/internal/fakeollama"
+	"ai-chatbot-web/internal/models"
+	"ai-chatbot-web/internal/store"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type embedder struct{ calls int }
+
+func (e *embedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.calls++
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		for _, v := range fakeollama.Embed(text, fakeollama.DefaultDimensions) {
+			embeddings[i] = append(embeddings[i], float32(v))
+		}
+	}
+	return embeddings, nil
+}
+
+func (e *embedder) EmbeddingModel() string { return "test-embed" }
+
+func TestSplit(t *testing.T) {
+	text := "First paragraph.\r\n\r\nSecond paragraph is here.\n\n\n" + strings.Repeat("word ", 30)
+	chunks := Split(text, 40, 10)
+	for _, chunk := range chunks {
+		if len(chunk) > 40 {
+			t.Errorf("chunk longer than 40 bytes: %q", chunk)
+		}
+	}
+	if chunks[0] != "First paragraph." || !strings.HasPrefix(chunks[1], "Second") {
+		t.Errorf("paragraphs not kept together: %q", chunks)
+	}
+	if !strings.HasPrefix(chunks[3], "word word") || strings.Count(strings.Join(chunks, " "), "word") <= 30 {
+		t.Errorf("chunks do not overlap: %q", chunks)
+	}
+
+	if got := Split(strings.Repeat("é", 30), 9, 0); len(got) != 8 || got[0] != "éééé" {
+		t.Errorf("long word not cut on character boundaries: %q", got)
+	}
+	if got := Split(" \n\n ", 100, 10); len(got) != 0 {
+		t.Errorf("blank text gave chunks: %q", got)
+	}
+
+	// sizes too small for a character, or none at all, still end
+	for _, size := range []int{-1, 0, 1, 3} {
+		if got := Split("a 🙂🙂 b", size, size); strings.Join(got, "") != "a🙂🙂b" {
+			t.Errorf("Split with size %d = %q", size, got)
+		}
+	}
+}
+
+func TestNewIndexChunkSettings(t *testing.T) {
+	for _, tc := range []struct {
+		size, overlap         string
+		wantSize, wantOverlap int
+	}{
+		{"", "", 1200, 200},
+		{"500", "50", 500, 50},
+		{"0", "", 1200, 200},
+		{"10", "", 1200, 200},
+		{"150", "", 150, 37},
+		{"400", "400", 400, 100},
+	} {
+		t.Setenv("RAG_CHUNK_SIZE", tc.size)
+		t.Setenv("RAG_CHUNK_OVERLAP", tc.overlap)
+		x := NewIndex(nil, nil)
+		if x.chunkSize != tc.wantSize || x.chunkOverlap != tc.wantOverlap {
+			t.Errorf("size %q, overlap %q: got %d, %d; want %d, %d",
+				tc.size, tc.overlap, x.chunkSize, x.chunkOverlap, tc.wantSize, tc.wantOverlap)
+		}
+	}
+}
+
+// pdf builds a one-page PDF around a content stream.
+func pdf(content string, compress bool) []byte {
+	dict, body := "", content
+	if compress {
+		var b bytes.Buffer
+		w := zlib.NewWriter(&b)
+		w.Write([]byte(content))
+		w.Close()
+		dict, body = " /Filter /FlateDecode", b.String()
+	}
+	return []byte(fmt.Sprintf("%%PDF-1.4\n1 0 obj\n<< /Type /Page /Contents 2 0 R >>\nendobj\n"+
+		"2 0 obj\n<< /Length %d%s >>\nstream\n%s\nendstream\nendobj\n"+
+		"3 0 obj\n<< /Subtype /Image /Length 4 >>\nstream\n(xx)\nendstream\nendobj\n%%%%EOF\n",
+		len(body), dict, body))
+}
+
+func TestExtract(t *testing.T) {
+	page := `BT /F1 12 Tf 72 712 Td (Restart the \(primary\) database) Tj
+0 -14 Td [(Run ) -300 (failover) 120 (.sh)] TJ
+T* <FEFF00E9007400E9> Tj ET`
+	want := "Restart the (primary) database\nRun failover.sh\nété"
+
+	tests := []struct {
+		name     string
+		data     []byte
+		want     string
+		wantKind string
+		wantErr  error
+	}{
+		{"notes.md", []byte("# Runbook\n\nStep one."), "# Runbook\n\nStep one.", KindMarkdown, nil},
+		{"notes", []byte("\xef\xbb\xbfplain"), "plain", KindText, nil},
+		{"page.pdf", pdf(page, false), want, KindPDF, nil},
+		{"upload", pdf(page, true), want, KindPDF, nil},
+		{"scan.pdf", pdf("q 1 0 0 1 0 0 cm /Im0 Do Q", true), "", "", ErrNoText},
+		{"bad.txt", []byte("caf\xe9"), "", "", ErrUnreadable},
+		{"empty.md", []byte("\n \n"), "", "", ErrNoText},
+		{"image", []byte("\x89PNG\r\n\x1a\n\x00\x00"), "", "", ErrUnsupportedType},
+	}
+	for _, tt := range tests {
+		text, kind, err := Extract(tt.name, tt.data)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if text != tt.want || kind != tt.wantKind {
+			t.Errorf("%s: got %s %q, want %s %q", tt.name, kind, text, tt.wantKind, tt.want)
+		}
+	}
+}
+
+func TestRetrieve(t *testing.T) {
+	ctx := context.Background()
+	e := &embedder{}
+	documents := store.NewMemoryStore().Documents()
+	index := NewIndex(e, documents)
+	index.chunkSize = 60
+
+	if r, err := index.Retrieve(ctx, "c1", "anything"); r != nil || err != nil || e.calls != 0 {
+		t.Fatalf("Retrieve without documents = %v, %v after %d embed calls", r, err, e.calls)
+	}
+
+	runbook := "Disk full on the database host: rotate the logs.\n\n" +
+		"Certificate expired: renew it with certbot.\n\n" +
+		"High latency: check the load balancer health."
+	document, err := index.Add(ctx, "c1", "runbook.md", []byte(runbook))
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if document.Chunks != 3 || document.Kind != KindMarkdown || document.EmbeddingModel != "test-embed" {
+		t.Errorf("document = %+v", document)
+	}
+
+	r, err := index.Retrieve(ctx, "c1", "how do I renew an expired certificate")
+	if err != nil || r == nil {
+		t.Fatalf("Retrieve = %v, %v", r, err)
+	}
+	top := r.Citations[0]
+	if top.Source != 1 || top.Document != "runbook.md" || top.Position != 1 || !strings.Contains(top.Excerpt, "certbot") {
+		t.Errorf("top citation = %+v", top)
+	}
+	if len(r.Citations) != 3 || r.Citations[1].Score > top.Score {
+		t.Errorf("citations not ranked: %+v", r.Citations)
+	}
+
+	history := []models.Message{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "question"}}
+	injected := r.Inject(history)
+	if len(injected) != 3 || injected[2].Content != "question" || injected[1].Role != "system" ||
+		!strings.Contains(injected[1].Content, "[1] runbook.md, part 2:\nCertificate expired") {
+		t.Errorf("Inject = %+v", injected)
+	}
+	if len(history) != 2 {
+		t.Error("Inject modified its input")
+	}
+
+	index.minScore = 0.99
+	if r, _ := index.Retrieve(ctx, "c1", "unrelated words entirely"); r != nil {
+		t.Errorf("weak matches kept: %+v", r.Citations)
+	}
+	if r, _ := index.Retrieve(ctx, "c2", "certificate"); r != nil {
+		t.Error("documents of another conversation retrieved")
+	}
+}
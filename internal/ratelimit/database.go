@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"ai-chatbot-web/internal/database"
+	"ai-chatbot-web/internal/models"
+	"fmt"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DatabaseLimiter keeps request counts in the rate_limit_hits table and
+// derives token usage from the stored message token counts, so limits
+// survive restarts and are shared between server instances.
+type DatabaseLimiter struct {
+	db *database.Database
+}
+
+func NewDatabaseLimiter(db *database.Database) *DatabaseLimiter {
+	return &DatabaseLimiter{
+		db: db,
+	}
+}
+
+func (d *DatabaseLimiter) Take(buckets []Bucket, window time.Duration) (int, time.Duration, error) {
+	full := -1
+	var retryAfter time.Duration
+
+	err := d.db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := d.lock(tx, buckets); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		cutoff := now.Add(-window)
+
+		for i, b := range buckets {
+			if err := tx.Where("key = ? AND created_at <= ?", b.Key, cutoff).Delete(&models.RateLimitHit{}).Error; err != nil {
+				return err
+			}
+
+			var hits []models.RateLimitHit
+			if err := tx.Where("key = ?", b.Key).Order("created_at ASC").Limit(b.Limit).Find(&hits).Error; err != nil {
+				return err
+			}
+
+			if len(hits) >= b.Limit {
+				full = i
+				retryAfter = hits[0].CreatedAt.Add(window).Sub(now)
+				return nil
+			}
+		}
+
+		for _, b := range buckets {
+			if err := tx.Create(&models.RateLimitHit{Key: b.Key, CreatedAt: now}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to apply rate limit: %v", err)
+	}
+
+	return full, retryAfter, nil
+}
+
+// lock keeps concurrent requests for the same buckets, on this server or
+// another, from both seeing room for one more hit. On Postgres each key
+// is locked until tx ends, in a fixed order so that two requests cannot
+// deadlock. SQLite allows one writer at a time, and Take writes first.
+func (d *DatabaseLimiter) lock(tx *gorm.DB, buckets []Bucket) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	keys := make([]string, len(buckets))
+	for i, b := range buckets {
+		keys[i] = b.Key
+	}
+	slices.Sort(keys)
+	for _, key := range slices.Compact(keys) {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", key).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DatabaseLimiter) Requests(key string, window time.Duration) (int, error) {
+	var count int64
+	if err := d.db.DB.Model(&models.RateLimitHit{}).
+		Where("key = ? AND created_at > ?", key, time.Now().Add(-window)).
+		Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count requests: %v", err)
+	}
+	return int(count), nil
+}
+
+func (d *DatabaseLimiter) TokensUsed(subject Subject, since time.Time) (int, error) {
+	// Timestamps are stored in local time; compare like with like so
+	// SQLite's string comparison stays correct.
+	query := d.db.DB.Model(&models.Message{}).Where("messages.created_at >= ?", since.In(time.Local))
+
+	switch subject.Kind {
+	case KindUser:
+		query = query.
+			Joins("JOIN conversations ON conversations.id = messages.conversation_id").
+			Where("conversations.user_id = ?", subject.ID)
+	case KindAPIKey:
+		query = query.Where("messages.api_key_id = ?", subject.ID)
+	default:
+		return 0, fmt.Errorf("unknown subject kind: %s", subject.Kind)
+	}
+
+	var total int64
+	if err := query.Select("COALESCE(SUM(messages.token_count), 0)").Scan(&total).Error; err != nil {
+		return 0, fmt.Errorf("failed to sum token usage: %v", err)
+	}
+	return int(total), nil
+}
+
+// AddTokens is a no-op: token usage is read back from the messages table.
+func (d *DatabaseLimiter) AddTokens(subject Subject, tokens int) error {
+	return nil
+}
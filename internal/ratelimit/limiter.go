@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"time"
+)
+
+const (
+	KindUser   = "user"
+	KindAPIKey = "api_key"
+)
+
+// Subject identifies who a limit is applied to.
+type Subject struct {
+	Kind string
+	ID   string
+}
+
+// Key returns the bucket key for the subject.
+func (s Subject) Key() string {
+	return s.Kind + ":" + s.ID
+}
+
+// Bucket is one request limit checked by Limiter.Take.
+type Bucket struct {
+	Key   string
+	Limit int
+}
+
+// Limiter stores rate limit state. Implementations must be safe for
+// concurrent use.
+type Limiter interface {
+	// Take records a request against every bucket if each had fewer than
+	// its limit of requests in the trailing window, and returns -1. When a
+	// bucket is full nothing is recorded, and it returns the index of that
+	// bucket and how long until a slot frees up.
+	Take(buckets []Bucket, window time.Duration) (int, time.Duration, error)
+
+	// Requests returns how many requests key made in the trailing window.
+	Requests(key string, window time.Duration) (int, error)
+
+	// TokensUsed returns the tokens consumed by subject since t.
+	TokensUsed(subject Subject, since time.Time) (int, error)
+
+	// AddTokens records tokens consumed by subject.
+	AddTokens(subject Subject, tokens int) error
+}
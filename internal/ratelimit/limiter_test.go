@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"ai-chatbot-web/internal/database/databasetest"
+	"ai-chatbot-web/internal/models"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// limiters returns a fresh limiter of each kind.
+func limiters(t *testing.T) map[string]Limiter {
+	return map[string]Limiter{
+		"memory":   NewMemoryLimiter(),
+		"database": NewDatabaseLimiter(databasetest.Open(t)),
+	}
+}
+
+func TestLimiterTake(t *testing.T) {
+	for name, limiter := range limiters(t) {
+		t.Run(name, func(t *testing.T) {
+			window := 200 * time.Millisecond
+			user := Bucket{Key: "user:alice", Limit: 3}
+			key := Bucket{Key: "api_key:k1", Limit: 1}
+
+			if full, _, err := limiter.Take([]Bucket{user, key}, window); err != nil || full != -1 {
+				t.Fatalf("first request: full %d, err %v", full, err)
+			}
+			// the key is full, so the user's slot is not spent either
+			full, retryAfter, err := limiter.Take([]Bucket{user, key}, window)
+			if err != nil || full != 1 || retryAfter <= 0 || retryAfter > window {
+				t.Errorf("second request: full %d, retry after %s, err %v", full, retryAfter, err)
+			}
+			if n, _ := limiter.Requests(user.Key, window); n != 1 {
+				t.Errorf("user requests = %d, want 1", n)
+			}
+
+			for range 2 {
+				if full, _, _ := limiter.Take([]Bucket{user}, window); full != -1 {
+					t.Errorf("user refused below the limit")
+				}
+			}
+			if full, _, _ := limiter.Take([]Bucket{user}, window); full != 0 {
+				t.Errorf("user allowed over the limit")
+			}
+
+			// slots free up as the window slides
+			time.Sleep(window)
+			if full, _, _ := limiter.Take([]Bucket{user, key}, window); full != -1 {
+				t.Errorf("refused after the window passed")
+			}
+		})
+	}
+}
+
+func TestLimiterTakeConcurrently(t *testing.T) {
+	for name, limiter := range limiters(t) {
+		t.Run(name, func(t *testing.T) {
+			buckets := []Bucket{{Key: "user:alice", Limit: 5}, {Key: "api_key:k1", Limit: 50}}
+
+			var wg sync.WaitGroup
+			var allowed atomic.Int32
+			for range 20 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					full, _, err := limiter.Take(buckets, time.Minute)
+					if err != nil {
+						t.Errorf("Take: %v", err)
+					}
+					if err == nil && full == -1 {
+						allowed.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if n := allowed.Load(); n != 5 {
+				t.Errorf("%d of 20 concurrent requests allowed, want 5", n)
+			}
+			if n, _ := limiter.Requests("api_key:k1", time.Minute); n != 5 {
+				t.Errorf("key requests = %d, want 5", n)
+			}
+		})
+	}
+}
+
+func TestMemoryLimiterTokens(t *testing.T) {
+	m := NewMemoryLimiter()
+	alice := Subject{Kind: KindUser, ID: "alice"}
+	m.AddTokens(alice, 10)
+	m.AddTokens(alice, 5)
+	if used, _ := m.TokensUsed(alice, time.Now().Add(-time.Hour)); used != 15 {
+		t.Errorf("tokens used = %d, want 15", used)
+	}
+	if used, _ := m.TokensUsed(alice, time.Now().Add(time.Hour)); used != 0 {
+		t.Errorf("tokens used from the future = %d", used)
+	}
+}
+
+func TestMemoryLimiterForgetsQuietSubjects(t *testing.T) {
+	m := NewMemoryLimiter()
+	m.Take([]Bucket{{Key: "user:alice", Limit: 5}}, time.Minute)
+	m.AddTokens(Subject{Kind: KindUser, ID: "alice"}, 10)
+
+	// alice goes quiet for longer than anything is kept
+	for key, hits := range m.requests {
+		m.requests[key] = []time.Time{hits[0].Add(-time.Hour)}
+	}
+	for key, records := range m.tokens {
+		records[0].at = records[0].at.Add(-tokenRetention - time.Hour)
+		m.tokens[key] = records
+	}
+	m.swept = time.Now().Add(-sweepInterval)
+
+	m.AddTokens(Subject{Kind: KindUser, ID: "bob"}, 1)
+	if _, ok := m.requests["user:alice"]; ok {
+		t.Error("alice's requests were kept")
+	}
+	if _, ok := m.tokens["user:alice"]; ok {
+		t.Error("alice's tokens were kept")
+	}
+	if len(m.tokens) != 1 {
+		t.Errorf("tokens kept for %d subjects, want 1", len(m.tokens))
+	}
+}
+
+func TestDatabaseLimiterTokens(t *testing.T) {
+	db := databasetest.Open(t)
+	d := NewDatabaseLimiter(db)
+
+	conversation := models.Conversation{UserID: "alice"}
+	if err := db.DB.Create(&conversation).Error; err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	now := time.Now()
+	for _, msg := range []models.Message{
+		{Role: "user", TokenCount: 10, APIKeyID: "k1", CreatedAt: now},
+		{Role: "assistant", TokenCount: 20, CreatedAt: now},
+		{Role: "user", TokenCount: 100, CreatedAt: now.Add(-48 * time.Hour)},
+	} {
+		msg.ConversationID = conversation.ID
+		if err := db.DB.Create(&msg).Error; err != nil {
+			t.Fatalf("create message: %v", err)
+		}
+	}
+
+	since := now.Add(-time.Hour)
+	if used, err := d.TokensUsed(Subject{Kind: KindUser, ID: "alice"}, since); err != nil || used != 30 {
+		t.Errorf("user tokens = %d, %v; want 30", used, err)
+	}
+	if used, err := d.TokensUsed(Subject{Kind: KindAPIKey, ID: "k1"}, since); err != nil || used != 10 {
+		t.Errorf("key tokens = %d, %v; want 10", used, err)
+	}
+	if _, err := d.TokensUsed(Subject{Kind: "team", ID: "x"}, since); err == nil {
+		t.Error("unknown subject kind accepted")
+	}
+}
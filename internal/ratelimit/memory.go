@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenRetention bounds how long token records are kept in memory; quotas
+// only ever look back to the start of the current day.
+const tokenRetention = 48 * time.Hour
+
+// sweepInterval is how often MemoryLimiter drops the state of subjects
+// that have gone quiet, which nothing else would look at again.
+const sweepInterval = time.Hour
+
+type tokenRecord struct {
+	at     time.Time
+	tokens int
+}
+
+// MemoryLimiter keeps rate limit state in process memory. State is lost on
+// restart and is not shared between server instances.
+type MemoryLimiter struct {
+	mu       sync.Mutex
+	requests map[string][]time.Time
+	tokens   map[string][]tokenRecord
+
+	window time.Duration // longest window passed to Take
+	swept  time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		requests: make(map[string][]time.Time),
+		tokens:   make(map[string][]tokenRecord),
+		swept:    time.Now(),
+	}
+}
+
+func (m *MemoryLimiter) Take(buckets []Bucket, window time.Duration) (int, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.window = max(m.window, window)
+	m.sweep(now)
+
+	for i, b := range buckets {
+		if hits := m.prune(b.Key, now.Add(-window)); len(hits) >= b.Limit {
+			return i, hits[0].Add(window).Sub(now), nil
+		}
+	}
+
+	for _, b := range buckets {
+		m.requests[b.Key] = append(m.requests[b.Key], now)
+	}
+	return -1, 0, nil
+}
+
+func (m *MemoryLimiter) Requests(key string, window time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.prune(key, time.Now().Add(-window))), nil
+}
+
+func (m *MemoryLimiter) TokensUsed(subject Subject, since time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	total := 0
+	for _, rec := range m.tokens[subject.Key()] {
+		if !rec.at.Before(since) {
+			total += rec.tokens
+		}
+	}
+	return total, nil
+}
+
+func (m *MemoryLimiter) AddTokens(subject Subject, tokens int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	key := subject.Key()
+	m.sweep(now)
+
+	m.tokens[key] = append(m.pruneTokens(key, now.Add(-tokenRetention)), tokenRecord{at: now, tokens: tokens})
+	return nil
+}
+
+// sweep prunes every subject once sweepInterval has passed since the last
+// sweep, so subjects that stopped making requests do not stay in memory.
+// Callers must hold m.mu.
+func (m *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(m.swept) < sweepInterval {
+		return
+	}
+	m.swept = now
+
+	for key := range m.requests {
+		m.prune(key, now.Add(-m.window))
+	}
+	for key := range m.tokens {
+		m.pruneTokens(key, now.Add(-tokenRetention))
+	}
+}
+
+// pruneTokens drops token records older than cutoff and returns what is
+// left. Callers must hold m.mu.
+func (m *MemoryLimiter) pruneTokens(key string, cutoff time.Time) []tokenRecord {
+	records := m.tokens[key]
+	for len(records) > 0 && records[0].at.Before(cutoff) {
+		records = records[1:]
+	}
+
+	if len(records) == 0 {
+		delete(m.tokens, key)
+	} else {
+		m.tokens[key] = records
+	}
+	return records
+}
+
+// prune drops hits older than cutoff and returns what is left. Callers must
+// hold m.mu.
+func (m *MemoryLimiter) prune(key string, cutoff time.Time) []time.Time {
+	hits := m.requests[key]
+	i := 0
+	for i < len(hits) && !hits[i].After(cutoff) {
+		i++
+	}
+	hits = hits[i:]
+
+	if len(hits) == 0 {
+		delete(m.requests, key)
+	} else {
+		m.requests[key] = hits
+	}
+	return hits
+}
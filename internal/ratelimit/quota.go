@@ -0,0 +1,214 @@
+package ratelimit
+
+import (
+	"ai-chatbot-web/internal/database"
+	"ai-chatbot-web/internal/logging"
+	"os"
+	"strconv"
+	"time"
+)
+
+// requestWindow is the window requests-per-minute limits are measured over.
+const requestWindow = time.Minute
+
+// Limits configures one class of subject. Zero means unlimited.
+type Limits struct {
+	RequestsPerMinute int `json:"requests_per_minute"`
+	TokensPerDay      int `json:"tokens_per_day"`
+}
+
+// Decision is the outcome of a quota check.
+type Decision struct {
+	Allowed    bool
+	RetryAfter time.Duration
+	Reason     string
+}
+
+// BucketUsage describes consumption of one limit.
+type BucketUsage struct {
+	Limit     int       `json:"limit"` // 0 means unlimited
+	Used      int       `json:"used"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+// SubjectUsage reports usage for a single subject.
+type SubjectUsage struct {
+	ID       string      `json:"id"`
+	Requests BucketUsage `json:"requests"`
+	Tokens   BucketUsage `json:"tokens"`
+}
+
+// Quota applies per-user and per-API-key limits using a Limiter.
+type Quota struct {
+	limiter   Limiter
+	userLimit Limits
+	keyLimit  Limits
+}
+
+// NewQuota creates a Quota configured from environment variables:
+//
+//	RATE_LIMIT_BACKEND             memory (default) or database
+//	RATE_LIMIT_USER_RPM            requests per minute per user
+//	RATE_LIMIT_USER_TOKENS_PER_DAY tokens per UTC day per user
+//	RATE_LIMIT_KEY_RPM             requests per minute per API key
+//	RATE_LIMIT_KEY_TOKENS_PER_DAY  tokens per UTC day per API key
+//
+// Limits that are unset or zero are not enforced.
+func NewQuota(db *database.Database) *Quota {
+	var limiter Limiter
+	switch backend := os.Getenv("RATE_LIMIT_BACKEND"); backend {
+	case "database":
+		limiter = NewDatabaseLimiter(db)
+	case "", "memory":
+		limiter = NewMemoryLimiter()
+	default:
+		logging.For("ratelimit").Warn("unknown RATE_LIMIT_BACKEND, using memory", "backend", backend)
+		limiter = NewMemoryLimiter()
+	}
+
+	return NewQuotaWithLimiter(limiter,
+		Limits{
+			RequestsPerMinute: envInt("RATE_LIMIT_USER_RPM"),
+			TokensPerDay:      envInt("RATE_LIMIT_USER_TOKENS_PER_DAY"),
+		},
+		Limits{
+			RequestsPerMinute: envInt("RATE_LIMIT_KEY_RPM"),
+			TokensPerDay:      envInt("RATE_LIMIT_KEY_TOKENS_PER_DAY"),
+		},
+	)
+}
+
+func NewQuotaWithLimiter(limiter Limiter, userLimit, keyLimit Limits) *Quota {
+	return &Quota{
+		limiter:   limiter,
+		userLimit: userLimit,
+		keyLimit:  keyLimit,
+	}
+}
+
+// AllowRequest reports whether a request may proceed and, if so, counts it
+// against every subject. A request refused by one subject's limit is not
+// counted against the others.
+func (q *Quota) AllowRequest(subjects ...Subject) (Decision, error) {
+	var buckets []Bucket
+	var limited []Subject
+	for _, s := range subjects {
+		limit := q.limitsFor(s).RequestsPerMinute
+		if limit <= 0 {
+			continue
+		}
+		buckets = append(buckets, Bucket{Key: s.Key(), Limit: limit})
+		limited = append(limited, s)
+	}
+	if len(buckets) == 0 {
+		return Decision{Allowed: true}, nil
+	}
+
+	full, retryAfter, err := q.limiter.Take(buckets, requestWindow)
+	if err != nil {
+		return Decision{}, err
+	}
+	if full >= 0 {
+		return Decision{
+			RetryAfter: retryAfter,
+			Reason:     "request rate limit exceeded for " + limited[full].Kind,
+		}, nil
+	}
+	return Decision{Allowed: true}, nil
+}
+
+// AllowTokens reports whether every subject still has token quota left
+// today.
+func (q *Quota) AllowTokens(subjects ...Subject) (Decision, error) {
+	dayStart, dayEnd := today()
+
+	for _, s := range subjects {
+		limit := q.limitsFor(s).TokensPerDay
+		if limit <= 0 {
+			continue
+		}
+
+		used, err := q.limiter.TokensUsed(s, dayStart)
+		if err != nil {
+			return Decision{}, err
+		}
+		if used >= limit {
+			return Decision{
+				RetryAfter: time.Until(dayEnd),
+				Reason:     "daily token quota exceeded for " + s.Kind,
+			}, nil
+		}
+	}
+	return Decision{Allowed: true}, nil
+}
+
+// RecordTokens adds tokens to every subject's daily usage.
+func (q *Quota) RecordTokens(tokens int, subjects ...Subject) error {
+	for _, s := range subjects {
+		if err := q.limiter.AddTokens(s, tokens); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Usage reports current consumption for subject.
+func (q *Quota) Usage(s Subject) (*SubjectUsage, error) {
+	limits := q.limitsFor(s)
+	dayStart, dayEnd := today()
+
+	requests, err := q.limiter.Requests(s.Key(), requestWindow)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := q.limiter.TokensUsed(s, dayStart)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SubjectUsage{
+		ID:       s.ID,
+		Requests: bucket(limits.RequestsPerMinute, requests, time.Now().Add(requestWindow)),
+		Tokens:   bucket(limits.TokensPerDay, tokens, dayEnd),
+	}, nil
+}
+
+func (q *Quota) limitsFor(s Subject) Limits {
+	if s.Kind == KindAPIKey {
+		return q.keyLimit
+	}
+	return q.userLimit
+}
+
+func bucket(limit, used int, resetAt time.Time) BucketUsage {
+	remaining := 0
+	if limit > 0 {
+		remaining = max(limit-used, 0)
+	}
+	return BucketUsage{
+		Limit:     limit,
+		Used:      used,
+		Remaining: remaining,
+		ResetAt:   resetAt,
+	}
+}
+
+// today returns the bounds of the current UTC day.
+func today() (time.Time, time.Time) {
+	start := time.Now().UTC().Truncate(24 * time.Hour)
+	return start, start.Add(24 * time.Hour)
+}
+
+func envInt(name string) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		logging.For("ratelimit").Warn("ignoring invalid limit", "name", name, "value", v)
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuotaAllowRequest(t *testing.T) {
+	q := NewQuotaWithLimiter(NewMemoryLimiter(), Limits{RequestsPerMinute: 2}, Limits{RequestsPerMinute: 1})
+	alice := Subject{Kind: KindUser, ID: "alice"}
+	key := Subject{Kind: KindAPIKey, ID: "k1"}
+
+	if d, err := q.AllowRequest(alice, key); err != nil || !d.Allowed {
+		t.Fatalf("first request: %+v, %v", d, err)
+	}
+	d, err := q.AllowRequest(alice, key)
+	if err != nil || d.Allowed || d.Reason != "request rate limit exceeded for api_key" || d.RetryAfter <= 0 {
+		t.Errorf("request over the key limit: %+v, %v", d, err)
+	}
+
+	// the refused request did not use up alice's second slot
+	if d, _ := q.AllowRequest(alice); !d.Allowed {
+		t.Errorf("alice refused after a request her key refused: %+v", d)
+	}
+	if d, _ := q.AllowRequest(alice); d.Allowed || d.Reason != "request rate limit exceeded for user" {
+		t.Errorf("request over the user limit: %+v", d)
+	}
+
+	// without limits nothing is counted
+	unlimited := NewQuotaWithLimiter(NewMemoryLimiter(), Limits{}, Limits{})
+	for range 5 {
+		if d, _ := unlimited.AllowRequest(alice, key); !d.Allowed {
+			t.Fatalf("unlimited request refused: %+v", d)
+		}
+	}
+	if usage, _ := unlimited.Usage(alice); usage.Requests.Used != 0 || usage.Requests.Limit != 0 {
+		t.Errorf("unlimited usage = %+v", usage.Requests)
+	}
+}
+
+func TestQuotaTokens(t *testing.T) {
+	q := NewQuotaWithLimiter(NewMemoryLimiter(), Limits{TokensPerDay: 100}, Limits{TokensPerDay: 10})
+	alice := Subject{Kind: KindUser, ID: "alice"}
+	key := Subject{Kind: KindAPIKey, ID: "k1"}
+
+	if d, _ := q.AllowTokens(alice, key); !d.Allowed {
+		t.Fatalf("fresh subjects refused: %+v", d)
+	}
+	q.RecordTokens(10, alice, key)
+
+	d, err := q.AllowTokens(alice, key)
+	_, dayEnd := today()
+	if err != nil || d.Allowed || d.Reason != "daily token quota exceeded for api_key" {
+		t.Errorf("over the key quota: %+v, %v", d, err)
+	}
+	// the quota resets at the end of the UTC day
+	if time.Now().Add(d.RetryAfter).Sub(dayEnd).Abs() > time.Second {
+		t.Errorf("retry after %s, day ends at %s", d.RetryAfter, dayEnd)
+	}
+	if d, _ := q.AllowTokens(alice); !d.Allowed {
+		t.Errorf("alice refused under her quota: %+v", d)
+	}
+
+	usage, err := q.Usage(alice)
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	if usage.Tokens.Limit != 100 || usage.Tokens.Used != 10 || usage.Tokens.Remaining != 90 || !usage.Tokens.ResetAt.Equal(dayEnd) {
+		t.Errorf("token usage = %+v", usage.Tokens)
+	}
+}
+
+func TestToday(t *testing.T) {
+	start, end := today()
+	now := time.Now()
+	if now.Before(start) || !now.Before(end) || end.Sub(start) != 24*time.Hour {
+		t.Errorf("today = %s to %s, now %s", start, end, now)
+	}
+	if start.Location() != time.UTC || start.Hour() != 0 || start.Minute() != 0 {
+		t.Errorf("day starts at %s, want UTC midnight", start)
+	}
+}
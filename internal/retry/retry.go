@@ -0,0 +1,77 @@
+// Package retry decides whether and when failed calls to the model server
+// are tried again. The API server and the CLI share it so both back off
+// the same way.
+package retry
+
+import (
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Policy controls how failed model calls are retried.
+type Policy struct {
+	Retries   int           // retries after the first attempt
+	BaseDelay time.Duration // delay before the first retry, doubled each time
+	MaxDelay  time.Duration // cap on any single delay
+}
+
+// FromEnv reads AI_RETRIES (default 2), AI_RETRY_BASE_DELAY (default
+// 250ms) and AI_RETRY_MAX_DELAY (default 4s).
+func FromEnv() Policy {
+	policy := Policy{
+		Retries:   2,
+		BaseDelay: 250 * time.Millisecond,
+		MaxDelay:  4 * time.Second,
+	}
+	if v, err := strconv.Atoi(os.Getenv("AI_RETRIES")); err == nil && v >= 0 {
+		policy.Retries = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("AI_RETRY_BASE_DELAY")); err == nil && v > 0 {
+		policy.BaseDelay = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("AI_RETRY_MAX_DELAY")); err == nil && v > 0 {
+		policy.MaxDelay = v
+	}
+	return policy
+}
+
+// Backoff returns the delay before retry number attempt (starting at 0):
+// exponential with "equal jitter", so it lies between half and all of
+// BaseDelay*2^attempt, capped at MaxDelay. A longer Retry-After from the
+// server is honoured up to MaxDelay.
+func (p Policy) Backoff(attempt int, retryAfter time.Duration) time.Duration {
+	delay := p.BaseDelay
+	for i := 0; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay > 0 {
+		half := delay / 2
+		delay = half + time.Duration(rand.Int63n(int64(delay-half)+1))
+	}
+
+	if retryAfter > delay {
+		delay = min(retryAfter, p.MaxDelay)
+	}
+	return delay
+}
+
+// Status reports whether a call the model server answered with status may
+// succeed if tried again: server errors, rate limiting and timeouts.
+func Status(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests || status == http.StatusRequestTimeout
+}
+
+// RetryAfter parses a Retry-After header given in seconds, returning zero
+// when there is none.
+func RetryAfter(header http.Header) time.Duration {
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 0
+}
@@ -0,0 +1,63 @@
+package retry
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	p := Policy{Retries: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for attempt, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		for i := 0; i < 50; i++ {
+			d := p.Backoff(attempt, 0)
+			if d < max/2 || d > max {
+				t.Fatalf("attempt %d: delay %v outside [%v, %v]", attempt, d, max/2, max)
+			}
+		}
+	}
+
+	if d := p.Backoff(0, 700*time.Millisecond); d != 700*time.Millisecond {
+		t.Errorf("Retry-After not honoured: %v", d)
+	}
+	if d := p.Backoff(0, time.Minute); d != time.Second {
+		t.Errorf("Retry-After not capped: %v", d)
+	}
+
+	// delays too short to halve must not panic
+	for _, base := range []time.Duration{0, 1, 2, 3} {
+		tiny := Policy{BaseDelay: base, MaxDelay: time.Second}
+		if d := tiny.Backoff(0, 0); d < 0 || d > base {
+			t.Errorf("base %v: delay %v", base, d)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	for status, want := range map[int]bool{
+		http.StatusInternalServerError: true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusTooManyRequests:     true,
+		http.StatusRequestTimeout:      true,
+		http.StatusNotFound:            false,
+		http.StatusBadRequest:          false,
+	} {
+		if Status(status) != want {
+			t.Errorf("Status(%d) = %v", status, !want)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for value, want := range map[string]time.Duration{"": 0, "3": 3 * time.Second, "0": 0, "soon": 0} {
+		header := http.Header{}
+		if value != "" {
+			header.Set("Retry-After", value)
+		}
+		if got := RetryAfter(header); got != want {
+			t.Errorf("RetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
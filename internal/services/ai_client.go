@@ -1,82 +1,317 @@
 package services
 
 import (
+	"ai-chatbot-web/internal/logging"
+	"ai-chatbot-web/internal/metrics"
 	"ai-chatbot-web/internal/models"
+	"ai-chatbot-web/internal/retry"
+	"ai-chatbot-web/internal/tools"
+	"ai-chatbot-web/internal/tracing"
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 
 type AIClient struct {
 	provider string
-	baseURL  string
+	router   *BackendRouter
 	model    string
 	client	*http.Client
+	retry    retry.Policy
+	log      *slog.Logger
+
+	// fallbackTimeout bounds the wait for the first token from each model
+	// in a fallback chain except the last, so a slow model hands over to
+	// the next one in time.
+	fallbackTimeout time.Duration
+
+	embedModel string // see Embed
+
+	vision sync.Map // names of models that can see, see SupportsVision
 }
 
 type OllamaRequest struct {
 	Model   string `json:"model"`
 	Messages []OllamaMessage `json:"messages"`
+	Tools   []tools.Definition `json:"tools,omitempty"`
 	Stream bool `json:"stream"`
 }
 
 type OllamaMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	Images  []string `json:"images,omitempty"` // base64, for vision models
+	ToolCalls []tools.Call `json:"tool_calls,omitempty"`
+	ToolName  string       `json:"tool_name,omitempty"`
 }
 
 type OllamaResponse struct {
-	Message OllamaMessage `json:"message"`
+	Model           string        `json:"model"`
+	Message         OllamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error,omitempty"` // set when the model fails mid-reply
+}
+
+// ChatResult is a model response along with the accounting data recorded
+// on the assistant message.
+type ChatResult struct {
+	Content          string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Latency          time.Duration
+	TimeToFirstToken time.Duration
+	Backend          string // name of the backend that answered
+
+	// ToolCalls are the tools the model asked to call instead of, or
+	// before, answering.
+	ToolCalls []tools.Call
+}
+
+// ChatOptions are the per-request settings of SendMessage.
+type ChatOptions struct {
+	// Models lists the models to try in order. When one fails, or sends
+	// no token within AI_FALLBACK_TIMEOUT (default 30s), the next is tried.
+	// Empty means the configured model.
+	Models []string
+
+	// Tools are offered to the model. Calls it makes are returned in
+	// ChatResult.ToolCalls; see CompleteWithTools.
+	Tools []tools.Definition
+
+	// OnToken, if set, is called with each piece of the reply as it
+	// arrives.
+	OnToken func(content string)
+
+	// OnReset, if set, is called when the content passed to OnToken so
+	// far is dropped: a model failed part way and the next one of the
+	// chain starts, or, in CompleteWithTools, the content came with tool
+	// calls and the model is asked again. Without it a model that fails
+	// part way ends the chain.
+	OnReset func()
+}
+
+// ChatProvider generates replies to a conversation. AIClient is the real
+// implementation; handlers depend on the interface so tests can fake it.
+type ChatProvider interface {
+	SendMessage(ctx context.Context, messages []models.Message, options ChatOptions) (*ChatResult, error)
+	EstimateTokens(text string) int
+	GetModel() string
 }
 
 // NewAIClient initializes and returns a new AIClient based on environment variables.
-func NewAIClient() *AIClient {
+// The Ollama backends are configured as described on NewBackendRouter.
+func NewAIClient() (*AIClient, error) {
 	provider := os.Getenv("AI_PROVIDER")
 	if provider == "" {
 		provider = "ollama"
 	}
 
-	baseURL := os.Getenv("OLLAMA_HOST")
-	if baseURL == "" {
-		baseURL = "http://localhost:11434"
+	router, err := NewBackendRouter()
+	if err != nil {
+		return nil, err
 	}
 
-    // Ensure baseURL has http:// prefix
-    if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
-        baseURL = "http://" + baseURL
-    }
-
 	model := os.Getenv("OLLAMA_MODEL")
 	if model == "" {
 		model = "llama3.1:8b"
 	}
 
+	embedModel := os.Getenv("OLLAMA_EMBED_MODEL")
+	if embedModel == "" {
+		embedModel = "nomic-embed-text"
+	}
+
+	fallbackTimeout := 30 * time.Second
+	if v, err := time.ParseDuration(os.Getenv("AI_FALLBACK_TIMEOUT")); err == nil && v > 0 {
+		fallbackTimeout = v
+	}
+
+	// Replies stream for as long as the model writes, so only the wait
+	// for the response to start is bounded.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 60 * time.Second
+
 	return &AIClient{
 		provider: provider,
-		baseURL:  baseURL,
+		router:   router,
 		model:    model,
 		client:   &http.Client{
-			Timeout: 60 * time.Second,
+			Transport: transport,
 		},
-	}
+		retry:    retry.FromEnv(),
+		log:      logging.For("ai"),
+		fallbackTimeout: fallbackTimeout,
+		embedModel: embedModel,
+	}, nil
+}
+
+// StartHealthChecks checks the backends periodically until ctx is done.
+func (ai *AIClient) StartHealthChecks(ctx context.Context) {
+	ai.router.Start(ctx)
+}
+
+// Backends reports the state of every model backend.
+func (ai *AIClient) Backends() []BackendStatus {
+	return ai.router.Backends()
 }
 
 // SendMessage sends a message to the configured AI provider and returns the response.
-func (ai *AIClient) SendMessage(messages []models.Message) (string, error) {
+// The request ID on ctx, if any, is logged and forwarded to the provider.
+// ChatResult.Model is the model that answered.
+func (ai *AIClient) SendMessage(ctx context.Context, messages []models.Message, options ChatOptions) (*ChatResult, error) {
+	chain := options.Models
+	if len(chain) == 0 {
+		chain = []string{ai.model}
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "ai.chat",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("gen_ai.system", ai.provider),
+			attribute.String("gen_ai.request.model", chain[0]),
+			attribute.StringSlice("gen_ai.request.fallback_models", chain[1:]),
+			attribute.Int("gen_ai.request.messages", len(messages)),
+			attribute.Int("gen_ai.request.tools", len(options.Tools)),
+			attribute.Bool("gen_ai.streaming", true),
+		),
+	)
+	defer span.End()
+
+	var result *ChatResult
+	var err error
+	for i, model := range chain {
+		last := i == len(chain)-1
+		attempt, streamed := options, false
+		if options.OnToken != nil {
+			attempt.OnToken = func(content string) {
+				streamed = true
+				options.OnToken(content)
+			}
+		}
+		result, err = ai.sendWithTimeout(ctx, model, messages, attempt, last)
+		if err == nil || last || ctx.Err() != nil {
+			break
+		}
+		if streamed {
+			if options.OnReset == nil {
+				break
+			}
+			options.OnReset()
+		}
+
+		metrics.ModelFallback(ai.provider, model)
+		span.AddEvent("fallback", trace.WithAttributes(
+			attribute.String("from", model),
+			attribute.String("to", chain[i+1]),
+			attribute.String("error", err.Error()),
+		))
+		ai.log.WarnContext(ctx, "model failed, falling back",
+			"provider", ai.provider, "model", model, "next", chain[i+1], "error", err)
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(
+		attribute.String("gen_ai.response.model", result.Model),
+		attribute.String("gen_ai.backend", result.Backend),
+		attribute.Int("gen_ai.usage.input_tokens", result.PromptTokens),
+		attribute.Int("gen_ai.usage.output_tokens", result.CompletionTokens),
+		attribute.Int64("gen_ai.latency_ms", result.Latency.Milliseconds()),
+		attribute.Int64("gen_ai.time_to_first_token_ms", result.TimeToFirstToken.Milliseconds()),
+		attribute.Int("gen_ai.response.tool_calls", len(result.ToolCalls)),
+	)
+
+	ai.log.InfoContext(ctx, "model response",
+		"provider", ai.provider,
+		"model", result.Model,
+		"backend", result.Backend,
+		"prompt_tokens", result.PromptTokens,
+		"completion_tokens", result.CompletionTokens,
+		"latency_ms", result.Latency.Milliseconds(),
+		"time_to_first_token_ms", result.TimeToFirstToken.Milliseconds(),
+		"content", logging.Content(result.Content),
+	)
+
+	return result, nil
+}
+
+// sendWithTimeout asks one model of a chain. Unless it is the last model
+// the call is cut off if no token arrives within ai.fallbackTimeout, which
+// is reported as an UpstreamTimeout. Once the reply has started it is left
+// to finish.
+func (ai *AIClient) sendWithTimeout(ctx context.Context, model string, messages []models.Message, options ChatOptions, last bool) (*ChatResult, error) {
+	attemptCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if !last {
+		timer := time.AfterFunc(ai.fallbackTimeout, cancel)
+		defer timer.Stop()
+		onToken := options.OnToken
+		options.OnToken = func(content string) {
+			timer.Stop()
+			if onToken != nil {
+				onToken(content)
+			}
+		}
+	}
+
+	start := time.Now()
+	ai.log.DebugContext(ctx, "model request", "provider", ai.provider, "model", model, "messages", len(messages))
+
+	var result *ChatResult
+	var err error
 	switch ai.provider {
 	case "ollama":
-		return ai.sendOllamaMessage(messages)
+		result, err = ai.sendOllamaMessage(attemptCtx, model, messages, options)
 	default:
-		return "", fmt.Errorf("unsupported AI provider: %s", ai.provider)
+		return nil, fmt.Errorf("unsupported AI provider: %s", ai.provider)
+	}
+
+	if err != nil && attemptCtx.Err() != nil && ctx.Err() == nil {
+		err = &UpstreamError{
+			Kind: UpstreamTimeout,
+			Err:  fmt.Errorf("model %s did not start answering within %s", model, ai.fallbackTimeout),
+		}
 	}
+
+	completionTokens := 0
+	if result != nil {
+		completionTokens = result.CompletionTokens
+	}
+	metrics.ObserveModelCall(ai.provider, model, time.Since(start), completionTokens, err)
+
+	if err != nil {
+		ai.log.WarnContext(ctx, "model request failed", "provider", ai.provider, "model", model,
+			"duration_ms", time.Since(start).Milliseconds(), "error", err)
+	}
+	return result, err
 }
 
-func (ai *AIClient) sendOllamaMessage(messages []models.Message) (string, error) {
+// sendOllamaMessage streams the response from Ollama so the time to first
+// token can be measured, and returns it once complete.
+func (ai *AIClient) sendOllamaMessage(ctx context.Context, model string, messages []models.Message, options ChatOptions) (*ChatResult, error) {
 
 	// convert internal message to ollam format
 	ollamaMessages := make([]OllamaMessage, len(messages))
@@ -84,39 +319,194 @@ func (ai *AIClient) sendOllamaMessage(messages []models.Message) (string, error)
 		ollamaMessages[i] = OllamaMessage{
 			Role:    msg.Role,
 			Content: msg.Content,
+			ToolCalls: msg.ToolCalls,
+			ToolName:  msg.ToolName,
+		}
+		for _, data := range msg.ImageData {
+			ollamaMessages[i].Images = append(ollamaMessages[i].Images, base64.StdEncoding.EncodeToString(data))
 		}
 	}
 
 	request := OllamaRequest{
-		Model:    ai.model,
+		Model:    model,
 		Messages: ollamaMessages,
-		Stream:   false,
+		Tools:    options.Tools,
+		Stream:   true,
 	}
 
 	jsonData, err := json.Marshal(request)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %v", err)
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
 	}
 
-	resp, err := ai.client.Post(ai.baseURL+"/api/chat",
-		"application/json",
-		bytes.NewBuffer(jsonData),
-		)
+	start := time.Now()
+	resp, backend, err := ai.postWithRetry(ctx, model, "/api/chat", jsonData)
 	if err != nil {
-		return "", fmt.Errorf("API request failed: %v", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
+	defer backend.release()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API request failed with status: %s", resp.Status)
+	defer metrics.StreamStarted()()
+
+	result, err := ai.readOllamaStream(ctx, model, resp, start, options.OnToken)
+	backend.record(err)
+	if err != nil {
+		return nil, err
+	}
+	result.Backend = backend.Name
+	return result, nil
+}
+
+// readOllamaStream assembles a streamed chat response, passing each piece
+// to onToken, if set, as it arrives. A stream that reports an error or
+// ends before its done chunk is an UpstreamFailed error, since the reply
+// is incomplete.
+func (ai *AIClient) readOllamaStream(ctx context.Context, model string, resp *http.Response, start time.Time, onToken func(string)) (*ChatResult, error) {
+	result := &ChatResult{Model: model}
+	var content strings.Builder
+	decoder := json.NewDecoder(resp.Body)
+
+	for {
+		var chunk OllamaResponse
+		if err := decoder.Decode(&chunk); err != nil {
+			if err == io.EOF && ctx.Err() == nil {
+				return nil, &UpstreamError{Kind: UpstreamFailed, Err: fmt.Errorf("model server ended the reply before it was done")}
+			}
+			return nil, streamError(ctx, err)
+		}
+		if chunk.Error != "" {
+			return nil, &UpstreamError{Kind: UpstreamFailed, Err: fmt.Errorf("model failed mid-reply: %s", chunk.Error)}
+		}
+
+		if chunk.Message.Content != "" && result.TimeToFirstToken == 0 {
+			result.TimeToFirstToken = time.Since(start)
+		}
+		content.WriteString(chunk.Message.Content)
+		if onToken != nil && chunk.Message.Content != "" {
+			onToken(chunk.Message.Content)
+		}
+		result.ToolCalls = append(result.ToolCalls, chunk.Message.ToolCalls...)
+
+		if chunk.Done {
+			if chunk.Model != "" {
+				result.Model = chunk.Model
+			}
+			result.PromptTokens = chunk.PromptEvalCount
+			result.CompletionTokens = chunk.EvalCount
+			break
+		}
+	}
+
+	result.Content = content.String()
+	result.Latency = time.Since(start)
+	if result.CompletionTokens == 0 {
+		result.CompletionTokens = ai.EstimateTokens(result.Content)
+	}
+
+	return result, nil
+}
+
+// postWithRetry sends a request to a model backend chosen by the router.
+// Failures before the response starts fail over to the next backend
+// straight away; once every backend has failed the request is retried
+// with backoff according to ai.retry. Errors caused by the backends are
+// returned as *UpstreamError.
+//
+// The returned backend has the request counted as in flight; call its
+// release method once the response has been read.
+func (ai *AIClient) postWithRetry(ctx context.Context, model, path string, body []byte) (*http.Response, *Backend, error) {
+	tried := map[*Backend]bool{}
+	retries := 0
+	var lastErr error
+
+	for {
+		backend, err := ai.router.Pick(model, tried)
+		if err != nil {
+			if lastErr != nil {
+				return nil, nil, lastErr
+			}
+			return nil, nil, err
+		}
+
+		backend.acquire()
+		resp, err := ai.post(ctx, backend, path, body)
+		if err == nil {
+			return resp, backend, nil
+		}
+		backend.release()
+		backend.record(err)
+		lastErr = err
+
+		upstream, ok := asUpstream(err)
+		if !ok || !upstream.retryable() {
+			return nil, nil, err
+		}
+		tried[backend] = true
+
+		if ai.router.hasUntried(model, tried) {
+			trace.SpanFromContext(ctx).AddEvent("failover", trace.WithAttributes(
+				attribute.String("backend", backend.Name),
+				attribute.String("error", err.Error()),
+			))
+			ai.log.WarnContext(ctx, "backend failed, failing over",
+				"backend", backend.Name, "model", model, "error", err)
+			continue
+		}
+
+		if retries >= ai.retry.Retries {
+			return nil, nil, err
+		}
+		delay := ai.retry.Backoff(retries, upstream.RetryAfter)
+		retries++
+		clear(tried)
+
+		metrics.ModelRetry(ai.provider, model)
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+			attribute.Int("attempt", retries),
+			attribute.Int64("delay_ms", delay.Milliseconds()),
+			attribute.String("error", err.Error()),
+		))
+		ai.log.WarnContext(ctx, "retrying model request",
+			"provider", ai.provider, "model", model,
+			"attempt", retries, "delay_ms", delay.Milliseconds(), "error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+// post makes a single attempt at a request to a backend.
+func (ai *AIClient) post(ctx context.Context, backend *Backend, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, backend.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set("X-Request-ID", id)
 	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
-	var response OllamaResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("failed to decode response: %v", err)
+	resp, err := ai.client.Do(req)
+	if err != nil {
+		return nil, transportError(ctx, err)
 	}
 
-	return response.Message.Content, nil
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&failure)
+		return nil, statusError(resp, failure.Error)
+	}
+	return resp, nil
 }
 
 func (ai *AIClient) EstimateTokens(text string) int {
@@ -0,0 +1,291 @@
+package services
+
+import (
+	"ai-chatbot-web/internal/fakeollama"
+	"ai-chatbot-web/internal/models"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSendMessageRecordsSpan(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(previous)
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		enc := json.NewEncoder(w)
+		enc.Encode(OllamaResponse{Model: "test-model", Message: OllamaMessage{Role: "assistant", Content: "hi"}})
+		enc.Encode(OllamaResponse{Model: "test-model", Done: true, PromptEvalCount: 12, EvalCount: 3})
+	}))
+	defer server.Close()
+
+	t.Setenv("OLLAMA_HOST", server.URL)
+	t.Setenv("OLLAMA_MODEL", "test-model")
+	client, err := NewAIClient()
+	if err != nil {
+		t.Fatalf("NewAIClient: %v", err)
+	}
+
+	result, err := client.SendMessage(context.Background(), []models.Message{{Role: "user", Content: "hello"}}, ChatOptions{})
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if result.Content != "hi" {
+		t.Errorf("content = %q", result.Content)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "ai.chat" {
+		t.Errorf("span name = %q", span.Name)
+	}
+
+	want := map[string]int64{
+		"gen_ai.usage.input_tokens":  12,
+		"gen_ai.usage.output_tokens": 3,
+	}
+	for _, kv := range span.Attributes {
+		if v, ok := want[string(kv.Key)]; ok {
+			if kv.Value.AsInt64() != v {
+				t.Errorf("%s = %d, want %d", kv.Key, kv.Value.AsInt64(), v)
+			}
+			delete(want, string(kv.Key))
+		}
+	}
+	if len(want) > 0 {
+		t.Errorf("missing attributes: %v", want)
+	}
+
+	if traceparent == "" {
+		t.Error("trace context was not propagated to the model server")
+	}
+}
+
+func TestSendMessageFallsBackThroughChain(t *testing.T) {
+	fakes := newPool(t, "a")
+	fakes["a"].SetModels("small")
+	client := newPoolClient(t)
+
+	result, err := send(t, client, "big", "small")
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if result.Model != "small" {
+		t.Errorf("answered by %q, want small", result.Model)
+	}
+	if n := len(fakes["a"].Requests()); n != 2 {
+		t.Errorf("model server saw %d requests, want 2", n)
+	}
+
+	// the last model's error is returned when the whole chain fails
+	_, err = send(t, client, "big", "huge")
+	if upstream, ok := asUpstream(err); !ok || upstream.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
+
+func TestSendMessageFallsBackOnTimeout(t *testing.T) {
+	t.Setenv("AI_FALLBACK_TIMEOUT", "50ms")
+	fakes := newPool(t, "a")
+	fakes["a"].SetModels("big", "small")
+	fakes["a"].SetLatency(150 * time.Millisecond)
+	client := newPoolClient(t)
+
+	result, err := send(t, client, "big", "small")
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if result.Model != "small" {
+		t.Errorf("answered by %q, want small", result.Model)
+	}
+	// a slow model is not the backend's fault
+	if state := client.Backends()[0].Circuit; state != CircuitClosed {
+		t.Errorf("circuit %s after a fallback timeout", state)
+	}
+}
+
+func TestSendMessageLetsStartedRepliesFinish(t *testing.T) {
+	t.Setenv("AI_FALLBACK_TIMEOUT", "50ms")
+	fakes := newPool(t, "a")
+	fakes["a"].SetModels("big", "small")
+	fakes["a"].SetTokenDelay(20 * time.Millisecond)
+	fakes["a"].Respond("one two three four five six seven eight")
+	client := newPoolClient(t)
+
+	result, err := send(t, client, "big", "small")
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if result.Model != "big" || result.Content != "one two three four five six seven eight" {
+		t.Errorf("answered by %q with %q, want the whole reply from big", result.Model, result.Content)
+	}
+}
+
+func TestSendMessageResetsAfterAFailedStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OllamaRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		enc := json.NewEncoder(w)
+		enc.Encode(OllamaResponse{Model: req.Model, Message: OllamaMessage{Role: "assistant", Content: req.Model + " says"}})
+		if req.Model == "big" {
+			w.Write([]byte("{not json\n")) // cut off mid-reply
+			return
+		}
+		enc.Encode(OllamaResponse{Model: req.Model, Done: true})
+	}))
+	defer server.Close()
+	t.Setenv("OLLAMA_HOST", server.URL)
+	t.Setenv("AI_RETRY_BASE_DELAY", "1ms")
+	client, err := NewAIClient()
+	if err != nil {
+		t.Fatalf("NewAIClient: %v", err)
+	}
+	messages := []models.Message{{Role: "user", Content: "hello"}}
+
+	var shown strings.Builder
+	options := ChatOptions{
+		Models:  []string{"big", "small"},
+		OnToken: func(content string) { shown.WriteString(content) },
+		OnReset: shown.Reset,
+	}
+	result, err := client.SendMessage(context.Background(), messages, options)
+	if err != nil || result.Model != "small" || shown.String() != "small says" {
+		t.Errorf("SendMessage = %+v, %v; shown %q", result, err, shown.String())
+	}
+
+	// without a way to take back what was streamed, there is no fallback
+	shown.Reset()
+	options.OnReset = nil
+	if _, err := client.SendMessage(context.Background(), messages, options); err == nil || shown.String() != "big says" {
+		t.Errorf("SendMessage without OnReset: err %v, shown %q", err, shown.String())
+	}
+}
+
+func TestSendMessageRejectsBrokenStreams(t *testing.T) {
+	replies := map[string]fakeollama.Reply{
+		"error": {Content: "half a reply", Error: "model runner has unexpectedly stopped"},
+		"cut":   {Content: "half a reply", Cut: true},
+	}
+	for name, reply := range replies {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("AI_BREAKER_THRESHOLD", "1")
+			fakes := newPool(t, "a")
+			fakes["a"].SetModels("big", "small")
+			client := newPoolClient(t)
+
+			fakes["a"].Script(reply)
+			_, err := send(t, client, "big")
+			upstream, ok := asUpstream(err)
+			if !ok || upstream.HTTPStatus() != http.StatusBadGateway {
+				t.Fatalf("SendMessage = %v, want a 502 upstream error", err)
+			}
+			if state := client.Backends()[0].Circuit; state != CircuitOpen {
+				t.Errorf("circuit %s after a broken stream, want open", state)
+			}
+		})
+	}
+
+	// a broken stream hands over to the next model of the chain
+	fakes := newPool(t, "a")
+	fakes["a"].SetModels("big", "small")
+	client := newPoolClient(t)
+	fakes["a"].Script(replies["cut"])
+	result, err := send(t, client, "big", "small")
+	if err != nil || result.Model != "small" {
+		t.Errorf("SendMessage = %+v, %v; want small to answer", result, err)
+	}
+}
+
+func TestSupportsVisionAfterHealthChecks(t *testing.T) {
+	fakes := newPool(t, "a")
+	fakes["a"].SetModels("llama")
+	client := newPoolClient(t)
+	ctx := context.Background()
+	client.router.Refresh(ctx)
+
+	// no backend has the model, so it is blind rather than unavailable
+	if got, err := client.SupportsVision(ctx, "llava"); err != nil || got {
+		t.Errorf("SupportsVision of a missing model = %v, %v; want false", got, err)
+	}
+	if got, err := client.SupportsVision(ctx, "llama"); err != nil || got {
+		t.Errorf("SupportsVision(llama) = %v, %v; want false", got, err)
+	}
+
+	// once the model is pulled the earlier answer does not stick
+	fakes["a"].SetModels("llama", "llava")
+	fakes["a"].SetVision("llava")
+	client.router.Refresh(ctx)
+	if got, err := client.SupportsVision(ctx, "llava"); err != nil || !got {
+		t.Errorf("SupportsVision after a pull = %v, %v; want true", got, err)
+	}
+}
+
+func TestSupportsVisionClosesTheCircuit(t *testing.T) {
+	t.Setenv("AI_RETRIES", "0")
+	t.Setenv("AI_BREAKER_THRESHOLD", "1")
+	t.Setenv("AI_BREAKER_COOLDOWN", "20ms")
+	fakes := newPool(t, "a")
+	fakes["a"].FailNext(1, http.StatusServiceUnavailable)
+	client := newPoolClient(t)
+	ctx := context.Background()
+
+	if _, err := send(t, client, fakeollama.DefaultModel); err == nil {
+		t.Fatal("SendMessage succeeded despite the injected failure")
+	}
+	if state := client.Backends()[0].Circuit; state != CircuitOpen {
+		t.Fatalf("circuit %s after a failure, want open", state)
+	}
+
+	// the vision check is the probe once the cooldown is over
+	time.Sleep(30 * time.Millisecond)
+	if _, err := client.SupportsVision(ctx, fakeollama.DefaultModel); err != nil {
+		t.Fatalf("SupportsVision: %v", err)
+	}
+	if _, err := send(t, client, fakeollama.DefaultModel); err != nil {
+		t.Errorf("SendMessage after the probe: %v", err)
+	}
+	if state := client.Backends()[0].Circuit; state != CircuitClosed {
+		t.Errorf("circuit %s after the probe, want closed", state)
+	}
+}
+
+func TestSupportsVisionAndSendsImages(t *testing.T) {
+	fakes := newPool(t, "a")
+	fakes["a"].SetModels("llava", "llama")
+	fakes["a"].SetVision("llava")
+	client := newPoolClient(t)
+	ctx := context.Background()
+
+	for model, want := range map[string]bool{"llava": true, "llama": false, "missing": false} {
+		if got, err := client.SupportsVision(ctx, model); err != nil || got != want {
+			t.Errorf("SupportsVision(%s) = %v, %v; want %v", model, got, err, want)
+		}
+	}
+
+	messages := []models.Message{{Role: "user", Content: "what is this?", ImageData: [][]byte{[]byte("png")}}}
+	if _, err := client.SendMessage(ctx, messages, ChatOptions{Models: []string{"llava"}}); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	req, _ := fakes["a"].LastRequest()
+	if images := req.Messages[0].Images; len(images) != 1 || images[0] != "cG5n" {
+		t.Errorf("images sent = %v", images)
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"ai-chatbot-web/internal/database"
+	"ai-chatbot-web/internal/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix marks bearer tokens that are API keys rather than sessions.
+const APIKeyPrefix = "gbk_"
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid, expired or revoked API key")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+type APIKeyService struct {
+	db *database.Database
+}
+
+func NewAPIKeyService(db *database.Database) *APIKeyService {
+	return &APIKeyService{
+		db: db,
+	}
+}
+
+// IsAPIKey reports whether a bearer token looks like an API key.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// Create issues a new API key for userID. The raw key is returned once and
+// cannot be recovered later. Scopes default to read and write.
+func (s *APIKeyService) Create(userID, name string, scopes []string, expiresAt *time.Time) (string, *models.APIKey, error) {
+	if len(scopes) == 0 {
+		scopes = []string{ScopeRead, ScopeWrite}
+	}
+	for _, scope := range scopes {
+		if scope != ScopeRead && scope != ScopeWrite {
+			return "", nil, &ValidationError{Field: "scopes", Message: "unknown scope: " + scope}
+		}
+	}
+	if expiresAt != nil && expiresAt.Before(time.Now()) {
+		return "", nil, &ValidationError{Field: "expires_at", Message: "expires_at must be in the future"}
+	}
+
+	token, err := GenerateToken()
+	if err != nil {
+		return "", nil, err
+	}
+	raw := APIKeyPrefix + token
+
+	key := models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    raw[:len(APIKeyPrefix)+8],
+		KeyHash:   HashToken(raw),
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.db.DB.Create(&key).Error; err != nil {
+		return "", nil, fmt.Errorf("failed to create API key: %v", err)
+	}
+
+	return raw, &key, nil
+}
+
+// List returns every key belonging to userID, newest first.
+func (s *APIKeyService) List(userID string) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := s.db.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %v", err)
+	}
+	return keys, nil
+}
+
+// Revoke marks a key as revoked. Revoked keys are kept so they still show
+// up in listings.
+func (s *APIKeyService) Revoke(userID, keyID string) error {
+	result := s.db.DB.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke API key: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate resolves a raw API key to its key record and owner, and
+// records the time it was used.
+func (s *APIKeyService) Authenticate(raw string) (*models.APIKey, *models.User, error) {
+	var key models.APIKey
+	if err := s.db.DB.First(&key, "key_hash = ?", HashToken(raw)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, fmt.Errorf("failed to load API key: %v", err)
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var user models.User
+	if err := s.db.DB.First(&user, "id = ?", key.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, fmt.Errorf("failed to load user: %v", err)
+	}
+
+	s.db.DB.Model(&key).Update("last_used_at", now)
+	key.LastUsedAt = &now
+
+	return &key, &user, nil
+}
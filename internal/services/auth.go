@@ -0,0 +1,173 @@
+package services
+
+import (
+	"ai-chatbot-web/internal/database"
+	"ai-chatbot-web/internal/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const minPasswordLength = 8
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrUsernameTaken      = errors.New("username already taken")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+)
+
+// ValidationError rejects a bad value in a request, such as a short
+// password. Handlers answer it with a 400 naming Field.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+type AuthService struct {
+	db         *database.Database
+	sessionTTL time.Duration
+}
+
+// NewAuthService creates an AuthService. Session lifetime is read from
+// SESSION_TTL (a Go duration such as "24h") and defaults to 7 days.
+func NewAuthService(db *database.Database) *AuthService {
+	ttl := 7 * 24 * time.Hour
+	if v := os.Getenv("SESSION_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			ttl = d
+		}
+	}
+
+	return &AuthService{
+		db:         db,
+		sessionTTL: ttl,
+	}
+}
+
+// Register creates a new user with a bcrypt-hashed password. A username
+// already in use is ErrUsernameTaken.
+func (a *AuthService) Register(username, password string) (*models.User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, &ValidationError{Field: "username", Message: "username is required"}
+	}
+	if len(password) < minPasswordLength {
+		return nil, &ValidationError{Field: "password", Message: fmt.Sprintf("password must be at least %d characters", minPasswordLength)}
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %v", err)
+	}
+
+	user := models.User{
+		Username:     username,
+		PasswordHash: string(hash),
+	}
+	// the unique index decides, so concurrent registrations cannot both win
+	if err := a.db.DB.Create(&user).Error; err != nil {
+		if a.db.IsUniqueViolation(err) {
+			return nil, ErrUsernameTaken
+		}
+		return nil, fmt.Errorf("failed to create user: %v", err)
+	}
+
+	return &user, nil
+}
+
+// Login verifies the credentials and issues a new session token. The raw
+// token is only returned here; the database keeps its SHA-256 hash.
+func (a *AuthService) Login(username, password string) (string, *models.Session, error) {
+	var user models.User
+	if err := a.db.DB.First(&user, "username = ?", strings.TrimSpace(username)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil, ErrInvalidCredentials
+		}
+		return "", nil, fmt.Errorf("failed to load user: %v", err)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return "", nil, ErrInvalidCredentials
+	}
+
+	token, err := GenerateToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	session := models.Session{
+		UserID:    user.ID,
+		TokenHash: HashToken(token),
+		ExpiresAt: time.Now().Add(a.sessionTTL),
+	}
+	if err := a.db.DB.Create(&session).Error; err != nil {
+		return "", nil, fmt.Errorf("failed to create session: %v", err)
+	}
+
+	return token, &session, nil
+}
+
+// Authenticate resolves a session token to its user.
+func (a *AuthService) Authenticate(token string) (*models.User, error) {
+	if token == "" {
+		return nil, ErrInvalidToken
+	}
+
+	var session models.Session
+	if err := a.db.DB.First(&session, "token_hash = ?", HashToken(token)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, fmt.Errorf("failed to load session: %v", err)
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		a.db.DB.Delete(&session)
+		return nil, ErrInvalidToken
+	}
+
+	var user models.User
+	if err := a.db.DB.First(&user, "id = ?", session.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, fmt.Errorf("failed to load user: %v", err)
+	}
+
+	return &user, nil
+}
+
+// Logout revokes the session belonging to token.
+func (a *AuthService) Logout(token string) error {
+	if err := a.db.DB.Where("token_hash = ?", HashToken(token)).Delete(&models.Session{}).Error; err != nil {
+		return fmt.Errorf("failed to delete session: %v", err)
+	}
+	return nil
+}
+
+// GenerateToken returns a random 256-bit hex-encoded token.
+func GenerateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// HashToken returns the hex-encoded SHA-256 of a bearer token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"ai-chatbot-web/internal/database/databasetest"
+	"ai-chatbot-web/internal/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAuthRegister(t *testing.T) {
+	auth := NewAuthService(databasetest.Open(t))
+
+	user, err := auth.Register("  alice ", "correct horse")
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if user.ID == "" || user.Username != "alice" || user.PasswordHash == "correct horse" {
+		t.Errorf("user = %+v", user)
+	}
+
+	// the unique index catches the duplicate
+	if _, err := auth.Register("alice", "another password"); !errors.Is(err, ErrUsernameTaken) {
+		t.Errorf("duplicate Register: err = %v, want ErrUsernameTaken", err)
+	}
+
+	var invalid *ValidationError
+	if _, err := auth.Register(" ", "correct horse"); !errors.As(err, &invalid) || invalid.Field != "username" {
+		t.Errorf("blank username: err = %v", err)
+	}
+	if _, err := auth.Register("bob", "short"); !errors.As(err, &invalid) || invalid.Field != "password" {
+		t.Errorf("short password: err = %v", err)
+	}
+}
+
+func TestAuthSessions(t *testing.T) {
+	db := databasetest.Open(t)
+	auth := NewAuthService(db)
+	alice, err := auth.Register("alice", "correct horse")
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	if _, _, err := auth.Login("alice", "wrong horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password: err = %v", err)
+	}
+	if _, _, err := auth.Login("nobody", "correct horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("unknown user: err = %v", err)
+	}
+
+	token, session, err := auth.Login("alice", "correct horse")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if session.TokenHash == token || session.TokenHash != HashToken(token) {
+		t.Errorf("session stores %q for token %q", session.TokenHash, token)
+	}
+	if user, err := auth.Authenticate(token); err != nil || user.ID != alice.ID {
+		t.Errorf("Authenticate = %+v, %v", user, err)
+	}
+	if _, err := auth.Authenticate(""); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("empty token: err = %v", err)
+	}
+
+	// a second session outlives the logout of the first
+	other, _, err := auth.Login("alice", "correct horse")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if err := auth.Logout(token); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if _, err := auth.Authenticate(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("after logout: err = %v", err)
+	}
+	if _, err := auth.Authenticate(other); err != nil {
+		t.Errorf("other session after logout: err = %v", err)
+	}
+
+	// expired sessions are refused and cleaned up
+	db.DB.Model(&models.Session{}).Where("token_hash = ?", HashToken(other)).Update("expires_at", time.Now().Add(-time.Minute))
+	if _, err := auth.Authenticate(other); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expired session: err = %v", err)
+	}
+	var left int64
+	db.DB.Model(&models.Session{}).Count(&left)
+	if left != 0 {
+		t.Errorf("%d sessions left", left)
+	}
+}
+
+func TestAuthSessionTTL(t *testing.T) {
+	t.Setenv("SESSION_TTL", "1h")
+	auth := NewAuthService(databasetest.Open(t))
+	if _, err := auth.Register("alice", "correct horse"); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	_, session, err := auth.Login("alice", "correct horse")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if ttl := time.Until(session.ExpiresAt); ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("session expires in %s, want 1h", ttl)
+	}
+}
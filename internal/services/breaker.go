@@ -0,0 +1,130 @@
+package services
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// CircuitBreaker stops calls to a backend that keeps failing. After
+// Threshold consecutive failures it opens and rejects calls for Cooldown;
+// then a single probe call is let through, which closes the circuit if it
+// succeeds and reopens it if it fails.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	// OnStateChange, if set, is called with the new state on every
+	// transition.
+	OnStateChange func(state string)
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker reads AI_BREAKER_THRESHOLD (default 5, 0 disables the
+// breaker) and AI_BREAKER_COOLDOWN (default 30s).
+func NewCircuitBreaker() *CircuitBreaker {
+	b := &CircuitBreaker{
+		Threshold: 5,
+		Cooldown:  30 * time.Second,
+		state:     CircuitClosed,
+	}
+	if v, err := strconv.Atoi(os.Getenv("AI_BREAKER_THRESHOLD")); err == nil && v >= 0 {
+		b.Threshold = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("AI_BREAKER_COOLDOWN")); err == nil && v > 0 {
+		b.Cooldown = v
+	}
+	return b
+}
+
+// Allow reports whether a call may proceed. When it may not, it returns
+// how long until the breaker lets a probe through.
+func (b *CircuitBreaker) Allow() (bool, time.Duration) {
+	if b.Threshold <= 0 {
+		return true, 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		wait := b.Cooldown - time.Since(b.openedAt)
+		if wait > 0 {
+			return false, wait
+		}
+		b.setState(CircuitHalfOpen)
+		b.probing = true
+		return true, 0
+	case CircuitHalfOpen:
+		if b.probing {
+			return false, b.Cooldown
+		}
+		b.probing = true
+		return true, 0
+	default:
+		return true, 0
+	}
+}
+
+// Record reports the outcome of a call that Allow let through.
+func (b *CircuitBreaker) Record(success bool) {
+	if b.Threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if success {
+		b.failures = 0
+		b.setState(CircuitClosed)
+		return
+	}
+
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.Threshold {
+		b.openedAt = time.Now()
+		b.setState(CircuitOpen)
+	}
+}
+
+// Release gives up a call that Allow let through without recording an
+// outcome, for calls cancelled by the caller.
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// State returns the current state.
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// setState must be called with b.mu held.
+func (b *CircuitBreaker) setState(state string) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	if b.OnStateChange != nil {
+		b.OnStateChange(state)
+	}
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := &CircuitBreaker{Threshold: 2, Cooldown: 20 * time.Millisecond, state: CircuitClosed}
+
+	b.Allow()
+	b.Record(false)
+	if b.State() != CircuitClosed {
+		t.Fatalf("opened after one failure")
+	}
+	b.Allow()
+	b.Record(false)
+	if ok, wait := b.Allow(); ok || wait <= 0 {
+		t.Fatalf("open circuit allowed a call (wait %v)", wait)
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	if ok, _ := b.Allow(); !ok || b.State() != CircuitHalfOpen {
+		t.Fatalf("expected a probe after the cooldown, state %s", b.State())
+	}
+	if ok, _ := b.Allow(); ok {
+		t.Fatal("half open circuit allowed a second concurrent probe")
+	}
+
+	b.Record(false)
+	if b.State() != CircuitOpen {
+		t.Fatalf("failed probe should reopen, state %s", b.State())
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	b.Allow()
+	b.Record(true)
+	if ok, _ := b.Allow(); !ok || b.State() != CircuitClosed {
+		t.Fatalf("successful probe should close, state %s", b.State())
+	}
+}
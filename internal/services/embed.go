@@ -0,0 +1,98 @@
+package services
+
+import (
+	"ai-chatbot-web/internal/metrics"
+	"ai-chatbot-web/internal/tracing"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// embedBatch is the most texts sent in one /api/embed request.
+const embedBatch = 32
+
+type ollamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type ollamaEmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// EmbeddingModel is the model used by Embed, set with OLLAMA_EMBED_MODEL
+// (default nomic-embed-text).
+func (ai *AIClient) EmbeddingModel() string {
+	return ai.embedModel
+}
+
+// Embed returns an embedding for each text, in order, using Ollama's
+// /api/embed. Requests are routed, retried and failed over like chat
+// requests.
+func (ai *AIClient) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ai.embed",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("gen_ai.system", ai.provider),
+			attribute.String("gen_ai.request.model", ai.embedModel),
+			attribute.Int("gen_ai.request.inputs", len(texts)),
+		),
+	)
+	defer span.End()
+
+	start := time.Now()
+	embeddings := make([][]float32, 0, len(texts))
+	var err error
+	for i := 0; i < len(texts) && err == nil; i += embedBatch {
+		var batch [][]float32
+		batch, err = ai.embedBatch(ctx, texts[i:min(i+embedBatch, len(texts))])
+		embeddings = append(embeddings, batch...)
+	}
+	metrics.ObserveModelCall(ai.provider, ai.embedModel, time.Since(start), 0, err)
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		ai.log.WarnContext(ctx, "embedding request failed", "model", ai.embedModel, "inputs", len(texts), "error", err)
+		return nil, err
+	}
+	ai.log.DebugContext(ctx, "embedded", "model", ai.embedModel, "inputs", len(texts),
+		"duration_ms", time.Since(start).Milliseconds())
+	return embeddings, nil
+}
+
+func (ai *AIClient) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(ollamaEmbedRequest{Model: ai.embedModel, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	resp, backend, err := ai.postWithRetry(ctx, ai.embedModel, "/api/embed", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	defer backend.release()
+
+	var response ollamaEmbedResponse
+	err = json.NewDecoder(io.LimitReader(resp.Body, 256<<20)).Decode(&response)
+	if err != nil {
+		err = streamError(ctx, err)
+	} else if len(response.Embeddings) != len(texts) {
+		err = &UpstreamError{
+			Kind: UpstreamFailed,
+			Err:  fmt.Errorf("got %d embeddings for %d inputs", len(response.Embeddings), len(texts)),
+		}
+	}
+	backend.record(err)
+	if err != nil {
+		return nil, err
+	}
+	return response.Embeddings, nil
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrShuttingDown is returned by Start once the tracker is closed.
+	ErrShuttingDown = errors.New("server is shutting down")
+	// ErrInterrupted is the cancellation cause of generations cut off by
+	// Interrupt.
+	ErrInterrupted = errors.New("generation interrupted by shutdown")
+)
+
+// GenerationTracker keeps track of in-flight model generations so the
+// server can let them finish before shutting down.
+type GenerationTracker struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	closed  bool
+	next    int
+	cancels map[int]context.CancelCauseFunc
+}
+
+func NewGenerationTracker() *GenerationTracker {
+	return &GenerationTracker{
+		cancels: make(map[int]context.CancelCauseFunc),
+	}
+}
+
+// Start registers a generation. The returned context is cancelled with
+// ErrInterrupted if the generation is interrupted; call done when the
+// generation has finished, including persisting its result.
+func (t *GenerationTracker) Start(parent context.Context) (context.Context, func(), error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, nil, ErrShuttingDown
+	}
+
+	ctx, cancel := context.WithCancelCause(parent)
+	id := t.next
+	t.next++
+	t.cancels[id] = cancel
+	t.wg.Add(1)
+
+	var once sync.Once
+	done := func() {
+		once.Do(func() {
+			t.mu.Lock()
+			delete(t.cancels, id)
+			t.mu.Unlock()
+			cancel(nil)
+			t.wg.Done()
+		})
+	}
+	return ctx, done, nil
+}
+
+// Close stops new generations from starting.
+func (t *GenerationTracker) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+}
+
+// Active returns the number of generations in flight.
+func (t *GenerationTracker) Active() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.cancels)
+}
+
+// Interrupt cancels every in-flight generation and returns how many were
+// cancelled.
+func (t *GenerationTracker) Interrupt() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, cancel := range t.cancels {
+		cancel(ErrInterrupted)
+	}
+	return len(t.cancels)
+}
+
+// Wait blocks until every generation is done or ctx expires.
+func (t *GenerationTracker) Wait(ctx context.Context) error {
+	finished := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Interrupted reports whether ctx, as returned by Start, was cancelled by
+// Interrupt.
+func Interrupted(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrInterrupted)
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"ai-chatbot-web/internal/database"
+	"ai-chatbot-web/internal/models"
+	"context"
+	"fmt"
+	"time"
+)
+
+// ReconcileResult counts the rows fixed up by ReconcileMessages.
+type ReconcileResult struct {
+	Backfilled     int64 `json:"backfilled"`
+	Interrupted    int64 `json:"interrupted"`
+	SystemMessages int64 `json:"system_messages"`
+}
+
+// ReconcileMessages repairs state left behind by crashes and by rows
+// written before messages had a status:
+//
+//   - messages without a status are marked complete
+//   - user messages pending for longer than stuckAfter are marked
+//     interrupted so they can be retried
+//   - conversations missing their system message get one
+//
+// A server starting alone passes 0, since none of the pending turns can
+// still be generating. When instances share the database, stuckAfter
+// should comfortably exceed the model timeout so turns still being
+// generated by another instance are left alone.
+func ReconcileMessages(ctx context.Context, db *database.Database, stuckAfter time.Duration) (*ReconcileResult, error) {
+	result := &ReconcileResult{}
+	tx := db.DB.WithContext(ctx)
+
+	backfill := tx.Model(&models.Message{}).
+		Where("status = ? OR status IS NULL", "").
+		Update("status", models.MessageStatusComplete)
+	if backfill.Error != nil {
+		return nil, fmt.Errorf("failed to backfill message status: %v", backfill.Error)
+	}
+	result.Backfilled = backfill.RowsAffected
+
+	stuck := tx.Model(&models.Message{}).
+		Where("status = ? AND created_at < ?", models.MessageStatusPending, time.Now().Add(-stuckAfter)).
+		Update("status", models.MessageStatusInterrupted)
+	if stuck.Error != nil {
+		return nil, fmt.Errorf("failed to mark stuck messages: %v", stuck.Error)
+	}
+	result.Interrupted = stuck.RowsAffected
+
+	var orphans []models.Conversation
+	if err := tx.Where("NOT EXISTS (?)",
+		db.DB.Model(&models.Message{}).Select("1").
+			Where("messages.conversation_id = conversations.id AND messages.role = ?", "system"),
+	).Find(&orphans).Error; err != nil {
+		return nil, fmt.Errorf("failed to find conversations without a system message: %v", err)
+	}
+
+	for _, conversation := range orphans {
+		if conversation.SystemPrompt == "" {
+			continue
+		}
+		err := tx.Create(&models.Message{
+			ConversationID: conversation.ID,
+			Role:           "system",
+			Content:        conversation.SystemPrompt,
+			TokenCount:     len(conversation.SystemPrompt) / 4, // same estimate as AIClient.EstimateTokens
+			Status:         models.MessageStatusComplete,
+			CreatedAt:      conversation.CreatedAt,
+		}).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore system message for %s: %v", conversation.ID, err)
+		}
+		result.SystemMessages++
+	}
+
+	return result, nil
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"ai-chatbot-web/internal/database/databasetest"
+	"ai-chatbot-web/internal/models"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReconcileMessages(t *testing.T) {
+	db := databasetest.Open(t)
+	now := time.Now()
+
+	conversation := models.Conversation{UserID: "alice", SystemPrompt: "Be brief.", CreatedAt: now.Add(-time.Hour)}
+	if err := db.DB.Create(&conversation).Error; err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	messages := map[string]*models.Message{
+		"old pending":    {Role: "user", Status: models.MessageStatusPending, CreatedAt: now.Add(-time.Hour)},
+		"recent pending": {Role: "user", Status: models.MessageStatusPending, CreatedAt: now.Add(-time.Second)},
+		"no status":      {Role: "assistant", CreatedAt: now.Add(-time.Minute)},
+		"failed":         {Role: "user", Status: models.MessageStatusFailed, CreatedAt: now.Add(-time.Minute)},
+	}
+	for name, msg := range messages {
+		msg.ConversationID = conversation.ID
+		msg.Content = name
+		if err := db.DB.Create(msg).Error; err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+	status := func(name string) string {
+		var msg models.Message
+		db.DB.First(&msg, "id = ?", messages[name].ID)
+		return msg.Status
+	}
+
+	// Another instance may still be generating the recent turn
+	result, err := ReconcileMessages(context.Background(), db, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("ReconcileMessages: %v", err)
+	}
+	if result.Backfilled != 1 || result.Interrupted != 1 || result.SystemMessages != 1 {
+		t.Errorf("result = %+v", result)
+	}
+	if status("old pending") != models.MessageStatusInterrupted || status("recent pending") != models.MessageStatusPending ||
+		status("no status") != models.MessageStatusComplete || status("failed") != models.MessageStatusFailed {
+		t.Errorf("statuses after 5m: %s, %s, %s, %s", status("old pending"), status("recent pending"), status("no status"), status("failed"))
+	}
+
+	// Alone at startup, every pending turn was cut off
+	if result, err = ReconcileMessages(context.Background(), db, 0); err != nil {
+		t.Fatalf("ReconcileMessages: %v", err)
+	}
+	if result.Interrupted != 1 || result.SystemMessages != 0 || status("recent pending") != models.MessageStatusInterrupted {
+		t.Errorf("result = %+v, recent pending %s", result, status("recent pending"))
+	}
+
+	var system []models.Message
+	db.DB.Where("conversation_id = ? AND role = ?", conversation.ID, "system").Find(&system)
+	if len(system) != 1 || system[0].Content != "Be brief." || !system[0].CreatedAt.Equal(conversation.CreatedAt) {
+		t.Errorf("system messages = %+v", system)
+	}
+}
@@ -0,0 +1,421 @@
+package services
+
+import (
+	"ai-chatbot-web/internal/logging"
+	"ai-chatbot-web/internal/metrics"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Backend is one Ollama host in the pool.
+type Backend struct {
+	Name string
+	URL  string
+
+	breaker  *CircuitBreaker
+	inFlight atomic.Int64
+
+	mu        sync.Mutex
+	checked   bool // false until the first health check finishes
+	healthy   bool
+	models    map[string]bool
+	lastError string
+	checkedAt time.Time
+}
+
+// BackendStatus is a snapshot of a backend for health reporting.
+type BackendStatus struct {
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Healthy   bool      `json:"healthy"`
+	Circuit   string    `json:"circuit"`
+	InFlight  int64     `json:"in_flight"`
+	Models    []string  `json:"models"`
+	LastError string    `json:"last_error,omitempty"`
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+}
+
+// BackendReporter is implemented by chat providers that spread requests
+// over several backends.
+type BackendReporter interface {
+	Backends() []BackendStatus
+}
+
+// available reports whether the backend should be offered requests for
+// model. Backends that have not been checked yet are given the benefit of
+// the doubt.
+func (b *Backend) available(model string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.checked {
+		return true
+	}
+	return b.healthy && hasModel(b.models, model)
+}
+
+func hasModel(models map[string]bool, model string) bool {
+	if models[model] {
+		return true
+	}
+	// Ollama treats "name" and "name:latest" as the same model
+	if !strings.Contains(model, ":") {
+		return models[model+":latest"]
+	}
+	return false
+}
+
+// acquire and release track requests in flight on the backend.
+func (b *Backend) acquire() {
+	metrics.SetBackendInFlight(b.Name, b.inFlight.Add(1))
+}
+
+func (b *Backend) release() {
+	metrics.SetBackendInFlight(b.Name, b.inFlight.Add(-1))
+}
+
+// record feeds the outcome of a request to the backend's circuit breaker.
+// Only failures that point at the backend count against it.
+func (b *Backend) record(err error) {
+	upstream, ok := asUpstream(err)
+	switch {
+	case err == nil:
+		b.breaker.Record(true)
+	case ok:
+		b.breaker.Record(!upstream.backendFault())
+	default:
+		// cancelled by the caller: says nothing about the backend
+		b.breaker.Release()
+	}
+}
+
+func (b *Backend) status() BackendStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	models := make([]string, 0, len(b.models))
+	for m := range b.models {
+		models = append(models, m)
+	}
+	sort.Strings(models)
+
+	return BackendStatus{
+		Name:      b.Name,
+		URL:       b.URL,
+		Healthy:   !b.checked || b.healthy,
+		Circuit:   b.breaker.State(),
+		InFlight:  b.inFlight.Load(),
+		Models:    models,
+		LastError: b.lastError,
+		CheckedAt: b.checkedAt,
+	}
+}
+
+// BackendRouter spreads model requests over a pool of Ollama backends. It
+// learns which models each backend has from /api/tags, sends each request
+// to the eligible backend with the fewest requests in flight, and skips
+// backends that fail health checks or whose circuit breaker is open.
+type BackendRouter struct {
+	backends []*Backend
+	interval time.Duration
+	client   *http.Client
+	log      *slog.Logger
+}
+
+type backendConfig struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// NewBackendRouter builds the pool from, in order of precedence:
+//
+//   - OLLAMA_BACKENDS_FILE, a JSON file {"backends": [{"name": ..., "url": ...}]}
+//   - OLLAMA_HOSTS, a comma separated list of URLs, each optionally
+//     prefixed with "name="
+//   - OLLAMA_HOST, a single backend (default http://localhost:11434)
+//
+// OLLAMA_HEALTH_INTERVAL (default 30s) sets how often backends are checked.
+func NewBackendRouter() (*BackendRouter, error) {
+	var configs []backendConfig
+
+	switch {
+	case os.Getenv("OLLAMA_BACKENDS_FILE") != "":
+		data, err := os.ReadFile(os.Getenv("OLLAMA_BACKENDS_FILE"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backends file: %v", err)
+		}
+		var file struct {
+			Backends []backendConfig `json:"backends"`
+		}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse backends file: %v", err)
+		}
+		configs = file.Backends
+
+	case os.Getenv("OLLAMA_HOSTS") != "":
+		for _, entry := range strings.Split(os.Getenv("OLLAMA_HOSTS"), ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			name, host, found := strings.Cut(entry, "=")
+			if !found {
+				name, host = "", entry
+			}
+			configs = append(configs, backendConfig{Name: name, URL: host})
+		}
+
+	default:
+		configs = []backendConfig{{URL: os.Getenv("OLLAMA_HOST")}}
+	}
+
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no model backends configured")
+	}
+
+	interval := 30 * time.Second
+	if v, err := time.ParseDuration(os.Getenv("OLLAMA_HEALTH_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+
+	router := &BackendRouter{
+		interval: interval,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		log:      logging.For("router"),
+	}
+
+	seen := map[string]bool{}
+	for _, config := range configs {
+		backend, err := router.newBackend(config)
+		if err != nil {
+			return nil, err
+		}
+		if seen[backend.Name] {
+			return nil, fmt.Errorf("duplicate backend name: %s", backend.Name)
+		}
+		seen[backend.Name] = true
+		router.backends = append(router.backends, backend)
+	}
+	return router, nil
+}
+
+func (r *BackendRouter) newBackend(config backendConfig) (*Backend, error) {
+	baseURL := config.URL
+	if baseURL == "" {
+		baseURL = "http://localhost:11434"
+	}
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		baseURL = "http://" + baseURL
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	parsed, err := url.Parse(baseURL)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid backend URL %q", config.URL)
+	}
+
+	name := config.Name
+	if name == "" {
+		name = parsed.Host
+	}
+
+	breaker := NewCircuitBreaker()
+	breaker.OnStateChange = func(state string) {
+		metrics.SetCircuitState(name, state)
+		r.log.Warn("backend circuit breaker changed state", "backend", name, "state", state)
+	}
+
+	return &Backend{
+		Name:    name,
+		URL:     baseURL,
+		breaker: breaker,
+		models:  map[string]bool{},
+	}, nil
+}
+
+// Backends returns the status of every backend.
+func (r *BackendRouter) Backends() []BackendStatus {
+	statuses := make([]BackendStatus, len(r.backends))
+	for i, b := range r.backends {
+		statuses[i] = b.status()
+	}
+	return statuses
+}
+
+// Start runs health checks every interval until ctx is done. The first
+// check runs immediately.
+func (r *BackendRouter) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			r.Refresh(ctx)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Refresh checks every backend now, in parallel.
+func (r *BackendRouter) Refresh(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, b := range r.backends {
+		wg.Add(1)
+		go func(b *Backend) {
+			defer wg.Done()
+			r.check(ctx, b)
+		}(b)
+	}
+	wg.Wait()
+}
+
+// check lists the backend's models, which doubles as a health check.
+func (r *BackendRouter) check(ctx context.Context, b *Backend) {
+	models, err := r.listModels(ctx, b)
+
+	b.mu.Lock()
+	wasHealthy := !b.checked || b.healthy
+	b.checked = true
+	b.checkedAt = time.Now()
+	b.healthy = err == nil
+	if err == nil {
+		b.models = models
+		b.lastError = ""
+	} else {
+		b.lastError = err.Error()
+	}
+	b.mu.Unlock()
+
+	metrics.SetBackendUp(b.Name, err == nil)
+	switch {
+	case err != nil && wasHealthy:
+		r.log.Warn("backend unhealthy", "backend", b.Name, "error", err)
+	case err == nil && !wasHealthy:
+		r.log.Info("backend healthy again", "backend", b.Name, "models", len(models))
+	}
+}
+
+func (r *BackendRouter) listModels(ctx context.Context, b *Backend) (map[string]bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.URL+"/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("health check returned %s", resp.Status)
+	}
+
+	var tags struct {
+		Models []struct {
+			Name  string `json:"name"`
+			Model string `json:"model"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("invalid /api/tags response: %v", err)
+	}
+
+	models := make(map[string]bool, len(tags.Models))
+	for _, m := range tags.Models {
+		models[m.Name] = true
+		if m.Model != "" {
+			models[m.Model] = true
+		}
+	}
+	return models, nil
+}
+
+// Pick chooses the backend for the next attempt at a request for model:
+// the one with the fewest requests in flight among those that are healthy,
+// have the model, have not been tried yet and whose circuit breaker lets
+// the call through. If every backend has been tried, tried ones are
+// eligible again.
+//
+// When no backend can take the request Pick returns an *UpstreamError.
+func (r *BackendRouter) Pick(model string, tried map[*Backend]bool) (*Backend, error) {
+	var candidates []*Backend
+	for _, b := range r.backends {
+		if b.available(model) {
+			candidates = append(candidates, b)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, &UpstreamError{
+			Kind: UpstreamUnavailable,
+			Err:  fmt.Errorf("no healthy backend serves model %s", model),
+		}
+	}
+
+	fresh := candidates[:0:0]
+	for _, b := range candidates {
+		if !tried[b] {
+			fresh = append(fresh, b)
+		}
+	}
+	if len(fresh) > 0 {
+		candidates = fresh
+	}
+
+	// least in flight first; ties keep configuration order
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].inFlight.Load() < candidates[j].inFlight.Load()
+	})
+
+	var wait time.Duration
+	for _, b := range candidates {
+		ok, retryIn := b.breaker.Allow()
+		if ok {
+			return b, nil
+		}
+		if wait == 0 || retryIn < wait {
+			wait = retryIn
+		}
+	}
+	return nil, &UpstreamError{
+		Kind:       UpstreamUnavailable,
+		RetryAfter: wait,
+		Err:        fmt.Errorf("model server unavailable, retry in %s", wait.Round(time.Second)),
+	}
+}
+
+// hasUntried reports whether a backend other than those tried could take
+// a request for model.
+func (r *BackendRouter) hasUntried(model string, tried map[*Backend]bool) bool {
+	for _, b := range r.backends {
+		if !tried[b] && b.available(model) {
+			return true
+		}
+	}
+	return false
+}
+
+// lacks reports whether every backend has listed its models and none has
+// model, healthy or not, so asking for it can only fail.
+func (r *BackendRouter) lacks(model string) bool {
+	for _, b := range r.backends {
+		b.mu.Lock()
+		maybe := !b.checked || hasModel(b.models, model)
+		b.mu.Unlock()
+		if maybe {
+			return false
+		}
+	}
+	return true
+}
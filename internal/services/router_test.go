@@ -0,0 +1,149 @@
+package services
+
+import (
+	"ai-chatbot-web/internal/fakeollama"
+	"ai-chatbot-web/internal/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newPool starts a fake Ollama per name and points OLLAMA_HOSTS at them.
+func newPool(t *testing.T, names ...string) map[string]*fakeollama.Server {
+	t.Helper()
+	fakes := map[string]*fakeollama.Server{}
+	hosts := ""
+	for i, name := range names {
+		fake := fakeollama.New()
+		srv := httptest.NewServer(fake)
+		t.Cleanup(srv.Close)
+		fakes[name] = fake
+		if i > 0 {
+			hosts += ","
+		}
+		hosts += name + "=" + srv.URL
+	}
+	t.Setenv("OLLAMA_HOSTS", hosts)
+	t.Setenv("OLLAMA_MODEL", fakeollama.DefaultModel)
+	t.Setenv("AI_RETRY_BASE_DELAY", "1ms")
+	return fakes
+}
+
+func newPoolClient(t *testing.T) *AIClient {
+	t.Helper()
+	client, err := NewAIClient()
+	if err != nil {
+		t.Fatalf("NewAIClient: %v", err)
+	}
+	return client
+}
+
+func send(t *testing.T, client *AIClient, chain ...string) (*ChatResult, error) {
+	t.Helper()
+	return client.SendMessage(context.Background(), []models.Message{{Role: "user", Content: "hello"}}, ChatOptions{Models: chain})
+}
+
+func TestNewBackendRouterConfig(t *testing.T) {
+	t.Setenv("OLLAMA_HOSTS", "gpu1=http://10.0.0.1:11434, 10.0.0.2:11434/")
+	router, err := NewBackendRouter()
+	if err != nil {
+		t.Fatalf("NewBackendRouter: %v", err)
+	}
+	got := router.Backends()
+	if len(got) != 2 || got[0].Name != "gpu1" || got[1].Name != "10.0.0.2:11434" || got[1].URL != "http://10.0.0.2:11434" {
+		t.Errorf("backends from OLLAMA_HOSTS: %+v", got)
+	}
+
+	file := filepath.Join(t.TempDir(), "backends.json")
+	os.WriteFile(file, []byte(`{"backends": [{"name": "a", "url": "http://a:11434"}, {"name": "a", "url": "http://b:11434"}]}`), 0o600)
+	t.Setenv("OLLAMA_BACKENDS_FILE", file)
+	if _, err := NewBackendRouter(); err == nil {
+		t.Error("duplicate backend names were accepted")
+	}
+}
+
+func TestRouterFailsOverToHealthyBackend(t *testing.T) {
+	t.Setenv("AI_RETRIES", "0")
+	fakes := newPool(t, "a", "b")
+	client := newPoolClient(t)
+
+	fakes["a"].FailNext(1, http.StatusServiceUnavailable)
+	result, err := send(t, client)
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if result.Backend != "b" {
+		t.Errorf("answered by %q, want b", result.Backend)
+	}
+	if len(fakes["a"].Requests()) != 1 || len(fakes["b"].Requests()) != 1 {
+		t.Errorf("requests: a=%d b=%d", len(fakes["a"].Requests()), len(fakes["b"].Requests()))
+	}
+}
+
+func TestRouterSkipsDownBackend(t *testing.T) {
+	t.Setenv("AI_RETRIES", "0")
+	t.Setenv("AI_BREAKER_THRESHOLD", "1")
+	fakes := newPool(t, "b")
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	t.Setenv("OLLAMA_HOSTS", "a="+down.URL+","+os.Getenv("OLLAMA_HOSTS"))
+	client := newPoolClient(t)
+
+	for i := 0; i < 3; i++ {
+		result, err := send(t, client)
+		if err != nil || result.Backend != "b" {
+			t.Fatalf("call %d: backend %v, err %v", i, result, err)
+		}
+	}
+	if n := len(fakes["b"].Requests()); n != 3 {
+		t.Errorf("b saw %d requests, want 3", n)
+	}
+	if state := client.Backends()[0].Circuit; state != CircuitOpen {
+		t.Errorf("circuit of the down backend is %s", state)
+	}
+
+	client.router.Refresh(context.Background())
+	if status := client.Backends()[0]; status.Healthy || status.LastError == "" {
+		t.Errorf("health check missed the down backend: %+v", status)
+	}
+}
+
+func TestRouterRoutesByModel(t *testing.T) {
+	fakes := newPool(t, "a", "b")
+	fakes["a"].SetModels("some-other-model")
+	client := newPoolClient(t)
+	client.router.Refresh(context.Background())
+
+	for i := 0; i < 3; i++ {
+		if result, err := send(t, client); err != nil || result.Backend != "b" {
+			t.Fatalf("call %d: %v, err %v", i, result, err)
+		}
+	}
+	if n := len(fakes["a"].Requests()); n != 0 {
+		t.Errorf("backend without the model got %d requests", n)
+	}
+
+	fakes["b"].SetModels("some-other-model")
+	client.router.Refresh(context.Background())
+	_, err := send(t, client)
+	if upstream, ok := asUpstream(err); !ok || upstream.Kind != UpstreamUnavailable {
+		t.Errorf("no backend with the model: %v", err)
+	}
+}
+
+func TestRouterPrefersLeastLoaded(t *testing.T) {
+	newPool(t, "a", "b")
+	client := newPoolClient(t)
+
+	a, _ := client.router.Pick(fakeollama.DefaultModel, nil)
+	a.acquire()
+	defer a.release()
+	b, _ := client.router.Pick(fakeollama.DefaultModel, nil)
+	if a.Name != "a" || b.Name != "b" {
+		t.Errorf("picked %s then %s, want a then b", a.Name, b.Name)
+	}
+}
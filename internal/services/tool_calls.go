@@ -0,0 +1,132 @@
+package services
+
+import (
+	"ai-chatbot-web/internal/logging"
+	"ai-chatbot-web/internal/metrics"
+	"ai-chatbot-web/internal/models"
+	"ai-chatbot-web/internal/tools"
+	"ai-chatbot-web/internal/tracing"
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// ToolTurn is a reply produced with tools. Steps holds, in order, every
+// assistant message that called tools followed by the tool results, ready
+// to be saved before the final reply in Result.
+type ToolTurn struct {
+	Steps  []models.Message
+	Result *ChatResult
+}
+
+// CompleteWithTools asks provider for a reply to messages. While the model
+// answers with tool calls they are run with registry and the results fed
+// back as tool messages. Only the tools in options.Tools are run; calls to
+// any other tool are answered with an error. After tools.MaxRounds rounds
+// the tools are withdrawn so the model has to answer. Content streamed
+// with tool calls is not part of the reply, so options.OnReset, if set, is
+// called after it.
+//
+// The steps carry the accounting of the calls that produced them but no
+// conversation or API key, which the caller fills in.
+func CompleteWithTools(ctx context.Context, provider ChatProvider, registry *tools.Registry, messages []models.Message, options ChatOptions) (*ToolTurn, error) {
+	turn := &ToolTurn{}
+	history := append([]models.Message(nil), messages...)
+	offered := map[string]bool{}
+	for _, definition := range options.Tools {
+		offered[definition.Function.Name] = true
+	}
+
+	for round := 0; ; round++ {
+		if round == tools.MaxRounds {
+			options.Tools = nil
+		}
+
+		result, err := provider.SendMessage(ctx, history, options)
+		if err != nil {
+			return nil, err
+		}
+		if len(result.ToolCalls) == 0 || len(options.Tools) == 0 {
+			result.ToolCalls = nil
+			turn.Result = result
+			return turn, nil
+		}
+
+		step := models.Message{
+			Role:               "assistant",
+			Content:            result.Content,
+			ToolCalls:          result.ToolCalls,
+			TokenCount:         result.CompletionTokens,
+			Status:             models.MessageStatusComplete,
+			CreatedAt:          time.Now(),
+			Model:              result.Model,
+			PromptTokens:       result.PromptTokens,
+			CompletionTokens:   result.CompletionTokens,
+			LatencyMs:          result.Latency.Milliseconds(),
+			TimeToFirstTokenMs: result.TimeToFirstToken.Milliseconds(),
+			Backend:            result.Backend,
+		}
+		history = append(history, step)
+		turn.Steps = append(turn.Steps, step)
+		if result.Content != "" && options.OnReset != nil {
+			options.OnReset()
+		}
+
+		for _, call := range result.ToolCalls {
+			output := runTool(ctx, registry, call, offered[call.Function.Name])
+			toolMessage := models.Message{
+				Role:       "tool",
+				Content:    output,
+				ToolName:   call.Function.Name,
+				TokenCount: provider.EstimateTokens(output),
+				Status:     models.MessageStatusComplete,
+				CreatedAt:  time.Now(),
+			}
+			history = append(history, toolMessage)
+			turn.Steps = append(turn.Steps, toolMessage)
+		}
+	}
+}
+
+// unknownTool stands in for the names of tools that were not offered in
+// span names and metric labels, which must not take arbitrary values from
+// the model.
+const unknownTool = "unknown"
+
+// runTool runs one call in its own span. A call to a tool that was not
+// offered is not run; the model is told so instead.
+func runTool(ctx context.Context, registry *tools.Registry, call tools.Call, offered bool) string {
+	name := call.Function.Name
+	if !offered {
+		name = unknownTool
+	}
+	ctx, span := tracing.Tracer().Start(ctx, "tool."+name)
+	defer span.End()
+
+	start := time.Now()
+	var output string
+	var err error
+	if offered {
+		output, err = registry.Run(ctx, call)
+	} else {
+		err = fmt.Errorf("tool %q is not enabled for this conversation", call.Function.Name)
+		output = "error: " + err.Error()
+	}
+	metrics.ToolCall(name, err)
+
+	log := logging.For("tools")
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.WarnContext(ctx, "tool call failed", "tool", call.Function.Name,
+			"duration_ms", time.Since(start).Milliseconds(), "error", err)
+	} else {
+		log.InfoContext(ctx, "tool called", "tool", call.Function.Name,
+			"duration_ms", time.Since(start).Milliseconds(), "result", logging.Content(output))
+	}
+	span.SetAttributes(attribute.Int("tool.result_length", len(output)))
+	return output
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"ai-chatbot-web/internal/models"
+	"ai-chatbot-web/internal/tools"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// loopingProvider calls current_time for as long as tools are offered.
+type loopingProvider struct {
+	calls int
+}
+
+func (p *loopingProvider) SendMessage(ctx context.Context, messages []models.Message, options ChatOptions) (*ChatResult, error) {
+	p.calls++
+	if len(options.Tools) > 0 {
+		call := tools.Call{Function: tools.FunctionCall{Name: "current_time", Arguments: json.RawMessage(`{}`)}}
+		return &ChatResult{Model: "m", ToolCalls: []tools.Call{call}}, nil
+	}
+	return &ChatResult{Model: "m", Content: "done"}, nil
+}
+
+func (p *loopingProvider) EstimateTokens(text string) int { return len(text) / 4 }
+
+func (p *loopingProvider) GetModel() string { return "m" }
+
+func TestCompleteWithToolsStopsAfterMaxRounds(t *testing.T) {
+	registry := tools.NewRegistry()
+	tools.RegisterBuiltins(registry)
+	provider := &loopingProvider{}
+
+	turn, err := CompleteWithTools(context.Background(), provider, registry,
+		[]models.Message{{Role: "user", Content: "what time is it?"}},
+		ChatOptions{Tools: registry.Definitions("current_time")})
+	if err != nil {
+		t.Fatalf("CompleteWithTools: %v", err)
+	}
+	if turn.Result.Content != "done" || provider.calls != tools.MaxRounds+1 {
+		t.Errorf("result %q after %d calls", turn.Result.Content, provider.calls)
+	}
+	if len(turn.Steps) != 2*tools.MaxRounds {
+		t.Errorf("%d steps, want %d", len(turn.Steps), 2*tools.MaxRounds)
+	}
+	for i := 1; i < len(turn.Steps); i += 2 {
+		if step := turn.Steps[i]; step.Role != "tool" || step.ToolName != "current_time" || step.Content == "" {
+			t.Fatalf("step %d = %+v", i, step)
+		}
+	}
+}
+
+// scriptedProvider answers with each of calls in turn, then with "done".
+type scriptedProvider struct {
+	calls [][]tools.Call
+}
+
+func (p *scriptedProvider) SendMessage(ctx context.Context, messages []models.Message, options ChatOptions) (*ChatResult, error) {
+	if len(p.calls) == 0 {
+		return &ChatResult{Model: "m", Content: "done"}, nil
+	}
+	calls := p.calls[0]
+	p.calls = p.calls[1:]
+	return &ChatResult{Model: "m", ToolCalls: calls}, nil
+}
+
+func (p *scriptedProvider) EstimateTokens(text string) int { return len(text) / 4 }
+
+func (p *scriptedProvider) GetModel() string { return "m" }
+
+func TestCompleteWithToolsOnlyRunsOfferedTools(t *testing.T) {
+	registry := tools.NewRegistry()
+	tools.RegisterBuiltins(registry)
+	provider := &scriptedProvider{calls: [][]tools.Call{{
+		{Function: tools.FunctionCall{Name: "calculate", Arguments: json.RawMessage(`{"expression": "6 * 7"}`)}},
+		{Function: tools.FunctionCall{Name: "current_time", Arguments: json.RawMessage(`{}`)}},
+	}}}
+
+	turn, err := CompleteWithTools(context.Background(), provider, registry,
+		[]models.Message{{Role: "user", Content: "what is 6 * 7?"}},
+		ChatOptions{Tools: registry.Definitions("current_time")})
+	if err != nil {
+		t.Fatalf("CompleteWithTools: %v", err)
+	}
+	if len(turn.Steps) != 3 {
+		t.Fatalf("%d steps, want 3: %+v", len(turn.Steps), turn.Steps)
+	}
+	if refused := turn.Steps[1]; refused.ToolName != "calculate" || refused.Content == "42" || !strings.HasPrefix(refused.Content, "error:") {
+		t.Errorf("call to a tool that was not offered = %+v", refused)
+	}
+	if ran := turn.Steps[2]; ran.ToolName != "current_time" || strings.HasPrefix(ran.Content, "error:") {
+		t.Errorf("call to an offered tool = %+v", ran)
+	}
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"ai-chatbot-web/internal/retry"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Kinds of upstream failure. They double as the error codes returned to
+// API clients.
+const (
+	// UpstreamFailed: the model server answered with an error or a broken
+	// response (502).
+	UpstreamFailed = "upstream_error"
+	// UpstreamUnavailable: the model server could not be reached, is
+	// overloaded, or the circuit breaker is open (503).
+	UpstreamUnavailable = "upstream_unavailable"
+	// UpstreamTimeout: the model server did not answer in time (504).
+	UpstreamTimeout = "upstream_timeout"
+)
+
+// UpstreamError is returned by AIClient when the model server, rather than
+// this service, is at fault. Handlers map it to a 502, 503 or 504.
+type UpstreamError struct {
+	Kind       string
+	StatusCode int           // status returned by the model server, if any
+	RetryAfter time.Duration // when to try again, if known
+	Err        error
+
+	// preStream is set for failures before any of the response was read,
+	// which are safe to retry.
+	preStream bool
+}
+
+func (e *UpstreamError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatus is the status the API answers with for this failure.
+func (e *UpstreamError) HTTPStatus() int {
+	switch e.Kind {
+	case UpstreamUnavailable:
+		return http.StatusServiceUnavailable
+	case UpstreamTimeout:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// backendFault reports whether the failure says something about the health
+// of the model server. Client errors such as an unknown model do not.
+func (e *UpstreamError) backendFault() bool {
+	return e.StatusCode == 0 || retry.Status(e.StatusCode)
+}
+
+func (e *UpstreamError) retryable() bool {
+	return e.preStream && e.backendFault()
+}
+
+func asUpstream(err error) (*UpstreamError, bool) {
+	var upstream *UpstreamError
+	ok := errors.As(err, &upstream)
+	return upstream, ok
+}
+
+// transportError classifies an error from sending a request. Cancellation
+// by the caller is returned unchanged: it is not the backend's fault.
+func transportError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+	kind := UpstreamUnavailable
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		kind = UpstreamTimeout
+	}
+	return &UpstreamError{Kind: kind, Err: fmt.Errorf("API request failed: %v", err), preStream: true}
+}
+
+// statusError classifies a non-200 response from the model server.
+func statusError(resp *http.Response, message string) error {
+	kind := UpstreamFailed
+	switch resp.StatusCode {
+	case http.StatusServiceUnavailable, http.StatusTooManyRequests:
+		kind = UpstreamUnavailable
+	case http.StatusGatewayTimeout, http.StatusRequestTimeout:
+		kind = UpstreamTimeout
+	}
+
+	err := fmt.Errorf("API request failed with status: %s", resp.Status)
+	if message != "" {
+		err = fmt.Errorf("API request failed with status: %s: %s", resp.Status, message)
+	}
+
+	return &UpstreamError{Kind: kind, StatusCode: resp.StatusCode, RetryAfter: retry.RetryAfter(resp.Header), Err: err, preStream: true}
+}
+
+// streamError classifies a failure while reading the response. It is not
+// retried since part of the reply has already been consumed.
+func streamError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+	kind := UpstreamFailed
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		kind = UpstreamTimeout
+	}
+	return &UpstreamError{Kind: kind, Err: fmt.Errorf("failed to decode response: %v", err)}
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// VisionChecker is implemented by providers that can tell which models
+// accept images. Handlers refuse images for models it reports as blind.
+type VisionChecker interface {
+	SupportsVision(ctx context.Context, model string) (bool, error)
+}
+
+type ollamaShowResponse struct {
+	Capabilities []string `json:"capabilities"`
+	Details      struct {
+		Families []string `json:"families"`
+	} `json:"details"`
+}
+
+// SupportsVision asks Ollama's /api/show whether model can read images.
+// Ollama 0.6 and later list a "vision" capability; older servers are
+// recognised by the clip projector family of llava-style models. Models
+// the backends do not have are reported as blind. Only models that can
+// see are remembered: a blind answer may change once a model is pulled.
+func (ai *AIClient) SupportsVision(ctx context.Context, model string) (bool, error) {
+	if _, ok := ai.vision.Load(model); ok {
+		return true, nil
+	}
+	if ai.router.lacks(model) {
+		return false, nil
+	}
+
+	body, err := json.Marshal(map[string]string{"model": model})
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal request: %v", err)
+	}
+	resp, backend, err := ai.postWithRetry(ctx, model, "/api/show", body)
+	if upstream, ok := asUpstream(err); ok && upstream.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	defer backend.release()
+
+	var show ollamaShowResponse
+	err = json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&show)
+	if err != nil {
+		err = streamError(ctx, err)
+	}
+	backend.record(err)
+	if err != nil {
+		return false, err
+	}
+
+	vision := slices.Contains(show.Capabilities, "vision")
+	if len(show.Capabilities) == 0 {
+		vision = slices.ContainsFunc(show.Details.Families, func(family string) bool {
+			return strings.EqualFold(family, "clip")
+		})
+	}
+	if vision {
+		ai.vision.Store(model, true)
+	}
+	return vision, nil
+}
@@ -0,0 +1,322 @@
+package store
+
+import (
+	"ai-chatbot-web/internal/database"
+	"ai-chatbot-web/internal/models"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DatabaseStore implements ConversationStore, MessageStore and
+// DocumentStore on top of GORM.
+type DatabaseStore struct {
+	db *database.Database
+
+	pgvectorOnce sync.Once
+	pgvector     bool
+}
+
+func NewDatabaseStore(db *database.Database) *DatabaseStore {
+	return &DatabaseStore{
+		db: db,
+	}
+}
+
+// Conversations returns the store as a ConversationStore.
+func (s *DatabaseStore) Conversations() ConversationStore {
+	return databaseConversations{s}
+}
+
+// Messages returns the store as a MessageStore.
+func (s *DatabaseStore) Messages() MessageStore {
+	return databaseMessages{s}
+}
+
+// Documents returns the store as a DocumentStore.
+func (s *DatabaseStore) Documents() DocumentStore {
+	return databaseDocuments{s}
+}
+
+func (s *DatabaseStore) Ping(ctx context.Context) error {
+	return s.db.Ping()
+}
+
+func (s *DatabaseStore) tx(ctx context.Context) *gorm.DB {
+	return s.db.DB.WithContext(ctx)
+}
+
+// notFound maps GORM's missing-record error to ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// databaseConversations, databaseMessages and databaseDocuments give the
+// interfaces their own method sets, since they share method names.
+type databaseConversations struct{ *DatabaseStore }
+
+type databaseMessages struct{ *DatabaseStore }
+
+type databaseDocuments struct{ *DatabaseStore }
+
+func (s databaseConversations) ListByUser(ctx context.Context, userID string) ([]models.Conversation, error) {
+	var conversations []models.Conversation
+	if err := s.tx(ctx).Where("user_id = ?", userID).Find(&conversations).Error; err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
+
+func (s databaseConversations) Get(ctx context.Context, id, userID string) (*models.Conversation, error) {
+	var conversation models.Conversation
+	if err := s.tx(ctx).First(&conversation, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &conversation, nil
+}
+
+func (s databaseConversations) GetWithMessages(ctx context.Context, id, userID string) (*models.Conversation, error) {
+	var conversation models.Conversation
+	err := s.tx(ctx).
+		Preload("Messages", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC") }).
+		First(&conversation, "id = ? AND user_id = ?", id, userID).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &conversation, nil
+}
+
+func (s databaseConversations) FindImported(ctx context.Context, userID, importKey string) (*models.Conversation, error) {
+	var conversation models.Conversation
+	err := s.tx(ctx).
+		Preload("Messages", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC") }).
+		First(&conversation, "user_id = ? AND import_key = ? AND import_key <> ''", userID, importKey).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &conversation, nil
+}
+
+func (s databaseConversations) Create(ctx context.Context, conversation *models.Conversation, messages ...*models.Message) error {
+	return s.tx(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(conversation).Error; err != nil {
+			return err
+		}
+		for _, message := range messages {
+			message.ConversationID = conversation.ID
+			if err := tx.Create(message).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s databaseConversations) Update(ctx context.Context, conversation *models.Conversation) error {
+	return s.tx(ctx).Omit("Messages").Save(conversation).Error
+}
+
+func (s databaseConversations) Delete(ctx context.Context, id string) error {
+	return s.tx(ctx).Transaction(func(tx *gorm.DB) error {
+		// dependents first, due to the foreign key constraints
+		if err := tx.Where("conversation_id = ?", id).Delete(&models.DocumentChunk{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("conversation_id = ?", id).Delete(&models.Document{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("conversation_id = ?", id).Delete(&models.Message{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Conversation{}, "id = ?", id).Error
+	})
+}
+
+func (s databaseMessages) Create(ctx context.Context, message *models.Message) error {
+	return s.tx(ctx).Create(message).Error
+}
+
+func (s databaseMessages) Append(ctx context.Context, messages ...*models.Message) error {
+	return s.tx(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, message := range messages {
+			if err := tx.Create(message).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s databaseMessages) Get(ctx context.Context, id, conversationID string) (*models.Message, error) {
+	var message models.Message
+	if err := s.tx(ctx).First(&message, "id = ? AND conversation_id = ?", id, conversationID).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &message, nil
+}
+
+func (s databaseMessages) History(ctx context.Context, conversationID, includeID string) ([]models.Message, error) {
+	var messages []models.Message
+	err := s.tx(ctx).
+		Where("conversation_id = ? AND (status = ? OR id = ?)", conversationID, models.MessageStatusComplete, includeID).
+		Order("created_at ASC").Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (s databaseMessages) IsLatest(ctx context.Context, message *models.Message) (bool, error) {
+	var newer int64
+	err := s.tx(ctx).Model(&models.Message{}).
+		Where("conversation_id = ? AND created_at > ?", message.ConversationID, message.CreatedAt).
+		Count(&newer).Error
+	if err != nil {
+		return false, err
+	}
+	return newer == 0, nil
+}
+
+func (s databaseMessages) SetStatus(ctx context.Context, message *models.Message, status string) error {
+	return s.tx(ctx).Model(message).Update("status", status).Error
+}
+
+func (s databaseMessages) CompleteTurn(ctx context.Context, userMessage *models.Message, replies ...*models.Message) error {
+	return s.tx(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, reply := range replies {
+			if err := tx.Create(reply).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(userMessage).Update("status", models.MessageStatusComplete).Error
+	})
+}
+
+// hasPgvector reports whether chunks have the embedding_vector column,
+// which migration 0007 adds on Postgres when pgvector can be installed.
+func (s *DatabaseStore) hasPgvector() bool {
+	s.pgvectorOnce.Do(func() {
+		s.pgvector = s.db.Type == "postgres" &&
+			s.db.DB.Migrator().HasColumn(&models.DocumentChunk{}, "embedding_vector")
+	})
+	return s.pgvector
+}
+
+// vectorLiteral formats an embedding as a pgvector value.
+func vectorLiteral(embedding []float32) string {
+	parts := make([]string, len(embedding))
+	for i, v := range embedding {
+		parts[i] = strconv.FormatFloat(float64(v), 'g', -1, 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+func (s databaseDocuments) ListByConversation(ctx context.Context, conversationID string) ([]models.Document, error) {
+	documents := []models.Document{}
+	err := s.tx(ctx).Where("conversation_id = ?", conversationID).Order("created_at ASC").Find(&documents).Error
+	if err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+func (s databaseDocuments) Create(ctx context.Context, document *models.Document, chunks []models.DocumentChunk) error {
+	return s.tx(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(document).Error; err != nil {
+			return err
+		}
+		for i := range chunks {
+			chunk := &chunks[i]
+			chunk.DocumentID = document.ID
+			chunk.ConversationID = document.ConversationID
+			if err := tx.Create(chunk).Error; err != nil {
+				return err
+			}
+			if s.hasPgvector() {
+				err := tx.Exec("UPDATE document_chunks SET embedding_vector = CAST(? AS vector) WHERE id = ?",
+					vectorLiteral(chunk.Embedding), chunk.ID).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s databaseDocuments) Delete(ctx context.Context, id, conversationID string) error {
+	return s.tx(ctx).Transaction(func(tx *gorm.DB) error {
+		// chunks first, due to the foreign key constraint
+		err := tx.Where("document_id = ? AND conversation_id = ?", id, conversationID).Delete(&models.DocumentChunk{}).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Delete(&models.Document{}, "id = ? AND conversation_id = ?", id, conversationID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (s databaseDocuments) Search(ctx context.Context, conversationID string, embedding []float32, k int) ([]Match, error) {
+	if s.hasPgvector() {
+		return s.searchPgvector(ctx, conversationID, embedding, k)
+	}
+
+	var chunks []models.DocumentChunk
+	if err := s.tx(ctx).Where("conversation_id = ?", conversationID).Find(&chunks).Error; err != nil {
+		return nil, err
+	}
+	return rank(chunks, embedding, k), nil
+}
+
+// searchPgvector ranks chunks in the database by cosine distance.
+func (s databaseDocuments) searchPgvector(ctx context.Context, conversationID string, embedding []float32, k int) ([]Match, error) {
+	var rows []struct {
+		ID             string
+		DocumentID     string
+		ConversationID string
+		Position       int
+		Content        string
+		CreatedAt      time.Time
+		Distance       float64
+	}
+	vector := vectorLiteral(embedding)
+	err := s.tx(ctx).Raw(`SELECT id, document_id, conversation_id, position, content, created_at,
+			embedding_vector <=> CAST(? AS vector) AS distance
+		FROM document_chunks
+		WHERE conversation_id = ? AND vector_dims(embedding_vector) = ?
+		ORDER BY distance
+		LIMIT ?`, vector, conversationID, len(embedding), k).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]Match, len(rows))
+	for i, row := range rows {
+		matches[i] = Match{
+			Chunk: models.DocumentChunk{
+				ID:             row.ID,
+				DocumentID:     row.DocumentID,
+				ConversationID: row.ConversationID,
+				Position:       row.Position,
+				Content:        row.Content,
+				CreatedAt:      row.CreatedAt,
+			},
+			Score: 1 - row.Distance,
+		}
+	}
+	return matches, nil
+}
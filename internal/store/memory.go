@@ -0,0 +1,326 @@
+package store
+
+import (
+	"ai-chatbot-web/internal/models"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore implements ConversationStore, MessageStore and DocumentStore
+// in process memory. It is meant for tests and for trying the server without a
+// database; nothing survives a restart.
+type MemoryStore struct {
+	mu            sync.Mutex
+	conversations map[string]models.Conversation
+	messages      map[string][]models.Message       // by conversation, oldest first
+	documents     map[string][]models.Document      // by conversation, oldest first
+	chunks        map[string][]models.DocumentChunk // by document
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		conversations: make(map[string]models.Conversation),
+		messages:      make(map[string][]models.Message),
+		documents:     make(map[string][]models.Document),
+		chunks:        make(map[string][]models.DocumentChunk),
+	}
+}
+
+// Conversations returns the store as a ConversationStore.
+func (s *MemoryStore) Conversations() ConversationStore {
+	return memoryConversations{s}
+}
+
+// Messages returns the store as a MessageStore.
+func (s *MemoryStore) Messages() MessageStore {
+	return memoryMessages{s}
+}
+
+// Documents returns the store as a DocumentStore.
+func (s *MemoryStore) Documents() DocumentStore {
+	return memoryDocuments{s}
+}
+
+type memoryConversations struct{ *MemoryStore }
+
+type memoryMessages struct{ *MemoryStore }
+
+type memoryDocuments struct{ *MemoryStore }
+
+// addMessage fills in what the GORM hooks and autoCreateTime would and
+// appends message to its conversation. s.mu must be held.
+func (s *MemoryStore) addMessage(message *models.Message) {
+	if message.ID == "" {
+		message.ID = uuid.New().String()
+	}
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = time.Now()
+	}
+	list := append(s.messages[message.ConversationID], *message)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	s.messages[message.ConversationID] = list
+}
+
+// findMessage returns a pointer to the stored copy of a message. s.mu must
+// be held.
+func (s *MemoryStore) findMessage(id, conversationID string) *models.Message {
+	list := s.messages[conversationID]
+	for i := range list {
+		if list[i].ID == id {
+			return &list[i]
+		}
+	}
+	return nil
+}
+
+func (s memoryConversations) ListByUser(ctx context.Context, userID string) ([]models.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conversations := []models.Conversation{}
+	for _, conversation := range s.conversations {
+		if conversation.UserID == userID {
+			conversations = append(conversations, conversation)
+		}
+	}
+	sort.Slice(conversations, func(i, j int) bool {
+		return conversations[i].CreatedAt.Before(conversations[j].CreatedAt)
+	})
+	return conversations, nil
+}
+
+func (s memoryConversations) Get(ctx context.Context, id, userID string) (*models.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conversation, ok := s.conversations[id]
+	if !ok || conversation.UserID != userID {
+		return nil, ErrNotFound
+	}
+	return &conversation, nil
+}
+
+func (s memoryConversations) GetWithMessages(ctx context.Context, id, userID string) (*models.Conversation, error) {
+	conversation, err := s.Get(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conversation.Messages = append([]models.Message(nil), s.messages[id]...)
+	return conversation, nil
+}
+
+func (s memoryConversations) FindImported(ctx context.Context, userID, importKey string) (*models.Conversation, error) {
+	s.mu.Lock()
+	var id string
+	for _, conversation := range s.conversations {
+		if importKey != "" && conversation.UserID == userID && conversation.ImportKey == importKey {
+			id = conversation.ID
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if id == "" {
+		return nil, ErrNotFound
+	}
+	return s.GetWithMessages(ctx, id, userID)
+}
+
+func (s memoryConversations) Create(ctx context.Context, conversation *models.Conversation, messages ...*models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if conversation.ID == "" {
+		conversation.ID = uuid.New().String()
+	}
+	now := time.Now()
+	if conversation.CreatedAt.IsZero() {
+		conversation.CreatedAt = now
+	}
+	if conversation.UpdatedAt.IsZero() {
+		conversation.UpdatedAt = now
+	}
+
+	stored := *conversation
+	stored.Messages = nil
+	s.conversations[conversation.ID] = stored
+
+	for _, message := range messages {
+		message.ConversationID = conversation.ID
+		s.addMessage(message)
+	}
+	return nil
+}
+
+func (s memoryConversations) Update(ctx context.Context, conversation *models.Conversation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.conversations[conversation.ID]; !ok {
+		return ErrNotFound
+	}
+	conversation.UpdatedAt = time.Now()
+	stored := *conversation
+	stored.Messages = nil
+	s.conversations[conversation.ID] = stored
+	return nil
+}
+
+func (s memoryConversations) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, document := range s.documents[id] {
+		delete(s.chunks, document.ID)
+	}
+	delete(s.documents, id)
+	delete(s.conversations, id)
+	delete(s.messages, id)
+	return nil
+}
+
+func (s memoryMessages) Create(ctx context.Context, message *models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addMessage(message)
+	return nil
+}
+
+func (s memoryMessages) Append(ctx context.Context, messages ...*models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, message := range messages {
+		s.addMessage(message)
+	}
+	return nil
+}
+
+func (s memoryMessages) Get(ctx context.Context, id, conversationID string) (*models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message := s.findMessage(id, conversationID)
+	if message == nil {
+		return nil, ErrNotFound
+	}
+	found := *message
+	return &found, nil
+}
+
+func (s memoryMessages) History(ctx context.Context, conversationID, includeID string) ([]models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var history []models.Message
+	for _, message := range s.messages[conversationID] {
+		if message.Status == models.MessageStatusComplete || message.ID == includeID {
+			history = append(history, message)
+		}
+	}
+	return history, nil
+}
+
+func (s memoryMessages) IsLatest(ctx context.Context, message *models.Message) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, other := range s.messages[message.ConversationID] {
+		if other.CreatedAt.After(message.CreatedAt) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (s memoryMessages) SetStatus(ctx context.Context, message *models.Message, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored := s.findMessage(message.ID, message.ConversationID); stored != nil {
+		stored.Status = status
+	}
+	message.Status = status
+	return nil
+}
+
+func (s memoryMessages) CompleteTurn(ctx context.Context, userMessage *models.Message, replies ...*models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, reply := range replies {
+		s.addMessage(reply)
+	}
+	if stored := s.findMessage(userMessage.ID, userMessage.ConversationID); stored != nil {
+		stored.Status = models.MessageStatusComplete
+	}
+	userMessage.Status = models.MessageStatusComplete
+	return nil
+}
+
+func (s memoryDocuments) ListByConversation(ctx context.Context, conversationID string) ([]models.Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]models.Document{}, s.documents[conversationID]...), nil
+}
+
+func (s memoryDocuments) Create(ctx context.Context, document *models.Document, chunks []models.DocumentChunk) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if document.ID == "" {
+		document.ID = uuid.New().String()
+	}
+	if document.CreatedAt.IsZero() {
+		document.CreatedAt = time.Now()
+	}
+	for i := range chunks {
+		if chunks[i].ID == "" {
+			chunks[i].ID = uuid.New().String()
+		}
+		chunks[i].DocumentID = document.ID
+		chunks[i].ConversationID = document.ConversationID
+		chunks[i].CreatedAt = document.CreatedAt
+	}
+
+	s.documents[document.ConversationID] = append(s.documents[document.ConversationID], *document)
+	s.chunks[document.ID] = append([]models.DocumentChunk(nil), chunks...)
+	return nil
+}
+
+func (s memoryDocuments) Delete(ctx context.Context, id, conversationID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := s.documents[conversationID]
+	for i := range list {
+		if list[i].ID == id {
+			s.documents[conversationID] = append(list[:i:i], list[i+1:]...)
+			delete(s.chunks, id)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s memoryDocuments) Search(ctx context.Context, conversationID string, embedding []float32, k int) ([]Match, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var chunks []models.DocumentChunk
+	for _, document := range s.documents[conversationID] {
+		chunks = append(chunks, s.chunks[document.ID]...)
+	}
+	return rank(chunks, embedding, k), nil
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"ai-chatbot-web/internal/models"
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned when a conversation or message does not exist or
+// belongs to another user.
+var ErrNotFound = errors.New("not found")
+
+// ConversationStore persists conversations. Implementations must be safe
+// for concurrent use.
+type ConversationStore interface {
+	// ListByUser returns the conversations owned by userID.
+	ListByUser(ctx context.Context, userID string) ([]models.Conversation, error)
+
+	// Get returns the conversation if it is owned by userID.
+	Get(ctx context.Context, id, userID string) (*models.Conversation, error)
+
+	// GetWithMessages is Get with the conversation's messages loaded.
+	GetWithMessages(ctx context.Context, id, userID string) (*models.Conversation, error)
+
+	// FindImported returns the conversation of userID imported under
+	// importKey, with its messages.
+	FindImported(ctx context.Context, userID, importKey string) (*models.Conversation, error)
+
+	// Create saves a conversation together with its initial messages,
+	// typically the system message, as a single unit.
+	Create(ctx context.Context, conversation *models.Conversation, messages ...*models.Message) error
+
+	// Update saves changes to a conversation's settings.
+	Update(ctx context.Context, conversation *models.Conversation) error
+
+	// Delete removes a conversation and all of its messages.
+	Delete(ctx context.Context, id string) error
+}
+
+// MessageStore persists the messages of a conversation. Implementations
+// must be safe for concurrent use.
+type MessageStore interface {
+	// Create saves a message.
+	Create(ctx context.Context, message *models.Message) error
+
+	// Append saves messages, in order, as a single unit.
+	Append(ctx context.Context, messages ...*models.Message) error
+
+	// Get returns a message of the given conversation.
+	Get(ctx context.Context, id, conversationID string) (*models.Message, error)
+
+	// History returns the complete messages of a conversation plus the
+	// message includeID, oldest first. It is the context sent to the model.
+	History(ctx context.Context, conversationID, includeID string) ([]models.Message, error)
+
+	// IsLatest reports whether no message in the conversation is newer
+	// than message.
+	IsLatest(ctx context.Context, message *models.Message) (bool, error)
+
+	// SetStatus updates the status of message.
+	SetStatus(ctx context.Context, message *models.Message, status string) error
+
+	// CompleteTurn saves the replies, in order, and marks userMessage
+	// complete as a single unit. A turn has several replies when the model
+	// called tools before answering.
+	CompleteTurn(ctx context.Context, userMessage *models.Message, replies ...*models.Message) error
+}
+
+// Pinger is implemented by stores backed by a connection that can fail.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// DocumentStore persists the documents uploaded to conversations and the
+// embedded chunks searched for context. Implementations must be safe for
+// concurrent use.
+type DocumentStore interface {
+	// ListByConversation returns the documents of a conversation, oldest
+	// first.
+	ListByConversation(ctx context.Context, conversationID string) ([]models.Document, error)
+
+	// Create saves a document together with its chunks as a single unit.
+	Create(ctx context.Context, document *models.Document, chunks []models.DocumentChunk) error
+
+	// Delete removes a document of the given conversation and its chunks.
+	Delete(ctx context.Context, id, conversationID string) error
+
+	// Search returns the k chunks of a conversation's documents whose
+	// embeddings are most similar to embedding, best first. Chunks
+	// embedded with a different number of dimensions are skipped.
+	Search(ctx context.Context, conversationID string, embedding []float32, k int) ([]Match, error)
+}
+
+// Match is a chunk found by DocumentStore.Search.
+type Match struct {
+	Chunk models.DocumentChunk
+	Score float64 // cosine similarity
+}
@@ -0,0 +1,41 @@
+package store
+
+import (
+	"ai-chatbot-web/internal/models"
+	"math"
+	"sort"
+)
+
+// cosine returns the cosine similarity of a and b, or 0 if either is all
+// zeros.
+func cosine(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// rank scores every chunk against embedding by brute force and returns the
+// best k. It backs Search wherever pgvector is not available.
+func rank(chunks []models.DocumentChunk, embedding []float32, k int) []Match {
+	matches := []Match{}
+	for _, chunk := range chunks {
+		if len(chunk.Embedding) != len(embedding) {
+			continue
+		}
+		matches = append(matches, Match{Chunk: chunk, Score: cosine(chunk.Embedding, embedding)})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches
+}
@@ -0,0 +1,203 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// RegisterBuiltins adds the tools that ship with the chatbot:
+// current_time and calculate.
+func RegisterBuiltins(r *Registry) error {
+	builtins := []Tool{
+		{
+			Name:        "current_time",
+			Description: "Get the current date and time, optionally in an IANA time zone such as Europe/Paris.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"timezone": {"type": "string", "description": "IANA time zone name, default UTC"}
+				}
+			}`),
+			Handler: currentTime,
+		},
+		{
+			Name:        "calculate",
+			Description: "Evaluate an arithmetic expression with + - * / and parentheses, e.g. (2 + 3) * 4.5.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"expression": {"type": "string", "description": "the expression to evaluate"}
+				},
+				"required": ["expression"]
+			}`),
+			Handler: calculate,
+		},
+	}
+
+	for _, tool := range builtins {
+		if err := r.Register(tool); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func currentTime(ctx context.Context, raw json.RawMessage) (string, error) {
+	var args struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+
+	location := time.UTC
+	if args.Timezone != "" {
+		loc, err := time.LoadLocation(args.Timezone)
+		if err != nil {
+			return "", fmt.Errorf("unknown time zone %q", args.Timezone)
+		}
+		location = loc
+	}
+	return time.Now().In(location).Format("Monday, 2 January 2006 15:04:05 MST"), nil
+}
+
+func calculate(ctx context.Context, raw json.RawMessage) (string, error) {
+	var args struct {
+		Expression string `json:"expression"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %v", err)
+	}
+	if strings.TrimSpace(args.Expression) == "" {
+		return "", fmt.Errorf("expression is required")
+	}
+
+	value, err := evaluate(args.Expression)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64), nil
+}
+
+// evaluate parses and evaluates an arithmetic expression by recursive
+// descent:
+//
+//	expr   = term { ("+" | "-") term }
+//	term   = factor { ("*" | "/") factor }
+//	factor = number | "(" expr ")" | "-" factor
+func evaluate(expression string) (float64, error) {
+	p := &parser{input: expression}
+	value, err := p.expr()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return 0, fmt.Errorf("unexpected %q at position %d", p.input[p.pos], p.pos+1)
+	}
+	return value, nil
+}
+
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space byte, or 0 at the end.
+func (p *parser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) expr() (float64, error) {
+	value, err := p.term()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return value, nil
+		}
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			value += right
+		} else {
+			value -= right
+		}
+	}
+}
+
+func (p *parser) term() (float64, error) {
+	value, err := p.factor()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return value, nil
+		}
+		p.pos++
+		right, err := p.factor()
+		if err != nil {
+			return 0, err
+		}
+		if op == '*' {
+			value *= right
+		} else {
+			if right == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			value /= right
+		}
+	}
+}
+
+func (p *parser) factor() (float64, error) {
+	switch c := p.peek(); {
+	case c == '(':
+		p.pos++
+		value, err := p.expr()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return value, nil
+	case c == '-':
+		p.pos++
+		value, err := p.factor()
+		return -value, err
+	case c == '.' || (c >= '0' && c <= '9'):
+		start := p.pos
+		for p.pos < len(p.input) && (p.input[p.pos] == '.' || (p.input[p.pos] >= '0' && p.input[p.pos] <= '9')) {
+			p.pos++
+		}
+		return strconv.ParseFloat(p.input[start:p.pos], 64)
+	case c == 0:
+		return 0, fmt.Errorf("unexpected end of expression")
+	default:
+		return 0, fmt.Errorf("unexpected %q at position %d", c, p.pos+1)
+	}
+}
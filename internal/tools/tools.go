@@ -0,0 +1,190 @@
+// Package tools is a registry of functions the model may call through
+// Ollama's tool support. A tool has a name, a JSON schema for its
+// arguments and a handler; the registry produces the definitions sent in
+// the "tools" field of /api/chat and runs the calls the model returns.
+//
+// It only depends on the standard library so both the server and the CLI
+// can register tools into it:
+//
+//	registry := tools.NewRegistry()
+//	tools.RegisterBuiltins(registry)
+//	request.Tools = registry.Definitions(enabled...)
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MaxRounds bounds how many times the model may call tools before it has
+// to answer.
+const MaxRounds = 5
+
+// CallTimeout bounds a single tool call.
+const CallTimeout = 10 * time.Second
+
+// Handler runs a tool. args is the JSON object of arguments given by the
+// model; the returned text is sent back to it as the tool result.
+type Handler func(ctx context.Context, args json.RawMessage) (string, error)
+
+// Tool is a function the model can call.
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is the JSON schema of the arguments object.
+	Parameters json.RawMessage
+	Handler    Handler
+}
+
+// Definition is a tool as described to the model in a chat request.
+type Definition struct {
+	Type     string             `json:"type"`
+	Function FunctionDefinition `json:"function"`
+}
+
+type FunctionDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+// Call is a tool call returned by the model, in Ollama's format.
+type Call struct {
+	Function FunctionCall `json:"function"`
+}
+
+type FunctionCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Registry holds the tools available to conversations. It is safe for
+// concurrent use.
+type Registry struct {
+	mu    sync.RWMutex
+	tools map[string]Tool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		tools: make(map[string]Tool),
+	}
+}
+
+// Register adds a tool. Names must be unique and the parameters must be a
+// JSON schema object.
+func (r *Registry) Register(tool Tool) error {
+	if !validName.MatchString(tool.Name) {
+		return fmt.Errorf("invalid tool name %q", tool.Name)
+	}
+	if tool.Handler == nil {
+		return fmt.Errorf("tool %s has no handler", tool.Name)
+	}
+	if len(tool.Parameters) == 0 {
+		tool.Parameters = json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(tool.Parameters, &schema); err != nil {
+		return fmt.Errorf("tool %s: parameters must be a JSON schema object: %v", tool.Name, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.tools[tool.Name]; exists {
+		return fmt.Errorf("tool %s is already registered", tool.Name)
+	}
+	r.tools[tool.Name] = tool
+	return nil
+}
+
+// Has reports whether a tool is registered.
+func (r *Registry) Has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.tools[name]
+	return ok
+}
+
+// Names returns the registered tool names, sorted.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Definitions describes the named tools for a chat request, or every tool
+// if no names are given. Unknown names are skipped.
+func (r *Registry) Definitions(names ...string) []Definition {
+	if len(names) == 0 {
+		names = r.Names()
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var definitions []Definition
+	for _, name := range names {
+		tool, ok := r.tools[name]
+		if !ok {
+			continue
+		}
+		definitions = append(definitions, Definition{
+			Type: "function",
+			Function: FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return definitions
+}
+
+// Run executes a tool call and returns the text to send back to the
+// model. Failures, including calls to unknown tools, are reported to the
+// model in that text so it can recover; the error is returned as well for
+// logging.
+func (r *Registry) Run(ctx context.Context, call Call) (string, error) {
+	r.mu.RLock()
+	tool, ok := r.tools[call.Function.Name]
+	r.mu.RUnlock()
+	if !ok {
+		err := fmt.Errorf("unknown tool %q", call.Function.Name)
+		return "error: " + err.Error(), err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, CallTimeout)
+	defer cancel()
+
+	result, err := tool.Handler(ctx, arguments(call.Function.Arguments))
+	if err != nil {
+		return "error: " + err.Error(), err
+	}
+	return result, nil
+}
+
+// arguments normalises the arguments of a call to a JSON object. Ollama
+// sends an object; some models put a JSON encoded string there instead.
+func arguments(raw json.RawMessage) json.RawMessage {
+	var encoded string
+	if err := json.Unmarshal(raw, &encoded); err == nil {
+		raw = json.RawMessage(encoded)
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return json.RawMessage(`{}`)
+	}
+	return raw
+}
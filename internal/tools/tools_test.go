@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	if err := RegisterBuiltins(r); err != nil {
+		t.Fatalf("RegisterBuiltins: %v", err)
+	}
+
+	echo := Tool{
+		Name:    "echo",
+		Handler: func(ctx context.Context, args json.RawMessage) (string, error) { return string(args), nil },
+	}
+	if err := r.Register(echo); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := r.Register(echo); err == nil {
+		t.Error("duplicate name accepted")
+	}
+	if err := r.Register(Tool{Name: "bad name", Handler: echo.Handler}); err == nil {
+		t.Error("invalid name accepted")
+	}
+	if err := r.Register(Tool{Name: "broken", Parameters: json.RawMessage(`[`), Handler: echo.Handler}); err == nil {
+		t.Error("invalid schema accepted")
+	}
+
+	if got := strings.Join(r.Names(), ","); got != "calculate,current_time,echo" {
+		t.Errorf("Names = %s", got)
+	}
+
+	defs := r.Definitions("echo", "missing")
+	if len(defs) != 1 || defs[0].Type != "function" || defs[0].Function.Name != "echo" {
+		t.Fatalf("Definitions = %+v", defs)
+	}
+	if !json.Valid(defs[0].Function.Parameters) {
+		t.Error("default parameters schema is not valid JSON")
+	}
+}
+
+func TestRun(t *testing.T) {
+	r := NewRegistry()
+	RegisterBuiltins(r)
+	r.Register(Tool{
+		Name:    "fail",
+		Handler: func(ctx context.Context, args json.RawMessage) (string, error) { return "", errors.New("boom") },
+	})
+
+	call := func(name, args string) string {
+		result, _ := r.Run(context.Background(), Call{Function: FunctionCall{Name: name, Arguments: json.RawMessage(args)}})
+		return result
+	}
+
+	tests := []struct {
+		name, args, want string
+	}{
+		{"calculate", `{"expression": "(2 + 3) * 4.5"}`, "22.5"},
+		{"calculate", `"{\"expression\": \"-2 * -3 / 4\"}"`, "1.5"},
+		{"calculate", `{"expression": "1 / 0"}`, "error: division by zero"},
+		{"calculate", `{"expression": "2 +"}`, "error: unexpected end of expression"},
+		{"calculate", `{}`, "error: expression is required"},
+		{"fail", `null`, "error: boom"},
+		{"nope", `{}`, `error: unknown tool "nope"`},
+	}
+	for _, tt := range tests {
+		if got := call(tt.name, tt.args); got != tt.want {
+			t.Errorf("%s(%s) = %q, want %q", tt.name, tt.args, got, tt.want)
+		}
+	}
+
+	if got := call("current_time", `{"timezone": "Asia/Tokyo"}`); !strings.HasSuffix(got, "JST") {
+		t.Errorf("current_time = %q", got)
+	}
+}
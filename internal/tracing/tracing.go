@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "ai-chatbot-web"
+	defaultServiceName  = "ai-chatbot-web"
+)
+
+// Setup installs a global tracer provider. Spans are exported via OTLP/HTTP
+// when OTEL_EXPORTER_OTLP_ENDPOINT (or the traces-specific variant) is set
+// and written to stdout otherwise. OTEL_TRACES_EXPORTER may force "otlp",
+// "stdout" or "none". The returned func flushes and stops the exporter.
+func Setup(ctx context.Context) (func(context.Context) error, error) {
+	exporter, err := newExporter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+func newExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	kind := os.Getenv("OTEL_TRACES_EXPORTER")
+	if kind == "" {
+		kind = "stdout"
+		if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+			kind = "otlp"
+		}
+	}
+
+	switch kind {
+	case "otlp":
+		// Endpoint, headers and TLS settings come from the standard
+		// OTEL_EXPORTER_OTLP_* variables.
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %v", err)
+		}
+		return exporter, nil
+	case "stdout":
+		exporter, err := stdouttrace.New()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout exporter: %v", err)
+		}
+		return exporter, nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported OTEL_TRACES_EXPORTER: %s", kind)
+	}
+}
+
+// Tracer returns the tracer used for all application spans.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
@@ -0,0 +1,140 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func newTestExporter(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previous)
+	})
+	return exporter
+}
+
+func attr(span tracetest.SpanStub, key string) (attribute.Value, bool) {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestMiddlewareRecordsRouteSpan(t *testing.T) {
+	exporter := newTestExporter(t)
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/items/:id", func(c *gin.Context) {
+		c.Status(http.StatusTeapot)
+	})
+
+	parentTraceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/items/42", nil)
+	req.Header.Set("traceparent", "00-"+parentTraceID+"-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+
+	if span.Name != "GET /items/:id" {
+		t.Errorf("span name = %q", span.Name)
+	}
+	if got := span.SpanContext.TraceID().String(); got != parentTraceID {
+		t.Errorf("trace ID = %s, want propagated %s", got, parentTraceID)
+	}
+	if v, ok := attr(span, "http.route"); !ok || v.AsString() != "/items/:id" {
+		t.Errorf("http.route = %v", v)
+	}
+	if v, ok := attr(span, "http.response.status_code"); !ok || v.AsInt64() != http.StatusTeapot {
+		t.Errorf("http.response.status_code = %v", v)
+	}
+}
+
+func TestGormPluginRecordsQuerySpans(t *testing.T) {
+	exporter := newTestExporter(t)
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: gormlogger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.Use(&GormPlugin{System: "sqlite"}); err != nil {
+		t.Fatalf("register plugin: %v", err)
+	}
+
+	type note struct {
+		ID   uint
+		Body string
+	}
+	if err := db.AutoMigrate(&note{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	exporter.Reset()
+
+	ctx, parent := Tracer().Start(context.Background(), "parent")
+	tx := db.WithContext(ctx)
+	if err := tx.Create(&note{Body: "secret body"}).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	var notes []note
+	if err := tx.Find(&notes).Error; err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	parent.End()
+
+	operations := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "parent" {
+			continue
+		}
+		if span.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("span %s is not a child of the request span", span.Name)
+		}
+		operations[span.Name] = span
+	}
+
+	for _, name := range []string{"gorm.create", "gorm.query"} {
+		span, ok := operations[name]
+		if !ok {
+			t.Fatalf("missing %s span, got %v", name, operations)
+		}
+		statement, _ := attr(span, "db.statement")
+		if statement.AsString() == "" {
+			t.Errorf("%s has no db.statement", name)
+		}
+		if strings.Contains(statement.AsString(), "secret body") {
+			t.Errorf("%s statement leaks bound values: %s", name, statement.AsString())
+		}
+		if v, _ := attr(span, "db.system"); v.AsString() != "sqlite" {
+			t.Errorf("%s db.system = %q", name, v.AsString())
+		}
+	}
+}
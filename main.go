@@ -1,14 +1,31 @@
 package main
 
 import (
-	"ai-chatbot/ai"
+	"ai-chatbot-web/ai"
+	"flag"
+	"fmt"
+	"os"
 )
 
 func main() {
+	server := flag.String("server", os.Getenv("TACONITE_SERVER"), "chat server URL; keep conversations there instead of talking to Ollama")
+	apiKey := flag.String("api-key", os.Getenv("TACONITE_API_KEY"), "API key for --server")
+	flag.Parse()
+
     // Create conversation with small token limit to demonstrate trimming
     systemPrompt := "You are a helpful assistant. Your name is Taconite. Be informative but concise and friendly."
 	model := "llama3.1:8b"
 
-	chatbot := ai.NewInteractiveChatBot(model, systemPrompt)
+	chatbot, err := ai.NewInteractiveChatBot(model, systemPrompt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(1)
+	}
+	if *server != "" {
+		if err := chatbot.UseServer(*server, *apiKey); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+	}
 	chatbot.Run()
 }